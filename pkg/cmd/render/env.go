@@ -104,7 +104,10 @@ func getTLSCipherSuites(_ *envVarData) (map[string]string, error) {
 		return nil, fmt.Errorf("no valid TLS ciphers found")
 	}
 	// Remove invalid ciphers.
-	cipherSuites = tlshelpers.SupportedEtcdCiphers(cipherSuites)
+	cipherSuites, err := tlshelpers.SupportedEtcdCiphers(cipherSuites)
+	if err != nil {
+		return nil, err
+	}
 	return map[string]string{
 		"ETCD_CIPHER_SUITES": strings.Join(cipherSuites, ","),
 	}, nil
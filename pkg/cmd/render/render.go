@@ -1,6 +1,7 @@
 package render
 
 import (
+	"context"
 	"encoding/base64"
 	"encoding/json"
 	"errors"
@@ -347,7 +348,7 @@ func (r *renderOpts) Run() error {
 	// Write the serving and peer certs for the bootstrap etcd member
 	caCertData := templateData.EtcdSignerCert
 	caKeyData := templateData.EtcdSignerKey
-	serverCertData, serverKeyData, err := tlshelpers.CreateServerCertKey(caCertData, caKeyData, []string{templateData.BootstrapIP})
+	serverCertData, serverKeyData, err := tlshelpers.CreateServerCertKeyWithContext(context.TODO(), caCertData, caKeyData, templateData.Hostname, []string{templateData.BootstrapIP})
 	if err != nil {
 		return err
 	}
@@ -355,7 +356,7 @@ func (r *renderOpts) Run() error {
 	if err != nil {
 		return err
 	}
-	peerCertData, peerKeyData, err := tlshelpers.CreatePeerCertKey(caCertData, caKeyData, []string{templateData.BootstrapIP})
+	peerCertData, peerKeyData, err := tlshelpers.CreatePeerCertKeyWithContext(context.TODO(), caCertData, caKeyData, templateData.Hostname, []string{templateData.BootstrapIP})
 	if err != nil {
 		return err
 	}
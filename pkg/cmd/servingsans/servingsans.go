@@ -0,0 +1,117 @@
+package servingsans
+
+import (
+	"context"
+	"errors"
+	goflag "flag"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/ghodss/yaml"
+	"github.com/spf13/cobra"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/clientcmd"
+	"k8s.io/klog/v2"
+
+	"github.com/openshift/cluster-etcd-operator/pkg/tlshelpers"
+)
+
+type servingSANsOpts struct {
+	nodeFile   string
+	nodeName   string
+	kubeConfig string
+}
+
+// NewServingSANsCommand prints the SANs the operator places onto the serving cert of a node, without issuing a cert.
+// The output can be diffed against the SANs of the live etcd-serving-<node> secret.
+func NewServingSANsCommand(ctx context.Context, out io.Writer) *cobra.Command {
+	opts := servingSANsOpts{}
+	cmd := &cobra.Command{
+		Use:   "serving-sans",
+		Short: "Prints the SANs the operator places onto the etcd serving cert of a node",
+		Run: func(cmd *cobra.Command, args []string) {
+			defer klog.Flush()
+
+			if err := opts.Validate(); err != nil {
+				klog.Fatal(err)
+			}
+			if err := opts.Run(ctx, out); err != nil {
+				klog.Fatal(err)
+			}
+		},
+	}
+
+	opts.AddFlags(cmd)
+	return cmd
+}
+
+func (r *servingSANsOpts) AddFlags(cmd *cobra.Command) {
+	flagSet := cmd.Flags()
+	flagSet.StringVar(&r.nodeFile, "node-file", "", "YAML or JSON file containing the Node object")
+	flagSet.StringVar(&r.nodeName, "node-name", "", "name of the Node to read from the cluster, mutually exclusive with --node-file")
+	flagSet.StringVar(&r.kubeConfig, "kubeconfig", "", "Optional kubeconfig specifies the kubeConfig for when the cmd is running outside of a cluster")
+
+	// adding klog flags to tune verbosity better
+	gfs := goflag.NewFlagSet("", goflag.ExitOnError)
+	klog.InitFlags(gfs)
+	cmd.Flags().AddGoFlagSet(gfs)
+}
+
+func (r *servingSANsOpts) Validate() error {
+	if len(r.nodeFile) == 0 && len(r.nodeName) == 0 {
+		return errors.New("one of --node-file or --node-name must be set")
+	}
+	if len(r.nodeFile) > 0 && len(r.nodeName) > 0 {
+		return errors.New("--node-file and --node-name are mutually exclusive")
+	}
+	return nil
+}
+
+func (r *servingSANsOpts) Run(ctx context.Context, out io.Writer) error {
+	node, err := r.readNode(ctx)
+	if err != nil {
+		return err
+	}
+
+	hostNames, err := tlshelpers.ServerHostNamesForNode(node)
+	if err != nil {
+		return err
+	}
+	for _, hostName := range hostNames {
+		if _, err := fmt.Fprintln(out, hostName); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (r *servingSANsOpts) readNode(ctx context.Context) (*corev1.Node, error) {
+	if len(r.nodeFile) > 0 {
+		content, err := os.ReadFile(r.nodeFile)
+		if err != nil {
+			return nil, fmt.Errorf("error reading node file: %w", err)
+		}
+		node := &corev1.Node{}
+		if err := yaml.Unmarshal(content, node); err != nil {
+			return nil, fmt.Errorf("error parsing node file %s: %w", r.nodeFile, err)
+		}
+		return node, nil
+	}
+
+	kubeConfig, err := clientcmd.BuildConfigFromFlags("", r.kubeConfig)
+	if err != nil {
+		return nil, fmt.Errorf("error loading kubeconfig: %w", err)
+	}
+	kubeClient, err := kubernetes.NewForConfig(kubeConfig)
+	if err != nil {
+		return nil, err
+	}
+	node, err := kubeClient.CoreV1().Nodes().Get(ctx, r.nodeName, metav1.GetOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("error getting node %s: %w", r.nodeName, err)
+	}
+	return node, nil
+}
@@ -0,0 +1,54 @@
+package servingsans
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+const nodeWithMultipleAddresses = `apiVersion: v1
+kind: Node
+metadata:
+  name: master-0
+status:
+  addresses:
+  - type: Hostname
+    address: master-0
+  - type: InternalIP
+    address: 10.0.0.1
+  - type: ExternalIP
+    address: 203.0.113.10
+  - type: InternalIP
+    address: fd00::1
+`
+
+func TestServingSANs(t *testing.T) {
+	nodeFile := filepath.Join(t.TempDir(), "node.yaml")
+	require.NoError(t, os.WriteFile(nodeFile, []byte(nodeWithMultipleAddresses), 0600))
+
+	opts := servingSANsOpts{nodeFile: nodeFile}
+	require.NoError(t, opts.Validate())
+	out := &bytes.Buffer{}
+	require.NoError(t, opts.Run(context.TODO(), out))
+
+	require.Equal(t, `localhost
+etcd.kube-system.svc
+etcd.kube-system.svc.cluster.local
+etcd.openshift-etcd.svc
+etcd.openshift-etcd.svc.cluster.local
+127.0.0.1
+::1
+10.0.0.1
+fd00::1
+`, out.String())
+}
+
+func TestServingSANsValidation(t *testing.T) {
+	require.Error(t, (&servingSANsOpts{}).Validate())
+	require.Error(t, (&servingSANsOpts{nodeFile: "node.yaml", nodeName: "master-0"}).Validate())
+	require.NoError(t, (&servingSANsOpts{nodeName: "master-0"}).Validate())
+}
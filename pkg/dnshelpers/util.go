@@ -1,9 +1,11 @@
 package dnshelpers
 
 import (
+	"errors"
 	"fmt"
 	"net"
 	"net/url"
+	"strings"
 
 	configv1 "github.com/openshift/api/config/v1"
 	corev1 "k8s.io/api/core/v1"
@@ -106,17 +108,77 @@ func IsIPv4(ipString string) (bool, error) {
 	}
 }
 
+// NodeMissingInternalIPError is returned when a node does not report any InternalIP address. This is transient while
+// the node is bootstrapping, callers should retry later rather than treating it as a failure.
+type NodeMissingInternalIPError struct {
+	NodeName string
+}
+
+func (e *NodeMissingInternalIPError) Error() string {
+	return fmt.Sprintf("node/%s missing %s", e.NodeName, corev1.NodeInternalIP)
+}
+
+// NodeOnlyExternalIPError is returned when a node does not report any InternalIP but ExternalIP addresses, as some
+// bare-metal provisioners do. Unlike a missing InternalIP this does not resolve itself, the node addresses have to be
+// fixed or the ExternalIPs explicitly allowed, see GetIPAddressesForNodeNameWithExternalFallback.
+type NodeOnlyExternalIPError struct {
+	NodeName    string
+	ExternalIPs []string
+}
+
+func (e *NodeOnlyExternalIPError) Error() string {
+	return fmt.Sprintf("node/%s missing %s, it only reports the %s addresses %s", e.NodeName, corev1.NodeInternalIP, corev1.NodeExternalIP, strings.Join(e.ExternalIPs, ","))
+}
+
+// GetInternalIPAddressesForNodeName returns the InternalIP addresses of the node. It returns a
+// *NodeOnlyExternalIPError if the node has none but ExternalIP addresses, a *NodeMissingInternalIPError if it has
+// neither and an error if any of them is not a valid IP.
 func GetInternalIPAddressesForNodeName(node *corev1.Node) ([]string, error) {
+	addresses, err := getIPAddressesForNode(node, corev1.NodeInternalIP)
+	if err != nil {
+		return nil, err
+	}
+	if len(addresses) > 0 {
+		return addresses, nil
+	}
+
+	externalAddresses, err := getIPAddressesForNode(node, corev1.NodeExternalIP)
+	if err != nil {
+		return nil, err
+	}
+	if len(externalAddresses) > 0 {
+		return nil, &NodeOnlyExternalIPError{NodeName: node.Name, ExternalIPs: externalAddresses}
+	}
+	return nil, &NodeMissingInternalIPError{NodeName: node.Name}
+}
+
+// GetIPAddressesForNodeNameWithExternalFallback is GetInternalIPAddressesForNodeName, but returns the ExternalIP
+// addresses of a node that has no InternalIP. A node with InternalIPs never falls back.
+// Only use it when explicitly requested: certs issued on ExternalIPs are valid for addresses that are usually reachable
+// from outside the cluster network, so they widen where etcd can be impersonated and accepted from, and an ExternalIP
+// can be reassigned to another machine by the provider.
+func GetIPAddressesForNodeNameWithExternalFallback(node *corev1.Node) ([]string, error) {
+	addresses, err := GetInternalIPAddressesForNodeName(node)
+	var externalOnlyErr *NodeOnlyExternalIPError
+	if errors.As(err, &externalOnlyErr) {
+		klog.Warningf("node/%s has no %s, falling back to its %s addresses %s", node.Name, corev1.NodeInternalIP, corev1.NodeExternalIP, strings.Join(externalOnlyErr.ExternalIPs, ","))
+		return externalOnlyErr.ExternalIPs, nil
+	}
+	return addresses, err
+}
+
+// getIPAddressesForNode returns the addresses of the given type of the node and an error if any of them is not a
+// valid IP.
+func getIPAddressesForNode(node *corev1.Node, addressType corev1.NodeAddressType) ([]string, error) {
 	addresses := []string{}
 	for _, currAddress := range node.Status.Addresses {
-		if currAddress.Type == corev1.NodeInternalIP {
+		if currAddress.Type == addressType {
+			if net.ParseIP(currAddress.Address) == nil {
+				return nil, fmt.Errorf("node/%s has malformed %s %q", node.Name, addressType, currAddress.Address)
+			}
 			addresses = append(addresses, currAddress.Address)
 		}
 	}
-	if len(addresses) == 0 {
-		return nil, fmt.Errorf("node/%s missing %s", node.Name, corev1.NodeInternalIP)
-	}
-
 	return addresses, nil
 }
 
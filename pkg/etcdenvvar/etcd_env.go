@@ -269,7 +269,10 @@ func getCipherSuites(envVarContext envVarContext) (map[string]string, error) {
 		return nil, fmt.Errorf("couldn't get cipherSuites from observedConfig: %w", err)
 	}
 
-	actualCipherSuites := tlshelpers.SupportedEtcdCiphers(observedCipherSuites)
+	actualCipherSuites, err := tlshelpers.SupportedEtcdCiphers(observedCipherSuites)
+	if err != nil {
+		return nil, fmt.Errorf("invalid cipherSuites in observedConfig: %w", err)
+	}
 
 	if len(actualCipherSuites) == 0 {
 		return nil, fmt.Errorf("no supported cipherSuites not found in observedConfig")
@@ -3,6 +3,7 @@ package ceohelpers
 import (
 	"bytes"
 	"encoding/json"
+	"fmt"
 	"strconv"
 
 	operatorv1 "github.com/openshift/api/operator/v1"
@@ -15,6 +16,20 @@ import (
 // useUnsupportedUnsafeNonHANonProductionUnstableEtcd key is set
 // to any parsable value
 func isUnsupportedUnsafeEtcd(spec *operatorv1.StaticPodOperatorSpec) (bool, error) {
+	// 1. this violates operational best practices for etcd - unstable
+	// 2. this allows non-HA configurations which we cannot support in
+	//    production - unsafe and non-HA
+	// 3. this allows a situation where we can get stuck unable to re-achieve
+	//    quorum, resulting in cluster-death - unsafe, non-HA, non-production,
+	//    unstable
+	// 4. the combination of all these things makes the situation
+	//    unsupportable.
+	return ReadUnsupportedBoolOverride(&spec.OperatorSpec, "useUnsupportedUnsafeNonHANonProductionUnstableEtcd")
+}
+
+// ReadUnsupportedBoolOverride returns the boolean value of the given top-level key in the
+// unsupportedConfigOverrides. It returns false if the key is not set.
+func ReadUnsupportedBoolOverride(spec *operatorv1.OperatorSpec, key string) (bool, error) {
 	unsupportedConfig := map[string]interface{}{}
 	if spec.UnsupportedConfigOverrides.Raw == nil {
 		return false, nil
@@ -32,15 +47,7 @@ func isUnsupportedUnsafeEtcd(spec *operatorv1.StaticPodOperatorSpec) (bool, erro
 		return false, err
 	}
 
-	// 1. this violates operational best practices for etcd - unstable
-	// 2. this allows non-HA configurations which we cannot support in
-	//    production - unsafe and non-HA
-	// 3. this allows a situation where we can get stuck unable to re-achieve
-	//    quorum, resulting in cluster-death - unsafe, non-HA, non-production,
-	//    unstable
-	// 4. the combination of all these things makes the situation
-	//    unsupportable.
-	value, found, err := unstructured.NestedFieldNoCopy(unsupportedConfig, "useUnsupportedUnsafeNonHANonProductionUnstableEtcd")
+	value, found, err := unstructured.NestedFieldNoCopy(unsupportedConfig, key)
 	if err != nil {
 		return false, err
 	}
@@ -56,3 +63,34 @@ func isUnsupportedUnsafeEtcd(spec *operatorv1.StaticPodOperatorSpec) (bool, erro
 		return false, nil
 	}
 }
+
+// ReadUnsupportedOverride decodes the value of the given top-level key in the unsupportedConfigOverrides into the
+// given value, unknown fields are rejected. It returns false if the key is not set.
+func ReadUnsupportedOverride(spec *operatorv1.OperatorSpec, key string, into interface{}) (bool, error) {
+	if spec.UnsupportedConfigOverrides.Raw == nil {
+		return false, nil
+	}
+
+	configJson, err := kyaml.ToJSON(spec.UnsupportedConfigOverrides.Raw)
+	if err != nil {
+		klog.Warning(err)
+		// maybe it's just json
+		configJson = spec.UnsupportedConfigOverrides.Raw
+	}
+
+	unsupportedConfig := map[string]json.RawMessage{}
+	if err := json.Unmarshal(configJson, &unsupportedConfig); err != nil {
+		klog.V(4).Infof("decode of unsupported config failed with error: %v", err)
+		return false, err
+	}
+	value, found := unsupportedConfig[key]
+	if !found {
+		return false, nil
+	}
+	decoder := json.NewDecoder(bytes.NewReader(value))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(into); err != nil {
+		return false, fmt.Errorf("failed to decode %s: %w", key, err)
+	}
+	return true, nil
+}
@@ -0,0 +1,40 @@
+package etcdcertsigner
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/openshift/cluster-etcd-operator/pkg/operator/ceohelpers"
+	"github.com/openshift/cluster-etcd-operator/pkg/tlshelpers"
+)
+
+// protectCertSecretsFromDeletionOverride is the unsupportedConfigOverrides key that enables the finalizer based
+// deletion protection of the managed cert secrets.
+const protectCertSecretsFromDeletionOverride = "protectEtcdCertSecretsFromDeletion"
+
+// reconcileDeletionProtection adds the deletion protection finalizer to all managed cert secrets of the given nodes
+// when protectEtcdCertSecretsFromDeletion is set, and removes it again otherwise so that disabling the protection does
+// not leave undeletable secrets behind. The secrets of nodes that are no longer members are never protected.
+func (c *EtcdCertSignerController) reconcileDeletionProtection(ctx context.Context, nodeNames []string) error {
+	operatorSpec, _, _, err := c.operatorClient.GetStaticPodOperatorState()
+	if err != nil {
+		return err
+	}
+	protect, err := ceohelpers.ReadUnsupportedBoolOverride(&operatorSpec.OperatorSpec, protectCertSecretsFromDeletionOverride)
+	if err != nil {
+		return fmt.Errorf("failed to read %s from unsupportedConfigOverrides: %w", protectCertSecretsFromDeletionOverride, err)
+	}
+	return tlshelpers.SetDeletionProtectionForManagedSecrets(ctx, c.secretLister, c.secretClient, nodeNames, protect)
+}
+
+// releaseSignerDeletionProtection removes the deletion protection finalizer from the etcd and etcd metrics signers
+// that are about to be rotated, reconcileDeletionProtection adds it back once they are.
+func (c *EtcdCertSignerController) releaseSignerDeletionProtection(ctx context.Context) error {
+	for _, secretName := range []string{tlshelpers.EtcdSignerCertSecretName, tlshelpers.EtcdMetricsSignerCertSecretName} {
+		if err := tlshelpers.ReleaseSignerDeletionProtectionForRotation(ctx, c.secretLister, c.secretClient, secretName, time.Now()); err != nil {
+			return fmt.Errorf("error releasing the deletion protection of %s for its rotation: %w", secretName, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,76 @@
+package etcdcertsigner
+
+import (
+	"context"
+	"testing"
+
+	operatorv1 "github.com/openshift/api/operator/v1"
+	"github.com/openshift/library-go/pkg/operator/v1helpers"
+	"github.com/stretchr/testify/require"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+	corev1listers "k8s.io/client-go/listers/core/v1"
+	"k8s.io/client-go/tools/cache"
+
+	"github.com/openshift/cluster-etcd-operator/pkg/operator/operatorclient"
+	u "github.com/openshift/cluster-etcd-operator/pkg/testutils"
+	"github.com/openshift/cluster-etcd-operator/pkg/tlshelpers"
+)
+
+func TestReconcileDeletionProtection(t *testing.T) {
+	tests := map[string]struct {
+		overrides          []byte
+		expectedFinalizers []string
+	}{
+		"default off": {},
+		"enabled": {
+			overrides:          []byte(`{"protectEtcdCertSecretsFromDeletion": true}`),
+			expectedFinalizers: []string{tlshelpers.DeletionProtectionFinalizer},
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			removedNode := u.FakeSecret(operatorclient.TargetNamespace, tlshelpers.GetServingSecretNameForNode("master-9"), map[string][]byte{})
+			removedNode.Finalizers = []string{tlshelpers.DeletionProtectionFinalizer}
+			secrets := []runtime.Object{
+				u.FakeSecret(operatorclient.TargetNamespace, tlshelpers.EtcdClientCertSecretName, map[string][]byte{}),
+				u.FakeSecret(operatorclient.TargetNamespace, tlshelpers.GetServingSecretNameForNode("master-0"), map[string][]byte{}),
+				removedNode,
+			}
+			fakeKubeClient := fake.NewSimpleClientset(secrets...)
+			indexer := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{})
+			for _, secret := range secrets {
+				require.NoError(t, indexer.Add(secret))
+			}
+			fakeOperatorClient := v1helpers.NewFakeStaticPodOperatorClient(
+				&operatorv1.StaticPodOperatorSpec{
+					OperatorSpec: operatorv1.OperatorSpec{
+						ManagementState:            operatorv1.Managed,
+						UnsupportedConfigOverrides: runtime.RawExtension{Raw: test.overrides},
+					},
+				},
+				u.StaticPodOperatorStatus(),
+				nil,
+				nil,
+			)
+			c := &EtcdCertSignerController{
+				operatorClient: fakeOperatorClient,
+				secretClient:   fakeKubeClient.CoreV1(),
+				secretLister:   corev1listers.NewSecretLister(indexer),
+			}
+
+			require.NoError(t, c.reconcileDeletionProtection(context.TODO(), []string{"master-0"}))
+			for _, name := range []string{tlshelpers.EtcdClientCertSecretName, tlshelpers.GetServingSecretNameForNode("master-0")} {
+				secret, err := fakeKubeClient.CoreV1().Secrets(operatorclient.TargetNamespace).Get(context.TODO(), name, metav1.GetOptions{})
+				require.NoError(t, err)
+				require.Equal(t, test.expectedFinalizers, secret.Finalizers)
+			}
+			// the secrets of nodes that are no longer members are released either way
+			secret, err := fakeKubeClient.CoreV1().Secrets(operatorclient.TargetNamespace).Get(context.TODO(), removedNode.Name, metav1.GetOptions{})
+			require.NoError(t, err)
+			require.Empty(t, secret.Finalizers)
+		})
+	}
+}
@@ -2,10 +2,12 @@ package etcdcertsigner
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	corev1informers "k8s.io/client-go/informers/core/v1"
 	corev1client "k8s.io/client-go/kubernetes/typed/core/v1"
 	corev1listers "k8s.io/client-go/listers/core/v1"
+	"sort"
 	"strings"
 	"time"
 
@@ -13,6 +15,7 @@ import (
 	operatorv1 "github.com/openshift/api/operator/v1"
 	"github.com/openshift/cluster-etcd-operator/pkg/operator/health"
 	"github.com/openshift/library-go/pkg/controller/factory"
+	"github.com/openshift/library-go/pkg/crypto"
 	"github.com/openshift/library-go/pkg/operator/certrotation"
 	"github.com/openshift/library-go/pkg/operator/events"
 	"github.com/openshift/library-go/pkg/operator/resource/resourceapply"
@@ -22,7 +25,9 @@ import (
 	"k8s.io/apimachinery/pkg/labels"
 	utilerrors "k8s.io/apimachinery/pkg/util/errors"
 	"k8s.io/client-go/kubernetes"
+	"k8s.io/klog/v2"
 
+	"github.com/openshift/cluster-etcd-operator/pkg/dnshelpers"
 	"github.com/openshift/cluster-etcd-operator/pkg/operator/ceohelpers"
 	"github.com/openshift/cluster-etcd-operator/pkg/operator/operatorclient"
 	"github.com/openshift/cluster-etcd-operator/pkg/tlshelpers"
@@ -30,12 +35,12 @@ import (
 
 type certConfig struct {
 	// configmap name: "etcd-ca-bundle"
-	signerCaBundle certrotation.CABundleConfigMap
+	signerCaBundle tlshelpers.MinTrustedCABundleConfigMap
 	// secret name: "etcd-signer"
 	signerCert certrotation.RotatedSigningCASecret
 
 	// configmap name: "etcd-metric-ca-bundle"
-	metricsSignerCaBundle certrotation.CABundleConfigMap
+	metricsSignerCaBundle tlshelpers.MinTrustedCABundleConfigMap
 	// secret name: "etcd-metric-signer"
 	metricsSignerCert certrotation.RotatedSigningCASecret
 
@@ -65,12 +70,14 @@ type EtcdCertSignerController struct {
 	quorumChecker  ceohelpers.QuorumChecker
 
 	certConfig *certConfig
+	// certOpts are the options all certs are issued with, the node certs are re-created with them on every sync
+	certOpts []tlshelpers.CertOption
 }
 
 // NewEtcdCertSignerController watches master nodes and maintains secrets for each master node, placing them in a single secret (NOT a tls secret)
 // so that the revision controller only has to watch a single secret.  This isn't ideal because it's possible to have a
 // revision that is missing the content of a secret, but the actual static pod will fail if that happens and the later
-// revision will pick it up.
+// revision will pick it up. All certs are issued with the given options, see EtcdCertSignerOptions.
 func NewEtcdCertSignerController(
 	livenessChecker *health.MultiAlivenessChecker,
 	kubeClient kubernetes.Interface,
@@ -78,6 +85,7 @@ func NewEtcdCertSignerController(
 	kubeInformers v1helpers.KubeInformersForNamespaces,
 	eventRecorder events.Recorder,
 	quorumChecker ceohelpers.QuorumChecker,
+	certOpts ...tlshelpers.CertOption,
 ) factory.Controller {
 	eventRecorder = eventRecorder.WithComponentSuffix("etcd-cert-signer-controller")
 	cmInformer := kubeInformers.InformersFor(operatorclient.TargetNamespace).Core().V1().ConfigMaps()
@@ -88,6 +96,7 @@ func NewEtcdCertSignerController(
 		cmLister,
 		cmGetter,
 		eventRecorder,
+		certOpts...,
 	)
 
 	metricsSignerCaBundle := tlshelpers.CreateMetricsSignerCertRotationBundleConfigMap(
@@ -95,17 +104,18 @@ func NewEtcdCertSignerController(
 		cmLister,
 		cmGetter,
 		eventRecorder,
+		certOpts...,
 	)
 
 	secretInformer := kubeInformers.InformersFor(operatorclient.TargetNamespace).Core().V1().Secrets()
 	secretLister := secretInformer.Lister()
 	secretClient := v1helpers.CachedSecretGetter(kubeClient.CoreV1(), kubeInformers)
 
-	signerCert := tlshelpers.CreateSignerCert(secretInformer, secretLister, secretClient, eventRecorder)
-	etcdClientCert := tlshelpers.CreateEtcdClientCert(secretInformer, secretLister, secretClient, eventRecorder)
+	signerCert := tlshelpers.CreateSignerCert(secretInformer, secretLister, secretClient, eventRecorder, certOpts...)
+	etcdClientCert := tlshelpers.CreateEtcdClientCert(secretInformer, secretLister, secretClient, eventRecorder, certOpts...)
 
-	metricsSignerCert := tlshelpers.CreateMetricsSignerCert(secretInformer, secretLister, secretClient, eventRecorder)
-	metricsClientCert := tlshelpers.CreateMetricsClientCert(secretInformer, secretLister, secretClient, eventRecorder)
+	metricsSignerCert := tlshelpers.CreateMetricsSignerCert(secretInformer, secretLister, secretClient, eventRecorder, certOpts...)
+	metricsClientCert := tlshelpers.CreateMetricsClientCert(secretInformer, secretLister, secretClient, eventRecorder, certOpts...)
 
 	certCfg := &certConfig{
 		signerCaBundle: signerCaBundle,
@@ -127,6 +137,7 @@ func NewEtcdCertSignerController(
 		secretClient:   secretClient,
 		quorumChecker:  quorumChecker,
 		certConfig:     certCfg,
+		certOpts:       certOpts,
 	}
 
 	syncer := health.NewDefaultCheckingSyncWrapper(c.sync)
@@ -152,6 +163,12 @@ func (c *EtcdCertSignerController) sync(ctx context.Context, syncCtx factory.Syn
 	}
 
 	if err := c.syncAllMasterCertificates(ctx, syncCtx.Recorder()); err != nil {
+		// a node without InternalIP is still bootstrapping, retry without degrading
+		var missingIPErr *dnshelpers.NodeMissingInternalIPError
+		if errors.As(err, &missingIPErr) {
+			klog.V(2).Infof("EtcdCertSignerController waiting for node %s to report an InternalIP: %v", missingIPErr.NodeName, err)
+			return factory.SyntheticRequeueError
+		}
 		_, _, updateErr := v1helpers.UpdateStatus(ctx, c.operatorClient, v1helpers.UpdateConditionFn(operatorv1.OperatorCondition{
 			Type:    "EtcdCertSignerControllerDegraded",
 			Status:  operatorv1.ConditionTrue,
@@ -183,14 +200,22 @@ func (c *EtcdCertSignerController) syncAllMasterCertificates(ctx context.Context
 		return err
 	}
 
+	if err := c.ensureSignerChangeApproved(ctx, recorder, signerCaPair, tlshelpers.EtcdSignerCertSecretName); err != nil {
+		return err
+	}
+
 	// EnsureConfigMapCABundle is stateful w.r.t to the configmap it manages, so we can simply add it to the bundle before the new one
 	_, err = c.certConfig.signerCaBundle.EnsureConfigMapCABundle(ctx, signerCaPair)
 	if err != nil {
 		return fmt.Errorf("error on ensuring signer bundle for existing pair: %w", err)
 	}
 
+	if err := c.releaseSignerDeletionProtection(ctx); err != nil {
+		return err
+	}
+
 	// TODO(thomas): we need to transition that new signer as a replacement for the above - today we only bundle it
-	newSignerCaPair, err := c.certConfig.signerCert.EnsureSigningCertKeyPair(ctx)
+	newSignerCaPair, external, err := c.ensureSignerCertKeyPair(ctx, recorder)
 	if err != nil {
 		return fmt.Errorf("error on ensuring etcd-signer cert: %w", err)
 	}
@@ -199,10 +224,9 @@ func (c *EtcdCertSignerController) syncAllMasterCertificates(ctx context.Context
 	if err != nil {
 		return fmt.Errorf("error on ensuring signer bundle for new pair: %w", err)
 	}
-
-	_, err = c.certConfig.etcdClientCert.EnsureTargetCertKeyPair(ctx, signerCaPair, signerBundle)
-	if err != nil {
-		return fmt.Errorf("error on ensuring etcd client cert: %w", err)
+	if external {
+		// an externally provided signer replaces the user-specified one for issuing, it is trusted through the bundle now
+		signerCaPair = newSignerCaPair
 	}
 
 	metricsSignerCaPair, err := tlshelpers.ReadConfigMetricsSignerCert(ctx, c.secretClient)
@@ -226,12 +250,45 @@ func (c *EtcdCertSignerController) syncAllMasterCertificates(ctx context.Context
 		return fmt.Errorf("error on ensuring metrics signer bundle: %w", err)
 	}
 
+	nodes, err := c.nodeLister.List(labels.Set{"node-role.kubernetes.io/master": ""}.AsSelector())
+	if err != nil {
+		return fmt.Errorf("error listing master nodes: %w", err)
+	}
+	var nodeNames []string
+	for _, node := range nodes {
+		nodeNames = append(nodeNames, node.Name)
+	}
+	// the names are sorted to report errors the same way on every sync
+	sort.Strings(nodeNames)
+
+	// leaves must only be (re-)issued once their signers are trusted through the bundles just ensured
+	if err := tlshelpers.RequireSignersInBundles(nodeNames,
+		tlshelpers.BundleSigners{
+			BundleName: tlshelpers.EtcdSignerCaBundleConfigMapName,
+			Bundle:     signerBundle,
+			Signers:    []*crypto.CA{signerCaPair, newSignerCaPair},
+		},
+		tlshelpers.BundleSigners{
+			BundleName: tlshelpers.EtcdMetricsSignerCaBundleConfigMapName,
+			Bundle:     metricsSignerBundle,
+			Signers:    []*crypto.CA{metricsSignerCaPair, newMetricsSignerCaPair},
+		},
+	); err != nil {
+		return err
+	}
+
+	// the client certs do not depend on any node, so a node whose certs cannot be created must not hold them up
+	_, err = c.certConfig.etcdClientCert.EnsureTargetCertKeyPair(ctx, signerCaPair, signerBundle)
+	if err != nil {
+		return fmt.Errorf("error on ensuring etcd client cert: %w", err)
+	}
+
 	_, err = c.certConfig.metricsClientCert.EnsureTargetCertKeyPair(ctx, metricsSignerCaPair, metricsSignerBundle)
 	if err != nil {
 		return fmt.Errorf("error on ensuring metrics client cert: %w", err)
 	}
 
-	nodeCfgs, err := c.createNodeCertConfigs()
+	nodeCfgs, err := c.createNodeCertConfigs(nodes, nodeNames)
 	if err != nil {
 		return fmt.Errorf("error while creating cert configs for nodes: %w", err)
 	}
@@ -262,6 +319,10 @@ func (c *EtcdCertSignerController) syncAllMasterCertificates(ctx context.Context
 		return fmt.Errorf("encountered errors while syncing some certificates: %w", utilerrors.NewAggregate(errs))
 	}
 
+	if err := c.reconcileDeletionProtection(ctx, nodeNames); err != nil {
+		return fmt.Errorf("error on reconciling deletion protection of cert secrets: %w", err)
+	}
+
 	// Write a secret that aggregates all certs for all nodes for the static
 	// pod controller to watch. A single secret ensures that a cert change
 	// (e.g. node addition or cert rotation) triggers at most one static pod
@@ -285,10 +346,10 @@ func (c *EtcdCertSignerController) syncAllMasterCertificates(ctx context.Context
 
 // Nodes change internally the whole time (e.g. due to IPs changing), we thus re-create the cert configs every sync loop.
 // This works, because initialization is cheap and all state is kept in secrets, configmaps and their annotations.
-func (c *EtcdCertSignerController) createNodeCertConfigs() ([]*nodeCertConfigs, error) {
+func (c *EtcdCertSignerController) createNodeCertConfigs(nodes []*corev1.Node, nodeNames []string) ([]*nodeCertConfigs, error) {
 	var cfgs []*nodeCertConfigs
-	nodes, err := c.nodeLister.List(labels.Set{"node-role.kubernetes.io/master": ""}.AsSelector())
-	if err != nil {
+	// the secret names are derived from the node names, nodes must not end up sharing their certs
+	if err := tlshelpers.ValidateNodeSecretNames(nodeNames); err != nil {
 		return cfgs, err
 	}
 
@@ -297,7 +358,8 @@ func (c *EtcdCertSignerController) createNodeCertConfigs() ([]*nodeCertConfigs,
 			c.secretInformer,
 			c.secretLister,
 			c.secretClient,
-			c.eventRecorder)
+			c.eventRecorder,
+			c.certOpts...)
 		if err != nil {
 			return cfgs, fmt.Errorf("error creating peer cert for node [%s]: %w", node.Name, err)
 		}
@@ -306,7 +368,8 @@ func (c *EtcdCertSignerController) createNodeCertConfigs() ([]*nodeCertConfigs,
 			c.secretInformer,
 			c.secretLister,
 			c.secretClient,
-			c.eventRecorder)
+			c.eventRecorder,
+			c.certOpts...)
 		if err != nil {
 			return cfgs, fmt.Errorf("error creating serving cert for node [%s]: %w", node.Name, err)
 		}
@@ -315,7 +378,8 @@ func (c *EtcdCertSignerController) createNodeCertConfigs() ([]*nodeCertConfigs,
 			c.secretInformer,
 			c.secretLister,
 			c.secretClient,
-			c.eventRecorder)
+			c.eventRecorder,
+			c.certOpts...)
 		if err != nil {
 			return cfgs, fmt.Errorf("error creating metrics cert for node [%s]: %w", node.Name, err)
 		}
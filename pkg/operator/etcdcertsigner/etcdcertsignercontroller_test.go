@@ -63,6 +63,128 @@ func TestSyncAllMasters(t *testing.T) {
 	assertClientCerts(t, secretMap)
 }
 
+func TestSyncRecordsSecretDataHash(t *testing.T) {
+	fakeKubeClient, controller, recorder := setupController(t, []runtime.Object{})
+	require.NoError(t, controller.Sync(context.TODO(), factory.NewSyncContext("test", recorder)))
+
+	nodes, secretMap := allNodesAndSecrets(t, fakeKubeClient)
+	secretNames := []string{tlshelpers.EtcdClientCertSecretName, tlshelpers.EtcdMetricsClientCertSecretName}
+	for _, node := range nodes.Items {
+		secretNames = append(secretNames,
+			tlshelpers.GetPeerClientSecretNameForNode(node.Name),
+			tlshelpers.GetServingSecretNameForNode(node.Name),
+			tlshelpers.GetServingMetricsSecretNameForNode(node.Name),
+		)
+	}
+	for _, secretName := range secretNames {
+		secret := secretMap[secretName]
+		tampered, recorded := tlshelpers.SecretDataTampered(&secret)
+		require.Truef(t, recorded, "expected secret/%s to carry the data hash", secretName)
+		require.Falsef(t, tampered, "expected the data hash of secret/%s to match", secretName)
+
+		secret.Data["tls.key"] = []byte("tampered")
+		tampered, _ = tlshelpers.SecretDataTampered(&secret)
+		require.Truef(t, tampered, "expected secret/%s to be tampered", secretName)
+	}
+}
+
+func TestSyncIssuesCertsWithCertOptions(t *testing.T) {
+	fakeKubeClient, controller, recorder := setupController(t, []runtime.Object{},
+		tlshelpers.WithKeyAlgorithm(tlshelpers.ECDSAP256KeyAlgorithm), tlshelpers.WithExtraSANs([]string{"etcd.example.com"}))
+	require.NoError(t, controller.Sync(context.TODO(), factory.NewSyncContext("test", recorder)))
+
+	nodes, secretMap := allNodesAndSecrets(t, fakeKubeClient)
+	secretNames := []string{tlshelpers.EtcdClientCertSecretName, tlshelpers.EtcdMetricsClientCertSecretName}
+	for _, node := range nodes.Items {
+		secretNames = append(secretNames,
+			tlshelpers.GetPeerClientSecretNameForNode(node.Name),
+			tlshelpers.GetServingSecretNameForNode(node.Name),
+			tlshelpers.GetServingMetricsSecretNameForNode(node.Name),
+		)
+	}
+	for _, secretName := range secretNames {
+		secret := secretMap[secretName]
+		certs, err := crypto.CertsFromPEM(secret.Data["tls.crt"])
+		require.NoError(t, err)
+		require.Equalf(t, x509.ECDSA, certs[0].PublicKeyAlgorithm, "expected secret/%s to hold an ECDSA key", secretName)
+	}
+	for _, node := range nodes.Items {
+		secret := secretMap[tlshelpers.GetServingSecretNameForNode(node.Name)]
+		certs, err := crypto.CertsFromPEM(secret.Data["tls.crt"])
+		require.NoError(t, err)
+		require.Contains(t, certs[0].DNSNames, "etcd.example.com")
+	}
+}
+
+func TestSyncRequeuesOnNodeWithoutInternalIP(t *testing.T) {
+	fakeKubeClient, controller, recorder := setupController(t, []runtime.Object{
+		u.FakeNode("master-3", u.WithMasterLabel()),
+	})
+
+	err := controller.Sync(context.TODO(), factory.NewSyncContext("test", recorder))
+	require.Equal(t, factory.SyntheticRequeueError, err)
+
+	events, err := fakeKubeClient.CoreV1().Events(operatorclient.TargetNamespace).List(context.TODO(), metav1.ListOptions{})
+	require.NoError(t, err)
+	found := false
+	for _, event := range events.Items {
+		if event.Reason == "NodeInternalIPMissing" {
+			require.Contains(t, event.Message, "master-3")
+			found = true
+		}
+	}
+	require.True(t, found, "expected a NodeInternalIPMissing event")
+}
+
+func TestSyncRejectsCollidingNodeSecretNames(t *testing.T) {
+	fakeKubeClient, controller, recorder := setupController(t, []runtime.Object{
+		u.FakeNode("metrics-master-0", u.WithMasterLabel(), u.WithNodeInternalIP("10.0.0.4")),
+	})
+
+	err := controller.Sync(context.TODO(), factory.NewSyncContext("test", recorder))
+	require.ErrorContains(t, err, "nodes master-0 and metrics-master-0 both map to the secret etcd-serving-metrics-master-0")
+
+	// no node cert is issued while the conflict is unresolved
+	_, secretMap := allNodesAndSecrets(t, fakeKubeClient)
+	for _, nodeName := range []string{"master-0", "metrics-master-0"} {
+		require.NotContains(t, secretMap, tlshelpers.GetPeerClientSecretNameForNode(nodeName))
+	}
+}
+
+func TestSyncIssuesClientCertsDespiteFailingNodes(t *testing.T) {
+	tests := map[string]struct {
+		node        *corev1.Node
+		expectedErr string
+	}{
+		"node without InternalIP": {
+			node:        u.FakeNode("master-3", u.WithMasterLabel()),
+			expectedErr: factory.SyntheticRequeueError.Error(),
+		},
+		"colliding node secret names": {
+			node:        u.FakeNode("metrics-master-0", u.WithMasterLabel(), u.WithNodeInternalIP("10.0.0.4")),
+			expectedErr: "nodes master-0 and metrics-master-0 both map to the secret etcd-serving-metrics-master-0",
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			fakeKubeClient, controller, recorder := setupController(t, []runtime.Object{test.node})
+			fakeKubeClient.ClearActions()
+
+			err := controller.Sync(context.TODO(), factory.NewSyncContext("test", recorder))
+			require.ErrorContains(t, err, test.expectedErr)
+
+			_, secretMap := allNodesAndSecrets(t, fakeKubeClient)
+			assertClientCerts(t, secretMap)
+
+			// the bundles are checked as they were just ensured, not read back from the API
+			for _, action := range fakeKubeClient.Actions() {
+				require.False(t, action.Matches("get", "configmaps"), "unexpected live read of configmap %v", action)
+			}
+		})
+	}
+}
+
 func TestNewNodeAdded(t *testing.T) {
 	fakeKubeClient, controller, recorder := setupController(t, []runtime.Object{})
 
@@ -231,17 +353,17 @@ func checkCertPairSecret(t *testing.T, secretName, certName, keyName string, sec
 	}
 }
 
-func setupController(t *testing.T, objects []runtime.Object) (*fake.Clientset, factory.Controller, events.Recorder) {
+func setupController(t *testing.T, objects []runtime.Object, opts ...tlshelpers.CertOption) (*fake.Clientset, factory.Controller, events.Recorder) {
 	etcdMembers := []*etcdserverpb.Member{
 		u.FakeEtcdMemberWithoutServer(0),
 		u.FakeEtcdMemberWithoutServer(1),
 		u.FakeEtcdMemberWithoutServer(2),
 	}
-	return setupControllerWithEtcd(t, objects, etcdMembers)
+	return setupControllerWithEtcd(t, objects, etcdMembers, opts...)
 }
 
 // setupController configures EtcdCertSignerController for testing with etcd members.
-func setupControllerWithEtcd(t *testing.T, objects []runtime.Object, etcdMembers []*etcdserverpb.Member) (*fake.Clientset, factory.Controller, events.Recorder) {
+func setupControllerWithEtcd(t *testing.T, objects []runtime.Object, etcdMembers []*etcdserverpb.Member, opts ...tlshelpers.CertOption) (*fake.Clientset, factory.Controller, events.Recorder) {
 	// Add nodes and CAs
 	objects = append(objects,
 		&corev1.Namespace{
@@ -311,7 +433,8 @@ func setupControllerWithEtcd(t *testing.T, objects []runtime.Object, etcdMembers
 		fakeOperatorClient,
 		kubeInformerForNamespace,
 		recorder,
-		quorumChecker)
+		quorumChecker,
+		opts...)
 
 	stopChan := make(chan struct{})
 	t.Cleanup(func() {
@@ -0,0 +1,136 @@
+package etcdcertsigner
+
+import (
+	"fmt"
+	"time"
+
+	operatorv1 "github.com/openshift/api/operator/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/openshift/cluster-etcd-operator/pkg/operator/ceohelpers"
+	"github.com/openshift/cluster-etcd-operator/pkg/tlshelpers"
+)
+
+// certSignerOverride is the unsupportedConfigOverrides key that holds the EtcdCertSignerOptions.
+const certSignerOverride = "certSigner"
+
+// EtcdCertSignerOptions select how the EtcdCertSignerController issues the certs, the zero value keeps the defaults.
+// The operator reads them from the certSigner key of the unsupportedConfigOverrides, see
+// OptionsFromUnsupportedConfigOverrides. Every field maps to the tlshelpers.CertOption of the same name.
+type EtcdCertSignerOptions struct {
+	// CertMetadataAnnotations mirrors the notAfter, serial and SANs of the issued certs into annotations.
+	CertMetadataAnnotations bool `json:"certMetadataAnnotations,omitempty"`
+	// KeyAlgorithm is the algorithm of the generated keys, RSA or ECDSA-P256.
+	KeyAlgorithm tlshelpers.KeyAlgorithm `json:"keyAlgorithm,omitempty"`
+	// RSAKeySize is the modulus size in bits of the generated RSA keys, at least tlshelpers.DefaultRSAKeySize.
+	RSAKeySize int `json:"rsaKeySize,omitempty"`
+	// ClusterID is added as organizational unit to the subject of the issued certs.
+	ClusterID string `json:"clusterID,omitempty"`
+	// CodeSigningUsage adds the code signing extended key usage to the peer, serving and metrics certs.
+	CodeSigningUsage bool `json:"codeSigningUsage,omitempty"`
+	// MetricsServerAuthOnly issues the serving metrics certs with the server auth extended key usage only.
+	MetricsServerAuthOnly bool `json:"metricsServerAuthOnly,omitempty"`
+	// RSAPSSSignature signs the peer, serving and metrics certs with RSA-PSS.
+	RSAPSSSignature bool `json:"rsaPSSSignature,omitempty"`
+	// ExternalIPFallback issues the node certs on the ExternalIPs of nodes that have no InternalIP.
+	ExternalIPFallback bool `json:"externalIPFallback,omitempty"`
+	// ExtraSANs is a comma separated list of DNS names or IPs appended to the SANs of the node certs.
+	ExtraSANs string `json:"extraSANs,omitempty"`
+	// ExtraServiceNames are the <service>.<namespace> base names of services appended to the SANs of the node certs.
+	ExtraServiceNames []string `json:"extraServiceNames,omitempty"`
+	// ExtraOrganizations are appended to the subject organizations of the node certs.
+	ExtraOrganizations []string `json:"extraOrganizations,omitempty"`
+	// Validity is the validity of the peer, serving, metrics and client certs, e.g. 8760h.
+	Validity metav1.Duration `json:"validity,omitempty"`
+	// ClientCertValidity is the validity of the etcd and etcd metrics client certs.
+	ClientCertValidity metav1.Duration `json:"clientCertValidity,omitempty"`
+	// SignerValidity is the validity of the etcd and etcd metrics signers.
+	SignerValidity metav1.Duration `json:"signerValidity,omitempty"`
+	// MinTrustedCAs is the minimum number of CAs the etcd and etcd metrics CA bundles must trust.
+	MinTrustedCAs int `json:"minTrustedCAs,omitempty"`
+}
+
+// OptionsFromUnsupportedConfigOverrides returns the EtcdCertSignerOptions set in the certSigner key of the
+// unsupportedConfigOverrides of the given spec, e.g. certSigner: {keyAlgorithm: ECDSA-P256}. The controller is set up
+// once, so changes only take effect on the next start of the operator.
+func OptionsFromUnsupportedConfigOverrides(spec *operatorv1.OperatorSpec) (EtcdCertSignerOptions, error) {
+	options := EtcdCertSignerOptions{}
+	if _, err := ceohelpers.ReadUnsupportedOverride(spec, certSignerOverride, &options); err != nil {
+		return EtcdCertSignerOptions{}, fmt.Errorf("failed to read %s from unsupportedConfigOverrides: %w", certSignerOverride, err)
+	}
+	return options, nil
+}
+
+// CertOptions validates the options and returns the tlshelpers.CertOption to issue the certs with. Options that would
+// only be rejected at issuance, like an unknown key algorithm, are rejected here already, so that they can't degrade
+// the controller on every sync.
+func (o EtcdCertSignerOptions) CertOptions() ([]tlshelpers.CertOption, error) {
+	var opts []tlshelpers.CertOption
+	if o.CertMetadataAnnotations {
+		opts = append(opts, tlshelpers.WithCertMetadataAnnotations())
+	}
+	switch o.KeyAlgorithm {
+	case "":
+	case tlshelpers.RSAKeyAlgorithm, tlshelpers.ECDSAP256KeyAlgorithm:
+		opts = append(opts, tlshelpers.WithKeyAlgorithm(o.KeyAlgorithm))
+	default:
+		return nil, fmt.Errorf("unknown key algorithm %q, must be one of %q or %q", o.KeyAlgorithm, tlshelpers.RSAKeyAlgorithm, tlshelpers.ECDSAP256KeyAlgorithm)
+	}
+	if o.RSAKeySize != 0 {
+		if o.RSAKeySize < tlshelpers.DefaultRSAKeySize {
+			return nil, fmt.Errorf("RSA key size %d is smaller than %d", o.RSAKeySize, tlshelpers.DefaultRSAKeySize)
+		}
+		opts = append(opts, tlshelpers.WithRSAKeySize(o.RSAKeySize))
+	}
+	if len(o.ClusterID) > 0 {
+		opts = append(opts, tlshelpers.WithClusterID(o.ClusterID))
+	}
+	if o.CodeSigningUsage {
+		opts = append(opts, tlshelpers.WithCodeSigningUsage())
+	}
+	if o.MetricsServerAuthOnly {
+		opts = append(opts, tlshelpers.WithMetricsServerAuthOnly())
+	}
+	if o.RSAPSSSignature {
+		opts = append(opts, tlshelpers.WithRSAPSSSignature())
+	}
+	if o.ExternalIPFallback {
+		opts = append(opts, tlshelpers.WithExternalIPFallback())
+	}
+	if len(o.ExtraSANs) > 0 {
+		sans, err := tlshelpers.ParseExtraSANs(o.ExtraSANs)
+		if err != nil {
+			return nil, err
+		}
+		opts = append(opts, tlshelpers.WithExtraSANs(sans))
+	}
+	if len(o.ExtraServiceNames) > 0 {
+		opts = append(opts, tlshelpers.WithExtraServiceNames(o.ExtraServiceNames))
+	}
+	if len(o.ExtraOrganizations) > 0 {
+		opts = append(opts, tlshelpers.WithExtraOrganizations(o.ExtraOrganizations))
+	}
+	for _, validity := range []struct {
+		name     string
+		duration time.Duration
+		option   func(time.Duration) tlshelpers.CertOption
+	}{
+		{"validity", o.Validity.Duration, tlshelpers.WithValidity},
+		{"clientCertValidity", o.ClientCertValidity.Duration, tlshelpers.WithClientCertValidity},
+		{"signerValidity", o.SignerValidity.Duration, tlshelpers.WithSignerValidity},
+	} {
+		if validity.duration < 0 {
+			return nil, fmt.Errorf("%s must not be negative, got %s", validity.name, validity.duration)
+		}
+		if validity.duration > 0 {
+			opts = append(opts, validity.option(validity.duration))
+		}
+	}
+	if o.MinTrustedCAs < 0 {
+		return nil, fmt.Errorf("minTrustedCAs must not be negative, got %d", o.MinTrustedCAs)
+	}
+	if o.MinTrustedCAs > 0 {
+		opts = append(opts, tlshelpers.WithMinTrustedCAs(o.MinTrustedCAs))
+	}
+	return opts, nil
+}
@@ -0,0 +1,72 @@
+package etcdcertsigner
+
+import (
+	"testing"
+
+	operatorv1 "github.com/openshift/api/operator/v1"
+	"github.com/stretchr/testify/require"
+	"k8s.io/apimachinery/pkg/runtime"
+
+	"github.com/openshift/cluster-etcd-operator/pkg/tlshelpers"
+)
+
+func TestOptionsFromUnsupportedConfigOverrides(t *testing.T) {
+	tests := map[string]struct {
+		overrides       string
+		expectedOptions int
+		expectedErr     string
+	}{
+		"no overrides": {},
+		"no certSigner override": {
+			overrides: `{"resourceSync": {"dryRun": true}}`,
+		},
+		"all options": {
+			overrides: `{"certSigner": {"certMetadataAnnotations": true, "keyAlgorithm": "RSA", "rsaKeySize": 4096, "clusterID": "abc",
+				"codeSigningUsage": true, "metricsServerAuthOnly": true, "rsaPSSSignature": true, "externalIPFallback": true,
+				"extraSANs": "etcd.example.com,10.0.0.10", "extraServiceNames": ["etcd.openshift-etcd"], "extraOrganizations": ["acme"],
+				"validity": "8760h", "clientCertValidity": "720h", "signerValidity": "43800h", "minTrustedCAs": 2}}`,
+			expectedOptions: 15,
+		},
+		"typo": {
+			overrides:   `{"certSigner": {"key-algorithm": "ECDSA-P256"}}`,
+			expectedErr: "failed to read certSigner from unsupportedConfigOverrides",
+		},
+		"unknown key algorithm": {
+			overrides:   `{"certSigner": {"keyAlgorithm": "DSA"}}`,
+			expectedErr: `unknown key algorithm "DSA"`,
+		},
+		"small RSA key size": {
+			overrides:   `{"certSigner": {"rsaKeySize": 1024}}`,
+			expectedErr: "RSA key size 1024 is smaller than",
+		},
+		"invalid extra SAN": {
+			overrides:   `{"certSigner": {"extraSANs": "not a SAN"}}`,
+			expectedErr: "not a SAN",
+		},
+		"negative validity": {
+			overrides:   `{"certSigner": {"clientCertValidity": "-1h"}}`,
+			expectedErr: "clientCertValidity must not be negative",
+		},
+		"negative min trusted CAs": {
+			overrides:   `{"certSigner": {"minTrustedCAs": -1}}`,
+			expectedErr: "minTrustedCAs must not be negative",
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			spec := &operatorv1.OperatorSpec{UnsupportedConfigOverrides: runtime.RawExtension{Raw: []byte(test.overrides)}}
+			options, err := OptionsFromUnsupportedConfigOverrides(spec)
+			var opts []tlshelpers.CertOption
+			if err == nil {
+				opts, err = options.CertOptions()
+			}
+			if len(test.expectedErr) > 0 {
+				require.ErrorContains(t, err, test.expectedErr)
+				return
+			}
+			require.NoError(t, err)
+			require.Len(t, opts, test.expectedOptions)
+		})
+	}
+}
@@ -0,0 +1,84 @@
+package etcdcertsigner
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/openshift/library-go/pkg/crypto"
+	"github.com/openshift/library-go/pkg/operator/events"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/util/cert"
+
+	"github.com/openshift/cluster-etcd-operator/pkg/operator/ceohelpers"
+	"github.com/openshift/cluster-etcd-operator/pkg/operator/operatorclient"
+	"github.com/openshift/cluster-etcd-operator/pkg/tlshelpers"
+)
+
+// requireSignerChangeApprovalOverride is the unsupportedConfigOverrides key that disables automatically trusting
+// a changed user-specified signer.
+const requireSignerChangeApprovalOverride = "requireEtcdSignerChangeApproval"
+
+// ensureSignerChangeApproved refuses to adopt a signer that differs from the ones already trusted in the signer CA
+// bundle, unless the admin approved it by setting tlshelpers.SignerChangeApprovalAnnotation to the fingerprint of the
+// new signer on the secret it is provided in, openshift-config/<approvalSecretName>. This applies to the user-specified
+// signer as well as to the external signer, and only when requireEtcdSignerChangeApproval is set, otherwise any signer
+// is accepted. When there is no bundle yet, the signer is trusted on first use.
+func (c *EtcdCertSignerController) ensureSignerChangeApproved(ctx context.Context, recorder events.Recorder, signerCaPair *crypto.CA, approvalSecretName string) error {
+	operatorSpec, _, _, err := c.operatorClient.GetStaticPodOperatorState()
+	if err != nil {
+		return err
+	}
+	requireApproval, err := ceohelpers.ReadUnsupportedBoolOverride(&operatorSpec.OperatorSpec, requireSignerChangeApprovalOverride)
+	if err != nil {
+		return fmt.Errorf("failed to read %s from unsupportedConfigOverrides: %w", requireSignerChangeApprovalOverride, err)
+	}
+	if !requireApproval {
+		return nil
+	}
+
+	bundle, err := c.certConfig.signerCaBundle.Lister.ConfigMaps(c.certConfig.signerCaBundle.Namespace).Get(c.certConfig.signerCaBundle.Name)
+	if err != nil {
+		if apierrors.IsNotFound(err) {
+			return nil
+		}
+		return err
+	}
+	if len(bundle.Data["ca-bundle.crt"]) == 0 {
+		return nil
+	}
+	trustedCerts, err := cert.ParseCertsPEM([]byte(bundle.Data["ca-bundle.crt"]))
+	if err != nil {
+		return fmt.Errorf("could not parse %s/%s: %w", bundle.Namespace, bundle.Name, err)
+	}
+
+	signerCert := signerCaPair.Config.Certs[0]
+	for _, trustedCert := range trustedCerts {
+		if trustedCert.Equal(signerCert) {
+			return nil
+		}
+	}
+
+	fingerprint := tlshelpers.CertFingerprint(signerCert)
+	signerSecret, err := c.secretClient.Secrets(operatorclient.GlobalUserSpecifiedConfigNamespace).Get(ctx, approvalSecretName, metav1.GetOptions{})
+	if err != nil {
+		return fmt.Errorf("error getting %s/%s: %w", operatorclient.GlobalUserSpecifiedConfigNamespace, approvalSecretName, err)
+	}
+	if signerSecret.Annotations[tlshelpers.SignerChangeApprovalAnnotation] == fingerprint {
+		recorder.Eventf("EtcdSignerChangeApproved", "adopting changed signer %q with approved fingerprint %s", signerCert.Subject.CommonName, fingerprint)
+		return nil
+	}
+
+	recorder.Warningf("EtcdSignerChangeNotApproved", "signer %q with fingerprint %s is not trusted yet, annotate %s/%s with %s=%s to approve it",
+		signerCert.Subject.CommonName, fingerprint, operatorclient.GlobalUserSpecifiedConfigNamespace, approvalSecretName,
+		tlshelpers.SignerChangeApprovalAnnotation, fingerprint)
+	return fmt.Errorf("refusing to adopt changed signer %q with fingerprint %s without approval", signerCert.Subject.CommonName, fingerprint)
+}
+
+// ensureSignerCertKeyPair is tlshelpers.EnsureSignerCertKeyPair with the adoption of a new or changed external signer
+// guarded by ensureSignerChangeApproved, approved on openshift-config/etcd-external-signer.
+func (c *EtcdCertSignerController) ensureSignerCertKeyPair(ctx context.Context, recorder events.Recorder) (*crypto.CA, bool, error) {
+	return tlshelpers.EnsureSignerCertKeyPair(ctx, c.secretClient, c.certConfig.signerCert, func(externalSigner *crypto.CA) error {
+		return c.ensureSignerChangeApproved(ctx, recorder, externalSigner, tlshelpers.EtcdExternalSignerCertSecretName)
+	})
+}
@@ -0,0 +1,211 @@
+package etcdcertsigner
+
+import (
+	"context"
+	"testing"
+
+	operatorv1 "github.com/openshift/api/operator/v1"
+	"github.com/openshift/library-go/pkg/crypto"
+	"github.com/openshift/library-go/pkg/operator/events"
+	"github.com/openshift/library-go/pkg/operator/v1helpers"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+	corev1listers "k8s.io/client-go/listers/core/v1"
+	"k8s.io/client-go/tools/cache"
+
+	"github.com/openshift/cluster-etcd-operator/pkg/operator/operatorclient"
+	u "github.com/openshift/cluster-etcd-operator/pkg/testutils"
+	"github.com/openshift/cluster-etcd-operator/pkg/tlshelpers"
+)
+
+func TestEnsureSignerChangeApproved(t *testing.T) {
+	signerSecret := newCASecret(t, tlshelpers.EtcdSignerCertSecretName)
+	signer, err := crypto.GetCAFromBytes(signerSecret.Data["tls.crt"], signerSecret.Data["tls.key"])
+	require.NoError(t, err)
+	oldSignerSecret := newCASecret(t, tlshelpers.EtcdSignerCertSecretName)
+
+	approvedSignerSecret := signerSecret.DeepCopy()
+	approvedSignerSecret.Annotations = map[string]string{
+		tlshelpers.SignerChangeApprovalAnnotation: tlshelpers.CertFingerprint(signer.Config.Certs[0]),
+	}
+
+	requireApproval := []byte(`{"requireEtcdSignerChangeApproval": true}`)
+
+	tests := map[string]struct {
+		overrides    []byte
+		signerSecret *corev1.Secret
+		bundle       *corev1.ConfigMap
+		expectedErr  bool
+	}{
+		"approval not required, changed signer": {
+			signerSecret: signerSecret,
+			bundle:       newCABundle(oldSignerSecret),
+		},
+		"approval required, trust on first use": {
+			overrides:    requireApproval,
+			signerSecret: signerSecret,
+		},
+		"approval required, signer already trusted": {
+			overrides:    requireApproval,
+			signerSecret: signerSecret,
+			bundle:       newCABundle(oldSignerSecret, signerSecret),
+		},
+		"approval required, changed signer not approved": {
+			overrides:    requireApproval,
+			signerSecret: signerSecret,
+			bundle:       newCABundle(oldSignerSecret),
+			expectedErr:  true,
+		},
+		"approval required, changed signer approved": {
+			overrides:    requireApproval,
+			signerSecret: approvedSignerSecret,
+			bundle:       newCABundle(oldSignerSecret),
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			indexer := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{})
+			if test.bundle != nil {
+				require.NoError(t, indexer.Add(test.bundle))
+			}
+			fakeKubeClient := fake.NewSimpleClientset(test.signerSecret)
+			fakeOperatorClient := v1helpers.NewFakeStaticPodOperatorClient(
+				&operatorv1.StaticPodOperatorSpec{
+					OperatorSpec: operatorv1.OperatorSpec{
+						ManagementState:            operatorv1.Managed,
+						UnsupportedConfigOverrides: runtime.RawExtension{Raw: test.overrides},
+					},
+				},
+				u.StaticPodOperatorStatus(),
+				nil,
+				nil,
+			)
+
+			c := &EtcdCertSignerController{
+				operatorClient: fakeOperatorClient,
+				secretClient:   fakeKubeClient.CoreV1(),
+				certConfig: &certConfig{
+					signerCaBundle: tlshelpers.CreateSignerCertRotationBundleConfigMap(nil, corev1listers.NewConfigMapLister(indexer), nil, nil),
+				},
+			}
+
+			err := c.ensureSignerChangeApproved(context.TODO(), events.NewInMemoryRecorder(t.Name()), signer, tlshelpers.EtcdSignerCertSecretName)
+			if test.expectedErr {
+				require.Error(t, err)
+			} else {
+				require.NoError(t, err)
+			}
+		})
+	}
+}
+
+func TestEnsureSignerCertKeyPairRequiresExternalSignerApproval(t *testing.T) {
+	currentSigner := newCASecret(t, tlshelpers.EtcdSignerCertSecretName)
+	currentSigner.Namespace = operatorclient.TargetNamespace
+	currentSigner.Finalizers = []string{tlshelpers.DeletionProtectionFinalizer}
+	externalSigner := newCASecret(t, tlshelpers.EtcdExternalSignerCertSecretName)
+	external, err := crypto.GetCAFromBytes(externalSigner.Data["tls.crt"], externalSigner.Data["tls.key"])
+	require.NoError(t, err)
+	approvedExternalSigner := externalSigner.DeepCopy()
+	approvedExternalSigner.Annotations = map[string]string{
+		tlshelpers.SignerChangeApprovalAnnotation: tlshelpers.CertFingerprint(external.Config.Certs[0]),
+	}
+
+	requireApproval := []byte(`{"requireEtcdSignerChangeApproval": true}`)
+
+	tests := map[string]struct {
+		overrides      []byte
+		externalSigner *corev1.Secret
+		bundle         *corev1.ConfigMap
+		expectedErr    string
+	}{
+		"approval not required": {
+			externalSigner: externalSigner,
+			bundle:         newCABundle(currentSigner),
+		},
+		"approval required, external signer not approved": {
+			overrides:      requireApproval,
+			externalSigner: externalSigner,
+			bundle:         newCABundle(currentSigner),
+			expectedErr:    `refusing to adopt changed signer "foo" with fingerprint ` + tlshelpers.CertFingerprint(external.Config.Certs[0]) + " without approval",
+		},
+		"approval required, external signer approved": {
+			overrides:      requireApproval,
+			externalSigner: approvedExternalSigner,
+			bundle:         newCABundle(currentSigner),
+		},
+		"approval required, external signer already trusted": {
+			overrides:      requireApproval,
+			externalSigner: externalSigner,
+			bundle:         newCABundle(currentSigner, externalSigner),
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			indexer := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{})
+			require.NoError(t, indexer.Add(test.bundle))
+			fakeKubeClient := fake.NewSimpleClientset(currentSigner, test.externalSigner)
+			fakeOperatorClient := v1helpers.NewFakeStaticPodOperatorClient(
+				&operatorv1.StaticPodOperatorSpec{
+					OperatorSpec: operatorv1.OperatorSpec{
+						ManagementState:            operatorv1.Managed,
+						UnsupportedConfigOverrides: runtime.RawExtension{Raw: test.overrides},
+					},
+				},
+				u.StaticPodOperatorStatus(),
+				nil,
+				nil,
+			)
+			recorder := events.NewInMemoryRecorder(t.Name())
+			secretLister := corev1listers.NewSecretLister(cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{}))
+
+			c := &EtcdCertSignerController{
+				operatorClient: fakeOperatorClient,
+				secretClient:   fakeKubeClient.CoreV1(),
+				certConfig: &certConfig{
+					signerCert:     tlshelpers.CreateSignerCert(nil, secretLister, fakeKubeClient.CoreV1(), recorder),
+					signerCaBundle: tlshelpers.CreateSignerCertRotationBundleConfigMap(nil, corev1listers.NewConfigMapLister(indexer), nil, nil),
+				},
+			}
+
+			ca, adopted, err := c.ensureSignerCertKeyPair(context.TODO(), recorder)
+			signer, getErr := fakeKubeClient.CoreV1().Secrets(operatorclient.TargetNamespace).Get(context.TODO(), tlshelpers.EtcdSignerCertSecretName, metav1.GetOptions{})
+			require.NoError(t, getErr)
+			if len(test.expectedErr) > 0 {
+				require.EqualError(t, err, test.expectedErr)
+				var reasons []string
+				for _, event := range recorder.Events() {
+					reasons = append(reasons, event.Reason)
+				}
+				require.Contains(t, reasons, "EtcdSignerChangeNotApproved")
+				// the current signer is left in place, protection included
+				require.Equal(t, currentSigner.Data, signer.Data)
+				require.Equal(t, currentSigner.Finalizers, signer.Finalizers)
+				return
+			}
+			require.NoError(t, err)
+			require.True(t, adopted)
+			require.Equal(t, external.Config.Certs[0].Raw, ca.Config.Certs[0].Raw)
+			require.Equal(t, externalSigner.Data, signer.Data)
+		})
+	}
+}
+
+func newCABundle(caSecrets ...*corev1.Secret) *corev1.ConfigMap {
+	var bundle []byte
+	for _, s := range caSecrets {
+		bundle = append(bundle, s.Data["tls.crt"]...)
+	}
+	return &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace: operatorclient.TargetNamespace,
+			Name:      tlshelpers.EtcdSignerCaBundleConfigMapName,
+		},
+		Data: map[string]string{"ca-bundle.crt": string(bundle)},
+	}
+}
@@ -0,0 +1,104 @@
+package resourcesynccontroller
+
+import (
+	"context"
+
+	"github.com/openshift/library-go/pkg/operator/events"
+	"github.com/openshift/library-go/pkg/operator/resourcesynccontroller"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	corev1client "k8s.io/client-go/kubernetes/typed/core/v1"
+	"k8s.io/klog/v2"
+)
+
+// dryRunConfigMapsGetter hands out configmap clients that read from the delegate, but only log and record an event
+// for every write instead of performing it.
+type dryRunConfigMapsGetter struct {
+	delegate corev1client.ConfigMapsGetter
+	recorder events.Recorder
+	registry *syncRegistry
+}
+
+func (g *dryRunConfigMapsGetter) ConfigMaps(namespace string) corev1client.ConfigMapInterface {
+	return &dryRunConfigMaps{ConfigMapInterface: g.delegate.ConfigMaps(namespace), namespace: namespace, getter: g}
+}
+
+type dryRunConfigMaps struct {
+	corev1client.ConfigMapInterface
+	namespace string
+	getter    *dryRunConfigMapsGetter
+}
+
+func (c *dryRunConfigMaps) skip(verb, name string) {
+	destination := resourcesynccontroller.ResourceLocation{Namespace: c.namespace, Name: name}
+	skipWrite(c.getter.recorder, configMapKind, verb, destination, c.getter.registry.configMapSources[destination])
+}
+
+func (c *dryRunConfigMaps) Create(_ context.Context, configMap *corev1.ConfigMap, _ metav1.CreateOptions) (*corev1.ConfigMap, error) {
+	c.skip("create", configMap.Name)
+	return configMap, nil
+}
+
+func (c *dryRunConfigMaps) Update(_ context.Context, configMap *corev1.ConfigMap, _ metav1.UpdateOptions) (*corev1.ConfigMap, error) {
+	c.skip("update", configMap.Name)
+	return configMap, nil
+}
+
+func (c *dryRunConfigMaps) Delete(_ context.Context, name string, _ metav1.DeleteOptions) error {
+	c.skip("delete", name)
+	return nil
+}
+
+func (c *dryRunConfigMaps) Patch(ctx context.Context, name string, _ types.PatchType, _ []byte, _ metav1.PatchOptions, _ ...string) (*corev1.ConfigMap, error) {
+	c.skip("patch", name)
+	return c.Get(ctx, name, metav1.GetOptions{})
+}
+
+// dryRunSecretsGetter hands out secret clients that read from the delegate, but only log and record an event for
+// every write instead of performing it.
+type dryRunSecretsGetter struct {
+	delegate corev1client.SecretsGetter
+	recorder events.Recorder
+	registry *syncRegistry
+}
+
+func (g *dryRunSecretsGetter) Secrets(namespace string) corev1client.SecretInterface {
+	return &dryRunSecrets{SecretInterface: g.delegate.Secrets(namespace), namespace: namespace, getter: g}
+}
+
+type dryRunSecrets struct {
+	corev1client.SecretInterface
+	namespace string
+	getter    *dryRunSecretsGetter
+}
+
+func (c *dryRunSecrets) skip(verb, name string) {
+	destination := resourcesynccontroller.ResourceLocation{Namespace: c.namespace, Name: name}
+	skipWrite(c.getter.recorder, secretKind, verb, destination, c.getter.registry.secretSources[destination])
+}
+
+func (c *dryRunSecrets) Create(_ context.Context, secret *corev1.Secret, _ metav1.CreateOptions) (*corev1.Secret, error) {
+	c.skip("create", secret.Name)
+	return secret, nil
+}
+
+func (c *dryRunSecrets) Update(_ context.Context, secret *corev1.Secret, _ metav1.UpdateOptions) (*corev1.Secret, error) {
+	c.skip("update", secret.Name)
+	return secret, nil
+}
+
+func (c *dryRunSecrets) Delete(_ context.Context, name string, _ metav1.DeleteOptions) error {
+	c.skip("delete", name)
+	return nil
+}
+
+func (c *dryRunSecrets) Patch(ctx context.Context, name string, _ types.PatchType, _ []byte, _ metav1.PatchOptions, _ ...string) (*corev1.Secret, error) {
+	c.skip("patch", name)
+	return c.Get(ctx, name, metav1.GetOptions{})
+}
+
+func skipWrite(recorder events.Recorder, kind, verb string, destination, source resourcesynccontroller.ResourceLocation) {
+	klog.Infof("dry-run: skipping %s of %s %s/%s synced from %s/%s", verb, kind, destination.Namespace, destination.Name, source.Namespace, source.Name)
+	recorder.Eventf("ResourceSyncDryRun", "dry-run: skipped %s of %s %s/%s synced from %s/%s", verb, kind, destination.Namespace, destination.Name, source.Namespace, source.Name)
+}
@@ -0,0 +1,143 @@
+package resourcesynccontroller
+
+import (
+	"context"
+
+	"github.com/openshift/library-go/pkg/operator/resourcesynccontroller"
+	"github.com/prometheus/client_golang/prometheus"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	corev1client "k8s.io/client-go/kubernetes/typed/core/v1"
+	"k8s.io/component-base/metrics/legacyregistry"
+)
+
+func init() {
+	legacyregistry.RawMustRegister(resourceSyncMetrics.collectors()...)
+}
+
+const (
+	configMapKind = "configmap"
+	secretKind    = "secret"
+)
+
+var resourceSyncMetrics = newSyncMetrics()
+
+// syncMetrics counts per synced resource how often the destination was written and how often that failed, and how
+// often the sync was skipped because its precondition was not fulfilled.
+type syncMetrics struct {
+	copies   *prometheus.CounterVec
+	failures *prometheus.CounterVec
+	skips    *prometheus.CounterVec
+}
+
+func newSyncMetrics() *syncMetrics {
+	labels := []string{"kind", "source_namespace", "source_name", "destination_namespace", "destination_name"}
+	return &syncMetrics{
+		copies: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "etcd_operator_resource_sync_copies_total",
+			Help: "Number of times a synced configmap or secret was written to its destination.",
+		}, labels),
+		failures: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "etcd_operator_resource_sync_failures_total",
+			Help: "Number of times writing a synced configmap or secret to its destination failed.",
+		}, labels),
+		skips: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "etcd_operator_resource_sync_precondition_skips_total",
+			Help: "Number of times syncing a configmap or secret was skipped because its precondition was not fulfilled.",
+		}, labels),
+	}
+}
+
+func (m *syncMetrics) collectors() []prometheus.Collector {
+	return []prometheus.Collector{m.copies, m.failures, m.skips}
+}
+
+func syncLabels(kind string, destination, source resourcesynccontroller.ResourceLocation) prometheus.Labels {
+	return prometheus.Labels{
+		"kind":                  kind,
+		"source_namespace":      source.Namespace,
+		"source_name":           source.Name,
+		"destination_namespace": destination.Namespace,
+		"destination_name":      destination.Name,
+	}
+}
+
+// countSkips wraps the precondition of a sync to count the syncs it skips.
+func (m *syncMetrics) countSkips(kind string, destination, source resourcesynccontroller.ResourceLocation, precondition func() (bool, error)) func() (bool, error) {
+	return func() (bool, error) {
+		fulfilled, err := precondition()
+		if !fulfilled && err == nil {
+			m.skips.With(syncLabels(kind, destination, source)).Inc()
+		}
+		return fulfilled, err
+	}
+}
+
+// countWrite counts the result of writing a destination. Writes to anything but a registered destination are ignored.
+func (m *syncMetrics) countWrite(kind string, destination resourcesynccontroller.ResourceLocation, sources map[resourcesynccontroller.ResourceLocation]resourcesynccontroller.ResourceLocation, err error) {
+	source, ok := sources[destination]
+	if !ok {
+		return
+	}
+	if err != nil {
+		m.failures.With(syncLabels(kind, destination, source)).Inc()
+		return
+	}
+	m.copies.With(syncLabels(kind, destination, source)).Inc()
+}
+
+// metricsConfigMapsGetter hands out configmap clients that count the writes of synced destinations.
+type metricsConfigMapsGetter struct {
+	delegate corev1client.ConfigMapsGetter
+	registry *syncRegistry
+}
+
+func (g *metricsConfigMapsGetter) ConfigMaps(namespace string) corev1client.ConfigMapInterface {
+	return &metricsConfigMaps{ConfigMapInterface: g.delegate.ConfigMaps(namespace), namespace: namespace, registry: g.registry}
+}
+
+type metricsConfigMaps struct {
+	corev1client.ConfigMapInterface
+	namespace string
+	registry  *syncRegistry
+}
+
+func (c *metricsConfigMaps) Create(ctx context.Context, configMap *corev1.ConfigMap, opts metav1.CreateOptions) (*corev1.ConfigMap, error) {
+	created, err := c.ConfigMapInterface.Create(ctx, configMap, opts)
+	c.registry.metrics.countWrite(configMapKind, resourcesynccontroller.ResourceLocation{Namespace: c.namespace, Name: configMap.Name}, c.registry.configMapSources, err)
+	return created, err
+}
+
+func (c *metricsConfigMaps) Update(ctx context.Context, configMap *corev1.ConfigMap, opts metav1.UpdateOptions) (*corev1.ConfigMap, error) {
+	updated, err := c.ConfigMapInterface.Update(ctx, configMap, opts)
+	c.registry.metrics.countWrite(configMapKind, resourcesynccontroller.ResourceLocation{Namespace: c.namespace, Name: configMap.Name}, c.registry.configMapSources, err)
+	return updated, err
+}
+
+// metricsSecretsGetter hands out secret clients that count the writes of synced destinations.
+type metricsSecretsGetter struct {
+	delegate corev1client.SecretsGetter
+	registry *syncRegistry
+}
+
+func (g *metricsSecretsGetter) Secrets(namespace string) corev1client.SecretInterface {
+	return &metricsSecrets{SecretInterface: g.delegate.Secrets(namespace), namespace: namespace, registry: g.registry}
+}
+
+type metricsSecrets struct {
+	corev1client.SecretInterface
+	namespace string
+	registry  *syncRegistry
+}
+
+func (c *metricsSecrets) Create(ctx context.Context, secret *corev1.Secret, opts metav1.CreateOptions) (*corev1.Secret, error) {
+	created, err := c.SecretInterface.Create(ctx, secret, opts)
+	c.registry.metrics.countWrite(secretKind, resourcesynccontroller.ResourceLocation{Namespace: c.namespace, Name: secret.Name}, c.registry.secretSources, err)
+	return created, err
+}
+
+func (c *metricsSecrets) Update(ctx context.Context, secret *corev1.Secret, opts metav1.UpdateOptions) (*corev1.Secret, error) {
+	updated, err := c.SecretInterface.Update(ctx, secret, opts)
+	c.registry.metrics.countWrite(secretKind, resourcesynccontroller.ResourceLocation{Namespace: c.namespace, Name: secret.Name}, c.registry.secretSources, err)
+	return updated, err
+}
@@ -0,0 +1,134 @@
+package resourcesynccontroller
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/openshift/library-go/pkg/operator/resourcesynccontroller"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	corev1client "k8s.io/client-go/kubernetes/typed/core/v1"
+	"k8s.io/klog/v2"
+)
+
+const (
+	// SyncedFromAnnotation is set on every destination the controller writes, its value is the namespace/name of the
+	// source. It marks the destination as maintained by the operator, a destination without it was not written by the
+	// controller since the annotation was introduced. The controller watches all destination namespaces, so a synced
+	// destination that is deleted by somebody else is recreated with the next sync right away.
+	SyncedFromAnnotation = "etcd.openshift.io/synced-from"
+
+	// ExternalOwnerAnnotation is set by the admin on a destination to take it over, e.g. to maintain their own copy of
+	// etcd-client in openshift-config. Its value names the owner. Syncs that respect external owners neither overwrite
+	// nor delete such a destination until the annotation is removed.
+	ExternalOwnerAnnotation = "etcd.openshift.io/external-owner"
+)
+
+// ownershipConfigMapsGetter hands out configmap clients that set SyncedFromAnnotation on every write of a synced
+// destination.
+type ownershipConfigMapsGetter struct {
+	delegate corev1client.ConfigMapsGetter
+	registry *syncRegistry
+}
+
+func (g *ownershipConfigMapsGetter) ConfigMaps(namespace string) corev1client.ConfigMapInterface {
+	return &ownershipConfigMaps{ConfigMapInterface: g.delegate.ConfigMaps(namespace), namespace: namespace, registry: g.registry}
+}
+
+type ownershipConfigMaps struct {
+	corev1client.ConfigMapInterface
+	namespace string
+	registry  *syncRegistry
+}
+
+func (c *ownershipConfigMaps) stamp(configMap *corev1.ConfigMap) *corev1.ConfigMap {
+	source, ok := c.registry.configMapSources[resourcesynccontroller.ResourceLocation{Namespace: c.namespace, Name: configMap.Name}]
+	if !ok {
+		return configMap
+	}
+	configMap = configMap.DeepCopy()
+	configMap.Annotations = withSyncedFromAnnotation(configMap.Annotations, source)
+	return configMap
+}
+
+func (c *ownershipConfigMaps) Create(ctx context.Context, configMap *corev1.ConfigMap, opts metav1.CreateOptions) (*corev1.ConfigMap, error) {
+	return c.ConfigMapInterface.Create(ctx, c.stamp(configMap), opts)
+}
+
+func (c *ownershipConfigMaps) Update(ctx context.Context, configMap *corev1.ConfigMap, opts metav1.UpdateOptions) (*corev1.ConfigMap, error) {
+	return c.ConfigMapInterface.Update(ctx, c.stamp(configMap), opts)
+}
+
+// ownershipSecretsGetter hands out secret clients that set SyncedFromAnnotation on every write of a synced
+// destination.
+type ownershipSecretsGetter struct {
+	delegate corev1client.SecretsGetter
+	registry *syncRegistry
+}
+
+func (g *ownershipSecretsGetter) Secrets(namespace string) corev1client.SecretInterface {
+	return &ownershipSecrets{SecretInterface: g.delegate.Secrets(namespace), namespace: namespace, registry: g.registry}
+}
+
+type ownershipSecrets struct {
+	corev1client.SecretInterface
+	namespace string
+	registry  *syncRegistry
+}
+
+func (c *ownershipSecrets) stamp(secret *corev1.Secret) *corev1.Secret {
+	source, ok := c.registry.secretSources[resourcesynccontroller.ResourceLocation{Namespace: c.namespace, Name: secret.Name}]
+	if !ok {
+		return secret
+	}
+	secret = secret.DeepCopy()
+	secret.Annotations = withSyncedFromAnnotation(secret.Annotations, source)
+	return secret
+}
+
+func (c *ownershipSecrets) Create(ctx context.Context, secret *corev1.Secret, opts metav1.CreateOptions) (*corev1.Secret, error) {
+	return c.SecretInterface.Create(ctx, c.stamp(secret), opts)
+}
+
+func (c *ownershipSecrets) Update(ctx context.Context, secret *corev1.Secret, opts metav1.UpdateOptions) (*corev1.Secret, error) {
+	return c.SecretInterface.Update(ctx, c.stamp(secret), opts)
+}
+
+func withSyncedFromAnnotation(annotations map[string]string, source resourcesynccontroller.ResourceLocation) map[string]string {
+	if annotations == nil {
+		annotations = map[string]string{}
+	}
+	annotations[SyncedFromAnnotation] = formatLocation(source)
+	return annotations
+}
+
+// externalOwnerPrecondition is not fulfilled while the existing destination carries the ExternalOwnerAnnotation,
+// otherwise the given precondition decides. The destination is checked first, so a precondition that deletes a stale
+// destination never removes an externally owned one.
+func externalOwnerPrecondition(kind string, secretsGetter corev1client.SecretsGetter, configMapsGetter corev1client.ConfigMapsGetter,
+	destination resourcesynccontroller.ResourceLocation, precondition func() (bool, error)) (bool, error) {
+	var destinationMeta metav1.Object
+	var err error
+	switch kind {
+	case configMapKind:
+		destinationMeta, err = configMapsGetter.ConfigMaps(destination.Namespace).Get(context.Background(), destination.Name, metav1.GetOptions{})
+	case secretKind:
+		destinationMeta, err = secretsGetter.Secrets(destination.Namespace).Get(context.Background(), destination.Name, metav1.GetOptions{})
+	default:
+		return false, fmt.Errorf("unknown kind %s of %s", kind, formatLocation(destination))
+	}
+	if err != nil && !apierrors.IsNotFound(err) {
+		return false, err
+	}
+	if err == nil {
+		if owner := destinationMeta.GetAnnotations()[ExternalOwnerAnnotation]; len(owner) > 0 {
+			klog.V(2).Infof("not syncing %s %s, it is owned by %q", kind, formatLocation(destination), owner)
+			return false, nil
+		}
+	}
+	if precondition == nil {
+		return alwaysFulfilled()
+	}
+	return precondition()
+}
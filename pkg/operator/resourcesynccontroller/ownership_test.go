@@ -0,0 +1,138 @@
+package resourcesynccontroller
+
+import (
+	"context"
+	"testing"
+
+	"github.com/openshift/api/annotations"
+	configv1 "github.com/openshift/api/config/v1"
+	"github.com/openshift/library-go/pkg/operator/events"
+	"github.com/openshift/library-go/pkg/operator/resourcesynccontroller"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+
+	"github.com/openshift/cluster-etcd-operator/pkg/operator/operatorclient"
+	"github.com/openshift/cluster-etcd-operator/pkg/tlshelpers"
+)
+
+func TestSyncedFromAnnotation(t *testing.T) {
+	fakeKubeClient := fake.NewSimpleClientset(
+		&corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{Namespace: operatorclient.TargetNamespace, Name: "etcd-client"},
+			Type:       corev1.SecretTypeTLS,
+			Data:       map[string][]byte{"tls.crt": []byte("cert"), "tls.key": []byte("key")},
+		},
+		&corev1.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{Namespace: operatorclient.TargetNamespace, Name: "etcd-ca-bundle"},
+			Data:       map[string]string{"ca-bundle.crt": "bundle"},
+		},
+		// written by somebody else, it is not synced and keeps its annotations
+		&corev1.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{Namespace: operatorclient.OperatorNamespace, Name: "unrelated"},
+		},
+	)
+
+	syncOnce(t, fakeKubeClient, ResourceSyncControllerOptions{}, newSyncMetrics())
+
+	for _, namespace := range []string{operatorclient.GlobalUserSpecifiedConfigNamespace, operatorclient.OperatorNamespace} {
+		secret, err := fakeKubeClient.CoreV1().Secrets(namespace).Get(context.TODO(), "etcd-client", metav1.GetOptions{})
+		require.NoError(t, err)
+		require.Equal(t, "openshift-etcd/etcd-client", secret.Annotations[SyncedFromAnnotation])
+	}
+	configMap, err := fakeKubeClient.CoreV1().ConfigMaps(operatorclient.GlobalUserSpecifiedConfigNamespace).Get(context.TODO(), "etcd-serving-ca", metav1.GetOptions{})
+	require.NoError(t, err)
+	require.Equal(t, "openshift-etcd/etcd-ca-bundle", configMap.Annotations[SyncedFromAnnotation])
+
+	// the source itself is left alone
+	source, err := fakeKubeClient.CoreV1().Secrets(operatorclient.TargetNamespace).Get(context.TODO(), "etcd-client", metav1.GetOptions{})
+	require.NoError(t, err)
+	require.NotContains(t, source.Annotations, SyncedFromAnnotation)
+	unrelated, err := fakeKubeClient.CoreV1().ConfigMaps(operatorclient.OperatorNamespace).Get(context.TODO(), "unrelated", metav1.GetOptions{})
+	require.NoError(t, err)
+	require.NotContains(t, unrelated.Annotations, SyncedFromAnnotation)
+}
+
+func TestExternalOwnerPrecondition(t *testing.T) {
+	source := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Namespace: operatorclient.TargetNamespace, Name: "etcd-client"},
+		Type:       corev1.SecretTypeTLS,
+		Data:       map[string][]byte{"tls.crt": []byte("cert"), "tls.key": []byte("key")},
+	}
+	userCopy := func(annotations map[string]string) *corev1.Secret {
+		return &corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{Namespace: operatorclient.GlobalUserSpecifiedConfigNamespace, Name: "etcd-client", Annotations: annotations},
+			Type:       corev1.SecretTypeTLS,
+			Data:       map[string][]byte{"tls.crt": []byte("user cert"), "tls.key": []byte("user key")},
+		}
+	}
+
+	tests := map[string]struct {
+		objects      []runtime.Object
+		expectedCert string
+	}{
+		"destination missing": {
+			objects:      []runtime.Object{source},
+			expectedCert: "cert",
+		},
+		"destination not claimed": {
+			objects:      []runtime.Object{source, userCopy(nil)},
+			expectedCert: "cert",
+		},
+		"destination claimed with empty owner": {
+			objects:      []runtime.Object{source, userCopy(map[string]string{ExternalOwnerAnnotation: ""})},
+			expectedCert: "cert",
+		},
+		"destination claimed": {
+			objects:      []runtime.Object{source, userCopy(map[string]string{ExternalOwnerAnnotation: "example-team"})},
+			expectedCert: "user cert",
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			fakeKubeClient := fake.NewSimpleClientset(test.objects...)
+
+			syncOnce(t, fakeKubeClient, ResourceSyncControllerOptions{}, newSyncMetrics())
+
+			destination, err := fakeKubeClient.CoreV1().Secrets(operatorclient.GlobalUserSpecifiedConfigNamespace).Get(context.TODO(), "etcd-client", metav1.GetOptions{})
+			require.NoError(t, err)
+			require.Equal(t, test.expectedCert, string(destination.Data["tls.crt"]))
+
+			// the copy in the operator namespace cannot be claimed
+			operatorCopy, err := fakeKubeClient.CoreV1().Secrets(operatorclient.OperatorNamespace).Get(context.TODO(), "etcd-client", metav1.GetOptions{})
+			require.NoError(t, err)
+			require.Equal(t, "cert", string(operatorCopy.Data["tls.crt"]))
+		})
+	}
+}
+
+func TestExternalOwnerKeepsLegacyMetricsCABundleCopy(t *testing.T) {
+	destination := resourcesynccontroller.ResourceLocation{Namespace: operatorclient.GlobalUserSpecifiedConfigNamespace, Name: "etcd-metric-serving-ca"}
+	fakeKubeClient := fake.NewSimpleClientset(&corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace: destination.Namespace,
+			Name:      destination.Name,
+			Annotations: map[string]string{
+				ExternalOwnerAnnotation:        "example-team",
+				annotations.OpenShiftComponent: tlshelpers.EtcdJiraComponentName,
+			},
+		},
+	})
+
+	var legacySync syncRegistration
+	for _, sync := range syncRegistrations(fakeKubeClient.CoreV1(), fakeKubeClient.CoreV1(), events.NewInMemoryRecorder(t.Name()), RemoveMetricsCABundleBackCopy, configv1.HighlyAvailableTopologyMode, tlshelpers.EtcdJiraComponentName) {
+		if sync.destination == destination {
+			legacySync = sync
+		}
+	}
+	require.NotNil(t, legacySync.precondition)
+
+	fulfilled, err := legacySync.precondition()
+	require.NoError(t, err)
+	require.False(t, fulfilled)
+	_, err = fakeKubeClient.CoreV1().ConfigMaps(destination.Namespace).Get(context.TODO(), destination.Name, metav1.GetOptions{})
+	require.NoError(t, err)
+}
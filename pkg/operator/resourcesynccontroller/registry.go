@@ -0,0 +1,123 @@
+package resourcesynccontroller
+
+import (
+	"context"
+	"fmt"
+	"sort"
+
+	"github.com/openshift/library-go/pkg/operator/resourcesynccontroller"
+	utilerrors "k8s.io/apimachinery/pkg/util/errors"
+	corev1client "k8s.io/client-go/kubernetes/typed/core/v1"
+)
+
+// syncRegistry registers syncs with the library-go resource sync controller and keeps track of the source of every
+// registered destination, which the library-go controller does not expose.
+type syncRegistry struct {
+	controller *resourcesynccontroller.ResourceSyncController
+	metrics    *syncMetrics
+
+	configMapSources map[resourcesynccontroller.ResourceLocation]resourcesynccontroller.ResourceLocation
+	secretSources    map[resourcesynccontroller.ResourceLocation]resourcesynccontroller.ResourceLocation
+}
+
+func newSyncRegistry(metrics *syncMetrics) *syncRegistry {
+	return &syncRegistry{
+		metrics:          metrics,
+		configMapSources: map[resourcesynccontroller.ResourceLocation]resourcesynccontroller.ResourceLocation{},
+		secretSources:    map[resourcesynccontroller.ResourceLocation]resourcesynccontroller.ResourceLocation{},
+	}
+}
+
+func alwaysFulfilled() (bool, error) {
+	return true, nil
+}
+
+func neverFulfilled() (bool, error) {
+	return false, nil
+}
+
+func (r *syncRegistry) SyncConfigMap(destination, source resourcesynccontroller.ResourceLocation) error {
+	return r.SyncConfigMapConditionally(destination, source, alwaysFulfilled)
+}
+
+func (r *syncRegistry) SyncConfigMapConditionally(destination, source resourcesynccontroller.ResourceLocation, precondition func() (bool, error)) error {
+	if err := r.controller.SyncConfigMapConditionally(destination, source, r.metrics.countSkips(configMapKind, destination, source, precondition)); err != nil {
+		return err
+	}
+	r.configMapSources[destination] = source
+	return nil
+}
+
+// SyncConfigMapConditionallyOrDelete is SyncConfigMapConditionally, but additionally deletes the destination while the
+// precondition is not fulfilled, e.g. because the source was removed, instead of leaving a stale copy behind. Only a
+// destination owned by the operator, i.e. carrying the given component annotation, is deleted. This is an explicit
+// opt-in, the other syncs keep the destination.
+func (r *syncRegistry) SyncConfigMapConditionallyOrDelete(destination, source resourcesynccontroller.ResourceLocation, configMapsGetter corev1client.ConfigMapsGetter, jiraComponent string, precondition func() (bool, error)) error {
+	return r.SyncConfigMapConditionally(destination, source, func() (bool, error) {
+		return deleteStaleConfigMapPrecondition(context.Background(), configMapsGetter, destination, jiraComponent, precondition)
+	})
+}
+
+func (r *syncRegistry) SyncSecret(destination, source resourcesynccontroller.ResourceLocation) error {
+	return r.SyncSecretConditionally(destination, source, alwaysFulfilled)
+}
+
+func (r *syncRegistry) SyncSecretConditionally(destination, source resourcesynccontroller.ResourceLocation, precondition func() (bool, error)) error {
+	if err := r.controller.SyncSecretConditionally(destination, source, r.metrics.countSkips(secretKind, destination, source, precondition)); err != nil {
+		return err
+	}
+	r.secretSources[destination] = source
+	return nil
+}
+
+// validate returns an error if a registered sync copies a resource onto itself or if the syncs of a kind form a cycle,
+// e.g. A to B and B to A. library-go would execute both and thrash the resources.
+func (r *syncRegistry) validate() error {
+	var errs []error
+	errs = append(errs, findSyncCycles(configMapKind, r.configMapSources)...)
+	errs = append(errs, findSyncCycles(secretKind, r.secretSources)...)
+	return utilerrors.NewAggregate(errs)
+}
+
+// findSyncCycles follows the sources of every destination and reports each destination that is reached again.
+func findSyncCycles(kind string, sources map[resourcesynccontroller.ResourceLocation]resourcesynccontroller.ResourceLocation) []error {
+	destinations := make([]resourcesynccontroller.ResourceLocation, 0, len(sources))
+	for destination := range sources {
+		destinations = append(destinations, destination)
+	}
+	sort.Slice(destinations, func(i, j int) bool {
+		return formatLocation(destinations[i]) < formatLocation(destinations[j])
+	})
+
+	var errs []error
+	for _, destination := range destinations {
+		if sources[destination] == destination {
+			errs = append(errs, fmt.Errorf("%s %s is synced from itself", kind, formatLocation(destination)))
+			continue
+		}
+
+		path := []string{formatLocation(destination)}
+		visited := map[resourcesynccontroller.ResourceLocation]bool{destination: true}
+		for current := destination; ; {
+			source, ok := sources[current]
+			if !ok {
+				break
+			}
+			path = append(path, formatLocation(source))
+			if source == destination {
+				errs = append(errs, fmt.Errorf("%s syncs form a cycle: %v", kind, path))
+				break
+			}
+			if visited[source] {
+				break
+			}
+			visited[source] = true
+			current = source
+		}
+	}
+	return errs
+}
+
+func formatLocation(location resourcesynccontroller.ResourceLocation) string {
+	return location.Namespace + "/" + location.Name
+}
@@ -0,0 +1,187 @@
+package resourcesynccontroller
+
+import (
+	"context"
+	"testing"
+
+	"github.com/openshift/api/annotations"
+	operatorv1 "github.com/openshift/api/operator/v1"
+	"github.com/openshift/library-go/pkg/controller/factory"
+	"github.com/openshift/library-go/pkg/operator/events"
+	"github.com/openshift/library-go/pkg/operator/resourcesynccontroller"
+	"github.com/openshift/library-go/pkg/operator/v1helpers"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+
+	"github.com/openshift/cluster-etcd-operator/pkg/operator/operatorclient"
+)
+
+func TestSyncRegistryValidate(t *testing.T) {
+	caBundle := resourcesynccontroller.ResourceLocation{Namespace: operatorclient.TargetNamespace, Name: "etcd-ca-bundle"}
+	servingCA := resourcesynccontroller.ResourceLocation{Namespace: operatorclient.GlobalUserSpecifiedConfigNamespace, Name: "etcd-serving-ca"}
+	operatorCABundle := resourcesynccontroller.ResourceLocation{Namespace: operatorclient.OperatorNamespace, Name: "etcd-ca-bundle"}
+	client := resourcesynccontroller.ResourceLocation{Namespace: operatorclient.TargetNamespace, Name: "etcd-client"}
+
+	tests := map[string]struct {
+		register    func(r *syncRegistry) error
+		expectedErr string
+	}{
+		"chain": {
+			register: func(r *syncRegistry) error {
+				if err := r.SyncConfigMap(servingCA, caBundle); err != nil {
+					return err
+				}
+				return r.SyncConfigMap(operatorCABundle, servingCA)
+			},
+		},
+		"removal": {
+			register: func(r *syncRegistry) error {
+				return r.SyncSecret(client, resourcesynccontroller.ResourceLocation{})
+			},
+		},
+		"self-referential configmap": {
+			register: func(r *syncRegistry) error {
+				return r.SyncConfigMap(caBundle, caBundle)
+			},
+			expectedErr: "configmap openshift-etcd/etcd-ca-bundle is synced from itself",
+		},
+		"self-referential secret": {
+			register: func(r *syncRegistry) error {
+				return r.SyncSecret(client, client)
+			},
+			expectedErr: "secret openshift-etcd/etcd-client is synced from itself",
+		},
+		"cycle": {
+			register: func(r *syncRegistry) error {
+				if err := r.SyncConfigMap(servingCA, caBundle); err != nil {
+					return err
+				}
+				return r.SyncConfigMapConditionally(caBundle, servingCA, alwaysFulfilled)
+			},
+			expectedErr: "[configmap syncs form a cycle: [openshift-config/etcd-serving-ca openshift-etcd/etcd-ca-bundle openshift-config/etcd-serving-ca], " +
+				"configmap syncs form a cycle: [openshift-etcd/etcd-ca-bundle openshift-config/etcd-serving-ca openshift-etcd/etcd-ca-bundle]]",
+		},
+		"same location as configmap and secret": {
+			register: func(r *syncRegistry) error {
+				if err := r.SyncConfigMap(servingCA, caBundle); err != nil {
+					return err
+				}
+				return r.SyncSecret(caBundle, servingCA)
+			},
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			fakeKubeClient := fake.NewSimpleClientset()
+			kubeInformersForNamespaces := v1helpers.NewKubeInformersForNamespaces(fakeKubeClient,
+				operatorclient.GlobalUserSpecifiedConfigNamespace,
+				operatorclient.TargetNamespace,
+				operatorclient.OperatorNamespace,
+			)
+			registry := newSyncRegistry(newSyncMetrics())
+			registry.controller = resourcesynccontroller.NewResourceSyncController(
+				v1helpers.NewFakeOperatorClient(nil, nil, nil),
+				kubeInformersForNamespaces,
+				fakeKubeClient.CoreV1(),
+				fakeKubeClient.CoreV1(),
+				events.NewInMemoryRecorder(t.Name()),
+			)
+
+			require.NoError(t, test.register(registry))
+			err := registry.validate()
+			if len(test.expectedErr) > 0 {
+				require.EqualError(t, err, test.expectedErr)
+				return
+			}
+			require.NoError(t, err)
+		})
+	}
+}
+
+func TestSyncConfigMapConditionallyOrDelete(t *testing.T) {
+	caBundle := resourcesynccontroller.ResourceLocation{Namespace: operatorclient.TargetNamespace, Name: "etcd-ca-bundle"}
+	servingCA := resourcesynccontroller.ResourceLocation{Namespace: operatorclient.GlobalUserSpecifiedConfigNamespace, Name: "etcd-serving-ca"}
+	configMap := func(loc resourcesynccontroller.ResourceLocation, owner, bundle string) *corev1.ConfigMap {
+		cm := &corev1.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{Namespace: loc.Namespace, Name: loc.Name},
+			Data:       map[string]string{"ca-bundle.crt": bundle},
+		}
+		if len(owner) > 0 {
+			cm.Annotations = map[string]string{annotations.OpenShiftComponent: owner}
+		}
+		return cm
+	}
+
+	tests := map[string]struct {
+		objects        []runtime.Object
+		deleteStale    bool
+		expectedBundle string
+	}{
+		"source present": {
+			objects:        []runtime.Object{configMap(caBundle, "etcd", "new bundle"), configMap(servingCA, "etcd", "stale bundle")},
+			deleteStale:    true,
+			expectedBundle: "new bundle",
+		},
+		"source absent with delete": {
+			objects:     []runtime.Object{configMap(servingCA, "etcd", "stale bundle")},
+			deleteStale: true,
+		},
+		"source absent with delete keeps destination not owned by the operator": {
+			objects:        []runtime.Object{configMap(servingCA, "kube-apiserver", "foreign bundle")},
+			deleteStale:    true,
+			expectedBundle: "foreign bundle",
+		},
+		"source absent without delete": {
+			objects:        []runtime.Object{configMap(servingCA, "etcd", "stale bundle")},
+			expectedBundle: "stale bundle",
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			fakeKubeClient := fake.NewSimpleClientset(test.objects...)
+			kubeInformersForNamespaces := v1helpers.NewKubeInformersForNamespaces(fakeKubeClient,
+				operatorclient.GlobalUserSpecifiedConfigNamespace,
+				operatorclient.TargetNamespace,
+			)
+			recorder := events.NewInMemoryRecorder(t.Name())
+			registry := newSyncRegistry(newSyncMetrics())
+			registry.controller = resourcesynccontroller.NewResourceSyncController(
+				v1helpers.NewFakeOperatorClient(&operatorv1.OperatorSpec{ManagementState: operatorv1.Managed}, &operatorv1.OperatorStatus{}, nil),
+				kubeInformersForNamespaces,
+				fakeKubeClient.CoreV1(),
+				fakeKubeClient.CoreV1(),
+				recorder,
+			)
+			precondition := func() (bool, error) {
+				return configMapExistsPrecondition(fakeKubeClient.CoreV1(), caBundle)
+			}
+			if test.deleteStale {
+				require.NoError(t, registry.SyncConfigMapConditionallyOrDelete(servingCA, caBundle, fakeKubeClient.CoreV1(), "etcd", precondition))
+			} else {
+				require.NoError(t, registry.SyncConfigMapConditionally(servingCA, caBundle, precondition))
+			}
+
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			kubeInformersForNamespaces.Start(ctx.Done())
+			for _, namespace := range kubeInformersForNamespaces.Namespaces().List() {
+				kubeInformersForNamespaces.InformersFor(namespace).WaitForCacheSync(ctx.Done())
+			}
+			require.NoError(t, registry.controller.Sync(ctx, factory.NewSyncContext("test", recorder)))
+
+			destination, err := fakeKubeClient.CoreV1().ConfigMaps(servingCA.Namespace).Get(ctx, servingCA.Name, metav1.GetOptions{})
+			if len(test.expectedBundle) == 0 {
+				require.True(t, apierrors.IsNotFound(err))
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, test.expectedBundle, destination.Data["ca-bundle.crt"])
+		})
+	}
+}
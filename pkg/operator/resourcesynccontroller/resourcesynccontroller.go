@@ -2,26 +2,148 @@ package resourcesynccontroller
 
 import (
 	"context"
+	"fmt"
+	"reflect"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
 	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/client-go/kubernetes"
 	corev1client "k8s.io/client-go/kubernetes/typed/core/v1"
+	"k8s.io/klog/v2"
 
+	"github.com/openshift/api/annotations"
+	configv1 "github.com/openshift/api/config/v1"
+	operatorv1 "github.com/openshift/api/operator/v1"
 	"github.com/openshift/library-go/pkg/operator/events"
 	"github.com/openshift/library-go/pkg/operator/resourcesynccontroller"
 	"github.com/openshift/library-go/pkg/operator/v1helpers"
 
+	"github.com/openshift/cluster-etcd-operator/pkg/operator/ceohelpers"
 	"github.com/openshift/cluster-etcd-operator/pkg/operator/operatorclient"
+	"github.com/openshift/cluster-etcd-operator/pkg/tlshelpers"
 )
 
+// ResourceSyncControllerOptions are the options of NewResourceSyncControllerWithOptions, the zero value selects the
+// behavior of NewResourceSyncController. The operator reads them from the resourceSync key of the
+// unsupportedConfigOverrides, see OptionsFromUnsupportedConfigOverrides.
+type ResourceSyncControllerOptions struct {
+	// DryRun logs every copy or removal the controller would perform on a destination together with its source and
+	// reports it as event, but does not write it.
+	DryRun bool `json:"dryRun,omitempty"`
+	// MetricsCABundleBackCopy selects how the legacy copy of the metrics ca-bundle in openshift-config is handled, it
+	// is maintained by default. The copies within openshift-etcd and the one in the operator namespace, which the etcd
+	// ServiceMonitors read, are always kept.
+	MetricsCABundleBackCopy MetricsCABundleBackCopy `json:"metricsCABundleBackCopy,omitempty"`
+	// AllCertsBackupNamespace mirrors the etcd-all-certs secret, which holds the cert material of all nodes, into the
+	// given namespace once it is populated, e.g. to snapshot the etcd PKI for disaster recovery. The namespace must be
+	// watched by the kubeInformersForNamespaces. Access to it must be restricted like to the target namespace.
+	AllCertsBackupNamespace string `json:"allCertsBackupNamespace,omitempty"`
+	// Topology selects the syncs: with configv1.ExternalTopologyMode, i.e. a hosted control plane, the syncs into
+	// kube-system and openshift-config are not registered. Every other topology gets the standard set of syncs.
+	Topology configv1.TopologyMode `json:"-"`
+	// SyncToggles switches individual syncs on or off, e.g. for support to isolate a problem with a single copy. It is
+	// keyed by the ID of a sync, <kind>/<namespace>/<name> of its destination like
+	// configmap/openshift-config/etcd-serving-ca. Syncs set to false are not registered, their destinations are left as
+	// they are. Syncs missing in the map are enabled, a nil map enables all of them. Unknown IDs are rejected.
+	SyncToggles map[string]bool `json:"syncToggles,omitempty"`
+	// JiraComponent is the component annotation of the copies owned by the operator, it must match the
+	// tlshelpers.WithJiraComponent the certs and bundles are created with. Stale copies carrying another component are
+	// not deleted. Defaults to tlshelpers.EtcdJiraComponentName.
+	JiraComponent string `json:"-"`
+}
+
+// jiraComponentName returns the component annotation of the copies owned by the operator.
+func (o ResourceSyncControllerOptions) jiraComponentName() string {
+	if len(o.JiraComponent) > 0 {
+		return o.JiraComponent
+	}
+	return tlshelpers.EtcdJiraComponentName
+}
+
+// MetricsCABundleBackCopy is the handling of the legacy copy of the metrics ca-bundle in openshift-config. It is only
+// kept for the transition period until all consumers read the metrics ca-bundle from openshift-etcd.
+type MetricsCABundleBackCopy string
+
+const (
+	// MaintainMetricsCABundleBackCopy keeps the copy up to date.
+	MaintainMetricsCABundleBackCopy MetricsCABundleBackCopy = ""
+	// SkipMetricsCABundleBackCopy stops maintaining the copy, the destination is left as it is.
+	SkipMetricsCABundleBackCopy MetricsCABundleBackCopy = "Skip"
+	// RemoveMetricsCABundleBackCopy stops maintaining the copy and deletes the stale destination if it is owned by the operator.
+	RemoveMetricsCABundleBackCopy MetricsCABundleBackCopy = "Remove"
+)
+
+// resourceSyncOverride is the unsupportedConfigOverrides key that holds the ResourceSyncControllerOptions.
+const resourceSyncOverride = "resourceSync"
+
+// OptionsFromUnsupportedConfigOverrides returns the ResourceSyncControllerOptions set in the resourceSync key of the
+// unsupportedConfigOverrides of the given spec, e.g. resourceSync: {dryRun: true}. The topology is not read from
+// there. The syncs are registered once, so changes only take effect on the next start of the operator.
+func OptionsFromUnsupportedConfigOverrides(spec *operatorv1.OperatorSpec) (ResourceSyncControllerOptions, error) {
+	options := ResourceSyncControllerOptions{}
+	if _, err := ceohelpers.ReadUnsupportedOverride(spec, resourceSyncOverride, &options); err != nil {
+		return ResourceSyncControllerOptions{}, fmt.Errorf("failed to read %s from unsupportedConfigOverrides: %w", resourceSyncOverride, err)
+	}
+	return options, nil
+}
+
 func NewResourceSyncController(
 	operatorConfigClient v1helpers.OperatorClient,
 	kubeInformersForNamespaces v1helpers.KubeInformersForNamespaces,
 	kubeClient kubernetes.Interface,
 	eventRecorder events.Recorder) (*resourcesynccontroller.ResourceSyncController, error) {
+	return NewResourceSyncControllerWithOptions(operatorConfigClient, kubeInformersForNamespaces, kubeClient, eventRecorder, ResourceSyncControllerOptions{})
+}
 
-	secretClient := v1helpers.CachedSecretGetter(kubeClient.CoreV1(), kubeInformersForNamespaces)
-	configMapClient := v1helpers.CachedConfigMapGetter(kubeClient.CoreV1(), kubeInformersForNamespaces)
+// NewResourceSyncControllerWithOptions is NewResourceSyncController with the given options.
+func NewResourceSyncControllerWithOptions(
+	operatorConfigClient v1helpers.OperatorClient,
+	kubeInformersForNamespaces v1helpers.KubeInformersForNamespaces,
+	kubeClient kubernetes.Interface,
+	eventRecorder events.Recorder,
+	options ResourceSyncControllerOptions) (*resourcesynccontroller.ResourceSyncController, error) {
+	return newResourceSyncController(operatorConfigClient, kubeInformersForNamespaces, kubeClient, eventRecorder, options, resourceSyncMetrics)
+}
+
+func newResourceSyncController(
+	operatorConfigClient v1helpers.OperatorClient,
+	kubeInformersForNamespaces v1helpers.KubeInformersForNamespaces,
+	kubeClient kubernetes.Interface,
+	eventRecorder events.Recorder,
+	options ResourceSyncControllerOptions,
+	metrics *syncMetrics) (*resourcesynccontroller.ResourceSyncController, error) {
+
+	switch options.MetricsCABundleBackCopy {
+	case MaintainMetricsCABundleBackCopy, SkipMetricsCABundleBackCopy, RemoveMetricsCABundleBackCopy:
+	default:
+		return nil, fmt.Errorf("unknown metrics ca-bundle back-copy handling %q, must be one of %q, %q or %q", options.MetricsCABundleBackCopy,
+			MaintainMetricsCABundleBackCopy, SkipMetricsCABundleBackCopy, RemoveMetricsCABundleBackCopy)
+	}
+	if err := validateSyncToggles(options.SyncToggles); err != nil {
+		return nil, err
+	}
+
+	registry := newSyncRegistry(metrics)
+	var secretClient corev1client.SecretsGetter = &ownershipSecretsGetter{
+		delegate: &metricsSecretsGetter{
+			delegate: v1helpers.CachedSecretGetter(kubeClient.CoreV1(), kubeInformersForNamespaces),
+			registry: registry,
+		},
+		registry: registry,
+	}
+	var configMapClient corev1client.ConfigMapsGetter = &ownershipConfigMapsGetter{
+		delegate: &metricsConfigMapsGetter{
+			delegate: v1helpers.CachedConfigMapGetter(kubeClient.CoreV1(), kubeInformersForNamespaces),
+			registry: registry,
+		},
+		registry: registry,
+	}
+	if options.DryRun {
+		secretClient = &dryRunSecretsGetter{delegate: secretClient, recorder: eventRecorder, registry: registry}
+		configMapClient = &dryRunConfigMapsGetter{delegate: configMapClient, recorder: eventRecorder, registry: registry}
+	}
 
 	resourceSyncController := resourcesynccontroller.NewResourceSyncController(
 		operatorConfigClient,
@@ -30,120 +152,159 @@ func NewResourceSyncController(
 		configMapClient,
 		eventRecorder,
 	)
+	registry.controller = resourceSyncController
 
-	if err := resourceSyncController.SyncConfigMap(
-		resourcesynccontroller.ResourceLocation{Namespace: operatorclient.TargetNamespace, Name: "cluster-config-v1"},
-		resourcesynccontroller.ResourceLocation{Namespace: operatorclient.KubeSystemNamespace, Name: "cluster-config-v1"},
-	); err != nil {
-		return nil, err
+	var registered []syncRegistration
+	for _, sync := range syncRegistrations(secretClient, configMapClient, eventRecorder, options.MetricsCABundleBackCopy, options.Topology, options.jiraComponentName()) {
+		if enabled, ok := options.SyncToggles[sync.ID()]; ok && !enabled {
+			klog.Infof("not registering disabled sync %s", sync)
+			continue
+		}
+		if err := sync.register(registry); err != nil {
+			return nil, fmt.Errorf("could not register %s: %w", sync, err)
+		}
+		registered = append(registered, sync)
 	}
 
-	// serving ca
-	caBundleExistsFunc := func() (bool, error) {
-		return configMapExistsPrecondition(configMapClient, resourcesynccontroller.ResourceLocation{Namespace: operatorclient.TargetNamespace, Name: "etcd-ca-bundle"})
-	}
-	if err := resourceSyncController.SyncConfigMapConditionally(
-		resourcesynccontroller.ResourceLocation{Namespace: operatorclient.OperatorNamespace, Name: "etcd-ca-bundle"},
-		resourcesynccontroller.ResourceLocation{Namespace: operatorclient.TargetNamespace, Name: "etcd-ca-bundle"},
-		caBundleExistsFunc,
-	); err != nil {
-		return nil, err
+	// all certs backup
+	if len(options.AllCertsBackupNamespace) > 0 {
+		allCerts := resourcesynccontroller.ResourceLocation{Namespace: operatorclient.TargetNamespace, Name: tlshelpers.EtcdAllCertsSecretName}
+		if err := registry.SyncSecretConditionally(
+			resourcesynccontroller.ResourceLocation{Namespace: options.AllCertsBackupNamespace, Name: tlshelpers.EtcdAllCertsSecretName},
+			allCerts,
+			func() (bool, error) {
+				return secretExistsPrecondition(secretClient, allCerts)
+			},
+		); err != nil {
+			return nil, fmt.Errorf("could not back up %s to namespace %q: %w", tlshelpers.EtcdAllCertsSecretName, options.AllCertsBackupNamespace, err)
+		}
 	}
 
-	if err := resourceSyncController.SyncConfigMapConditionally(
-		resourcesynccontroller.ResourceLocation{Namespace: operatorclient.TargetNamespace, Name: "etcd-peer-client-ca"},
-		resourcesynccontroller.ResourceLocation{Namespace: operatorclient.TargetNamespace, Name: "etcd-ca-bundle"},
-		caBundleExistsFunc,
-	); err != nil {
-		return nil, err
+	if err := registry.validate(); err != nil {
+		return nil, fmt.Errorf("invalid resource sync registrations: %w", err)
 	}
 
-	// "etcd-serving-ca" is replaced by the "etcd-ca-bundle"
-	if err := resourceSyncController.SyncConfigMapConditionally(
-		resourcesynccontroller.ResourceLocation{Namespace: operatorclient.TargetNamespace, Name: "etcd-serving-ca"},
-		resourcesynccontroller.ResourceLocation{Namespace: operatorclient.TargetNamespace, Name: "etcd-ca-bundle"},
-		caBundleExistsFunc,
-	); err != nil {
-		return nil, err
-	}
+	// the informers are not started yet, so look the sources up live
+	logMissingSyncSources(context.Background(), kubeClient.CoreV1(), kubeClient.CoreV1(), registered)
 
-	if err := resourceSyncController.SyncConfigMapConditionally(
-		resourcesynccontroller.ResourceLocation{Namespace: operatorclient.GlobalUserSpecifiedConfigNamespace, Name: "etcd-serving-ca"},
-		resourcesynccontroller.ResourceLocation{Namespace: operatorclient.TargetNamespace, Name: "etcd-ca-bundle"},
-		caBundleExistsFunc,
-	); err != nil {
-		return nil, err
+	return resourceSyncController, nil
+}
+
+// configMapExistsPrecondition will check whether the given resourcesynccontroller.ResourceLocation already exists.
+// This is to ensure that the destination is not removed in case we're switching locations, or they are accidentally deleted.
+func configMapExistsPrecondition(configMapsGetter corev1client.ConfigMapsGetter, loc resourcesynccontroller.ResourceLocation) (bool, error) {
+	_, err := configMapsGetter.ConfigMaps(loc.Namespace).Get(context.Background(), loc.Name, metav1.GetOptions{})
+	if err != nil {
+		if apierrors.IsNotFound(err) {
+			return false, nil
+		}
+		return false, err
 	}
+	return true, nil
+}
 
-	// metrics serving
-	metricsBundleExistsFunc := func() (bool, error) {
-		return configMapExistsPrecondition(configMapClient, resourcesynccontroller.ResourceLocation{Namespace: operatorclient.TargetNamespace, Name: "etcd-metrics-ca-bundle"})
+// configMapDiffersPrecondition is fulfilled unless the destination already holds the same data as the source. The sync
+// also copies the labels and annotations of the source, so an external actor touching only the metadata of the source
+// would otherwise cause a write of the destination every time. A missing source or destination is always synced, so
+// deletions and creations of the source still converge.
+func configMapDiffersPrecondition(configMapsGetter corev1client.ConfigMapsGetter, destination, source resourcesynccontroller.ResourceLocation) (bool, error) {
+	sourceConfigMap, err := configMapsGetter.ConfigMaps(source.Namespace).Get(context.Background(), source.Name, metav1.GetOptions{})
+	if err != nil {
+		if apierrors.IsNotFound(err) {
+			return true, nil
+		}
+		return false, err
 	}
-	// TODO(thomas): copying the metrics ca-bundle back to openshift-config should not be necessary anymore
-	// this buys us some more transition time, but the source of truth stays in openshift-etcd
-	if err := resourceSyncController.SyncConfigMapConditionally(
-		resourcesynccontroller.ResourceLocation{Namespace: operatorclient.GlobalUserSpecifiedConfigNamespace, Name: "etcd-metric-serving-ca"},
-		resourcesynccontroller.ResourceLocation{Namespace: operatorclient.TargetNamespace, Name: "etcd-metrics-ca-bundle"},
-		metricsBundleExistsFunc,
-	); err != nil {
-		return nil, err
+	destinationConfigMap, err := configMapsGetter.ConfigMaps(destination.Namespace).Get(context.Background(), destination.Name, metav1.GetOptions{})
+	if err != nil {
+		if apierrors.IsNotFound(err) {
+			return true, nil
+		}
+		return false, err
 	}
-	if err := resourceSyncController.SyncConfigMapConditionally(
-		resourcesynccontroller.ResourceLocation{Namespace: operatorclient.TargetNamespace, Name: "etcd-metrics-proxy-client-ca"},
-		resourcesynccontroller.ResourceLocation{Namespace: operatorclient.TargetNamespace, Name: "etcd-metrics-ca-bundle"},
-		metricsBundleExistsFunc,
-	); err != nil {
-		return nil, err
+	return !configMapDataEqual(sourceConfigMap, destinationConfigMap), nil
+}
+
+func configMapDataEqual(a, b *corev1.ConfigMap) bool {
+	dataEqual := (len(a.Data) == 0 && len(b.Data) == 0) || reflect.DeepEqual(a.Data, b.Data)
+	binaryDataEqual := (len(a.BinaryData) == 0 && len(b.BinaryData) == 0) || reflect.DeepEqual(a.BinaryData, b.BinaryData)
+	return dataEqual && binaryDataEqual
+}
+
+// secretExistsPrecondition will check whether the given resourcesynccontroller.ResourceLocation already exists and is
+// populated. This is to ensure that the destination is not written with an empty secret while the source is being
+// created, or removed in case the source is accidentally deleted.
+func secretExistsPrecondition(secretsGetter corev1client.SecretsGetter, loc resourcesynccontroller.ResourceLocation) (bool, error) {
+	secret, err := secretsGetter.Secrets(loc.Namespace).Get(context.Background(), loc.Name, metav1.GetOptions{})
+	if err != nil {
+		if apierrors.IsNotFound(err) {
+			return false, nil
+		}
+		return false, err
 	}
-	if err := resourceSyncController.SyncConfigMapConditionally(
-		resourcesynccontroller.ResourceLocation{Namespace: operatorclient.OperatorNamespace, Name: "etcd-metric-serving-ca"},
-		resourcesynccontroller.ResourceLocation{Namespace: operatorclient.TargetNamespace, Name: "etcd-metrics-ca-bundle"},
-		metricsBundleExistsFunc,
-	); err != nil {
-		return nil, err
+	return secretPopulated(secret), nil
+}
+
+func secretPopulated(secret *corev1.Secret) bool {
+	if len(secret.Data) == 0 {
+		return false
 	}
-	if err := resourceSyncController.SyncConfigMapConditionally(
-		resourcesynccontroller.ResourceLocation{Namespace: operatorclient.TargetNamespace, Name: "etcd-metrics-proxy-serving-ca"},
-		resourcesynccontroller.ResourceLocation{Namespace: operatorclient.TargetNamespace, Name: "etcd-metrics-ca-bundle"},
-		metricsBundleExistsFunc,
-	); err != nil {
-		return nil, err
+	for _, value := range secret.Data {
+		if len(value) == 0 {
+			return false
+		}
 	}
+	return true
+}
 
-	// client certs
-	if err := resourceSyncController.SyncSecret(
-		resourcesynccontroller.ResourceLocation{Namespace: operatorclient.OperatorNamespace, Name: "etcd-metric-client"},
-		resourcesynccontroller.ResourceLocation{Namespace: operatorclient.TargetNamespace, Name: "etcd-metric-client"},
-	); err != nil {
-		return nil, err
+// secretKeysPrecondition extends secretExistsPrecondition, it is only fulfilled if the source also holds all the given
+// keys. A source that exists but lacks any of them, e.g. a client cert secret truncated to its tls.crt, is never
+// propagated, the sync is skipped with a warning event instead.
+func secretKeysPrecondition(secretsGetter corev1client.SecretsGetter, recorder events.Recorder, loc resourcesynccontroller.ResourceLocation, keys ...string) (bool, error) {
+	secret, err := secretsGetter.Secrets(loc.Namespace).Get(context.Background(), loc.Name, metav1.GetOptions{})
+	if err != nil {
+		if apierrors.IsNotFound(err) {
+			return false, nil
+		}
+		return false, err
 	}
-
-	if err := resourceSyncController.SyncSecret(
-		resourcesynccontroller.ResourceLocation{Namespace: operatorclient.OperatorNamespace, Name: "etcd-client"},
-		resourcesynccontroller.ResourceLocation{Namespace: operatorclient.TargetNamespace, Name: "etcd-client"},
-	); err != nil {
-		return nil, err
+	var missing []string
+	for _, key := range keys {
+		if len(secret.Data[key]) == 0 {
+			missing = append(missing, key)
+		}
 	}
-
-	if err := resourceSyncController.SyncSecret(
-		resourcesynccontroller.ResourceLocation{Namespace: operatorclient.GlobalUserSpecifiedConfigNamespace, Name: "etcd-client"},
-		resourcesynccontroller.ResourceLocation{Namespace: operatorclient.TargetNamespace, Name: "etcd-client"},
-	); err != nil {
-		return nil, err
+	if len(missing) > 0 {
+		recorder.Warningf("SecretSyncSkipped", "not syncing secret %s, it lacks the keys %s", formatLocation(loc), strings.Join(missing, ", "))
+		return false, nil
 	}
-
-	return resourceSyncController, nil
+	return secretPopulated(secret), nil
 }
 
-// configMapExistsPrecondition will check whether the given resourcesynccontroller.ResourceLocation already exists.
-// This is to ensure that the destination is not removed in case we're switching locations, or they are accidentally deleted.
-func configMapExistsPrecondition(configMapsGetter corev1client.ConfigMapsGetter, loc resourcesynccontroller.ResourceLocation) (bool, error) {
-	_, err := configMapsGetter.ConfigMaps(loc.Namespace).Get(context.Background(), loc.Name, metav1.GetOptions{})
+// deleteStaleConfigMapPrecondition returns the given precondition. While it is not fulfilled, the destination is
+// deleted if it is owned by the operator, i.e. carries the given component annotation. A destination created or taken
+// over by somebody else is left alone.
+func deleteStaleConfigMapPrecondition(ctx context.Context, configMapsGetter corev1client.ConfigMapsGetter,
+	destination resourcesynccontroller.ResourceLocation, jiraComponent string, precondition func() (bool, error)) (bool, error) {
+	fulfilled, err := precondition()
+	if err != nil || fulfilled {
+		return fulfilled, err
+	}
+
+	configMap, err := configMapsGetter.ConfigMaps(destination.Namespace).Get(ctx, destination.Name, metav1.GetOptions{})
 	if err != nil {
 		if apierrors.IsNotFound(err) {
 			return false, nil
 		}
 		return false, err
 	}
-	return true, nil
+	if configMap.Annotations[annotations.OpenShiftComponent] != jiraComponent {
+		klog.V(2).Infof("not deleting stale configmap %s/%s, it is not owned by %s", destination.Namespace, destination.Name, jiraComponent)
+		return false, nil
+	}
+	err = configMapsGetter.ConfigMaps(destination.Namespace).Delete(ctx, destination.Name, metav1.DeleteOptions{})
+	if err != nil && !apierrors.IsNotFound(err) {
+		return false, err
+	}
+	return false, nil
 }
@@ -0,0 +1,653 @@
+package resourcesynccontroller
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/openshift/api/annotations"
+	operatorv1 "github.com/openshift/api/operator/v1"
+	"github.com/openshift/library-go/pkg/controller/factory"
+	"github.com/openshift/library-go/pkg/operator/events"
+	"github.com/openshift/library-go/pkg/operator/resourcesynccontroller"
+	"github.com/openshift/library-go/pkg/operator/v1helpers"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+	clienttesting "k8s.io/client-go/testing"
+
+	"github.com/openshift/cluster-etcd-operator/pkg/operator/operatorclient"
+	"github.com/openshift/cluster-etcd-operator/pkg/tlshelpers"
+)
+
+func TestMetricsCABundleBackCopy(t *testing.T) {
+	legacyCopy := resourcesynccontroller.ResourceLocation{Namespace: operatorclient.GlobalUserSpecifiedConfigNamespace, Name: "etcd-metric-serving-ca"}
+	operatorCopy := resourcesynccontroller.ResourceLocation{Namespace: operatorclient.OperatorNamespace, Name: "etcd-metric-serving-ca"}
+	staleCopy := func(loc resourcesynccontroller.ResourceLocation, owner string) *corev1.ConfigMap {
+		configMap := &corev1.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{Namespace: loc.Namespace, Name: loc.Name},
+			Data:       map[string]string{"ca-bundle.crt": "stale bundle"},
+		}
+		if len(owner) > 0 {
+			configMap.Annotations = map[string]string{annotations.OpenShiftComponent: owner}
+		}
+		return configMap
+	}
+
+	tests := map[string]struct {
+		backCopy        MetricsCABundleBackCopy
+		jiraComponent   string
+		copies          []runtime.Object
+		expectedData    map[resourcesynccontroller.ResourceLocation]string
+		expectedDeletes int
+	}{
+		"maintained by default": {
+			copies: []runtime.Object{staleCopy(legacyCopy, tlshelpers.EtcdJiraComponentName), staleCopy(operatorCopy, tlshelpers.EtcdJiraComponentName)},
+			expectedData: map[resourcesynccontroller.ResourceLocation]string{
+				legacyCopy:   "new bundle",
+				operatorCopy: "new bundle",
+			},
+		},
+		"skipped copy is left as it is": {
+			backCopy: SkipMetricsCABundleBackCopy,
+			copies:   []runtime.Object{staleCopy(legacyCopy, tlshelpers.EtcdJiraComponentName), staleCopy(operatorCopy, tlshelpers.EtcdJiraComponentName)},
+			expectedData: map[resourcesynccontroller.ResourceLocation]string{
+				legacyCopy:   "stale bundle",
+				operatorCopy: "new bundle",
+			},
+		},
+		"removed copy owned by the operator is deleted": {
+			backCopy: RemoveMetricsCABundleBackCopy,
+			copies:   []runtime.Object{staleCopy(legacyCopy, tlshelpers.EtcdJiraComponentName), staleCopy(operatorCopy, tlshelpers.EtcdJiraComponentName)},
+			// the ServiceMonitors read the copy in the operator namespace
+			expectedData: map[resourcesynccontroller.ResourceLocation]string{
+				operatorCopy: "new bundle",
+			},
+			expectedDeletes: 1,
+		},
+		"removed copy owned by somebody else is kept": {
+			backCopy: RemoveMetricsCABundleBackCopy,
+			copies:   []runtime.Object{staleCopy(legacyCopy, "some-other-component"), staleCopy(operatorCopy, "")},
+			expectedData: map[resourcesynccontroller.ResourceLocation]string{
+				legacyCopy:   "stale bundle",
+				operatorCopy: "new bundle",
+			},
+		},
+		"removed copy owned by the configured component is deleted": {
+			backCopy:      RemoveMetricsCABundleBackCopy,
+			jiraComponent: "acme-etcd",
+			copies:        []runtime.Object{staleCopy(legacyCopy, "acme-etcd"), staleCopy(operatorCopy, "acme-etcd")},
+			expectedData: map[resourcesynccontroller.ResourceLocation]string{
+				operatorCopy: "new bundle",
+			},
+			expectedDeletes: 1,
+		},
+		"removed copy owned by the default component is kept with a configured component": {
+			backCopy:      RemoveMetricsCABundleBackCopy,
+			jiraComponent: "acme-etcd",
+			copies:        []runtime.Object{staleCopy(legacyCopy, tlshelpers.EtcdJiraComponentName), staleCopy(operatorCopy, "acme-etcd")},
+			expectedData: map[resourcesynccontroller.ResourceLocation]string{
+				legacyCopy:   "stale bundle",
+				operatorCopy: "new bundle",
+			},
+		},
+		"removed copy that is gone is not deleted again": {
+			backCopy: RemoveMetricsCABundleBackCopy,
+			expectedData: map[resourcesynccontroller.ResourceLocation]string{
+				operatorCopy: "new bundle",
+			},
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			fakeKubeClient := fake.NewSimpleClientset(append(test.copies, &corev1.ConfigMap{
+				ObjectMeta: metav1.ObjectMeta{Namespace: operatorclient.TargetNamespace, Name: "etcd-metrics-ca-bundle"},
+				Data:       map[string]string{"ca-bundle.crt": "new bundle"},
+			})...)
+
+			syncOnce(t, fakeKubeClient, ResourceSyncControllerOptions{MetricsCABundleBackCopy: test.backCopy, JiraComponent: test.jiraComponent}, newSyncMetrics())
+
+			// the copies are looked up in the cache, deletes are only sent for existing copies
+			var deletes int
+			for _, action := range fakeKubeClient.Actions() {
+				if action.GetVerb() == "delete" {
+					deletes++
+				}
+			}
+			require.Equal(t, test.expectedDeletes, deletes)
+			for _, loc := range []resourcesynccontroller.ResourceLocation{legacyCopy, operatorCopy} {
+				configMap, err := fakeKubeClient.CoreV1().ConfigMaps(loc.Namespace).Get(context.TODO(), loc.Name, metav1.GetOptions{})
+				expected, ok := test.expectedData[loc]
+				if !ok {
+					require.True(t, apierrors.IsNotFound(err), "%s should not exist", formatLocation(loc))
+					continue
+				}
+				require.NoError(t, err)
+				require.Equal(t, expected, configMap.Data["ca-bundle.crt"], formatLocation(loc))
+			}
+		})
+	}
+
+	// unknown handling is rejected
+	fakeKubeClient := fake.NewSimpleClientset()
+	_, err := NewResourceSyncControllerWithOptions(v1helpers.NewFakeOperatorClient(&operatorv1.OperatorSpec{}, &operatorv1.OperatorStatus{}, nil),
+		v1helpers.NewKubeInformersForNamespaces(fakeKubeClient, ""), fakeKubeClient, events.NewInMemoryRecorder(t.Name()),
+		ResourceSyncControllerOptions{MetricsCABundleBackCopy: "Delete"})
+	require.EqualError(t, err, `unknown metrics ca-bundle back-copy handling "Delete", must be one of "", "Skip" or "Remove"`)
+}
+
+func TestDryRun(t *testing.T) {
+	fakeKubeClient := fake.NewSimpleClientset(
+		&corev1.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{Namespace: operatorclient.TargetNamespace, Name: "etcd-ca-bundle"},
+			Data:       map[string]string{"ca-bundle.crt": "new bundle"},
+		},
+		&corev1.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{Namespace: operatorclient.GlobalUserSpecifiedConfigNamespace, Name: "etcd-serving-ca"},
+			Data:       map[string]string{"ca-bundle.crt": "stale bundle"},
+		},
+		&corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{Namespace: operatorclient.TargetNamespace, Name: "etcd-client"},
+			Type:       corev1.SecretTypeTLS,
+			Data:       map[string][]byte{"tls.crt": []byte("cert"), "tls.key": []byte("key")},
+		},
+	)
+
+	recorder := syncOnce(t, fakeKubeClient, ResourceSyncControllerOptions{DryRun: true}, newSyncMetrics())
+
+	for _, action := range fakeKubeClient.Actions() {
+		require.Contains(t, []string{"get", "list", "watch"}, action.GetVerb(), "unexpected %s of %s in dry-run", action.GetVerb(), action.GetResource().Resource)
+	}
+	servingCA, err := fakeKubeClient.CoreV1().ConfigMaps(operatorclient.GlobalUserSpecifiedConfigNamespace).Get(context.TODO(), "etcd-serving-ca", metav1.GetOptions{})
+	require.NoError(t, err)
+	require.Equal(t, "stale bundle", servingCA.Data["ca-bundle.crt"])
+
+	var dryRunEvents []string
+	for _, event := range recorder.Events() {
+		if event.Reason == "ResourceSyncDryRun" {
+			dryRunEvents = append(dryRunEvents, event.Message)
+		}
+	}
+	require.Contains(t, dryRunEvents, "dry-run: skipped update of configmap openshift-config/etcd-serving-ca synced from openshift-etcd/etcd-ca-bundle")
+	require.Contains(t, dryRunEvents, "dry-run: skipped create of secret openshift-config/etcd-client synced from openshift-etcd/etcd-client")
+}
+
+func TestSyncMetrics(t *testing.T) {
+	// the metrics ca bundle does not exist yet, so all syncs of it are skipped
+	fakeKubeClient := fake.NewSimpleClientset(
+		&corev1.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{Namespace: operatorclient.TargetNamespace, Name: "etcd-ca-bundle"},
+			Data:       map[string]string{"ca-bundle.crt": "bundle"},
+		},
+		&corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{Namespace: operatorclient.TargetNamespace, Name: "etcd-client"},
+			Type:       corev1.SecretTypeTLS,
+			Data:       map[string][]byte{"tls.crt": []byte("cert"), "tls.key": []byte("key")},
+		},
+	)
+	fakeKubeClient.PrependReactor("create", "secrets", func(action clienttesting.Action) (bool, runtime.Object, error) {
+		if action.GetNamespace() == operatorclient.GlobalUserSpecifiedConfigNamespace {
+			return true, nil, fmt.Errorf("forbidden")
+		}
+		return false, nil, nil
+	})
+	metrics := newSyncMetrics()
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(metrics.collectors()...)
+
+	syncOnce(t, fakeKubeClient, ResourceSyncControllerOptions{}, metrics)
+	syncOnce(t, fakeKubeClient, ResourceSyncControllerOptions{}, metrics)
+
+	families, err := registry.Gather()
+	require.NoError(t, err)
+	scraped := map[string]float64{}
+	for _, family := range families {
+		for _, metric := range family.GetMetric() {
+			labels := map[string]string{}
+			for _, label := range metric.GetLabel() {
+				labels[label.GetName()] = label.GetValue()
+			}
+			key := fmt.Sprintf("%s %s %s/%s -> %s/%s", family.GetName(), labels["kind"],
+				labels["source_namespace"], labels["source_name"], labels["destination_namespace"], labels["destination_name"])
+			scraped[key] = metric.GetCounter().GetValue()
+		}
+	}
+
+	// the destinations are only written by the first sync, the second one finds them up to date
+	require.Equal(t, 1.0, scraped["etcd_operator_resource_sync_copies_total configmap openshift-etcd/etcd-ca-bundle -> openshift-config/etcd-serving-ca"])
+	require.Equal(t, 1.0, scraped["etcd_operator_resource_sync_copies_total secret openshift-etcd/etcd-client -> openshift-etcd-operator/etcd-client"])
+	require.Equal(t, 2.0, scraped["etcd_operator_resource_sync_failures_total secret openshift-etcd/etcd-client -> openshift-config/etcd-client"])
+	require.NotContains(t, scraped, "etcd_operator_resource_sync_copies_total secret openshift-etcd/etcd-client -> openshift-config/etcd-client")
+	require.Equal(t, 2.0, scraped["etcd_operator_resource_sync_precondition_skips_total configmap openshift-etcd/etcd-metrics-ca-bundle -> openshift-etcd/etcd-metrics-proxy-client-ca"])
+	require.NotContains(t, scraped, "etcd_operator_resource_sync_precondition_skips_total configmap openshift-etcd/etcd-ca-bundle -> openshift-config/etcd-serving-ca")
+}
+
+func TestClientSecretSyncWaitsForSource(t *testing.T) {
+	tests := map[string]struct {
+		source               *corev1.Secret
+		expectedDestinations []string
+	}{
+		"source absent": {},
+		"source without data": {
+			source: &corev1.Secret{
+				ObjectMeta: metav1.ObjectMeta{Namespace: operatorclient.TargetNamespace, Name: "etcd-client"},
+				Type:       corev1.SecretTypeTLS,
+			},
+		},
+		"source with empty data": {
+			source: &corev1.Secret{
+				ObjectMeta: metav1.ObjectMeta{Namespace: operatorclient.TargetNamespace, Name: "etcd-client"},
+				Type:       corev1.SecretTypeTLS,
+				Data:       map[string][]byte{"tls.crt": {}, "tls.key": {}},
+			},
+		},
+		"source populated": {
+			source: &corev1.Secret{
+				ObjectMeta: metav1.ObjectMeta{Namespace: operatorclient.TargetNamespace, Name: "etcd-client"},
+				Type:       corev1.SecretTypeTLS,
+				Data:       map[string][]byte{"tls.crt": []byte("cert"), "tls.key": []byte("key")},
+			},
+			expectedDestinations: []string{"openshift-config/etcd-client", "openshift-etcd-operator/etcd-client"},
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			var objects []runtime.Object
+			if test.source != nil {
+				objects = append(objects, test.source)
+			}
+			fakeKubeClient := fake.NewSimpleClientset(objects...)
+
+			syncOnce(t, fakeKubeClient, ResourceSyncControllerOptions{}, newSyncMetrics())
+
+			var writtenDestinations []string
+			for _, action := range fakeKubeClient.Actions() {
+				if action.GetResource().Resource != "secrets" {
+					continue
+				}
+				require.Contains(t, []string{"get", "list", "watch", "create"}, action.GetVerb(), "unexpected %s of secret", action.GetVerb())
+				if create, ok := action.(clienttesting.CreateAction); ok {
+					secret := create.GetObject().(*corev1.Secret)
+					writtenDestinations = append(writtenDestinations, secret.Namespace+"/"+secret.Name)
+				}
+			}
+			require.ElementsMatch(t, test.expectedDestinations, writtenDestinations)
+		})
+	}
+}
+
+func TestClientSecretSyncRequiresTLSKeys(t *testing.T) {
+	tests := map[string]struct {
+		secretName           string
+		data                 map[string][]byte
+		expectedDestinations []string
+		expectedEvent        string
+	}{
+		"etcd-client complete": {
+			secretName:           "etcd-client",
+			data:                 map[string][]byte{"tls.crt": []byte("cert"), "tls.key": []byte("key")},
+			expectedDestinations: []string{"openshift-config/etcd-client", "openshift-etcd-operator/etcd-client"},
+		},
+		"etcd-client without tls.key": {
+			secretName:    "etcd-client",
+			data:          map[string][]byte{"tls.crt": []byte("cert")},
+			expectedEvent: "not syncing secret openshift-etcd/etcd-client, it lacks the keys tls.key",
+		},
+		"etcd-client with other keys only": {
+			secretName:    "etcd-client",
+			data:          map[string][]byte{"ca.crt": []byte("ca")},
+			expectedEvent: "not syncing secret openshift-etcd/etcd-client, it lacks the keys tls.crt, tls.key",
+		},
+		"etcd-metric-client complete": {
+			secretName:           "etcd-metric-client",
+			data:                 map[string][]byte{"tls.crt": []byte("cert"), "tls.key": []byte("key")},
+			expectedDestinations: []string{"openshift-etcd-operator/etcd-metric-client"},
+		},
+		"etcd-metric-client without tls.crt": {
+			secretName:    "etcd-metric-client",
+			data:          map[string][]byte{"tls.key": []byte("key")},
+			expectedEvent: "not syncing secret openshift-etcd/etcd-metric-client, it lacks the keys tls.crt",
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			fakeKubeClient := fake.NewSimpleClientset(&corev1.Secret{
+				ObjectMeta: metav1.ObjectMeta{Namespace: operatorclient.TargetNamespace, Name: test.secretName},
+				Type:       corev1.SecretTypeTLS,
+				Data:       test.data,
+			})
+
+			recorder := syncOnce(t, fakeKubeClient, ResourceSyncControllerOptions{}, newSyncMetrics())
+
+			var writtenDestinations []string
+			for _, action := range fakeKubeClient.Actions() {
+				if create, ok := action.(clienttesting.CreateAction); ok && action.GetResource().Resource == "secrets" {
+					secret := create.GetObject().(*corev1.Secret)
+					writtenDestinations = append(writtenDestinations, secret.Namespace+"/"+secret.Name)
+				}
+			}
+			require.ElementsMatch(t, test.expectedDestinations, writtenDestinations)
+
+			var skipped []string
+			for _, event := range recorder.Events() {
+				if event.Reason == "SecretSyncSkipped" {
+					skipped = append(skipped, event.Message)
+				}
+			}
+			if len(test.expectedEvent) == 0 {
+				require.Empty(t, skipped)
+				return
+			}
+			require.Contains(t, skipped, test.expectedEvent)
+		})
+	}
+}
+
+func TestClusterConfigSyncOnlyWhenDiffers(t *testing.T) {
+	clusterConfig := func(namespace, installConfig string) *corev1.ConfigMap {
+		return &corev1.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{Namespace: namespace, Name: "cluster-config-v1"},
+			Data:       map[string]string{"install-config": installConfig},
+		}
+	}
+
+	tests := map[string]struct {
+		objects       []runtime.Object
+		expectedWrite string
+	}{
+		"identical": {
+			objects: []runtime.Object{
+				clusterConfig(operatorclient.KubeSystemNamespace, "replicas: 3"),
+				clusterConfig(operatorclient.TargetNamespace, "replicas: 3"),
+			},
+		},
+		"identical data with changed source annotations": {
+			objects: []runtime.Object{
+				func() *corev1.ConfigMap {
+					source := clusterConfig(operatorclient.KubeSystemNamespace, "replicas: 3")
+					source.Annotations = map[string]string{"example.com/last-reconciled": "2024-01-01T00:00:00Z"}
+					return source
+				}(),
+				clusterConfig(operatorclient.TargetNamespace, "replicas: 3"),
+			},
+		},
+		"differs": {
+			objects: []runtime.Object{
+				clusterConfig(operatorclient.KubeSystemNamespace, "replicas: 3"),
+				clusterConfig(operatorclient.TargetNamespace, "replicas: 1"),
+			},
+			expectedWrite: "update",
+		},
+		"destination missing": {
+			objects: []runtime.Object{
+				clusterConfig(operatorclient.KubeSystemNamespace, "replicas: 3"),
+			},
+			expectedWrite: "create",
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			fakeKubeClient := fake.NewSimpleClientset(test.objects...)
+
+			syncOnce(t, fakeKubeClient, ResourceSyncControllerOptions{}, newSyncMetrics())
+
+			var writes []string
+			for _, action := range fakeKubeClient.Actions() {
+				if action.GetResource().Resource != "configmaps" || action.GetNamespace() != operatorclient.TargetNamespace {
+					continue
+				}
+				if verb := action.GetVerb(); verb != "get" && verb != "list" && verb != "watch" {
+					writes = append(writes, verb)
+				}
+			}
+			if len(test.expectedWrite) == 0 {
+				require.Empty(t, writes)
+			} else {
+				require.Equal(t, []string{test.expectedWrite}, writes)
+			}
+
+			destination, err := fakeKubeClient.CoreV1().ConfigMaps(operatorclient.TargetNamespace).Get(context.TODO(), "cluster-config-v1", metav1.GetOptions{})
+			require.NoError(t, err)
+			require.Equal(t, "replicas: 3", destination.Data["install-config"])
+		})
+	}
+}
+
+// syncOnce runs a single sync of a new resource sync controller against the given client and returns its recorder.
+// The actions of the client are cleared before the sync.
+func syncOnce(t *testing.T, fakeKubeClient *fake.Clientset, options ResourceSyncControllerOptions, metrics *syncMetrics) events.InMemoryRecorder {
+	fakeOperatorClient := v1helpers.NewFakeOperatorClient(
+		&operatorv1.OperatorSpec{ManagementState: operatorv1.Managed},
+		&operatorv1.OperatorStatus{},
+		nil,
+	)
+	kubeInformersForNamespaces := v1helpers.NewKubeInformersForNamespaces(fakeKubeClient, "",
+		operatorclient.GlobalUserSpecifiedConfigNamespace,
+		operatorclient.GlobalMachineSpecifiedConfigNamespace,
+		operatorclient.TargetNamespace,
+		operatorclient.OperatorNamespace,
+		operatorclient.KubeSystemNamespace,
+	)
+	recorder := events.NewInMemoryRecorder(t.Name())
+
+	controller, err := newResourceSyncController(fakeOperatorClient, kubeInformersForNamespaces, fakeKubeClient, recorder, options, metrics)
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	for _, namespace := range kubeInformersForNamespaces.Namespaces().List() {
+		kubeInformersForNamespaces.InformersFor(namespace).Core().V1().ConfigMaps().Informer()
+		kubeInformersForNamespaces.InformersFor(namespace).Core().V1().Secrets().Informer()
+	}
+	kubeInformersForNamespaces.Start(ctx.Done())
+	for _, namespace := range kubeInformersForNamespaces.Namespaces().List() {
+		kubeInformersForNamespaces.InformersFor(namespace).WaitForCacheSync(ctx.Done())
+	}
+	fakeKubeClient.ClearActions()
+
+	require.NoError(t, controller.Sync(ctx, factory.NewSyncContext("test", recorder)))
+	return recorder
+}
+
+func TestMetricsCABundleBackCopyRegistrations(t *testing.T) {
+	tests := map[string]struct {
+		backCopy               MetricsCABundleBackCopy
+		expectedConfigMapRules int
+	}{
+		"back-copy by default": {
+			expectedConfigMapRules: 9,
+		},
+		"back-copy skipped": {
+			backCopy:               SkipMetricsCABundleBackCopy,
+			expectedConfigMapRules: 8,
+		},
+		"back-copy removed": {
+			backCopy:               RemoveMetricsCABundleBackCopy,
+			expectedConfigMapRules: 9,
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			fakeKubeClient := fake.NewSimpleClientset()
+			fakeOperatorClient := v1helpers.NewFakeOperatorClient(&operatorv1.OperatorSpec{}, &operatorv1.OperatorStatus{}, nil)
+			kubeInformersForNamespaces := v1helpers.NewKubeInformersForNamespaces(fakeKubeClient, "",
+				operatorclient.GlobalUserSpecifiedConfigNamespace,
+				operatorclient.GlobalMachineSpecifiedConfigNamespace,
+				operatorclient.TargetNamespace,
+				operatorclient.OperatorNamespace,
+				operatorclient.KubeSystemNamespace,
+			)
+
+			controller, err := NewResourceSyncControllerWithOptions(fakeOperatorClient, kubeInformersForNamespaces, fakeKubeClient,
+				events.NewInMemoryRecorder(t.Name()), ResourceSyncControllerOptions{MetricsCABundleBackCopy: test.backCopy})
+			require.NoError(t, err)
+
+			recorder := httptest.NewRecorder()
+			resourcesynccontroller.NewDebugHandler(controller).ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/", nil))
+			rules := resourcesynccontroller.ControllerSyncRules{}
+			require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &rules))
+			require.Len(t, rules.Configs, test.expectedConfigMapRules)
+			require.Len(t, rules.Secrets, 3)
+			for _, rule := range rules.Configs {
+				if test.backCopy == SkipMetricsCABundleBackCopy && rule.Source.Name == "etcd-metrics-ca-bundle" {
+					require.NotEqual(t, operatorclient.GlobalUserSpecifiedConfigNamespace, rule.Destination.Namespace)
+				}
+			}
+		})
+	}
+}
+
+func TestAllCertsBackup(t *testing.T) {
+	const backupNamespace = "etcd-pki-backup"
+	allCerts := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Namespace: operatorclient.TargetNamespace, Name: "etcd-all-certs"},
+		Data:       map[string][]byte{"etcd-serving-master-0.crt": []byte("cert"), "etcd-serving-master-0.key": []byte("key")},
+	}
+
+	tests := map[string]struct {
+		backupNamespace     string
+		source              *corev1.Secret
+		expectedSecretRules int
+		expectedBackup      bool
+	}{
+		"disabled by default": {
+			source:              allCerts,
+			expectedSecretRules: 3,
+		},
+		"enabled": {
+			backupNamespace:     backupNamespace,
+			source:              allCerts,
+			expectedSecretRules: 4,
+			expectedBackup:      true,
+		},
+		"enabled waits for the source": {
+			backupNamespace:     backupNamespace,
+			expectedSecretRules: 4,
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			var objects []runtime.Object
+			if test.source != nil {
+				objects = append(objects, test.source)
+			}
+			fakeKubeClient := fake.NewSimpleClientset(objects...)
+			fakeOperatorClient := v1helpers.NewFakeOperatorClient(&operatorv1.OperatorSpec{ManagementState: operatorv1.Managed}, &operatorv1.OperatorStatus{}, nil)
+			kubeInformersForNamespaces := v1helpers.NewKubeInformersForNamespaces(fakeKubeClient, "",
+				operatorclient.GlobalUserSpecifiedConfigNamespace,
+				operatorclient.GlobalMachineSpecifiedConfigNamespace,
+				operatorclient.TargetNamespace,
+				operatorclient.OperatorNamespace,
+				operatorclient.KubeSystemNamespace,
+				backupNamespace,
+			)
+			recorder := events.NewInMemoryRecorder(t.Name())
+
+			controller, err := newResourceSyncController(fakeOperatorClient, kubeInformersForNamespaces, fakeKubeClient, recorder, ResourceSyncControllerOptions{AllCertsBackupNamespace: test.backupNamespace}, newSyncMetrics())
+			require.NoError(t, err)
+
+			debugRecorder := httptest.NewRecorder()
+			resourcesynccontroller.NewDebugHandler(controller).ServeHTTP(debugRecorder, httptest.NewRequest(http.MethodGet, "/", nil))
+			rules := resourcesynccontroller.ControllerSyncRules{}
+			require.NoError(t, json.Unmarshal(debugRecorder.Body.Bytes(), &rules))
+			require.Len(t, rules.Secrets, test.expectedSecretRules)
+
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			for _, namespace := range kubeInformersForNamespaces.Namespaces().List() {
+				kubeInformersForNamespaces.InformersFor(namespace).Core().V1().Secrets().Informer()
+			}
+			kubeInformersForNamespaces.Start(ctx.Done())
+			for _, namespace := range kubeInformersForNamespaces.Namespaces().List() {
+				kubeInformersForNamespaces.InformersFor(namespace).WaitForCacheSync(ctx.Done())
+			}
+			require.NoError(t, controller.Sync(ctx, factory.NewSyncContext("test", recorder)))
+
+			backup, err := fakeKubeClient.CoreV1().Secrets(backupNamespace).Get(ctx, "etcd-all-certs", metav1.GetOptions{})
+			if !test.expectedBackup {
+				require.True(t, apierrors.IsNotFound(err))
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, allCerts.Data, backup.Data)
+		})
+	}
+
+	// the backup namespace must be watched
+	fakeKubeClient := fake.NewSimpleClientset()
+	kubeInformersForNamespaces := v1helpers.NewKubeInformersForNamespaces(fakeKubeClient, "",
+		operatorclient.GlobalUserSpecifiedConfigNamespace,
+		operatorclient.TargetNamespace,
+		operatorclient.OperatorNamespace,
+		operatorclient.KubeSystemNamespace,
+	)
+	_, err := NewResourceSyncControllerWithOptions(v1helpers.NewFakeOperatorClient(&operatorv1.OperatorSpec{}, &operatorv1.OperatorStatus{}, nil),
+		kubeInformersForNamespaces, fakeKubeClient, events.NewInMemoryRecorder(t.Name()), ResourceSyncControllerOptions{AllCertsBackupNamespace: backupNamespace})
+	require.ErrorContains(t, err, `not watching namespace "etcd-pki-backup"`)
+}
+
+func TestOptionsFromUnsupportedConfigOverrides(t *testing.T) {
+	tests := map[string]struct {
+		overrides       []byte
+		expectedOptions ResourceSyncControllerOptions
+		expectedErr     string
+	}{
+		"unset": {},
+		"other overrides": {
+			overrides: []byte(`useUnsupportedUnsafeNonHANonProductionUnstableEtcd: true`),
+		},
+		"all options": {
+			overrides: []byte(`
+resourceSync:
+  dryRun: true
+  metricsCABundleBackCopy: Remove
+  allCertsBackupNamespace: etcd-pki-backup
+  syncToggles:
+    configmap/openshift-config/etcd-serving-ca: false
+`),
+			expectedOptions: ResourceSyncControllerOptions{
+				DryRun:                  true,
+				MetricsCABundleBackCopy: RemoveMetricsCABundleBackCopy,
+				AllCertsBackupNamespace: "etcd-pki-backup",
+				SyncToggles:             map[string]bool{"configmap/openshift-config/etcd-serving-ca": false},
+			},
+		},
+		"json": {
+			overrides:       []byte(`{"resourceSync": {"dryRun": true}}`),
+			expectedOptions: ResourceSyncControllerOptions{DryRun: true},
+		},
+		"unknown option": {
+			overrides:   []byte(`{"resourceSync": {"dry-run": true}}`),
+			expectedErr: `failed to read resourceSync from unsupportedConfigOverrides: failed to decode resourceSync: json: unknown field "dry-run"`,
+		},
+		"topology is not read": {
+			overrides:   []byte(`{"resourceSync": {"topology": "External"}}`),
+			expectedErr: `failed to read resourceSync from unsupportedConfigOverrides: failed to decode resourceSync: json: unknown field "topology"`,
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			options, err := OptionsFromUnsupportedConfigOverrides(&operatorv1.OperatorSpec{UnsupportedConfigOverrides: runtime.RawExtension{Raw: test.overrides}})
+			if len(test.expectedErr) > 0 {
+				require.EqualError(t, err, test.expectedErr)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, test.expectedOptions, options)
+		})
+	}
+}
@@ -0,0 +1,310 @@
+package resourcesynccontroller
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	configv1 "github.com/openshift/api/config/v1"
+	"github.com/openshift/library-go/pkg/operator/events"
+	"github.com/openshift/library-go/pkg/operator/resourcesynccontroller"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	utilerrors "k8s.io/apimachinery/pkg/util/errors"
+	"k8s.io/apimachinery/pkg/util/sets"
+	corev1client "k8s.io/client-go/kubernetes/typed/core/v1"
+	"k8s.io/klog/v2"
+
+	"github.com/openshift/cluster-etcd-operator/pkg/operator/operatorclient"
+)
+
+// syncRegistration is a single sync of the resource sync controller.
+type syncRegistration struct {
+	kind        string
+	destination resourcesynccontroller.ResourceLocation
+	source      resourcesynccontroller.ResourceLocation
+	// precondition gates the sync, it is always fulfilled if unset
+	precondition func() (bool, error)
+	// standardOnly marks syncs into the namespaces of the cluster itself, kube-system and openshift-config. A hosted
+	// control plane does not run next to those, so the syncs are irrelevant or even harmful there.
+	standardOnly bool
+	// respectExternalOwner skips the sync while the destination is claimed with the ExternalOwnerAnnotation, e.g. for
+	// copies in openshift-config an admin may want to maintain themselves
+	respectExternalOwner bool
+}
+
+func (s syncRegistration) String() string {
+	return fmt.Sprintf("%s %s from %s", s.kind, formatLocation(s.destination), formatLocation(s.source))
+}
+
+// ID returns the stable identifier of the sync, <kind>/<namespace>/<name> of its destination. A destination is only
+// written by a single sync, so the ID is unique.
+func (s syncRegistration) ID() string {
+	return fmt.Sprintf("%s/%s", s.kind, formatLocation(s.destination))
+}
+
+// appliesTo returns whether the sync is registered for the given control plane topology.
+func (s syncRegistration) appliesTo(topology configv1.TopologyMode) bool {
+	return !s.standardOnly || topology != configv1.ExternalTopologyMode
+}
+
+// withExternalOwnerPrecondition returns the precondition of the sync guarded by externalOwnerPrecondition.
+func (s syncRegistration) withExternalOwnerPrecondition(secretClient corev1client.SecretsGetter, configMapClient corev1client.ConfigMapsGetter) func() (bool, error) {
+	return func() (bool, error) {
+		return externalOwnerPrecondition(s.kind, secretClient, configMapClient, s.destination, s.precondition)
+	}
+}
+
+func (s syncRegistration) register(registry *syncRegistry) error {
+	precondition := s.precondition
+	if precondition == nil {
+		precondition = alwaysFulfilled
+	}
+	switch s.kind {
+	case configMapKind:
+		return registry.SyncConfigMapConditionally(s.destination, s.source, precondition)
+	case secretKind:
+		return registry.SyncSecretConditionally(s.destination, s.source, precondition)
+	}
+	return fmt.Errorf("unknown kind of sync %s", s)
+}
+
+// syncRegistrations returns all syncs of the controller for the given topology, in the order they are registered.
+func syncRegistrations(
+	secretClient corev1client.SecretsGetter,
+	configMapClient corev1client.ConfigMapsGetter,
+	recorder events.Recorder,
+	metricsCABundleBackCopy MetricsCABundleBackCopy,
+	topology configv1.TopologyMode,
+	jiraComponent string) []syncRegistration {
+
+	caBundle := resourcesynccontroller.ResourceLocation{Namespace: operatorclient.TargetNamespace, Name: "etcd-ca-bundle"}
+	caBundleExistsFunc := func() (bool, error) {
+		return configMapExistsPrecondition(configMapClient, caBundle)
+	}
+	metricsBundle := resourcesynccontroller.ResourceLocation{Namespace: operatorclient.TargetNamespace, Name: "etcd-metrics-ca-bundle"}
+	metricsBundleExistsFunc := func() (bool, error) {
+		return configMapExistsPrecondition(configMapClient, metricsBundle)
+	}
+	metricsClientSecret := resourcesynccontroller.ResourceLocation{Namespace: operatorclient.TargetNamespace, Name: "etcd-metric-client"}
+	metricsClientSecretExistsFunc := func() (bool, error) {
+		return secretKeysPrecondition(secretClient, recorder, metricsClientSecret, corev1.TLSCertKey, corev1.TLSPrivateKeyKey)
+	}
+	clientSecret := resourcesynccontroller.ResourceLocation{Namespace: operatorclient.TargetNamespace, Name: "etcd-client"}
+	clientSecretExistsFunc := func() (bool, error) {
+		return secretKeysPrecondition(secretClient, recorder, clientSecret, corev1.TLSCertKey, corev1.TLSPrivateKeyKey)
+	}
+
+	clusterConfig := resourcesynccontroller.ResourceLocation{Namespace: operatorclient.TargetNamespace, Name: "cluster-config-v1"}
+	clusterConfigSource := resourcesynccontroller.ResourceLocation{Namespace: operatorclient.KubeSystemNamespace, Name: "cluster-config-v1"}
+
+	syncs := []syncRegistration{
+		{
+			kind:        configMapKind,
+			destination: clusterConfig,
+			source:      clusterConfigSource,
+			precondition: func() (bool, error) {
+				return configMapDiffersPrecondition(configMapClient, clusterConfig, clusterConfigSource)
+			},
+			standardOnly: true,
+		},
+
+		// serving ca
+		{
+			kind:         configMapKind,
+			destination:  resourcesynccontroller.ResourceLocation{Namespace: operatorclient.OperatorNamespace, Name: "etcd-ca-bundle"},
+			source:       caBundle,
+			precondition: caBundleExistsFunc,
+		},
+		{
+			kind:         configMapKind,
+			destination:  resourcesynccontroller.ResourceLocation{Namespace: operatorclient.TargetNamespace, Name: "etcd-peer-client-ca"},
+			source:       caBundle,
+			precondition: caBundleExistsFunc,
+		},
+		// "etcd-serving-ca" is replaced by the "etcd-ca-bundle"
+		{
+			kind:         configMapKind,
+			destination:  resourcesynccontroller.ResourceLocation{Namespace: operatorclient.TargetNamespace, Name: "etcd-serving-ca"},
+			source:       caBundle,
+			precondition: caBundleExistsFunc,
+		},
+		{
+			kind:                 configMapKind,
+			destination:          resourcesynccontroller.ResourceLocation{Namespace: operatorclient.GlobalUserSpecifiedConfigNamespace, Name: "etcd-serving-ca"},
+			source:               caBundle,
+			precondition:         caBundleExistsFunc,
+			standardOnly:         true,
+			respectExternalOwner: true,
+		},
+	}
+
+	// metrics serving
+	// copying the metrics ca-bundle back to openshift-config should not be necessary anymore, it can be skipped or
+	// removed with the MetricsCABundleBackCopy option. The source of truth stays in openshift-etcd
+	if metricsCABundleBackCopy != SkipMetricsCABundleBackCopy {
+		legacyMetricsServingCA := resourcesynccontroller.ResourceLocation{Namespace: operatorclient.GlobalUserSpecifiedConfigNamespace, Name: "etcd-metric-serving-ca"}
+		legacyMetricsServingCAFunc := metricsBundleExistsFunc
+		if metricsCABundleBackCopy == RemoveMetricsCABundleBackCopy {
+			legacyMetricsServingCAFunc = func() (bool, error) {
+				return deleteStaleConfigMapPrecondition(context.Background(), configMapClient, legacyMetricsServingCA, jiraComponent, neverFulfilled)
+			}
+		}
+		syncs = append(syncs, syncRegistration{
+			kind:                 configMapKind,
+			destination:          legacyMetricsServingCA,
+			source:               metricsBundle,
+			precondition:         legacyMetricsServingCAFunc,
+			standardOnly:         true,
+			respectExternalOwner: true,
+		})
+	}
+	syncs = append(syncs,
+		// read by the etcd ServiceMonitors, always maintained
+		syncRegistration{
+			kind:         configMapKind,
+			destination:  resourcesynccontroller.ResourceLocation{Namespace: operatorclient.OperatorNamespace, Name: "etcd-metric-serving-ca"},
+			source:       metricsBundle,
+			precondition: metricsBundleExistsFunc,
+		},
+		syncRegistration{
+			kind:         configMapKind,
+			destination:  resourcesynccontroller.ResourceLocation{Namespace: operatorclient.TargetNamespace, Name: "etcd-metrics-proxy-client-ca"},
+			source:       metricsBundle,
+			precondition: metricsBundleExistsFunc,
+		},
+		syncRegistration{
+			kind:         configMapKind,
+			destination:  resourcesynccontroller.ResourceLocation{Namespace: operatorclient.TargetNamespace, Name: "etcd-metrics-proxy-serving-ca"},
+			source:       metricsBundle,
+			precondition: metricsBundleExistsFunc,
+		},
+
+		// client certs
+		syncRegistration{
+			kind:         secretKind,
+			destination:  resourcesynccontroller.ResourceLocation{Namespace: operatorclient.OperatorNamespace, Name: "etcd-metric-client"},
+			source:       metricsClientSecret,
+			precondition: metricsClientSecretExistsFunc,
+		},
+		syncRegistration{
+			kind:         secretKind,
+			destination:  resourcesynccontroller.ResourceLocation{Namespace: operatorclient.OperatorNamespace, Name: "etcd-client"},
+			source:       clientSecret,
+			precondition: clientSecretExistsFunc,
+		},
+		syncRegistration{
+			kind:                 secretKind,
+			destination:          resourcesynccontroller.ResourceLocation{Namespace: operatorclient.GlobalUserSpecifiedConfigNamespace, Name: "etcd-client"},
+			source:               clientSecret,
+			precondition:         clientSecretExistsFunc,
+			standardOnly:         true,
+			respectExternalOwner: true,
+		},
+	)
+
+	var applicable []syncRegistration
+	for _, sync := range syncs {
+		if !sync.appliesTo(topology) {
+			continue
+		}
+		if sync.respectExternalOwner {
+			sync.precondition = sync.withExternalOwnerPrecondition(secretClient, configMapClient)
+		}
+		applicable = append(applicable, sync)
+	}
+	return applicable
+}
+
+// validateSyncToggles returns an error if any of the given toggles refers to no sync of any topology.
+func validateSyncToggles(syncToggles map[string]bool) error {
+	if len(syncToggles) == 0 {
+		return nil
+	}
+	// the clients are only used by the preconditions, which are not run here
+	known := sets.NewString()
+	for _, sync := range syncRegistrations(nil, nil, nil, MaintainMetricsCABundleBackCopy, configv1.HighlyAvailableTopologyMode, "") {
+		known.Insert(sync.ID())
+	}
+	var unknown []string
+	for id := range syncToggles {
+		if !known.Has(id) {
+			unknown = append(unknown, id)
+		}
+	}
+	if len(unknown) > 0 {
+		sort.Strings(unknown)
+		return fmt.Errorf("unknown syncs %s, known syncs are %s", strings.Join(unknown, ", "), strings.Join(known.List(), ", "))
+	}
+	return nil
+}
+
+// missingSyncSource is a source that does not exist yet, together with the destinations of the syncs skipped until it
+// is created.
+type missingSyncSource struct {
+	kind         string
+	source       resourcesynccontroller.ResourceLocation
+	destinations []resourcesynccontroller.ResourceLocation
+}
+
+func (m missingSyncSource) String() string {
+	destinations := make([]string, 0, len(m.destinations))
+	for _, destination := range m.destinations {
+		destinations = append(destinations, formatLocation(destination))
+	}
+	return fmt.Sprintf("%s %s is missing, skipping the syncs to %s", m.kind, formatLocation(m.source), strings.Join(destinations, ", "))
+}
+
+// missingSyncSources checks which sources of the given syncs exist in the cluster. The sources that do not exist are
+// returned in the order of the syncs. Their syncs are skipped until the sources are created, which is expected early
+// in the life of a cluster, so it is not an error. Sources that could not be looked up are reported in the returned
+// error instead, whether they exist is unknown.
+func missingSyncSources(ctx context.Context, secretClient corev1client.SecretsGetter, configMapClient corev1client.ConfigMapsGetter, syncs []syncRegistration) ([]missingSyncSource, error) {
+	var missing []missingSyncSource
+	missingIndex := map[string]int{}
+	checked := sets.NewString()
+	var errs []error
+	for _, sync := range syncs {
+		key := sync.kind + "/" + formatLocation(sync.source)
+		if i, ok := missingIndex[key]; ok {
+			missing[i].destinations = append(missing[i].destinations, sync.destination)
+			continue
+		}
+		if checked.Has(key) {
+			continue
+		}
+		checked.Insert(key)
+
+		var err error
+		switch sync.kind {
+		case configMapKind:
+			_, err = configMapClient.ConfigMaps(sync.source.Namespace).Get(ctx, sync.source.Name, metav1.GetOptions{})
+		case secretKind:
+			_, err = secretClient.Secrets(sync.source.Namespace).Get(ctx, sync.source.Name, metav1.GetOptions{})
+		default:
+			err = fmt.Errorf("unknown kind of sync %s", sync)
+		}
+		switch {
+		case apierrors.IsNotFound(err):
+			missingIndex[key] = len(missing)
+			missing = append(missing, missingSyncSource{kind: sync.kind, source: sync.source, destinations: []resourcesynccontroller.ResourceLocation{sync.destination}})
+		case err != nil:
+			errs = append(errs, fmt.Errorf("could not check %s %s: %w", sync.kind, formatLocation(sync.source), err))
+		}
+	}
+	return missing, utilerrors.NewAggregate(errs)
+}
+
+// logMissingSyncSources logs the result of missingSyncSources, so that it is clear why syncs are not happening yet.
+// It is informational only, none of the outcomes fail the controller.
+func logMissingSyncSources(ctx context.Context, secretClient corev1client.SecretsGetter, configMapClient corev1client.ConfigMapsGetter, syncs []syncRegistration) {
+	missing, err := missingSyncSources(ctx, secretClient, configMapClient, syncs)
+	for _, m := range missing {
+		klog.Infof("source %s", m)
+	}
+	if err != nil {
+		klog.Warningf("could not check all sources of the resource syncs: %v", err)
+	}
+}
@@ -0,0 +1,258 @@
+package resourcesynccontroller
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	configv1 "github.com/openshift/api/config/v1"
+	operatorv1 "github.com/openshift/api/operator/v1"
+	"github.com/openshift/library-go/pkg/operator/events"
+	"github.com/openshift/library-go/pkg/operator/resourcesynccontroller"
+	"github.com/openshift/library-go/pkg/operator/v1helpers"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/client-go/kubernetes/fake"
+	clienttesting "k8s.io/client-go/testing"
+
+	"github.com/openshift/cluster-etcd-operator/pkg/operator/operatorclient"
+)
+
+func TestSyncRegistrationsPerTopology(t *testing.T) {
+	hosted := []string{
+		"configmap openshift-etcd-operator/etcd-ca-bundle from openshift-etcd/etcd-ca-bundle",
+		"configmap openshift-etcd/etcd-peer-client-ca from openshift-etcd/etcd-ca-bundle",
+		"configmap openshift-etcd/etcd-serving-ca from openshift-etcd/etcd-ca-bundle",
+		"configmap openshift-etcd-operator/etcd-metric-serving-ca from openshift-etcd/etcd-metrics-ca-bundle",
+		"configmap openshift-etcd/etcd-metrics-proxy-client-ca from openshift-etcd/etcd-metrics-ca-bundle",
+		"configmap openshift-etcd/etcd-metrics-proxy-serving-ca from openshift-etcd/etcd-metrics-ca-bundle",
+		"secret openshift-etcd-operator/etcd-metric-client from openshift-etcd/etcd-metric-client",
+		"secret openshift-etcd-operator/etcd-client from openshift-etcd/etcd-client",
+	}
+	standard := append([]string{
+		"configmap openshift-etcd/cluster-config-v1 from kube-system/cluster-config-v1",
+		"configmap openshift-config/etcd-serving-ca from openshift-etcd/etcd-ca-bundle",
+		"configmap openshift-config/etcd-metric-serving-ca from openshift-etcd/etcd-metrics-ca-bundle",
+		"secret openshift-config/etcd-client from openshift-etcd/etcd-client",
+	}, hosted...)
+
+	tests := map[string]struct {
+		topology configv1.TopologyMode
+		expected []string
+	}{
+		"highly available": {
+			topology: configv1.HighlyAvailableTopologyMode,
+			expected: standard,
+		},
+		"single node": {
+			topology: configv1.SingleReplicaTopologyMode,
+			expected: standard,
+		},
+		"unknown": {
+			expected: standard,
+		},
+		"hosted": {
+			topology: configv1.ExternalTopologyMode,
+			expected: hosted,
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			fakeKubeClient := fake.NewSimpleClientset()
+			kubeInformersForNamespaces := v1helpers.NewKubeInformersForNamespaces(fakeKubeClient, "",
+				operatorclient.GlobalUserSpecifiedConfigNamespace,
+				operatorclient.GlobalMachineSpecifiedConfigNamespace,
+				operatorclient.TargetNamespace,
+				operatorclient.OperatorNamespace,
+				operatorclient.KubeSystemNamespace,
+			)
+			controller, err := NewResourceSyncControllerWithOptions(v1helpers.NewFakeOperatorClient(&operatorv1.OperatorSpec{}, &operatorv1.OperatorStatus{}, nil),
+				kubeInformersForNamespaces, fakeKubeClient, events.NewInMemoryRecorder(t.Name()), ResourceSyncControllerOptions{Topology: test.topology})
+			require.NoError(t, err)
+
+			recorder := httptest.NewRecorder()
+			resourcesynccontroller.NewDebugHandler(controller).ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/", nil))
+			rules := resourcesynccontroller.ControllerSyncRules{}
+			require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &rules))
+			registered := sets.NewString()
+			for _, rule := range rules.Configs {
+				registered.Insert(syncRegistration{kind: configMapKind, destination: rule.Destination, source: rule.Source.ResourceLocation}.String())
+			}
+			for _, rule := range rules.Secrets {
+				registered.Insert(syncRegistration{kind: secretKind, destination: rule.Destination, source: rule.Source.ResourceLocation}.String())
+			}
+			require.Equal(t, sets.NewString(test.expected...).List(), registered.List())
+		})
+	}
+}
+
+func TestSyncRegistrationRegister(t *testing.T) {
+	newRegistry := func(t *testing.T) *syncRegistry {
+		fakeKubeClient := fake.NewSimpleClientset()
+		kubeInformersForNamespaces := v1helpers.NewKubeInformersForNamespaces(fakeKubeClient, "",
+			operatorclient.GlobalUserSpecifiedConfigNamespace,
+			operatorclient.TargetNamespace,
+			operatorclient.OperatorNamespace,
+			operatorclient.KubeSystemNamespace,
+		)
+		registry := newSyncRegistry(newSyncMetrics())
+		registry.controller = resourcesynccontroller.NewResourceSyncController(
+			v1helpers.NewFakeOperatorClient(nil, nil, nil),
+			kubeInformersForNamespaces,
+			fakeKubeClient.CoreV1(),
+			fakeKubeClient.CoreV1(),
+			events.NewInMemoryRecorder(t.Name()),
+		)
+		return registry
+	}
+
+	fakeKubeClient := fake.NewSimpleClientset()
+	for _, sync := range syncRegistrations(fakeKubeClient.CoreV1(), fakeKubeClient.CoreV1(), events.NewInMemoryRecorder(t.Name()), MaintainMetricsCABundleBackCopy, configv1.HighlyAvailableTopologyMode, "") {
+		t.Run(sync.String(), func(t *testing.T) {
+			registry := newRegistry(t)
+			require.NoError(t, sync.register(registry))
+
+			sources := registry.configMapSources
+			if sync.kind == secretKind {
+				sources = registry.secretSources
+			}
+			require.Equal(t, map[resourcesynccontroller.ResourceLocation]resourcesynccontroller.ResourceLocation{sync.destination: sync.source}, sources)
+			require.Equal(t, sync.standardOnly, !sync.appliesTo(configv1.ExternalTopologyMode))
+		})
+	}
+
+	unknown := syncRegistration{
+		kind:        "service",
+		destination: resourcesynccontroller.ResourceLocation{Namespace: operatorclient.OperatorNamespace, Name: "etcd"},
+		source:      resourcesynccontroller.ResourceLocation{Namespace: operatorclient.TargetNamespace, Name: "etcd"},
+	}
+	require.EqualError(t, unknown.register(newRegistry(t)), "unknown kind of sync service openshift-etcd-operator/etcd from openshift-etcd/etcd")
+}
+
+func TestSyncToggles(t *testing.T) {
+	tests := map[string]struct {
+		syncToggles      map[string]bool
+		expectedDisabled []string
+		expectedErr      string
+	}{
+		"all enabled by default": {},
+		"enabled explicitly": {
+			syncToggles: map[string]bool{"configmap/openshift-config/etcd-serving-ca": true},
+		},
+		"disable single syncs": {
+			syncToggles: map[string]bool{
+				"configmap/openshift-config/etcd-serving-ca":   false,
+				"secret/openshift-etcd-operator/etcd-client":   false,
+				"configmap/openshift-etcd/etcd-peer-client-ca": true,
+			},
+			expectedDisabled: []string{
+				"configmap openshift-config/etcd-serving-ca from openshift-etcd/etcd-ca-bundle",
+				"secret openshift-etcd-operator/etcd-client from openshift-etcd/etcd-client",
+			},
+		},
+		"unknown sync": {
+			syncToggles: map[string]bool{"configmap/openshift-config/etcd-ca-bundle": false, "etcd-serving-ca": false},
+			expectedErr: "unknown syncs configmap/openshift-config/etcd-ca-bundle, etcd-serving-ca, known syncs are configmap/openshift-config/etcd-metric-serving-ca",
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			fakeKubeClient := fake.NewSimpleClientset()
+			kubeInformersForNamespaces := v1helpers.NewKubeInformersForNamespaces(fakeKubeClient, "",
+				operatorclient.GlobalUserSpecifiedConfigNamespace,
+				operatorclient.GlobalMachineSpecifiedConfigNamespace,
+				operatorclient.TargetNamespace,
+				operatorclient.OperatorNamespace,
+				operatorclient.KubeSystemNamespace,
+			)
+			controller, err := NewResourceSyncControllerWithOptions(v1helpers.NewFakeOperatorClient(&operatorv1.OperatorSpec{}, &operatorv1.OperatorStatus{}, nil),
+				kubeInformersForNamespaces, fakeKubeClient, events.NewInMemoryRecorder(t.Name()), ResourceSyncControllerOptions{SyncToggles: test.syncToggles})
+			if len(test.expectedErr) > 0 {
+				require.ErrorContains(t, err, test.expectedErr)
+				return
+			}
+			require.NoError(t, err)
+
+			recorder := httptest.NewRecorder()
+			resourcesynccontroller.NewDebugHandler(controller).ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/", nil))
+			rules := resourcesynccontroller.ControllerSyncRules{}
+			require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &rules))
+			registered := sets.NewString()
+			for _, rule := range rules.Configs {
+				registered.Insert(syncRegistration{kind: configMapKind, destination: rule.Destination, source: rule.Source.ResourceLocation}.String())
+			}
+			for _, rule := range rules.Secrets {
+				registered.Insert(syncRegistration{kind: secretKind, destination: rule.Destination, source: rule.Source.ResourceLocation}.String())
+			}
+
+			all := sets.NewString()
+			for _, sync := range syncRegistrations(nil, nil, nil, MaintainMetricsCABundleBackCopy, configv1.HighlyAvailableTopologyMode, "") {
+				all.Insert(sync.String())
+			}
+			require.Equal(t, all.Difference(sets.NewString(test.expectedDisabled...)).List(), registered.List())
+		})
+	}
+}
+
+func TestSyncRegistrationIDsAreUnique(t *testing.T) {
+	ids := sets.NewString()
+	for _, sync := range syncRegistrations(nil, nil, nil, MaintainMetricsCABundleBackCopy, configv1.HighlyAvailableTopologyMode, "") {
+		require.False(t, ids.Has(sync.ID()), "duplicate sync ID %s", sync.ID())
+		ids.Insert(sync.ID())
+	}
+	require.True(t, ids.Has("configmap/openshift-config/etcd-serving-ca"))
+	require.True(t, ids.Has("secret/openshift-config/etcd-client"))
+}
+
+func TestMissingSyncSources(t *testing.T) {
+	fakeKubeClient := fake.NewSimpleClientset(
+		&corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Namespace: operatorclient.TargetNamespace, Name: "etcd-ca-bundle"}},
+		&corev1.Secret{ObjectMeta: metav1.ObjectMeta{Namespace: operatorclient.TargetNamespace, Name: "etcd-client"}},
+	)
+	syncs := syncRegistrations(nil, nil, nil, MaintainMetricsCABundleBackCopy, configv1.HighlyAvailableTopologyMode, "")
+
+	missing, err := missingSyncSources(context.TODO(), fakeKubeClient.CoreV1(), fakeKubeClient.CoreV1(), syncs)
+	require.NoError(t, err)
+	var reported []string
+	for _, m := range missing {
+		reported = append(reported, m.String())
+	}
+	require.Equal(t, []string{
+		"configmap kube-system/cluster-config-v1 is missing, skipping the syncs to openshift-etcd/cluster-config-v1",
+		"configmap openshift-etcd/etcd-metrics-ca-bundle is missing, skipping the syncs to openshift-config/etcd-metric-serving-ca, " +
+			"openshift-etcd-operator/etcd-metric-serving-ca, openshift-etcd/etcd-metrics-proxy-client-ca, openshift-etcd/etcd-metrics-proxy-serving-ca",
+		"secret openshift-etcd/etcd-metric-client is missing, skipping the syncs to openshift-etcd-operator/etcd-metric-client",
+	}, reported)
+
+	// a source that cannot be looked up is not reported as missing
+	fakeKubeClient.PrependReactor("get", "secrets", func(action clienttesting.Action) (bool, runtime.Object, error) {
+		if action.(clienttesting.GetAction).GetName() == "etcd-metric-client" {
+			return true, nil, apierrors.NewForbidden(corev1.Resource("secrets"), "etcd-metric-client", fmt.Errorf("denied"))
+		}
+		return false, nil, nil
+	})
+	missing, err = missingSyncSources(context.TODO(), fakeKubeClient.CoreV1(), fakeKubeClient.CoreV1(), syncs)
+	require.EqualError(t, err, `could not check secret openshift-etcd/etcd-metric-client: secrets "etcd-metric-client" is forbidden: denied`)
+	require.Len(t, missing, 2)
+
+	// nothing is missing once all sources exist
+	fakeKubeClient = fake.NewSimpleClientset(
+		&corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Namespace: operatorclient.KubeSystemNamespace, Name: "cluster-config-v1"}},
+		&corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Namespace: operatorclient.TargetNamespace, Name: "etcd-ca-bundle"}},
+		&corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Namespace: operatorclient.TargetNamespace, Name: "etcd-metrics-ca-bundle"}},
+		&corev1.Secret{ObjectMeta: metav1.ObjectMeta{Namespace: operatorclient.TargetNamespace, Name: "etcd-client"}},
+		&corev1.Secret{ObjectMeta: metav1.ObjectMeta{Namespace: operatorclient.TargetNamespace, Name: "etcd-metric-client"}},
+	)
+	missing, err = missingSyncSources(context.TODO(), fakeKubeClient.CoreV1(), fakeKubeClient.CoreV1(), syncs)
+	require.NoError(t, err)
+	require.Empty(t, missing)
+}
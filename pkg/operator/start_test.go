@@ -1,6 +1,147 @@
 package operator
 
-import "testing"
+import (
+	"context"
+	"testing"
+
+	configv1 "github.com/openshift/api/config/v1"
+	operatorv1 "github.com/openshift/api/operator/v1"
+	fakeconfig "github.com/openshift/client-go/config/clientset/versioned/fake"
+	fakeoperator "github.com/openshift/client-go/operator/clientset/versioned/fake"
+	"github.com/openshift/library-go/pkg/operator/events"
+	"github.com/openshift/library-go/pkg/operator/v1helpers"
+	"github.com/stretchr/testify/require"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+
+	"github.com/openshift/cluster-etcd-operator/pkg/operator/ceohelpers"
+	"github.com/openshift/cluster-etcd-operator/pkg/operator/operatorclient"
+	"github.com/openshift/cluster-etcd-operator/pkg/operator/resourcesynccontroller"
+)
 
 func TestNothing(t *testing.T) {
 }
+
+func TestReadResourceSyncControllerOptions(t *testing.T) {
+	infra := &configv1.Infrastructure{
+		ObjectMeta: metav1.ObjectMeta{Name: ceohelpers.InfrastructureClusterName},
+		Status:     configv1.InfrastructureStatus{ControlPlaneTopology: configv1.SingleReplicaTopologyMode},
+	}
+	etcd := func(overrides string) *operatorv1.Etcd {
+		return &operatorv1.Etcd{
+			ObjectMeta: metav1.ObjectMeta{Name: "cluster"},
+			Spec: operatorv1.EtcdSpec{StaticPodOperatorSpec: operatorv1.StaticPodOperatorSpec{OperatorSpec: operatorv1.OperatorSpec{
+				UnsupportedConfigOverrides: runtime.RawExtension{Raw: []byte(overrides)},
+			}}},
+		}
+	}
+
+	tests := map[string]struct {
+		etcd            *operatorv1.Etcd
+		infra           *configv1.Infrastructure
+		expectedOptions resourcesynccontroller.ResourceSyncControllerOptions
+		expectedWarning bool
+	}{
+		"defaults": {},
+		"options and topology": {
+			etcd:  etcd(`{"resourceSync": {"dryRun": true}}`),
+			infra: infra,
+			expectedOptions: resourcesynccontroller.ResourceSyncControllerOptions{
+				DryRun:   true,
+				Topology: configv1.SingleReplicaTopologyMode,
+			},
+		},
+		"typo falls back to the defaults": {
+			etcd:            etcd(`{"resourceSync": {"dry-run": true}}`),
+			infra:           infra,
+			expectedOptions: resourcesynccontroller.ResourceSyncControllerOptions{Topology: configv1.SingleReplicaTopologyMode},
+			expectedWarning: true,
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			var operatorObjects, configObjects []runtime.Object
+			if test.etcd != nil {
+				operatorObjects = append(operatorObjects, test.etcd)
+			}
+			if test.infra != nil {
+				configObjects = append(configObjects, test.infra)
+			}
+			recorder := events.NewInMemoryRecorder(t.Name())
+
+			options := readResourceSyncControllerOptions(context.TODO(), fakeoperator.NewSimpleClientset(operatorObjects...), fakeconfig.NewSimpleClientset(configObjects...), recorder)
+			require.Equal(t, test.expectedOptions, options)
+			requireWarning(t, recorder, "ResourceSyncOptionsIgnored", test.expectedWarning)
+		})
+	}
+}
+
+func TestReadCertSignerOptions(t *testing.T) {
+	etcd := func(overrides string) *operatorv1.Etcd {
+		return &operatorv1.Etcd{
+			ObjectMeta: metav1.ObjectMeta{Name: "cluster"},
+			Spec: operatorv1.EtcdSpec{StaticPodOperatorSpec: operatorv1.StaticPodOperatorSpec{OperatorSpec: operatorv1.OperatorSpec{
+				UnsupportedConfigOverrides: runtime.RawExtension{Raw: []byte(overrides)},
+			}}},
+		}
+	}
+
+	tests := map[string]struct {
+		etcd            *operatorv1.Etcd
+		expectedOptions int
+		expectedWarning bool
+	}{
+		"defaults":                  {},
+		"no certSigner override":    {etcd: etcd(`{"resourceSync": {"dryRun": true}}`)},
+		"options":                   {etcd: etcd(`{"certSigner": {"keyAlgorithm": "ECDSA-P256", "validity": "8760h"}}`), expectedOptions: 2},
+		"typo falls back":           {etcd: etcd(`{"certSigner": {"key-algorithm": "ECDSA-P256"}}`), expectedWarning: true},
+		"invalid option falls back": {etcd: etcd(`{"certSigner": {"keyAlgorithm": "DSA"}}`), expectedWarning: true},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			var operatorObjects []runtime.Object
+			if test.etcd != nil {
+				operatorObjects = append(operatorObjects, test.etcd)
+			}
+			recorder := events.NewInMemoryRecorder(t.Name())
+
+			opts := readCertSignerOptions(context.TODO(), fakeoperator.NewSimpleClientset(operatorObjects...), recorder)
+			require.Len(t, opts, test.expectedOptions)
+			requireWarning(t, recorder, "CertSignerOptionsIgnored", test.expectedWarning)
+		})
+	}
+}
+
+func TestNewResourceSyncControllerFallsBackToDefaults(t *testing.T) {
+	fakeKubeClient := fake.NewSimpleClientset()
+	kubeInformersForNamespaces := v1helpers.NewKubeInformersForNamespaces(fakeKubeClient, "",
+		operatorclient.GlobalUserSpecifiedConfigNamespace,
+		operatorclient.GlobalMachineSpecifiedConfigNamespace,
+		operatorclient.TargetNamespace,
+		operatorclient.OperatorNamespace,
+		operatorclient.KubeSystemNamespace,
+	)
+	recorder := events.NewInMemoryRecorder(t.Name())
+
+	controller, err := newResourceSyncController(v1helpers.NewFakeOperatorClient(&operatorv1.OperatorSpec{}, &operatorv1.OperatorStatus{}, nil),
+		kubeInformersForNamespaces, fakeKubeClient, recorder,
+		resourcesynccontroller.ResourceSyncControllerOptions{SyncToggles: map[string]bool{"configmap/openshift-config/unknown": false}})
+	require.NoError(t, err)
+	require.NotNil(t, controller)
+	requireWarning(t, recorder, "ResourceSyncOptionsIgnored", true)
+}
+
+func requireWarning(t *testing.T, recorder events.InMemoryRecorder, reason string, expected bool) {
+	var reasons []string
+	for _, event := range recorder.Events() {
+		reasons = append(reasons, event.Reason)
+	}
+	if expected {
+		require.Equal(t, []string{reason}, reasons)
+		return
+	}
+	require.Empty(t, reasons)
+}
@@ -28,8 +28,10 @@ import (
 	"github.com/openshift/cluster-etcd-operator/pkg/operator/health"
 	"github.com/openshift/library-go/pkg/controller/controllercmd"
 	"github.com/openshift/library-go/pkg/operator/configobserver/featuregates"
+	"github.com/openshift/library-go/pkg/operator/events"
 	"github.com/openshift/library-go/pkg/operator/genericoperatorclient"
 	"github.com/openshift/library-go/pkg/operator/resource/resourceapply"
+	libgoresourcesynccontroller "github.com/openshift/library-go/pkg/operator/resourcesynccontroller"
 	"github.com/openshift/library-go/pkg/operator/staticpod"
 	"github.com/openshift/library-go/pkg/operator/staticpod/controller/common"
 	"github.com/openshift/library-go/pkg/operator/staticpod/controller/installer"
@@ -66,6 +68,7 @@ import (
 	"github.com/openshift/cluster-etcd-operator/pkg/operator/resourcesynccontroller"
 	"github.com/openshift/cluster-etcd-operator/pkg/operator/scriptcontroller"
 	"github.com/openshift/cluster-etcd-operator/pkg/operator/targetconfigcontroller"
+	"github.com/openshift/cluster-etcd-operator/pkg/tlshelpers"
 )
 
 // masterMachineLabelSelectorString allows for getting only the master machines, it matters in larger installations with many worker nodes
@@ -137,15 +140,19 @@ func RunOperator(ctx context.Context, controllerContext *controllercmd.Controlle
 
 	operatorInformers := operatorv1informers.NewSharedInformerFactory(operatorConfigClient, 10*time.Minute)
 	etcdsInformer := operatorInformers.Operator().V1().Etcds()
-	kubeInformersForNamespaces := v1helpers.NewKubeInformersForNamespaces(
-		kubeClient,
+	resourceSyncOptions := readResourceSyncControllerOptions(ctx, operatorConfigClient, configClient, controllerContext.EventRecorder)
+	watchedNamespaces := []string{
 		"",
 		operatorclient.GlobalUserSpecifiedConfigNamespace,
 		operatorclient.GlobalMachineSpecifiedConfigNamespace,
 		operatorclient.TargetNamespace,
 		operatorclient.OperatorNamespace,
 		"kube-system",
-	)
+	}
+	if len(resourceSyncOptions.AllCertsBackupNamespace) > 0 {
+		watchedNamespaces = append(watchedNamespaces, resourceSyncOptions.AllCertsBackupNamespace)
+	}
+	kubeInformersForNamespaces := v1helpers.NewKubeInformersForNamespaces(kubeClient, watchedNamespaces...)
 
 	configInformers := configv1informers.NewSharedInformerFactory(configClient, 10*time.Minute)
 	clusterVersions := configInformers.Config().V1().ClusterVersions()
@@ -183,11 +190,12 @@ func RunOperator(ctx context.Context, controllerContext *controllercmd.Controlle
 		networkInformer,
 		controllerContext.EventRecorder)
 
-	resourceSyncController, err := resourcesynccontroller.NewResourceSyncController(
+	resourceSyncController, err := newResourceSyncController(
 		operatorClient,
 		kubeInformersForNamespaces,
 		kubeClient,
 		controllerContext.EventRecorder,
+		resourceSyncOptions,
 	)
 	if err != nil {
 		return err
@@ -353,6 +361,7 @@ func RunOperator(ctx context.Context, controllerContext *controllercmd.Controlle
 		kubeInformersForNamespaces,
 		controllerContext.EventRecorder,
 		quorumChecker,
+		readCertSignerOptions(ctx, operatorConfigClient, controllerContext.EventRecorder)...,
 	)
 
 	etcdEndpointsController := etcdendpointscontroller.NewEtcdEndpointsController(
@@ -584,6 +593,80 @@ func getEnabledDisabledFeatures(features featuregates.FeatureGate) ([]string, []
 	return enabled, disabled
 }
 
+// readResourceSyncControllerOptions reads the options of the resource sync controller from the unsupportedConfigOverrides
+// of the etcd operator config together with the control plane topology. The informers are not started yet, so both are
+// read live. The syncs are registered once, changes to the options take effect on the next start of the operator.
+// Neither an unreadable resourceSync override, e.g. one with a typo, nor a failed lookup keep the operator from starting,
+// they are reported as warning event and the defaults are used instead.
+func readResourceSyncControllerOptions(ctx context.Context, operatorConfigClient operatorversionedclient.Interface, configClient configv1client.Interface, recorder events.Recorder) resourcesynccontroller.ResourceSyncControllerOptions {
+	options := resourcesynccontroller.ResourceSyncControllerOptions{}
+	etcd, err := operatorConfigClient.OperatorV1().Etcds().Get(ctx, "cluster", metav1.GetOptions{})
+	switch {
+	case errors.IsNotFound(err):
+	case err != nil:
+		recorder.Warningf("ResourceSyncOptionsIgnored", "using the default resource sync options, could not get the etcd operator config: %v", err)
+	default:
+		if options, err = resourcesynccontroller.OptionsFromUnsupportedConfigOverrides(&etcd.Spec.OperatorSpec); err != nil {
+			recorder.Warningf("ResourceSyncOptionsIgnored", "using the default resource sync options: %v", err)
+			options = resourcesynccontroller.ResourceSyncControllerOptions{}
+		}
+	}
+
+	infra, err := configClient.ConfigV1().Infrastructures().Get(ctx, ceohelpers.InfrastructureClusterName, metav1.GetOptions{})
+	switch {
+	case errors.IsNotFound(err):
+	case err != nil:
+		recorder.Warningf("ResourceSyncOptionsIgnored", "registering the standard resource syncs, could not get the control plane topology: %v", err)
+	default:
+		options.Topology = infra.Status.ControlPlaneTopology
+	}
+	return options
+}
+
+// readCertSignerOptions reads the options the etcd cert signer controller issues the certs with from the
+// unsupportedConfigOverrides of the etcd operator config. Like the resource sync options they are read live at start.
+// Neither an unreadable or invalid certSigner override nor a failed lookup keep the operator from starting, they are
+// reported as warning event and the certs are issued with the defaults instead.
+func readCertSignerOptions(ctx context.Context, operatorConfigClient operatorversionedclient.Interface, recorder events.Recorder) []tlshelpers.CertOption {
+	etcd, err := operatorConfigClient.OperatorV1().Etcds().Get(ctx, "cluster", metav1.GetOptions{})
+	switch {
+	case errors.IsNotFound(err):
+		return nil
+	case err != nil:
+		recorder.Warningf("CertSignerOptionsIgnored", "using the default cert signer options, could not get the etcd operator config: %v", err)
+		return nil
+	}
+	options, err := etcdcertsigner.OptionsFromUnsupportedConfigOverrides(&etcd.Spec.OperatorSpec)
+	if err != nil {
+		recorder.Warningf("CertSignerOptionsIgnored", "using the default cert signer options: %v", err)
+		return nil
+	}
+	certOpts, err := options.CertOptions()
+	if err != nil {
+		recorder.Warningf("CertSignerOptionsIgnored", "using the default cert signer options: %v", err)
+		return nil
+	}
+	return certOpts
+}
+
+// newResourceSyncController creates the resource sync controller with the given options. Options the controller
+// rejects, e.g. an unknown sync toggle, are reported as warning event and the controller is created with the defaults
+// for the topology instead.
+func newResourceSyncController(
+	operatorClient v1helpers.OperatorClient,
+	kubeInformersForNamespaces v1helpers.KubeInformersForNamespaces,
+	kubeClient kubernetes.Interface,
+	recorder events.Recorder,
+	options resourcesynccontroller.ResourceSyncControllerOptions) (*libgoresourcesynccontroller.ResourceSyncController, error) {
+	resourceSyncController, err := resourcesynccontroller.NewResourceSyncControllerWithOptions(operatorClient, kubeInformersForNamespaces, kubeClient, recorder, options)
+	if err == nil {
+		return resourceSyncController, nil
+	}
+	recorder.Warningf("ResourceSyncOptionsIgnored", "using the default resource sync options: %v", err)
+	return resourcesynccontroller.NewResourceSyncControllerWithOptions(operatorClient, kubeInformersForNamespaces, kubeClient, recorder,
+		resourcesynccontroller.ResourceSyncControllerOptions{Topology: options.Topology})
+}
+
 // RevisionConfigMaps is a list of configmaps that are directly copied for the current values.  A different actor/controller modifies these.
 // the first element should be the configmap that contains the static pod manifest
 var RevisionConfigMaps = []revision.RevisionResource{
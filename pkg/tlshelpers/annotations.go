@@ -0,0 +1,121 @@
+package tlshelpers
+
+import (
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/openshift/library-go/pkg/crypto"
+	"github.com/openshift/library-go/pkg/operator/certrotation"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/util/sets"
+)
+
+const (
+	CertNotAfterAnnotation = "etcd.openshift.io/cert-not-after"
+	CertSerialAnnotation   = "etcd.openshift.io/cert-serial"
+	CertSANsAnnotation     = "etcd.openshift.io/cert-sans"
+
+	// NodeIPsAnnotation records the sorted, comma separated IPs of the node that its peer, serving and serving metrics
+	// certs were issued for, see NodeIPsChangedSinceIssuance.
+	NodeIPsAnnotation = "etcd.openshift.io/node-ips"
+
+	// SignerChangeApprovalAnnotation is set by the admin on the user-specified or the external signer secret to approve
+	// adopting a changed signer. Its value must be the CertFingerprint of the new signer certificate.
+	SignerChangeApprovalAnnotation = "etcd.openshift.io/approved-signer-fingerprint"
+
+	// SecretDataHashAnnotation records the SecretDataHash of a managed secret as it was written, see
+	// SecretDataTampered.
+	SecretDataHashAnnotation = "etcd.openshift.io/data-hash"
+)
+
+// secretDataHashKeys are the data keys of a managed secret covered by SecretDataHash, in the order they are hashed.
+var secretDataHashKeys = []string{corev1.ServiceAccountRootCAKey, corev1.TLSCertKey, corev1.TLSPrivateKeyKey}
+
+// certMetadataCreator wraps a certrotation.TargetCertCreator and mirrors key attributes of every newly issued
+// certificate into annotations on the managed secret, so they can be inspected without parsing the cert.
+type certMetadataCreator struct {
+	certrotation.TargetCertCreator
+}
+
+func (c *certMetadataCreator) SetAnnotations(cert *crypto.TLSCertificateConfig, annotations map[string]string) map[string]string {
+	annotations = c.TargetCertCreator.SetAnnotations(cert, annotations)
+	return setCertMetadataAnnotations(cert.Certs[0], annotations)
+}
+
+// secretDataHashCreator wraps a certrotation.TargetCertCreator and records the SecretDataHash of every newly issued
+// certificate on the managed secret, so SecretDataTampered can later check its data. It relies on certrotation writing
+// the PEM bytes of the cert key pair as the tls.crt and tls.key data of the secret.
+type secretDataHashCreator struct {
+	certrotation.TargetCertCreator
+}
+
+func (c *secretDataHashCreator) SetAnnotations(cert *crypto.TLSCertificateConfig, annotations map[string]string) map[string]string {
+	annotations = c.TargetCertCreator.SetAnnotations(cert, annotations)
+	certBytes, keyBytes, err := cert.GetPEMBytes()
+	if err != nil {
+		// the secret data was written from the same bytes, this can't fail here
+		return annotations
+	}
+	issued := &corev1.Secret{Data: map[string][]byte{
+		corev1.TLSCertKey:       certBytes,
+		corev1.TLSPrivateKeyKey: keyBytes,
+	}}
+	annotations[SecretDataHashAnnotation] = SecretDataHash(issued)
+	return annotations
+}
+
+func setCertMetadataAnnotations(cert *x509.Certificate, annotations map[string]string) map[string]string {
+	sans := sets.NewString(cert.DNSNames...)
+	for _, ip := range cert.IPAddresses {
+		sans.Insert(ip.String())
+	}
+
+	annotations[CertNotAfterAnnotation] = cert.NotAfter.Format(time.RFC3339)
+	annotations[CertSerialAnnotation] = cert.SerialNumber.String()
+	// List does a sort so that we have a consistent representation
+	annotations[CertSANsAnnotation] = strings.Join(sans.List(), ",")
+	return annotations
+}
+
+// SecretDataHash returns the hex encoded SHA-256 over the ca.crt, tls.crt and tls.key data of the given secret. The
+// keys are hashed in a fixed order with their values length-prefixed, so the hash does not depend on the ordering of
+// the data map and a value moved to another key, or a key removed, changes the hash. Other keys are not covered.
+func SecretDataHash(secret *corev1.Secret) string {
+	hash := sha256.New()
+	for _, key := range secretDataHashKeys {
+		value, ok := secret.Data[key]
+		if !ok {
+			continue
+		}
+		_, _ = fmt.Fprintf(hash, "%s\x00%d\x00", key, len(value))
+		_, _ = hash.Write(value)
+	}
+	return hex.EncodeToString(hash.Sum(nil))
+}
+
+// SetSecretDataHashAnnotation records the SecretDataHash of the given secret in its SecretDataHashAnnotation. It must be
+// called whenever the operator writes the data of the secret outside of certrotation, the cert creators of this package
+// record the hash of every cert they issue.
+func SetSecretDataHashAnnotation(secret *corev1.Secret) {
+	if secret.Annotations == nil {
+		secret.Annotations = map[string]string{}
+	}
+	secret.Annotations[SecretDataHashAnnotation] = SecretDataHash(secret)
+}
+
+// SecretDataTampered returns whether the ca.crt, tls.crt or tls.key data of the given managed secret changed since its
+// SecretDataHashAnnotation was recorded, e.g. by somebody editing the secret by hand. Unlike ValidateCertKeyPair it
+// catches any drift, also a cert replaced together with its key. recorded is false if the secret carries no hash, its
+// data can't be checked then. A controller can flag tampered secrets or force their regeneration, see
+// ForceRegenerateServingCert.
+func SecretDataTampered(secret *corev1.Secret) (tampered bool, recorded bool) {
+	recordedHash, ok := secret.Annotations[SecretDataHashAnnotation]
+	if !ok {
+		return false, false
+	}
+	return recordedHash != SecretDataHash(secret), true
+}
@@ -0,0 +1,105 @@
+package tlshelpers
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+
+	"github.com/openshift/cluster-etcd-operator/pkg/operator/operatorclient"
+	u "github.com/openshift/cluster-etcd-operator/pkg/testutils"
+)
+
+func TestSecretDataHash(t *testing.T) {
+	signer := newTestSigner(t, "etcd-signer")
+	caCert, _, err := signer.Config.GetPEMBytes()
+	require.NoError(t, err)
+	managed := func() *corev1.Secret {
+		secret := newTestCertSecret(t, signer, GetServingSecretNameForNode("master-0"), []string{"10.0.0.1"})
+		secret.Data[corev1.ServiceAccountRootCAKey] = caCert
+		return secret
+	}
+	original := managed()
+	SetSecretDataHashAnnotation(original)
+	other := newTestCertSecret(t, signer, GetServingSecretNameForNode("master-0"), []string{"10.0.0.1"})
+
+	tests := map[string]struct {
+		tamper           func(secret *corev1.Secret)
+		expectedTampered bool
+		expectedRecorded bool
+	}{
+		"unchanged": {
+			expectedRecorded: true,
+		},
+		"unrelated key added": {
+			tamper: func(secret *corev1.Secret) {
+				secret.Data["README"] = []byte("not covered")
+			},
+			expectedRecorded: true,
+		},
+		"unrelated annotation changed": {
+			tamper: func(secret *corev1.Secret) {
+				secret.Annotations[CertSerialAnnotation] = "42"
+			},
+			expectedRecorded: true,
+		},
+		"cert and key replaced": {
+			tamper: func(secret *corev1.Secret) {
+				secret.Data[corev1.TLSCertKey] = other.Data[corev1.TLSCertKey]
+				secret.Data[corev1.TLSPrivateKeyKey] = other.Data[corev1.TLSPrivateKeyKey]
+			},
+			expectedTampered: true,
+			expectedRecorded: true,
+		},
+		"ca.crt emptied": {
+			tamper: func(secret *corev1.Secret) {
+				secret.Data[corev1.ServiceAccountRootCAKey] = []byte{}
+			},
+			expectedTampered: true,
+			expectedRecorded: true,
+		},
+		"ca.crt removed": {
+			tamper: func(secret *corev1.Secret) {
+				delete(secret.Data, corev1.ServiceAccountRootCAKey)
+			},
+			expectedTampered: true,
+			expectedRecorded: true,
+		},
+		"cert moved to ca.crt": {
+			tamper: func(secret *corev1.Secret) {
+				secret.Data[corev1.ServiceAccountRootCAKey] = secret.Data[corev1.TLSCertKey]
+				secret.Data[corev1.TLSCertKey] = caCert
+			},
+			expectedTampered: true,
+			expectedRecorded: true,
+		},
+		"hash not recorded": {
+			tamper: func(secret *corev1.Secret) {
+				delete(secret.Annotations, SecretDataHashAnnotation)
+			},
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			secret := original.DeepCopy()
+			if test.tamper != nil {
+				test.tamper(secret)
+			}
+			tampered, recorded := SecretDataTampered(secret)
+			require.Equal(t, test.expectedTampered, tampered)
+			require.Equal(t, test.expectedRecorded, recorded)
+		})
+	}
+
+	// the hash does not depend on the order the data map is built in
+	reordered := u.FakeSecret(operatorclient.TargetNamespace, original.Name, map[string][]byte{
+		corev1.TLSPrivateKeyKey:        original.Data[corev1.TLSPrivateKeyKey],
+		corev1.ServiceAccountRootCAKey: original.Data[corev1.ServiceAccountRootCAKey],
+		corev1.TLSCertKey:              original.Data[corev1.TLSCertKey],
+	})
+	for i := 0; i < 10; i++ {
+		require.Equal(t, original.Annotations[SecretDataHashAnnotation], SecretDataHash(reordered))
+	}
+	require.Len(t, SecretDataHash(reordered), 64)
+}
@@ -0,0 +1,82 @@
+package tlshelpers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	corev1client "k8s.io/client-go/kubernetes/typed/core/v1"
+	"k8s.io/klog/v2"
+
+	"github.com/openshift/cluster-etcd-operator/pkg/operator/operatorclient"
+)
+
+// CertAuditEntry is the subject and issuer of the cert stored in a managed secret.
+type CertAuditEntry struct {
+	// Secret is the namespace/name of the secret the cert was read from.
+	Secret              string   `json:"secret"`
+	CommonName          string   `json:"commonName"`
+	Organizations       []string `json:"organizations,omitempty"`
+	IssuerCommonName    string   `json:"issuerCommonName"`
+	IssuerOrganizations []string `json:"issuerOrganizations,omitempty"`
+}
+
+// AuditCertSubjects returns the subject and issuer of the certs in all managed secrets for the given nodes: the
+// signers, the clients and the peer, serving and serving metrics certs of every node. Managed secrets that do not
+// exist are skipped.
+func AuditCertSubjects(ctx context.Context, secretClient corev1client.SecretsGetter, nodeNames []string) ([]CertAuditEntry, error) {
+	var entries []CertAuditEntry
+	for _, managed := range managedSecrets(nodeNames) {
+		secret, err := secretClient.Secrets(operatorclient.TargetNamespace).Get(ctx, managed.name, metav1.GetOptions{})
+		if err != nil {
+			if apierrors.IsNotFound(err) {
+				continue
+			}
+			return nil, fmt.Errorf("error getting %s/%s: %w", operatorclient.TargetNamespace, managed.name, err)
+		}
+
+		cert, err := certFromSecret(secret)
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, CertAuditEntry{
+			Secret:              secret.Namespace + "/" + secret.Name,
+			CommonName:          cert.Subject.CommonName,
+			Organizations:       cert.Subject.Organization,
+			IssuerCommonName:    cert.Issuer.CommonName,
+			IssuerOrganizations: cert.Issuer.Organization,
+		})
+	}
+	return entries, nil
+}
+
+// NewCertAuditHandler returns a read-only debug handler that serves AuditCertSubjects for the nodes returned by
+// nodeNames as JSON.
+func NewCertAuditHandler(secretClient corev1client.SecretsGetter, nodeNames func() ([]string, error)) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			w.Header().Set("Allow", http.MethodGet)
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		names, err := nodeNames()
+		if err != nil {
+			http.Error(w, fmt.Sprintf("could not list nodes: %v", err), http.StatusInternalServerError)
+			return
+		}
+		entries, err := AuditCertSubjects(r.Context(), secretClient, names)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(entries); err != nil {
+			klog.Errorf("failed to write cert audit response: %v", err)
+		}
+	})
+}
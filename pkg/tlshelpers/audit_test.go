@@ -0,0 +1,76 @@
+package tlshelpers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/client-go/kubernetes/fake"
+
+	"github.com/openshift/cluster-etcd-operator/pkg/operator/operatorclient"
+	u "github.com/openshift/cluster-etcd-operator/pkg/testutils"
+)
+
+func TestAuditCertSubjects(t *testing.T) {
+	signer := newTestSigner(t, "etcd-signer")
+	caCert, caKey, err := signer.Config.GetPEMBytes()
+	require.NoError(t, err)
+	certPEM, keyPEM, err := CreateServerCertKeyWithContext(context.TODO(), caCert, caKey, "master-0", []string{"10.0.0.1"})
+	require.NoError(t, err)
+
+	fakeKubeClient := fake.NewSimpleClientset(
+		newTestCASecret(t, signer, operatorclient.TargetNamespace, EtcdSignerCertSecretName),
+		u.FakeSecret(operatorclient.TargetNamespace, GetServingSecretNameForNode("master-0"), map[string][]byte{
+			corev1.TLSCertKey:       certPEM.Bytes(),
+			corev1.TLSPrivateKeyKey: keyPEM.Bytes(),
+		}),
+	)
+
+	entries, err := AuditCertSubjects(context.TODO(), fakeKubeClient.CoreV1(), []string{"master-0", "master-1"})
+	require.NoError(t, err)
+	expected := []CertAuditEntry{
+		{
+			Secret:           "openshift-etcd/etcd-signer",
+			CommonName:       "etcd-signer",
+			IssuerCommonName: "etcd-signer",
+		},
+		{
+			Secret:           "openshift-etcd/etcd-serving-master-0",
+			CommonName:       "system:etcd-server:master-0",
+			Organizations:    []string{"system:etcd-servers"},
+			IssuerCommonName: "etcd-signer",
+		},
+	}
+	require.Equal(t, expected, entries)
+
+	handler := NewCertAuditHandler(fakeKubeClient.CoreV1(), func() ([]string, error) {
+		return []string{"master-0"}, nil
+	})
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/debug/certs", nil))
+	require.Equal(t, http.StatusOK, recorder.Code)
+	require.Equal(t, "application/json", recorder.Header().Get("Content-Type"))
+	var served []CertAuditEntry
+	require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &served))
+	require.Equal(t, expected, served)
+
+	recorder = httptest.NewRecorder()
+	handler.ServeHTTP(recorder, httptest.NewRequest(http.MethodPost, "/debug/certs", nil))
+	require.Equal(t, http.StatusMethodNotAllowed, recorder.Code)
+
+	recorder = httptest.NewRecorder()
+	NewCertAuditHandler(fakeKubeClient.CoreV1(), func() ([]string, error) {
+		return nil, fmt.Errorf("node lister not synced")
+	}).ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/debug/certs", nil))
+	require.Equal(t, http.StatusInternalServerError, recorder.Code)
+
+	// a secret without a parsable cert fails the audit
+	fakeKubeClient = fake.NewSimpleClientset(u.FakeSecret(operatorclient.TargetNamespace, EtcdClientCertSecretName, nil))
+	_, err = AuditCertSubjects(context.TODO(), fakeKubeClient.CoreV1(), nil)
+	require.Error(t, err)
+}
@@ -0,0 +1,73 @@
+package tlshelpers
+
+import (
+	"crypto/x509"
+	"fmt"
+	"strings"
+
+	"github.com/openshift/library-go/pkg/crypto"
+	"github.com/openshift/library-go/pkg/operator/certrotation"
+	"github.com/openshift/library-go/pkg/operator/events"
+	"k8s.io/apimachinery/pkg/util/validation"
+	corev1informers "k8s.io/client-go/informers/core/v1"
+	corev1client "k8s.io/client-go/kubernetes/typed/core/v1"
+	corev1listers "k8s.io/client-go/listers/core/v1"
+
+	"github.com/openshift/cluster-etcd-operator/pkg/operator/operatorclient"
+)
+
+// ValidateBackupDestinationHostname returns an error if the given backup destination hostname is not a valid DNS name.
+func ValidateBackupDestinationHostname(hostname string) error {
+	if errs := validation.IsDNS1123Subdomain(hostname); len(errs) > 0 {
+		return fmt.Errorf("invalid backup destination hostname %q: %s", hostname, strings.Join(errs, ", "))
+	}
+	return nil
+}
+
+// CreateBackupDestinationCert creates the dedicated serving cert, signed by the etcd signer, for a cluster-external
+// etcd proxy backups are streamed to over TLS. The cert only covers the configured backup destination hostname.
+// There is no backup destination by default, callers should only create the cert once a hostname is configured.
+func CreateBackupDestinationCert(
+	hostname string,
+	secretInformer corev1informers.SecretInformer,
+	secretLister corev1listers.SecretLister,
+	secretGetter corev1client.SecretsGetter,
+	recorder events.Recorder,
+	opts ...CertOption) (*certrotation.RotatedSelfSignedCertKeySecret, error) {
+
+	if err := ValidateBackupDestinationHostname(hostname); err != nil {
+		return nil, err
+	}
+
+	certOpts := newCertOptions(opts...)
+	creator := &servingRotation{
+		ServingRotation: certrotation.ServingRotation{
+			Hostnames: func() []string {
+				return []string{hostname}
+			},
+			CertificateExtensionFn: append([]crypto.CertificateExtensionFunc{
+				func(certificate *x509.Certificate) error {
+					certificate.ExtKeyUsage = []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth}
+					return nil
+				},
+			}, certOpts.extensionFns()...),
+		},
+		keyAlgorithm: certOpts.keyAlgorithm,
+		rsaKeySize:   certOpts.rsaKeySize,
+	}
+
+	return &certrotation.RotatedSelfSignedCertKeySecret{
+		Namespace:     operatorclient.TargetNamespace,
+		Name:          EtcdBackupDestinationCertSecretName,
+		JiraComponent: certOpts.jiraComponentName(),
+		Description:   certOpts.description("serving certificate of the backup destination " + hostname),
+		Validity:      certOpts.certValidity(),
+		Refresh:       certOpts.certRefresh(),
+		CertCreator:   certOpts.wrapCertCreator(creator),
+
+		Informer:      secretInformer,
+		Lister:        secretLister,
+		Client:        secretGetter,
+		EventRecorder: recorder,
+	}, nil
+}
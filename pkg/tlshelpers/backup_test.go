@@ -0,0 +1,59 @@
+package tlshelpers
+
+import (
+	"context"
+	"crypto/x509"
+	"testing"
+
+	"github.com/openshift/library-go/pkg/operator/events"
+	"github.com/stretchr/testify/require"
+	"k8s.io/client-go/kubernetes/fake"
+	corev1listers "k8s.io/client-go/listers/core/v1"
+	"k8s.io/client-go/tools/cache"
+)
+
+func TestCreateBackupDestinationCert(t *testing.T) {
+	signer := newTestSigner(t, "etcd-signer")
+
+	tests := map[string]struct {
+		hostname    string
+		expectedErr bool
+	}{
+		"valid hostname": {
+			hostname: "backup-proxy.example.com",
+		},
+		"no hostname configured": {
+			expectedErr: true,
+		},
+		"not a DNS name": {
+			hostname:    "https://backup-proxy.example.com:2379",
+			expectedErr: true,
+		},
+		"upper case": {
+			hostname:    "Backup-Proxy.example.com",
+			expectedErr: true,
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			fakeKubeClient := fake.NewSimpleClientset()
+			secretLister := corev1listers.NewSecretLister(cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{}))
+			certSecret, err := CreateBackupDestinationCert(test.hostname, nil, secretLister, fakeKubeClient.CoreV1(), events.NewInMemoryRecorder(t.Name()))
+			if test.expectedErr {
+				require.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+
+			secret, err := certSecret.EnsureTargetCertKeyPair(context.TODO(), signer, signer.Config.Certs)
+			require.NoError(t, err)
+			require.Equal(t, EtcdBackupDestinationCertSecretName, secret.Name)
+			cert := parseSecretCert(t, secret)
+			require.Equal(t, []string{test.hostname}, cert.DNSNames)
+			require.Empty(t, cert.IPAddresses)
+			require.NoError(t, cert.VerifyHostname(test.hostname))
+			require.Equal(t, []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth}, cert.ExtKeyUsage)
+		})
+	}
+}
@@ -0,0 +1,298 @@
+package tlshelpers
+
+import (
+	"bytes"
+	"context"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/openshift/library-go/pkg/crypto"
+	"github.com/openshift/library-go/pkg/operator/certrotation"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/client-go/util/cert"
+)
+
+// caBundleKey is the key of the PEM encoded CAs in the CA bundle configmaps.
+const caBundleKey = "ca-bundle.crt"
+
+// DefaultMinTrustedCAs is the minimum number of CAs a managed CA bundle must trust unless configured otherwise, see
+// WithMinTrustedCAs.
+const DefaultMinTrustedCAs = 1
+
+// MinTrustedCABundleConfigMap maintains a CA bundle configmap just like certrotation.CABundleConfigMap, but refuses to
+// write a bundle that would trust fewer than MinTrustedCAs certificates. This guards against the bundle collapsing, e.g.
+// by pruning expired CAs, at the moment a rotation needs both the old and the new CA to be trusted.
+type MinTrustedCABundleConfigMap struct {
+	certrotation.CABundleConfigMap
+	// MinTrustedCAs is the minimum number of CAs the bundle must contain after an update, defaults to DefaultMinTrustedCAs.
+	MinTrustedCAs int
+}
+
+func (c MinTrustedCABundleConfigMap) EnsureConfigMapCABundle(ctx context.Context, signingCertKeyPair *crypto.CA) ([]*x509.Certificate, error) {
+	minTrustedCAs := c.MinTrustedCAs
+	if minTrustedCAs <= 0 {
+		minTrustedCAs = DefaultMinTrustedCAs
+	}
+
+	var existingCerts []*x509.Certificate
+	existing, err := c.Lister.ConfigMaps(c.Namespace).Get(c.Name)
+	if err != nil && !apierrors.IsNotFound(err) {
+		return nil, err
+	}
+	if err == nil && len(existing.Data[caBundleKey]) > 0 {
+		existingCerts, err = cert.ParseCertsPEM([]byte(existing.Data[caBundleKey]))
+		if err != nil {
+			return nil, fmt.Errorf("could not parse %s/%s: %w", c.Namespace, c.Name, err)
+		}
+	}
+
+	updatedCerts := updatedCABundle(existingCerts, signingCertKeyPair.Config.Certs[0])
+	if len(updatedCerts) < minTrustedCAs {
+		c.EventRecorder.Warningf("CABundleBelowMinTrustedCAs", "refusing to update %q in %q: it would trust %d CAs, but at least %d are required",
+			c.Name, c.Namespace, len(updatedCerts), minTrustedCAs)
+		return nil, fmt.Errorf("refusing to update configmap %s/%s with %d trusted CAs, the minimum is %d", c.Namespace, c.Name, len(updatedCerts), minTrustedCAs)
+	}
+
+	return c.CABundleConfigMap.EnsureConfigMapCABundle(ctx, signingCertKeyPair)
+}
+
+// updatedCABundle returns the certs the bundle trusts after adding the signer, the same way
+// certrotation.CABundleConfigMap does: expired certs are pruned and duplicates removed.
+func updatedCABundle(existingCerts []*x509.Certificate, signer *x509.Certificate) []*x509.Certificate {
+	certs := crypto.FilterExpiredCerts(append([]*x509.Certificate{signer}, existingCerts...)...)
+
+	var updatedCerts []*x509.Certificate
+	for _, c := range certs {
+		found := false
+		for _, u := range updatedCerts {
+			if bytes.Equal(c.Raw, u.Raw) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			updatedCerts = append(updatedCerts, c)
+		}
+	}
+	return updatedCerts
+}
+
+// CertInfo identifies a cert of a CA bundle.
+type CertInfo struct {
+	CommonName       string
+	IssuerCommonName string
+	SerialNumber     string
+	NotBefore        time.Time
+	NotAfter         time.Time
+	// Fingerprint is the SHA-256 fingerprint of the cert, see CertFingerprint.
+	Fingerprint string
+}
+
+// DiffCABundles compares two PEM encoded CA bundles, e.g. the ca-bundle.crt of the etcd-ca-bundle or the
+// etcd-metrics-ca-bundle before and after a signer rotation. It returns the certs only trusted by the new bundle and
+// the ones only trusted by the old bundle, each in bundle order. Certs are compared byte for byte, so a CA that was
+// re-issued with the same subject shows up as removed and added. An empty bundle trusts no certs.
+func DiffCABundles(oldBundle, newBundle []byte) (added, removed []CertInfo, err error) {
+	oldCerts, err := parseCABundle(oldBundle)
+	if err != nil {
+		return nil, nil, fmt.Errorf("could not parse the old CA bundle: %w", err)
+	}
+	newCerts, err := parseCABundle(newBundle)
+	if err != nil {
+		return nil, nil, fmt.Errorf("could not parse the new CA bundle: %w", err)
+	}
+	return certsNotIn(newCerts, oldCerts), certsNotIn(oldCerts, newCerts), nil
+}
+
+func parseCABundle(bundle []byte) ([]*x509.Certificate, error) {
+	if len(bytes.TrimSpace(bundle)) == 0 {
+		return nil, nil
+	}
+	return cert.ParseCertsPEM(bundle)
+}
+
+// certsNotIn returns the infos of all certs that are not part of others.
+func certsNotIn(certs, others []*x509.Certificate) []CertInfo {
+	var infos []CertInfo
+	for _, c := range certs {
+		found := false
+		for _, o := range others {
+			if bytes.Equal(c.Raw, o.Raw) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			infos = append(infos, newCertInfo(c))
+		}
+	}
+	return infos
+}
+
+func newCertInfo(c *x509.Certificate) CertInfo {
+	return CertInfo{
+		CommonName:       c.Subject.CommonName,
+		IssuerCommonName: c.Issuer.CommonName,
+		SerialNumber:     c.SerialNumber.String(),
+		NotBefore:        c.NotBefore,
+		NotAfter:         c.NotAfter,
+		Fingerprint:      CertFingerprint(c),
+	}
+}
+
+// PrunableCAs returns the CAs of bundlePEM, e.g. the ca-bundle.crt of the etcd-ca-bundle, that can safely be removed
+// from it: CAs that are expired at now and cover none of the given PEM encoded leafs, see BundleCoversLeaf. The leafs
+// must be all certs currently deployed, a CA that issued any of them is kept even if it is expired, as are CAs that
+// are not expired yet. Pruning never leaves the bundle with fewer than minTrustedCAs distinct CAs, the CAs that expired
+// first are pruned then, non-positive values select DefaultMinTrustedCAs. The CAs are returned once each, in bundle
+// order. Any leaf that cannot be parsed or verified fails the whole call, so that a CA is never reported as prunable
+// by mistake.
+func PrunableCAs(bundlePEM []byte, liveLeafCerts [][]byte, now time.Time, minTrustedCAs int) ([]CertInfo, error) {
+	if minTrustedCAs <= 0 {
+		minTrustedCAs = DefaultMinTrustedCAs
+	}
+	cas, err := parseCABundle(bundlePEM)
+	if err != nil {
+		return nil, fmt.Errorf("could not parse the CA bundle: %w", err)
+	}
+	leafs := make([][]*x509.Certificate, 0, len(liveLeafCerts))
+	for i, leafPEM := range liveLeafCerts {
+		certs, err := crypto.CertsFromPEM(leafPEM)
+		if err != nil {
+			return nil, fmt.Errorf("could not parse leaf cert %d: %w", i, err)
+		}
+		leafs = append(leafs, certs)
+	}
+
+	var prunable []CertInfo
+	seen := sets.NewString()
+	for _, ca := range cas {
+		fingerprint := CertFingerprint(ca)
+		if now.Before(ca.NotAfter) || seen.Has(fingerprint) {
+			continue
+		}
+		seen.Insert(fingerprint)
+		issuedLiveLeaf := false
+		for _, leaf := range leafs {
+			covered, err := casCoverLeaf([]*x509.Certificate{ca}, leaf)
+			if err != nil {
+				return nil, err
+			}
+			if covered {
+				issuedLiveLeaf = true
+				break
+			}
+		}
+		if !issuedLiveLeaf {
+			prunable = append(prunable, newCertInfo(ca))
+		}
+	}
+
+	distinct := sets.NewString()
+	for _, ca := range cas {
+		distinct.Insert(CertFingerprint(ca))
+	}
+	maxPrunable := distinct.Len() - minTrustedCAs
+	if maxPrunable <= 0 {
+		return nil, nil
+	}
+	if len(prunable) <= maxPrunable {
+		return prunable, nil
+	}
+
+	byExpiry := make([]int, len(prunable))
+	for i := range byExpiry {
+		byExpiry[i] = i
+	}
+	sort.SliceStable(byExpiry, func(i, j int) bool {
+		return prunable[byExpiry[i]].NotAfter.Before(prunable[byExpiry[j]].NotAfter)
+	})
+	pruned := sets.NewInt(byExpiry[:maxPrunable]...)
+	var limited []CertInfo
+	for i, ca := range prunable {
+		if pruned.Has(i) {
+			limited = append(limited, ca)
+		}
+	}
+	return limited, nil
+}
+
+// BundleCoversLeaf returns whether a chain can be built from the leaf cert in leafPEM to any of the CAs in bundlePEM,
+// e.g. to make sure no deployed leaf still depends on a CA before it is pruned from the etcd-ca-bundle. Certs following
+// the leaf in leafPEM are used as intermediates, and a CA of the bundle that is itself an intermediate is accepted as
+// anchor, as is a self-signed leaf that is part of the bundle. The chain is checked at the time the leaf was issued and
+// regardless of its usages, so expired leafs and CAs are still reported as covered. Issuers are matched by signature,
+// a CA that was re-issued with the same subject but a new key does not cover the leafs of its predecessor.
+// An empty bundle covers no leaf. Any failure other than the leaf being of an unknown authority is returned as error,
+// callers must not treat it as the leaf not being covered.
+func BundleCoversLeaf(bundlePEM []byte, leafPEM []byte) (bool, error) {
+	cas, err := parseCABundle(bundlePEM)
+	if err != nil {
+		return false, fmt.Errorf("could not parse the CA bundle: %w", err)
+	}
+	certs, err := crypto.CertsFromPEM(leafPEM)
+	if err != nil {
+		return false, fmt.Errorf("could not parse the leaf cert: %w", err)
+	}
+	return casCoverLeaf(cas, certs)
+}
+
+// casCoverLeaf is BundleCoversLeaf for the parsed CAs and leaf cert, followed by its intermediates.
+func casCoverLeaf(cas []*x509.Certificate, certs []*x509.Certificate) (bool, error) {
+	if len(cas) == 0 {
+		return false, nil
+	}
+
+	roots := x509.NewCertPool()
+	for _, ca := range cas {
+		roots.AddCert(ca)
+	}
+	intermediates := x509.NewCertPool()
+	for _, intermediate := range certs[1:] {
+		intermediates.AddCert(intermediate)
+	}
+	_, err := certs[0].Verify(x509.VerifyOptions{
+		Roots:         roots,
+		Intermediates: intermediates,
+		CurrentTime:   certs[0].NotBefore,
+		KeyUsages:     []x509.ExtKeyUsage{x509.ExtKeyUsageAny},
+	})
+	if err == nil {
+		return true, nil
+	}
+	var unknownAuthorityErr x509.UnknownAuthorityError
+	if errors.As(err, &unknownAuthorityErr) {
+		return false, nil
+	}
+	return false, fmt.Errorf("could not verify %q against the CA bundle: %w", certs[0].Subject.CommonName, err)
+}
+
+// ActiveSignerInBundle returns whether the cert of the given signer secret, e.g. etcd-signer, is one of the CAs of the
+// given CA bundle configmap, e.g. etcd-ca-bundle. The bundle may trust any number of CAs, e.g. the previous signer
+// during a rotation. A signer missing from the bundle, e.g. because a rotated signer was not synced into it yet,
+// breaks the TLS of every leaf it issues.
+func ActiveSignerInBundle(signerSecret *corev1.Secret, bundle *corev1.ConfigMap) (bool, error) {
+	signerPEM := signerSecret.Data[corev1.TLSCertKey]
+	if len(signerPEM) == 0 {
+		return false, fmt.Errorf("secret %s/%s is missing %s", signerSecret.Namespace, signerSecret.Name, corev1.TLSCertKey)
+	}
+	fingerprint, err := SignerFingerprint(signerPEM)
+	if err != nil {
+		return false, err
+	}
+	bundleCerts, err := parseCABundle([]byte(bundle.Data[caBundleKey]))
+	if err != nil {
+		return false, fmt.Errorf("could not parse %s of configmap %s/%s: %w", caBundleKey, bundle.Namespace, bundle.Name, err)
+	}
+	for _, bundleCert := range bundleCerts {
+		if CertFingerprint(bundleCert) == fingerprint {
+			return true, nil
+		}
+	}
+	return false, nil
+}
@@ -0,0 +1,471 @@
+package tlshelpers
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/openshift/library-go/pkg/crypto"
+	"github.com/openshift/library-go/pkg/operator/events"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/client-go/kubernetes/fake"
+	corev1listers "k8s.io/client-go/listers/core/v1"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/util/cert"
+
+	"github.com/openshift/cluster-etcd-operator/pkg/operator/operatorclient"
+)
+
+func TestMinTrustedCABundleConfigMap(t *testing.T) {
+	signer := newTestSigner(t, "etcd-signer")
+	otherSigner := newTestSigner(t, "etcd-signer-old")
+	expiredCert := newExpiredTestCert(t)
+
+	tests := map[string]struct {
+		minTrustedCAs     int
+		existingCerts     []*x509.Certificate
+		expectedErr       bool
+		expectedBundleLen int
+	}{
+		"new bundle with the default minimum": {
+			expectedBundleLen: 1,
+		},
+		"new bundle below the minimum is refused": {
+			minTrustedCAs: 2,
+			expectedErr:   true,
+		},
+		"expired CA is pruned with the default minimum": {
+			existingCerts:     []*x509.Certificate{expiredCert, signer.Config.Certs[0]},
+			expectedBundleLen: 1,
+		},
+		"pruning stops at the minimum": {
+			minTrustedCAs:     2,
+			existingCerts:     []*x509.Certificate{expiredCert, signer.Config.Certs[0]},
+			expectedErr:       true,
+			expectedBundleLen: 2,
+		},
+		"rotation with both CAs satisfies the minimum": {
+			minTrustedCAs:     2,
+			existingCerts:     []*x509.Certificate{otherSigner.Config.Certs[0]},
+			expectedBundleLen: 2,
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			indexer := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{})
+			fakeKubeClient := fake.NewSimpleClientset()
+			if len(test.existingCerts) > 0 {
+				caBytes, err := crypto.EncodeCertificates(test.existingCerts...)
+				require.NoError(t, err)
+				cm := &corev1.ConfigMap{
+					ObjectMeta: metav1.ObjectMeta{Namespace: operatorclient.TargetNamespace, Name: EtcdSignerCaBundleConfigMapName},
+					Data:       map[string]string{"ca-bundle.crt": string(caBytes)},
+				}
+				require.NoError(t, indexer.Add(cm))
+				fakeKubeClient = fake.NewSimpleClientset(cm)
+			}
+			recorder := events.NewInMemoryRecorder(t.Name())
+
+			bundle := CreateSignerCertRotationBundleConfigMap(nil, corev1listers.NewConfigMapLister(indexer), fakeKubeClient.CoreV1(), recorder,
+				WithMinTrustedCAs(test.minTrustedCAs))
+			_, err := bundle.EnsureConfigMapCABundle(context.TODO(), signer)
+
+			cm, getErr := fakeKubeClient.CoreV1().ConfigMaps(operatorclient.TargetNamespace).Get(context.TODO(), EtcdSignerCaBundleConfigMapName, metav1.GetOptions{})
+			if test.expectedErr {
+				require.Error(t, err)
+				require.Len(t, recorder.Events(), 1)
+				require.Equal(t, "CABundleBelowMinTrustedCAs", recorder.Events()[0].Reason)
+			} else {
+				require.NoError(t, err)
+			}
+			if test.expectedBundleLen == 0 {
+				require.True(t, apierrors.IsNotFound(getErr))
+				return
+			}
+			require.NoError(t, getErr)
+			certs, err := cert.ParseCertsPEM([]byte(cm.Data["ca-bundle.crt"]))
+			require.NoError(t, err)
+			require.Len(t, certs, test.expectedBundleLen)
+		})
+	}
+}
+
+func newExpiredTestCert(t *testing.T) *x509.Certificate {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	template := &x509.Certificate{
+		Subject:               pkix.Name{CommonName: "etcd-signer-expired"},
+		SerialNumber:          big.NewInt(1),
+		NotBefore:             time.Now().Add(-48 * time.Hour),
+		NotAfter:              time.Now().Add(-24 * time.Hour),
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	require.NoError(t, err)
+	expired, err := x509.ParseCertificate(der)
+	require.NoError(t, err)
+	return expired
+}
+
+func TestDiffCABundles(t *testing.T) {
+	oldSigner := newTestSigner(t, "etcd-signer-old")
+	newSigner := newTestSigner(t, "etcd-signer-new")
+	metricsSigner := newTestSigner(t, "etcd-metric-signer")
+	bundle := func(signers ...*crypto.CA) []byte {
+		var certs []*x509.Certificate
+		for _, signer := range signers {
+			certs = append(certs, signer.Config.Certs...)
+		}
+		pem, err := crypto.EncodeCertificates(certs...)
+		require.NoError(t, err)
+		return pem
+	}
+	names := func(infos []CertInfo) []string {
+		var commonNames []string
+		for _, info := range infos {
+			commonNames = append(commonNames, info.CommonName)
+		}
+		return commonNames
+	}
+
+	tests := map[string]struct {
+		oldBundle, newBundle []byte
+		expectedAdded        []string
+		expectedRemoved      []string
+	}{
+		"unchanged single cert": {
+			oldBundle: bundle(oldSigner),
+			newBundle: bundle(oldSigner),
+		},
+		"new bundle": {
+			newBundle:     bundle(oldSigner),
+			expectedAdded: []string{"etcd-signer-old"},
+		},
+		"rotation started": {
+			oldBundle:     bundle(oldSigner),
+			newBundle:     bundle(newSigner, oldSigner),
+			expectedAdded: []string{"etcd-signer-new"},
+		},
+		"rotation completed": {
+			oldBundle:       bundle(newSigner, oldSigner),
+			newBundle:       bundle(newSigner),
+			expectedRemoved: []string{"etcd-signer-old"},
+		},
+		"multi cert bundles": {
+			oldBundle:       bundle(oldSigner, metricsSigner),
+			newBundle:       bundle(newSigner, metricsSigner),
+			expectedAdded:   []string{"etcd-signer-new"},
+			expectedRemoved: []string{"etcd-signer-old"},
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			added, removed, err := DiffCABundles(test.oldBundle, test.newBundle)
+			require.NoError(t, err)
+			require.Equal(t, test.expectedAdded, names(added))
+			require.Equal(t, test.expectedRemoved, names(removed))
+		})
+	}
+
+	added, _, err := DiffCABundles(nil, bundle(newSigner))
+	require.NoError(t, err)
+	require.Equal(t, CertInfo{
+		CommonName:       "etcd-signer-new",
+		IssuerCommonName: "etcd-signer-new",
+		SerialNumber:     newSigner.Config.Certs[0].SerialNumber.String(),
+		NotBefore:        newSigner.Config.Certs[0].NotBefore,
+		NotAfter:         newSigner.Config.Certs[0].NotAfter,
+		Fingerprint:      CertFingerprint(newSigner.Config.Certs[0]),
+	}, added[0])
+
+	_, _, err = DiffCABundles([]byte("not a bundle"), bundle(newSigner))
+	require.ErrorContains(t, err, "could not parse the old CA bundle")
+}
+
+func TestBundleCoversLeaf(t *testing.T) {
+	encode := func(certs ...*x509.Certificate) []byte {
+		pem, err := crypto.EncodeCertificates(certs...)
+		require.NoError(t, err)
+		return pem
+	}
+	leafOf := func(signer *crypto.CA) []*x509.Certificate {
+		certConfig, err := signer.MakeServerCertForDuration(sets.NewString("10.0.0.1"), time.Hour)
+		require.NoError(t, err)
+		return certConfig.Certs
+	}
+
+	oldSigner := newTestSigner(t, "etcd-signer")
+	newSigner := newTestSigner(t, "etcd-signer")
+	otherSigner := newTestSigner(t, "etcd-metric-signer")
+	intermediateConfig, err := crypto.MakeCAConfigForDuration("etcd-intermediate", time.Hour, oldSigner)
+	require.NoError(t, err)
+	intermediate := &crypto.CA{Config: intermediateConfig, SerialGenerator: &crypto.RandomSerialGenerator{}}
+	selfSigned, err := crypto.MakeSelfSignedCAConfig("etcd-self-signed", 1)
+	require.NoError(t, err)
+
+	expired := newExpiredTestCert(t)
+	oldLeaf := leafOf(oldSigner)
+	intermediateLeaf := leafOf(intermediate)
+
+	tests := map[string]struct {
+		bundle      []byte
+		leaf        []byte
+		expected    bool
+		expectedErr string
+	}{
+		"issuer in bundle": {
+			bundle:   encode(oldSigner.Config.Certs[0]),
+			leaf:     encode(oldLeaf...),
+			expected: true,
+		},
+		"issuer among others": {
+			bundle:   encode(otherSigner.Config.Certs[0], newSigner.Config.Certs[0], oldSigner.Config.Certs[0]),
+			leaf:     encode(oldLeaf[0]),
+			expected: true,
+		},
+		"other issuer": {
+			bundle: encode(otherSigner.Config.Certs[0]),
+			leaf:   encode(oldLeaf...),
+		},
+		"issuer re-issued with the same subject": {
+			bundle: encode(newSigner.Config.Certs[0]),
+			leaf:   encode(oldLeaf...),
+		},
+		"root of the intermediate in bundle": {
+			bundle:   encode(oldSigner.Config.Certs[0]),
+			leaf:     encode(intermediateLeaf...),
+			expected: true,
+		},
+		"root of the intermediate in bundle without intermediate": {
+			bundle: encode(oldSigner.Config.Certs[0]),
+			leaf:   encode(intermediateLeaf[0]),
+		},
+		"intermediate in bundle": {
+			bundle:   encode(intermediate.Config.Certs[0]),
+			leaf:     encode(intermediateLeaf[0]),
+			expected: true,
+		},
+		"self-signed leaf in bundle": {
+			bundle:   encode(oldSigner.Config.Certs[0], selfSigned.Certs[0]),
+			leaf:     encode(selfSigned.Certs[0]),
+			expected: true,
+		},
+		"expired self-signed leaf in bundle": {
+			bundle:   encode(expired),
+			leaf:     encode(expired),
+			expected: true,
+		},
+		"self-signed leaf not in bundle": {
+			bundle: encode(oldSigner.Config.Certs[0]),
+			leaf:   encode(selfSigned.Certs[0]),
+		},
+		"empty bundle": {
+			leaf: encode(oldLeaf...),
+		},
+		"invalid bundle": {
+			bundle:      []byte("not a bundle"),
+			leaf:        encode(oldLeaf...),
+			expectedErr: "could not parse the CA bundle: data does not contain any valid RSA or ECDSA certificates",
+		},
+		"invalid leaf": {
+			bundle:      encode(oldSigner.Config.Certs[0]),
+			expectedErr: "could not parse the leaf cert: Could not read any certificates",
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			covered, err := BundleCoversLeaf(test.bundle, test.leaf)
+			if len(test.expectedErr) > 0 {
+				require.EqualError(t, err, test.expectedErr)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, test.expected, covered)
+		})
+	}
+}
+
+func TestActiveSignerInBundle(t *testing.T) {
+	oldSigner := newTestSigner(t, "etcd-signer")
+	activeSigner := newTestSigner(t, "etcd-signer")
+	otherSigner := newTestSigner(t, "etcd-metric-signer")
+	encode := func(signers ...*crypto.CA) string {
+		var certs []*x509.Certificate
+		for _, signer := range signers {
+			certs = append(certs, signer.Config.Certs[0])
+		}
+		pem, err := crypto.EncodeCertificates(certs...)
+		require.NoError(t, err)
+		return string(pem)
+	}
+	activeCertPEM, activeKeyPEM, err := activeSigner.Config.GetPEMBytes()
+	require.NoError(t, err)
+	signerSecret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Namespace: operatorclient.TargetNamespace, Name: EtcdSignerCertSecretName},
+		Data:       map[string][]byte{corev1.TLSCertKey: activeCertPEM, corev1.TLSPrivateKeyKey: activeKeyPEM},
+	}
+
+	tests := map[string]struct {
+		signerSecret  *corev1.Secret
+		bundle        string
+		expected      bool
+		expectedError string
+	}{
+		"active signer only": {
+			signerSecret: signerSecret,
+			bundle:       encode(activeSigner),
+			expected:     true,
+		},
+		"active signer among others": {
+			signerSecret: signerSecret,
+			bundle:       encode(otherSigner, oldSigner, activeSigner),
+			expected:     true,
+		},
+		"only the previous signer with the same subject": {
+			signerSecret: signerSecret,
+			bundle:       encode(oldSigner),
+		},
+		"empty bundle": {
+			signerSecret: signerSecret,
+		},
+		"invalid bundle": {
+			signerSecret:  signerSecret,
+			bundle:        "not a bundle",
+			expectedError: "could not parse ca-bundle.crt of configmap openshift-etcd/etcd-ca-bundle: data does not contain any valid RSA or ECDSA certificates",
+		},
+		"signer without cert": {
+			signerSecret: &corev1.Secret{
+				ObjectMeta: metav1.ObjectMeta{Namespace: operatorclient.TargetNamespace, Name: EtcdSignerCertSecretName},
+			},
+			bundle:        encode(activeSigner),
+			expectedError: "secret openshift-etcd/etcd-signer is missing tls.crt",
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			bundle := &corev1.ConfigMap{
+				ObjectMeta: metav1.ObjectMeta{Namespace: operatorclient.TargetNamespace, Name: EtcdSignerCaBundleConfigMapName},
+				Data:       map[string]string{"ca-bundle.crt": test.bundle},
+			}
+			inBundle, err := ActiveSignerInBundle(test.signerSecret, bundle)
+			if test.expectedError != "" {
+				require.EqualError(t, err, test.expectedError)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, test.expected, inBundle)
+		})
+	}
+}
+
+func TestPrunableCAs(t *testing.T) {
+	encode := func(certs ...*x509.Certificate) []byte {
+		pem, err := crypto.EncodeCertificates(certs...)
+		require.NoError(t, err)
+		return pem
+	}
+	leafOf := func(signer *crypto.CA) []*x509.Certificate {
+		certConfig, err := signer.MakeServerCertForDuration(sets.NewString("10.0.0.1"), time.Hour)
+		require.NoError(t, err)
+		return certConfig.Certs
+	}
+
+	// the test signers are valid for 100 days, so they are all expired a year from now
+	inAYear := time.Now().Add(365 * 24 * time.Hour)
+	issuingSigner := newTestSigner(t, "etcd-signer-1")
+	unusedSigner := newTestSigner(t, "etcd-signer-2")
+	intermediateSigner := newTestSigner(t, "etcd-signer-3")
+	currentConfig, err := crypto.MakeSelfSignedCAConfig("etcd-signer-4", 1000)
+	require.NoError(t, err)
+	currentSigner := &crypto.CA{Config: currentConfig, SerialGenerator: &crypto.RandomSerialGenerator{}}
+	intermediateConfig, err := crypto.MakeCAConfigForDuration("etcd-intermediate", time.Hour, intermediateSigner)
+	require.NoError(t, err)
+	intermediate := &crypto.CA{Config: intermediateConfig, SerialGenerator: &crypto.RandomSerialGenerator{}}
+
+	accumulated := encode(issuingSigner.Config.Certs[0], unusedSigner.Config.Certs[0], intermediateSigner.Config.Certs[0],
+		currentSigner.Config.Certs[0], unusedSigner.Config.Certs[0])
+
+	tests := map[string]struct {
+		bundle        []byte
+		leafs         [][]byte
+		now           time.Time
+		minTrustedCAs int
+		expectedCNs   []string
+		expectedErr   string
+	}{
+		"empty bundle": {
+			now: inAYear,
+		},
+		"nothing expired yet": {
+			bundle: accumulated,
+			now:    time.Now(),
+		},
+		"accumulated without live leafs": {
+			bundle:      accumulated,
+			now:         inAYear,
+			expectedCNs: []string{"etcd-signer-1", "etcd-signer-2", "etcd-signer-3"},
+		},
+		"expired CAs that issued live leafs are kept": {
+			bundle:      accumulated,
+			leafs:       [][]byte{encode(leafOf(issuingSigner)...), encode(leafOf(currentSigner)...)},
+			now:         inAYear,
+			expectedCNs: []string{"etcd-signer-2", "etcd-signer-3"},
+		},
+		"expired CA of a live leaf behind an intermediate is kept": {
+			bundle:      accumulated,
+			leafs:       [][]byte{encode(append(leafOf(intermediate), intermediate.Config.Certs[0])...)},
+			now:         inAYear,
+			expectedCNs: []string{"etcd-signer-1", "etcd-signer-2"},
+		},
+		"pruning stops at the minimum, the CAs expired first are pruned": {
+			bundle:        accumulated,
+			now:           inAYear,
+			minTrustedCAs: 3,
+			expectedCNs:   []string{"etcd-signer-1"},
+		},
+		"bundle at the minimum is not pruned": {
+			bundle:        accumulated,
+			now:           inAYear,
+			minTrustedCAs: 4,
+		},
+		"invalid leaf": {
+			bundle:      accumulated,
+			leafs:       [][]byte{encode(leafOf(issuingSigner)...), []byte("not a cert")},
+			now:         inAYear,
+			expectedErr: "could not parse leaf cert 1: Could not read any certificates",
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			prunable, err := PrunableCAs(test.bundle, test.leafs, test.now, test.minTrustedCAs)
+			if len(test.expectedErr) > 0 {
+				require.EqualError(t, err, test.expectedErr)
+				return
+			}
+			require.NoError(t, err)
+			var commonNames []string
+			for _, ca := range prunable {
+				commonNames = append(commonNames, ca.CommonName)
+				require.True(t, test.now.After(ca.NotAfter))
+			}
+			require.Equal(t, test.expectedCNs, commonNames)
+		})
+	}
+}
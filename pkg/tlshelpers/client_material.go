@@ -0,0 +1,142 @@
+package tlshelpers
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	configv1 "github.com/openshift/api/config/v1"
+	"github.com/openshift/library-go/pkg/crypto"
+	"go.etcd.io/etcd/client/pkg/v3/tlsutil"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	corev1client "k8s.io/client-go/kubernetes/typed/core/v1"
+
+	"github.com/openshift/cluster-etcd-operator/pkg/operator/operatorclient"
+)
+
+// ClientCertMaterial is the PEM encoded cert material a client needs to talk to etcd, e.g. etcdctl or a Go client.
+type ClientCertMaterial struct {
+	CertPEM     []byte
+	KeyPEM      []byte
+	CABundlePEM []byte
+}
+
+// ClientCertFiles are the paths ClientCertMaterial.WriteFiles wrote the material to, e.g. for the --cert, --key and
+// --cacert flags of etcdctl.
+type ClientCertFiles struct {
+	CertFile     string
+	KeyFile      string
+	CABundleFile string
+}
+
+// ReadClientCertMaterial reads the etcd-client secret and the etcd-ca-bundle configmap from the target namespace and
+// assembles them with ClientCertMaterialFrom.
+func ReadClientCertMaterial(ctx context.Context, secretClient corev1client.SecretsGetter, configMapClient corev1client.ConfigMapsGetter) (*ClientCertMaterial, error) {
+	secret, err := secretClient.Secrets(operatorclient.TargetNamespace).Get(ctx, EtcdClientCertSecretName, metav1.GetOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("error getting %s/%s: %w", operatorclient.TargetNamespace, EtcdClientCertSecretName, err)
+	}
+	caBundle, err := configMapClient.ConfigMaps(operatorclient.TargetNamespace).Get(ctx, EtcdSignerCaBundleConfigMapName, metav1.GetOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("error getting %s/%s: %w", operatorclient.TargetNamespace, EtcdSignerCaBundleConfigMapName, err)
+	}
+	return ClientCertMaterialFrom(secret, caBundle)
+}
+
+// ClientCertMaterialFrom assembles the client cert and key of the given secret, e.g. etcd-client, with the CA bundle of
+// the given configmap, e.g. etcd-ca-bundle. It fails if any of them is missing or the key does not match the cert.
+func ClientCertMaterialFrom(secret *corev1.Secret, caBundle *corev1.ConfigMap) (*ClientCertMaterial, error) {
+	material := &ClientCertMaterial{
+		CertPEM:     secret.Data[corev1.TLSCertKey],
+		KeyPEM:      secret.Data[corev1.TLSPrivateKeyKey],
+		CABundlePEM: []byte(caBundle.Data[caBundleKey]),
+	}
+	if len(material.CertPEM) == 0 {
+		return nil, fmt.Errorf("secret %s/%s is missing %s", secret.Namespace, secret.Name, corev1.TLSCertKey)
+	}
+	if len(material.KeyPEM) == 0 {
+		return nil, fmt.Errorf("secret %s/%s is missing %s", secret.Namespace, secret.Name, corev1.TLSPrivateKeyKey)
+	}
+	if len(material.CABundlePEM) == 0 {
+		return nil, fmt.Errorf("configmap %s/%s is missing %s", caBundle.Namespace, caBundle.Name, caBundleKey)
+	}
+
+	if _, err := tls.X509KeyPair(material.CertPEM, material.KeyPEM); err != nil {
+		return nil, fmt.Errorf("invalid key pair in secret %s/%s: %w", secret.Namespace, secret.Name, err)
+	}
+	if _, err := parseCABundle(material.CABundlePEM); err != nil {
+		return nil, fmt.Errorf("could not parse %s of configmap %s/%s: %w", caBundleKey, caBundle.Namespace, caBundle.Name, err)
+	}
+	return material, nil
+}
+
+// ClientTLSConfig reads the etcd-client secret and the etcd-ca-bundle configmap with ReadClientCertMaterial and returns
+// the tls.Config to dial etcd with, see ClientCertMaterial.TLSConfig.
+func ClientTLSConfig(ctx context.Context, secretClient corev1client.SecretsGetter, configMapClient corev1client.ConfigMapsGetter) (*tls.Config, error) {
+	material, err := ReadClientCertMaterial(ctx, secretClient, configMapClient)
+	if err != nil {
+		return nil, err
+	}
+	return material.TLSConfig()
+}
+
+// TLSConfig returns a client tls.Config that presents the client cert and trusts the CAs of the bundle. It is
+// restricted to TLS 1.2 or later and to the cipher suites etcd is bootstrapped with, see etcdClientCipherSuites.
+func (m *ClientCertMaterial) TLSConfig() (*tls.Config, error) {
+	keyPair, err := tls.X509KeyPair(m.CertPEM, m.KeyPEM)
+	if err != nil {
+		return nil, fmt.Errorf("invalid client key pair: %w", err)
+	}
+	roots := x509.NewCertPool()
+	if !roots.AppendCertsFromPEM(m.CABundlePEM) {
+		return nil, fmt.Errorf("could not load any CA from the bundle")
+	}
+	cipherSuites, err := etcdClientCipherSuites()
+	if err != nil {
+		return nil, err
+	}
+	return &tls.Config{
+		Certificates: []tls.Certificate{keyPair},
+		RootCAs:      roots,
+		MinVersion:   tls.VersionTLS12,
+		CipherSuites: cipherSuites,
+	}, nil
+}
+
+// etcdClientCipherSuites returns the IDs of the TLS 1.2 cipher suites of the intermediate TLS profile that etcd
+// supports, which are the ones etcd is bootstrapped with.
+func etcdClientCipherSuites() ([]uint16, error) {
+	ciphers, err := SupportedEtcdCiphers(crypto.OpenSSLToIANACipherSuites(configv1.TLSProfiles[configv1.TLSProfileIntermediateType].Ciphers))
+	if err != nil {
+		return nil, err
+	}
+	return tlsutil.GetCipherSuites(ciphers)
+}
+
+// WriteFiles writes the cert, key and CA bundle as tls.crt, tls.key and ca-bundle.crt into the existing directory dir.
+// The key is only readable by the owner.
+func (m *ClientCertMaterial) WriteFiles(dir string) (ClientCertFiles, error) {
+	files := ClientCertFiles{
+		CertFile:     filepath.Join(dir, corev1.TLSCertKey),
+		KeyFile:      filepath.Join(dir, corev1.TLSPrivateKeyKey),
+		CABundleFile: filepath.Join(dir, caBundleKey),
+	}
+	for _, file := range []struct {
+		path string
+		data []byte
+		perm os.FileMode
+	}{
+		{files.CertFile, m.CertPEM, 0644},
+		{files.KeyFile, m.KeyPEM, 0600},
+		{files.CABundleFile, m.CABundlePEM, 0644},
+	} {
+		if err := os.WriteFile(file.path, file.data, file.perm); err != nil {
+			return ClientCertFiles{}, fmt.Errorf("could not write %s: %w", file.path, err)
+		}
+	}
+	return files, nil
+}
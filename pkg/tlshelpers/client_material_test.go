@@ -0,0 +1,120 @@
+package tlshelpers
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+
+	"github.com/openshift/cluster-etcd-operator/pkg/operator/operatorclient"
+)
+
+func TestClientCertMaterial(t *testing.T) {
+	signer := newTestSigner(t, "etcd-signer")
+	caBytes, _, err := signer.Config.GetPEMBytes()
+	require.NoError(t, err)
+	otherSecret := newTestCertSecret(t, newTestSigner(t, "other-signer"), EtcdClientCertSecretName, []string{"etcd-client"})
+
+	newClientSecret := func(modifyFn func(*corev1.Secret)) *corev1.Secret {
+		secret := newTestCertSecret(t, signer, EtcdClientCertSecretName, []string{"etcd-client"}, withUsages(x509.ExtKeyUsageClientAuth))
+		if modifyFn != nil {
+			modifyFn(secret)
+		}
+		return secret
+	}
+	newCABundle := func(bundle string) *corev1.ConfigMap {
+		return &corev1.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{Name: EtcdSignerCaBundleConfigMapName, Namespace: operatorclient.TargetNamespace},
+			Data:       map[string]string{"ca-bundle.crt": bundle},
+		}
+	}
+
+	tests := map[string]struct {
+		objects       []runtime.Object
+		expectedError string
+	}{
+		"valid": {
+			objects: []runtime.Object{newClientSecret(nil), newCABundle(string(caBytes))},
+		},
+		"missing secret": {
+			objects:       []runtime.Object{newCABundle(string(caBytes))},
+			expectedError: `error getting openshift-etcd/etcd-client: secrets "etcd-client" not found`,
+		},
+		"missing ca bundle": {
+			objects:       []runtime.Object{newClientSecret(nil)},
+			expectedError: `error getting openshift-etcd/etcd-ca-bundle: configmaps "etcd-ca-bundle" not found`,
+		},
+		"missing cert": {
+			objects: []runtime.Object{newClientSecret(func(secret *corev1.Secret) {
+				delete(secret.Data, corev1.TLSCertKey)
+			}), newCABundle(string(caBytes))},
+			expectedError: "secret openshift-etcd/etcd-client is missing tls.crt",
+		},
+		"missing key": {
+			objects: []runtime.Object{newClientSecret(func(secret *corev1.Secret) {
+				delete(secret.Data, corev1.TLSPrivateKeyKey)
+			}), newCABundle(string(caBytes))},
+			expectedError: "secret openshift-etcd/etcd-client is missing tls.key",
+		},
+		"empty ca bundle": {
+			objects:       []runtime.Object{newClientSecret(nil), newCABundle("")},
+			expectedError: "configmap openshift-etcd/etcd-ca-bundle is missing ca-bundle.crt",
+		},
+		"invalid ca bundle": {
+			objects:       []runtime.Object{newClientSecret(nil), newCABundle("not a cert")},
+			expectedError: "could not parse ca-bundle.crt of configmap openshift-etcd/etcd-ca-bundle: data does not contain any valid RSA or ECDSA certificates",
+		},
+		"key of another cert": {
+			objects: []runtime.Object{newClientSecret(func(secret *corev1.Secret) {
+				secret.Data[corev1.TLSPrivateKeyKey] = otherSecret.Data[corev1.TLSPrivateKeyKey]
+			}), newCABundle(string(caBytes))},
+			expectedError: "invalid key pair in secret openshift-etcd/etcd-client: tls: private key does not match public key",
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			fakeKubeClient := fake.NewSimpleClientset(test.objects...)
+			material, err := ReadClientCertMaterial(context.TODO(), fakeKubeClient.CoreV1(), fakeKubeClient.CoreV1())
+			if test.expectedError != "" {
+				require.EqualError(t, err, test.expectedError)
+				return
+			}
+			require.NoError(t, err)
+
+			tlsConfig, err := ClientTLSConfig(context.TODO(), fakeKubeClient.CoreV1(), fakeKubeClient.CoreV1())
+			require.NoError(t, err)
+			require.NotNil(t, tlsConfig.RootCAs)
+			require.Len(t, tlsConfig.Certificates, 1)
+			require.Equal(t, uint16(tls.VersionTLS12), tlsConfig.MinVersion)
+			require.Contains(t, tlsConfig.CipherSuites, tls.TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256)
+			require.NotContains(t, tlsConfig.CipherSuites, tls.TLS_RSA_WITH_AES_128_CBC_SHA)
+			leaf, err := x509.ParseCertificate(tlsConfig.Certificates[0].Certificate[0])
+			require.NoError(t, err)
+			_, err = leaf.Verify(x509.VerifyOptions{Roots: tlsConfig.RootCAs, KeyUsages: []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth}})
+			require.NoError(t, err)
+
+			files, err := material.WriteFiles(t.TempDir())
+			require.NoError(t, err)
+			for path, expected := range map[string][]byte{
+				files.CertFile:     material.CertPEM,
+				files.KeyFile:      material.KeyPEM,
+				files.CABundleFile: caBytes,
+			} {
+				actual, err := os.ReadFile(path)
+				require.NoError(t, err)
+				require.Equal(t, expected, actual)
+			}
+			info, err := os.Stat(files.KeyFile)
+			require.NoError(t, err)
+			require.Equal(t, os.FileMode(0600), info.Mode().Perm())
+		})
+	}
+}
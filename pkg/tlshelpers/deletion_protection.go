@@ -0,0 +1,125 @@
+package tlshelpers
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/openshift/library-go/pkg/operator/certrotation"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/util/sets"
+	corev1client "k8s.io/client-go/kubernetes/typed/core/v1"
+	corev1listers "k8s.io/client-go/listers/core/v1"
+	"k8s.io/klog/v2"
+
+	"github.com/openshift/cluster-etcd-operator/pkg/operator/operatorclient"
+)
+
+// DeletionProtectionFinalizer blocks the deletion of a managed cert secret until the operator removes it again,
+// e.g. during an intentional rotation.
+const DeletionProtectionFinalizer = "etcd.openshift.io/deletion-protection"
+
+// SetDeletionProtectionForManagedSecrets adds or removes the DeletionProtectionFinalizer on all cert secrets the
+// operator maintains in the target namespace for the given nodes. Secrets that do not exist yet are skipped. The
+// finalizer is removed from all other secrets in the target namespace, e.g. the ones of nodes that are no longer
+// members, so that they can be cleaned up. The secrets are read from the lister, only secrets whose finalizer needs
+// to change are updated.
+func SetDeletionProtectionForManagedSecrets(ctx context.Context, secretLister corev1listers.SecretLister, secretClient corev1client.SecretsGetter, nodeNames []string, protect bool) error {
+	secrets, err := secretLister.Secrets(operatorclient.TargetNamespace).List(labels.Everything())
+	if err != nil {
+		return fmt.Errorf("error listing secrets in %s: %w", operatorclient.TargetNamespace, err)
+	}
+	managed := sets.NewString()
+	for _, secret := range managedSecrets(nodeNames) {
+		managed.Insert(secret.name)
+	}
+
+	for _, secret := range secrets {
+		// with the protection off, this only strips finalizers left behind and is a no-op otherwise
+		if err := setDeletionProtection(ctx, secretClient, secret, protect && managed.Has(secret.Name)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// SetDeletionProtection adds or removes the DeletionProtectionFinalizer on the given secret in the target namespace.
+// The secret is only updated if the finalizer needs to change.
+func SetDeletionProtection(ctx context.Context, secretClient corev1client.SecretsGetter, secretName string, protect bool) error {
+	secret, err := secretClient.Secrets(operatorclient.TargetNamespace).Get(ctx, secretName, metav1.GetOptions{})
+	if err != nil {
+		if apierrors.IsNotFound(err) {
+			return nil
+		}
+		return fmt.Errorf("error getting %s/%s: %w", operatorclient.TargetNamespace, secretName, err)
+	}
+	return setDeletionProtection(ctx, secretClient, secret, protect)
+}
+
+// ReleaseSignerDeletionProtectionForRotation removes the DeletionProtectionFinalizer from the given signer secret in
+// the target namespace when the signer is due for rotation at the given time, see NextSignerRotation, or was marked
+// for regeneration, so that the protection never stands in the way of an intentional rotation.
+// SetDeletionProtectionForManagedSecrets adds it back once the rotation went through.
+func ReleaseSignerDeletionProtectionForRotation(ctx context.Context, secretLister corev1listers.SecretLister, secretClient corev1client.SecretsGetter, secretName string, now time.Time) error {
+	secret, err := secretLister.Secrets(operatorclient.TargetNamespace).Get(secretName)
+	if err != nil {
+		if apierrors.IsNotFound(err) {
+			return nil
+		}
+		return fmt.Errorf("error getting %s/%s: %w", operatorclient.TargetNamespace, secretName, err)
+	}
+	if !hasDeletionProtection(secret) {
+		return nil
+	}
+	if _, ok := secret.Annotations[certrotation.CertificateNotAfterAnnotation]; ok {
+		nextRotation, err := NextSignerRotation(secret)
+		if err != nil {
+			return err
+		}
+		if now.Before(nextRotation) {
+			return nil
+		}
+	}
+	return setDeletionProtection(ctx, secretClient, secret, false)
+}
+
+func hasDeletionProtection(secret *corev1.Secret) bool {
+	for _, finalizer := range secret.Finalizers {
+		if finalizer == DeletionProtectionFinalizer {
+			return true
+		}
+	}
+	return false
+}
+
+// setDeletionProtection adds or removes the DeletionProtectionFinalizer on the given secret, if it needs to change.
+func setDeletionProtection(ctx context.Context, secretClient corev1client.SecretsGetter, secret *corev1.Secret, protect bool) error {
+	if hasDeletionProtection(secret) == protect {
+		return nil
+	}
+	secret = secret.DeepCopy()
+	secret.Finalizers = withDeletionProtection(secret.Finalizers, protect)
+	if _, err := secretClient.Secrets(secret.Namespace).Update(ctx, secret, metav1.UpdateOptions{}); err != nil {
+		return fmt.Errorf("error updating deletion protection of %s/%s: %w", secret.Namespace, secret.Name, err)
+	}
+	klog.V(2).Infof("set deletion protection of %s/%s to %v", secret.Namespace, secret.Name, protect)
+	return nil
+}
+
+// withDeletionProtection returns the given finalizers with or without the DeletionProtectionFinalizer, keeping all
+// other finalizers in place.
+func withDeletionProtection(finalizers []string, protect bool) []string {
+	var updated []string
+	for _, finalizer := range finalizers {
+		if finalizer != DeletionProtectionFinalizer {
+			updated = append(updated, finalizer)
+		}
+	}
+	if protect {
+		updated = append(updated, DeletionProtectionFinalizer)
+	}
+	return updated
+}
@@ -0,0 +1,211 @@
+package tlshelpers
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/openshift/library-go/pkg/crypto"
+	"github.com/openshift/library-go/pkg/operator/certrotation"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+	corev1listers "k8s.io/client-go/listers/core/v1"
+	clienttesting "k8s.io/client-go/testing"
+	"k8s.io/client-go/tools/cache"
+
+	"github.com/openshift/cluster-etcd-operator/pkg/operator/operatorclient"
+	u "github.com/openshift/cluster-etcd-operator/pkg/testutils"
+)
+
+func TestSetDeletionProtection(t *testing.T) {
+	signerSecret := u.FakeSecret(operatorclient.TargetNamespace, EtcdSignerCertSecretName, map[string][]byte{})
+	signerSecret.Finalizers = []string{"other.io/finalizer"}
+	fakeKubeClient := fake.NewSimpleClientset(
+		signerSecret,
+		u.FakeSecret(operatorclient.TargetNamespace, GetPeerClientSecretNameForNode("master-0"), map[string][]byte{}),
+	)
+	// the fake clientset deletes right away, emulate the apiserver only marking objects with finalizers as deleted
+	fakeKubeClient.PrependReactor("delete", "secrets", func(action clienttesting.Action) (bool, runtime.Object, error) {
+		deleteAction := action.(clienttesting.DeleteAction)
+		obj, err := fakeKubeClient.Tracker().Get(corev1.SchemeGroupVersion.WithResource("secrets"), deleteAction.GetNamespace(), deleteAction.GetName())
+		if err != nil {
+			return true, nil, err
+		}
+		secret := obj.(*corev1.Secret)
+		if len(secret.Finalizers) == 0 {
+			return false, nil, nil
+		}
+		now := metav1.Now()
+		secret.DeletionTimestamp = &now
+		return true, nil, fakeKubeClient.Tracker().Update(corev1.SchemeGroupVersion.WithResource("secrets"), secret, secret.Namespace)
+	})
+	secrets := fakeKubeClient.CoreV1().Secrets(operatorclient.TargetNamespace)
+
+	require.NoError(t, SetDeletionProtectionForManagedSecrets(context.TODO(), secretListerFor(t, fakeKubeClient), fakeKubeClient.CoreV1(), []string{"master-0"}, true))
+	signer, err := secrets.Get(context.TODO(), EtcdSignerCertSecretName, metav1.GetOptions{})
+	require.NoError(t, err)
+	require.Equal(t, []string{"other.io/finalizer", DeletionProtectionFinalizer}, signer.Finalizers)
+	peer, err := secrets.Get(context.TODO(), GetPeerClientSecretNameForNode("master-0"), metav1.GetOptions{})
+	require.NoError(t, err)
+	require.Equal(t, []string{DeletionProtectionFinalizer}, peer.Finalizers)
+
+	// protecting again is a no-op
+	require.NoError(t, SetDeletionProtection(context.TODO(), fakeKubeClient.CoreV1(), GetPeerClientSecretNameForNode("master-0"), true))
+	peer, err = secrets.Get(context.TODO(), GetPeerClientSecretNameForNode("master-0"), metav1.GetOptions{})
+	require.NoError(t, err)
+	require.Equal(t, []string{DeletionProtectionFinalizer}, peer.Finalizers)
+
+	// the finalizer blocks the deletion
+	require.NoError(t, secrets.Delete(context.TODO(), peer.Name, metav1.DeleteOptions{}))
+	peer, err = secrets.Get(context.TODO(), peer.Name, metav1.GetOptions{})
+	require.NoError(t, err)
+	require.NotNil(t, peer.DeletionTimestamp)
+
+	// removing the protection keeps foreign finalizers, and lets an unprotected secret be deleted
+	require.NoError(t, SetDeletionProtectionForManagedSecrets(context.TODO(), secretListerFor(t, fakeKubeClient), fakeKubeClient.CoreV1(), []string{"master-0"}, false))
+	signer, err = secrets.Get(context.TODO(), EtcdSignerCertSecretName, metav1.GetOptions{})
+	require.NoError(t, err)
+	require.Equal(t, []string{"other.io/finalizer"}, signer.Finalizers)
+	peer, err = secrets.Get(context.TODO(), GetPeerClientSecretNameForNode("master-0"), metav1.GetOptions{})
+	require.NoError(t, err)
+	require.Empty(t, peer.Finalizers)
+	require.NoError(t, secrets.Delete(context.TODO(), peer.Name, metav1.DeleteOptions{}))
+	_, err = secrets.Get(context.TODO(), peer.Name, metav1.GetOptions{})
+	require.Error(t, err)
+}
+
+func TestSetDeletionProtectionForManagedSecrets(t *testing.T) {
+	protected := func(name string) *corev1.Secret {
+		secret := u.FakeSecret(operatorclient.TargetNamespace, name, map[string][]byte{})
+		secret.Finalizers = []string{DeletionProtectionFinalizer}
+		return secret
+	}
+
+	tests := map[string]struct {
+		objects            []runtime.Object
+		protect            bool
+		expectedWrites     int
+		expectedFinalizers map[string][]string
+	}{
+		"off without finalizers is a no-op": {
+			objects: []runtime.Object{
+				u.FakeSecret(operatorclient.TargetNamespace, EtcdSignerCertSecretName, map[string][]byte{}),
+				u.FakeSecret(operatorclient.TargetNamespace, GetPeerClientSecretNameForNode("master-0"), map[string][]byte{}),
+			},
+			expectedFinalizers: map[string][]string{
+				EtcdSignerCertSecretName:                   nil,
+				GetPeerClientSecretNameForNode("master-0"): nil,
+			},
+		},
+		"on with finalizers in place is a no-op": {
+			objects: []runtime.Object{
+				protected(EtcdSignerCertSecretName),
+				protected(GetPeerClientSecretNameForNode("master-0")),
+			},
+			protect: true,
+			expectedFinalizers: map[string][]string{
+				EtcdSignerCertSecretName:                   {DeletionProtectionFinalizer},
+				GetPeerClientSecretNameForNode("master-0"): {DeletionProtectionFinalizer},
+			},
+		},
+		"removed node is released": {
+			objects: []runtime.Object{
+				protected(GetPeerClientSecretNameForNode("master-0")),
+				protected(GetPeerClientSecretNameForNode("master-9")),
+				protected(GetServingSecretNameForNode("master-9")),
+			},
+			protect:        true,
+			expectedWrites: 2,
+			expectedFinalizers: map[string][]string{
+				GetPeerClientSecretNameForNode("master-0"): {DeletionProtectionFinalizer},
+				GetPeerClientSecretNameForNode("master-9"): nil,
+				GetServingSecretNameForNode("master-9"):    nil,
+			},
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			fakeKubeClient := fake.NewSimpleClientset(test.objects...)
+			require.NoError(t, SetDeletionProtectionForManagedSecrets(context.TODO(), secretListerFor(t, fakeKubeClient), fakeKubeClient.CoreV1(), []string{"master-0"}, test.protect))
+
+			// the secrets are read from the lister, only the ones to change are written
+			var writes int
+			for _, action := range fakeKubeClient.Actions() {
+				require.Equal(t, "update", action.GetVerb())
+				writes++
+			}
+			require.Equal(t, test.expectedWrites, writes)
+			for secretName, expected := range test.expectedFinalizers {
+				secret, err := fakeKubeClient.CoreV1().Secrets(operatorclient.TargetNamespace).Get(context.TODO(), secretName, metav1.GetOptions{})
+				require.NoError(t, err)
+				require.Equal(t, expected, secret.Finalizers, secretName)
+			}
+		})
+	}
+}
+
+func TestReleaseSignerDeletionProtectionForRotation(t *testing.T) {
+	now := time.Now()
+	signerSecret := func(t *testing.T, notBefore time.Time, annotated bool) *corev1.Secret {
+		cfg, err := crypto.UnsafeMakeSelfSignedCAConfigForDurationAtTime("etcd-signer", func() time.Time { return notBefore }, etcdCaCertValidity)
+		require.NoError(t, err)
+		secret := newTestCASecret(t, &crypto.CA{Config: cfg}, operatorclient.TargetNamespace, EtcdSignerCertSecretName)
+		secret.Finalizers = []string{"other.io/finalizer", DeletionProtectionFinalizer}
+		if annotated {
+			secret.Annotations = map[string]string{certrotation.CertificateNotAfterAnnotation: cfg.Certs[0].NotAfter.Format(time.RFC3339)}
+		}
+		return secret
+	}
+
+	tests := map[string]struct {
+		secret           func(t *testing.T) *corev1.Secret
+		expectedReleased bool
+	}{
+		"not due": {
+			secret: func(t *testing.T) *corev1.Secret { return signerSecret(t, now, true) },
+		},
+		"due": {
+			secret:           func(t *testing.T) *corev1.Secret { return signerSecret(t, now.Add(-etcdCaCertValidity), true) },
+			expectedReleased: true,
+		},
+		"marked for regeneration": {
+			secret:           func(t *testing.T) *corev1.Secret { return signerSecret(t, now, false) },
+			expectedReleased: true,
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			fakeKubeClient := fake.NewSimpleClientset(test.secret(t))
+			require.NoError(t, ReleaseSignerDeletionProtectionForRotation(context.TODO(), secretListerFor(t, fakeKubeClient), fakeKubeClient.CoreV1(), EtcdSignerCertSecretName, now))
+
+			secret, err := fakeKubeClient.CoreV1().Secrets(operatorclient.TargetNamespace).Get(context.TODO(), EtcdSignerCertSecretName, metav1.GetOptions{})
+			require.NoError(t, err)
+			if test.expectedReleased {
+				require.Equal(t, []string{"other.io/finalizer"}, secret.Finalizers)
+				return
+			}
+			require.Equal(t, []string{"other.io/finalizer", DeletionProtectionFinalizer}, secret.Finalizers)
+		})
+	}
+
+	// absent secret
+	fakeKubeClient := fake.NewSimpleClientset()
+	require.NoError(t, ReleaseSignerDeletionProtectionForRotation(context.TODO(), secretListerFor(t, fakeKubeClient), fakeKubeClient.CoreV1(), EtcdSignerCertSecretName, now))
+}
+
+// secretListerFor returns a lister over the secrets currently held by the given fake client.
+func secretListerFor(t *testing.T, fakeKubeClient *fake.Clientset) corev1listers.SecretLister {
+	secrets, err := fakeKubeClient.CoreV1().Secrets(operatorclient.TargetNamespace).List(context.TODO(), metav1.ListOptions{})
+	require.NoError(t, err)
+	fakeKubeClient.ClearActions()
+	indexer := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{})
+	for i := range secrets.Items {
+		require.NoError(t, indexer.Add(&secrets.Items[i]))
+	}
+	return corev1listers.NewSecretLister(indexer)
+}
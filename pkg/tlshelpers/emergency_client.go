@@ -0,0 +1,36 @@
+package tlshelpers
+
+import (
+	"bytes"
+	"fmt"
+	"time"
+
+	"github.com/openshift/library-go/pkg/crypto"
+)
+
+// MaxEmergencyClientCertValidity is the longest validity CreateEmergencyClientCert issues a cert for.
+const MaxEmergencyClientCertValidity = 24 * time.Hour
+
+// CreateEmergencyClientCert issues a short-lived client cert and key with the identity of the etcd-client cert from the
+// given signer, e.g. for etcdctl during a break-glass recovery. The cert is not stored anywhere, so the managed
+// etcd-client secret is left alone. The validity must be positive and at most MaxEmergencyClientCertValidity.
+func CreateEmergencyClientCert(caCert, caKey []byte, validity time.Duration) (*bytes.Buffer, *bytes.Buffer, error) {
+	if validity <= 0 || validity > MaxEmergencyClientCertValidity {
+		return nil, nil, fmt.Errorf("emergency client cert validity must be between 0 and %s, got %s", MaxEmergencyClientCertValidity, validity)
+	}
+	signer, err := crypto.GetCAFromBytes(caCert, caKey)
+	if err != nil {
+		return nil, nil, err
+	}
+	certConfig, err := makeClientCertForDuration(signer, etcdClientUser(), validity, RSAKeyAlgorithm, DefaultRSAKeySize)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	certBytes := &bytes.Buffer{}
+	keyBytes := &bytes.Buffer{}
+	if err := certConfig.WriteCertConfig(certBytes, keyBytes); err != nil {
+		return nil, nil, err
+	}
+	return certBytes, keyBytes, nil
+}
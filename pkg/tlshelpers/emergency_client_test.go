@@ -0,0 +1,79 @@
+package tlshelpers
+
+import (
+	"context"
+	"crypto/x509"
+	"testing"
+	"time"
+
+	"github.com/openshift/library-go/pkg/crypto"
+	"github.com/openshift/library-go/pkg/operator/events"
+	"github.com/stretchr/testify/require"
+	"k8s.io/client-go/kubernetes/fake"
+	corev1listers "k8s.io/client-go/listers/core/v1"
+	"k8s.io/client-go/tools/cache"
+)
+
+func TestCreateEmergencyClientCert(t *testing.T) {
+	signer := newTestSigner(t, "etcd-signer")
+	caCert, caKey, err := signer.Config.GetPEMBytes()
+	require.NoError(t, err)
+
+	fakeKubeClient := fake.NewSimpleClientset()
+	secretLister := corev1listers.NewSecretLister(cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{}))
+	clientCert := CreateEtcdClientCert(nil, secretLister, fakeKubeClient.CoreV1(), events.NewInMemoryRecorder(t.Name()))
+	clientSecret, err := clientCert.EnsureTargetCertKeyPair(context.TODO(), signer, signer.Config.Certs)
+	require.NoError(t, err)
+	managedCert := parseSecretCert(t, clientSecret)
+
+	tests := map[string]struct {
+		validity    time.Duration
+		expectedErr string
+	}{
+		"a few hours": {
+			validity: 4 * time.Hour,
+		},
+		"maximum": {
+			validity: MaxEmergencyClientCertValidity,
+		},
+		"above maximum": {
+			validity:    25 * time.Hour,
+			expectedErr: "emergency client cert validity must be between 0 and 24h0m0s, got 25h0m0s",
+		},
+		"zero": {
+			expectedErr: "emergency client cert validity must be between 0 and 24h0m0s, got 0s",
+		},
+		"negative": {
+			validity:    -time.Hour,
+			expectedErr: "emergency client cert validity must be between 0 and 24h0m0s, got -1h0m0s",
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			before := time.Now().Truncate(time.Second)
+			certPEM, keyPEM, err := CreateEmergencyClientCert(caCert, caKey, test.validity)
+			if test.expectedErr != "" {
+				require.EqualError(t, err, test.expectedErr)
+				return
+			}
+			require.NoError(t, err)
+
+			certConfig, err := crypto.GetTLSCertificateConfigFromBytes(certPEM.Bytes(), keyPEM.Bytes())
+			require.NoError(t, err)
+			cert := certConfig.Certs[0]
+			require.NoError(t, cert.CheckSignatureFrom(signer.Config.Certs[0]))
+			require.Equal(t, managedCert.Subject.CommonName, cert.Subject.CommonName)
+			require.Equal(t, managedCert.Subject.Organization, cert.Subject.Organization)
+			require.Equal(t, "etcd-client", cert.Subject.CommonName)
+			require.ElementsMatch(t, []string{"system:etcd", "etcd-client"}, cert.Subject.Organization)
+			require.Equal(t, []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth}, cert.ExtKeyUsage)
+
+			require.False(t, cert.NotAfter.Before(before.Add(test.validity)))
+			require.False(t, cert.NotAfter.After(time.Now().Add(test.validity)))
+		})
+	}
+
+	_, _, err = CreateEmergencyClientCert([]byte("not a cert"), caKey, time.Hour)
+	require.Error(t, err)
+}
@@ -0,0 +1,66 @@
+package tlshelpers
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestVerifyCertAcceptedByEtcdVerifier(t *testing.T) {
+	signer := newTestSigner(t, "etcd-signer")
+	caCert, caKey, err := signer.Config.GetPEMBytes()
+	require.NoError(t, err)
+	otherSigner := newTestSigner(t, "etcd-signer-other")
+	otherCACert, _, err := otherSigner.Config.GetPEMBytes()
+	require.NoError(t, err)
+
+	certPEM, keyPEM, err := CreatePeerCertKeyWithContext(context.TODO(), caCert, caKey, "master-0", []string{"10.0.0.1"})
+	require.NoError(t, err)
+	_, otherKeyPEM, err := CreatePeerCertKeyWithContext(context.TODO(), caCert, caKey, "master-0", []string{"10.0.0.1"})
+	require.NoError(t, err)
+
+	tests := map[string]struct {
+		certPEM, keyPEM, caBundlePEM []byte
+		expectedErr                  bool
+	}{
+		"valid triple": {
+			certPEM:     certPEM.Bytes(),
+			keyPEM:      keyPEM.Bytes(),
+			caBundlePEM: caCert,
+		},
+		"valid triple with a multi CA bundle": {
+			certPEM:     certPEM.Bytes(),
+			keyPEM:      keyPEM.Bytes(),
+			caBundlePEM: append(append([]byte{}, otherCACert...), caCert...),
+		},
+		"leaf not matching the bundle": {
+			certPEM:     certPEM.Bytes(),
+			keyPEM:      keyPEM.Bytes(),
+			caBundlePEM: otherCACert,
+			expectedErr: true,
+		},
+		"key not matching the leaf": {
+			certPEM:     certPEM.Bytes(),
+			keyPEM:      otherKeyPEM.Bytes(),
+			caBundlePEM: caCert,
+			expectedErr: true,
+		},
+		"empty bundle": {
+			certPEM:     certPEM.Bytes(),
+			keyPEM:      keyPEM.Bytes(),
+			expectedErr: true,
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			err := VerifyCertAcceptedByEtcdVerifier(test.certPEM, test.keyPEM, test.caBundlePEM)
+			if test.expectedErr {
+				require.Error(t, err)
+			} else {
+				require.NoError(t, err)
+			}
+		})
+	}
+}
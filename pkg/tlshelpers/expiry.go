@@ -0,0 +1,284 @@
+package tlshelpers
+
+import (
+	"context"
+	"crypto/x509"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	utilerrors "k8s.io/apimachinery/pkg/util/errors"
+	corev1client "k8s.io/client-go/kubernetes/typed/core/v1"
+	"k8s.io/client-go/util/cert"
+
+	"github.com/openshift/cluster-etcd-operator/pkg/operator/operatorclient"
+)
+
+// CertExpiryFor reads the managed secret secretName in the etcd namespace and returns the NotAfter of its cert together
+// with the time the cert is due for refresh, which is the configured refresh duration after its NotBefore, but at the
+// latest at 80% of its validity. For secrets bundling several certs, like etcd-all-certs, the earliest expiring cert
+// is reported.
+func CertExpiryFor(ctx context.Context, secretClient corev1client.SecretsGetter, secretName string) (notAfter time.Time, refreshAt time.Time, err error) {
+	secret, err := secretClient.Secrets(operatorclient.TargetNamespace).Get(ctx, secretName, metav1.GetOptions{})
+	if err != nil {
+		return time.Time{}, time.Time{}, fmt.Errorf("error getting %s/%s: %w", operatorclient.TargetNamespace, secretName, err)
+	}
+
+	// sort the keys to deterministically report the first of several equally expiring certs
+	var certKeys []string
+	for key := range secret.Data {
+		if strings.HasSuffix(key, ".crt") {
+			certKeys = append(certKeys, key)
+		}
+	}
+	if len(certKeys) == 0 {
+		return time.Time{}, time.Time{}, fmt.Errorf("secret %s/%s contains no certificate", secret.Namespace, secret.Name)
+	}
+	sort.Strings(certKeys)
+
+	var earliest *x509.Certificate
+	for _, key := range certKeys {
+		certs, err := cert.ParseCertsPEM(secret.Data[key])
+		if err != nil {
+			return time.Time{}, time.Time{}, fmt.Errorf("could not parse %s in %s/%s: %w", key, secret.Namespace, secret.Name, err)
+		}
+		if earliest == nil || certs[0].NotAfter.Before(earliest.NotAfter) {
+			earliest = certs[0]
+		}
+	}
+
+	return earliest.NotAfter, refreshTime(earliest, refreshFor(secretName, certValidity(earliest))), nil
+}
+
+// CertStatus is the expiry state of a single cert in a secret bundling several certs.
+type CertStatus struct {
+	// Key is the data key of the cert in the secret, e.g. etcd-peer-master-0.crt
+	Key      string
+	Subject  string
+	NotAfter time.Time
+	// NeedsRefresh is true once the cert is within its refresh window, which includes expired certs
+	NeedsRefresh bool
+}
+
+// ScanAllCerts parses every cert of a secret bundling several certs, like etcd-all-certs, and returns their expiry
+// state at the given time, sorted by key. Keys other than *.crt are ignored. Certs that can't be parsed are reported
+// in the returned error, the statuses of all other certs are returned regardless.
+func ScanAllCerts(secret *corev1.Secret, now time.Time) ([]CertStatus, error) {
+	var certKeys []string
+	for key := range secret.Data {
+		if strings.HasSuffix(key, ".crt") {
+			certKeys = append(certKeys, key)
+		}
+	}
+	sort.Strings(certKeys)
+
+	var statuses []CertStatus
+	var errs []error
+	for _, key := range certKeys {
+		certs, err := cert.ParseCertsPEM(secret.Data[key])
+		if err != nil {
+			errs = append(errs, fmt.Errorf("could not parse %s in %s/%s: %w", key, secret.Namespace, secret.Name, err))
+			continue
+		}
+		refreshAt := refreshTime(certs[0], refreshFor(strings.TrimSuffix(key, ".crt"), certValidity(certs[0])))
+		statuses = append(statuses, CertStatus{
+			Key:          key,
+			Subject:      certs[0].Subject.String(),
+			NotAfter:     certs[0].NotAfter,
+			NeedsRefresh: !now.Before(refreshAt),
+		})
+	}
+
+	return statuses, utilerrors.NewAggregate(errs)
+}
+
+// AllCertsSummary condenses the certs of etcd-all-certs into a one-glance view of the health of the node certs.
+type AllCertsSummary struct {
+	// Peer, Serving and ServingMetrics count the node certs by type, Other counts certs whose key follows none of the
+	// node cert secret names
+	Peer           int
+	Serving        int
+	ServingMetrics int
+	Other          int
+	// EarliestNotAfter is the NotAfter of the soonest expiring cert, EarliestKey its data key. Both are unset if the
+	// secret holds no cert.
+	EarliestNotAfter time.Time
+	EarliestKey      string
+	// Expired lists the certs that are expired, sorted by key
+	Expired []CertStatus
+}
+
+func (s AllCertsSummary) String() string {
+	summary := fmt.Sprintf("%d peer, %d serving, %d serving-metrics", s.Peer, s.Serving, s.ServingMetrics)
+	if s.Other > 0 {
+		summary += fmt.Sprintf(", %d other", s.Other)
+	}
+	summary += " certs"
+	if len(s.EarliestKey) > 0 {
+		summary += fmt.Sprintf(", earliest expiry %s (%s)", s.EarliestNotAfter.UTC().Format(time.RFC3339), s.EarliestKey)
+	}
+	if len(s.Expired) > 0 {
+		var expiredKeys []string
+		for _, expired := range s.Expired {
+			expiredKeys = append(expiredKeys, expired.Key)
+		}
+		summary += fmt.Sprintf(", %d expired: %s", len(s.Expired), strings.Join(expiredKeys, ", "))
+	}
+	return summary
+}
+
+// SummarizeAllCerts summarizes the certs of the etcd-all-certs secret at the given time. The type of a cert is derived
+// from its key, which is the secret name of the cert with the .crt extension, e.g. etcd-serving-master-0.crt. Like with
+// ScanAllCerts, certs that can't be parsed are reported in the returned error and left out of the summary.
+func SummarizeAllCerts(secret *corev1.Secret, now time.Time) (AllCertsSummary, error) {
+	if secret == nil {
+		return AllCertsSummary{}, fmt.Errorf("all certs secret must not be nil")
+	}
+	statuses, err := ScanAllCerts(secret, now)
+
+	var summary AllCertsSummary
+	for _, status := range statuses {
+		certType, _, ok := nodeCertFromSecretName(strings.TrimSuffix(status.Key, ".crt"))
+		switch {
+		case !ok:
+			summary.Other++
+		case certType == PeerNodeCertType:
+			summary.Peer++
+		case certType == ServingNodeCertType:
+			summary.Serving++
+		case certType == ServingMetricsNodeCertType:
+			summary.ServingMetrics++
+		}
+		if len(summary.EarliestKey) == 0 || status.NotAfter.Before(summary.EarliestNotAfter) {
+			summary.EarliestNotAfter = status.NotAfter
+			summary.EarliestKey = status.Key
+		}
+		if !now.Before(status.NotAfter) {
+			summary.Expired = append(summary.Expired, status)
+		}
+	}
+	return summary, err
+}
+
+// NextSignerRotation returns the time the etcd signer in the given secret is due for rotation, which is the CA refresh
+// duration after its NotBefore, but at the latest at 80% of its validity. If the secret holds several CA certs, the
+// most recently issued one is the current signer.
+func NextSignerRotation(secret *corev1.Secret) (time.Time, error) {
+	if secret == nil {
+		return time.Time{}, fmt.Errorf("signer secret must not be nil")
+	}
+	signer, err := activeSignerCert(secret)
+	if err != nil {
+		return time.Time{}, err
+	}
+	return refreshTime(signer, refreshAfter(certValidity(signer), etcdCaCertRefreshFraction)), nil
+}
+
+// CertValidityWindow returns the NotBefore and NotAfter of the cert the given managed secret is in use with: the most
+// recently issued CA of the etcd and etcd metrics signer secrets, see NextSignerRotation, and the leaf cert of all
+// other secrets.
+func CertValidityWindow(secret *corev1.Secret) (notBefore, notAfter time.Time, err error) {
+	if secret == nil {
+		return time.Time{}, time.Time{}, fmt.Errorf("secret must not be nil")
+	}
+	var active *x509.Certificate
+	switch secret.Name {
+	case EtcdSignerCertSecretName, EtcdMetricsSignerCertSecretName:
+		active, err = activeSignerCert(secret)
+	default:
+		active, err = certFromSecret(secret)
+	}
+	if err != nil {
+		return time.Time{}, time.Time{}, err
+	}
+	return active.NotBefore, active.NotAfter, nil
+}
+
+// CertLifetimeElapsed returns the fraction of the lifetime of the cert the given managed secret is in use with that
+// has elapsed at now, see CertValidityWindow. It allows alerting at e.g. 90% of the lifetime regardless of the
+// validity the cert was issued with. The fraction is not capped, expired certs report more than 1.
+func CertLifetimeElapsed(secret *corev1.Secret, now time.Time) (float64, error) {
+	notBefore, notAfter, err := CertValidityWindow(secret)
+	if err != nil {
+		return 0, err
+	}
+	return lifetimeElapsed(notBefore, notAfter, now), nil
+}
+
+// lifetimeElapsed returns the fraction of the window from notBefore to notAfter that has elapsed at now, 0 before the
+// window starts.
+func lifetimeElapsed(notBefore, notAfter, now time.Time) float64 {
+	if !now.After(notBefore) {
+		return 0
+	}
+	lifetime := notAfter.Sub(notBefore)
+	if lifetime <= 0 {
+		return 1
+	}
+	return float64(now.Sub(notBefore)) / float64(lifetime)
+}
+
+// activeSignerCert returns the most recently issued CA of the tls.crt of the given signer secret.
+func activeSignerCert(secret *corev1.Secret) (*x509.Certificate, error) {
+	certs, err := certsFromSecret(secret)
+	if err != nil {
+		return nil, err
+	}
+	var newest *x509.Certificate
+	for _, c := range certs {
+		if !c.IsCA {
+			continue
+		}
+		if newest == nil || c.NotBefore.After(newest.NotBefore) {
+			newest = c
+		}
+	}
+	if newest == nil {
+		return nil, fmt.Errorf("secret %s/%s contains no CA certificate", secret.Namespace, secret.Name)
+	}
+	return newest, nil
+}
+
+// certsFromSecret returns all certs of the tls.crt of the given secret.
+func certsFromSecret(secret *corev1.Secret) ([]*x509.Certificate, error) {
+	certPEM := secret.Data[corev1.TLSCertKey]
+	if len(certPEM) == 0 {
+		return nil, fmt.Errorf("secret %s/%s is missing %s", secret.Namespace, secret.Name, corev1.TLSCertKey)
+	}
+	certs, err := cert.ParseCertsPEM(certPEM)
+	if err != nil {
+		return nil, fmt.Errorf("could not parse %s in %s/%s: %w", corev1.TLSCertKey, secret.Namespace, secret.Name, err)
+	}
+	return certs, nil
+}
+
+// refreshFor returns the refresh duration the managed secret is rotated with, given the validity of its cert.
+func refreshFor(secretName string, validity time.Duration) time.Duration {
+	switch secretName {
+	case EtcdSignerCertSecretName, EtcdMetricsSignerCertSecretName:
+		return refreshAfter(validity, etcdCaCertRefreshFraction)
+	}
+	if nodeName, ok := nodeNameFromCertSecretName(secretName); ok {
+		return nodeCertRefresh(nodeName, validity)
+	}
+	return refreshAfter(validity, etcdCertRefreshFraction)
+}
+
+// certValidity returns the duration the given cert was issued for.
+func certValidity(cert *x509.Certificate) time.Duration {
+	return cert.NotAfter.Sub(cert.NotBefore)
+}
+
+// refreshTime mirrors when certrotation considers a cert due for refresh.
+func refreshTime(cert *x509.Certificate, refresh time.Duration) time.Time {
+	validity := certValidity(cert)
+	at80Percent := cert.NotAfter.Add(-validity / 5)
+	refreshAt := cert.NotBefore.Add(refresh)
+	if at80Percent.Before(refreshAt) {
+		return at80Percent
+	}
+	return refreshAt
+}
@@ -0,0 +1,351 @@
+package tlshelpers
+
+import (
+	"context"
+	"crypto/x509"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/openshift/library-go/pkg/crypto"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/client-go/kubernetes/fake"
+	"k8s.io/client-go/util/cert"
+
+	"github.com/openshift/cluster-etcd-operator/pkg/operator/operatorclient"
+	u "github.com/openshift/cluster-etcd-operator/pkg/testutils"
+)
+
+func TestCertExpiryFor(t *testing.T) {
+	signer := newTestSigner(t, "etcd-signer")
+	signerCert := signer.Config.Certs[0]
+
+	longLived, err := makeServerCertForDuration(signer, sets.NewString("10.0.0.1"), etcdCertValidity, RSAKeyAlgorithm, 0)
+	require.NoError(t, err)
+	longCert, longKey, err := longLived.GetPEMBytes()
+	require.NoError(t, err)
+	shortLived, err := makeServerCertForDuration(signer, sets.NewString("10.0.0.2"), time.Hour, RSAKeyAlgorithm, 0)
+	require.NoError(t, err)
+	shortCert, shortKey, err := shortLived.GetPEMBytes()
+	require.NoError(t, err)
+
+	tests := map[string]struct {
+		objects           []runtime.Object
+		secretName        string
+		expectedNotAfter  time.Time
+		expectedRefreshAt time.Time
+		expectedErr       bool
+	}{
+		"signer secret": {
+			objects:           []runtime.Object{newTestCASecret(t, signer, operatorclient.TargetNamespace, EtcdSignerCertSecretName)},
+			secretName:        EtcdSignerCertSecretName,
+			expectedNotAfter:  signerCert.NotAfter,
+			expectedRefreshAt: signerCert.NotAfter.Add(-signerCert.NotAfter.Sub(signerCert.NotBefore) / 5),
+		},
+		"all certs bundle reports the earliest expiry": {
+			objects: []runtime.Object{u.FakeSecret(operatorclient.TargetNamespace, EtcdAllCertsSecretName, map[string][]byte{
+				"etcd-peer-master-0.crt":    longCert,
+				"etcd-peer-master-0.key":    longKey,
+				"etcd-serving-master-1.crt": shortCert,
+				"etcd-serving-master-1.key": shortKey,
+			})},
+			secretName:        EtcdAllCertsSecretName,
+			expectedNotAfter:  shortLived.Certs[0].NotAfter,
+			expectedRefreshAt: shortLived.Certs[0].NotAfter.Add(-shortLived.Certs[0].NotAfter.Sub(shortLived.Certs[0].NotBefore) / 5),
+		},
+		"missing secret": {
+			secretName:  EtcdClientCertSecretName,
+			expectedErr: true,
+		},
+		"missing cert key": {
+			objects: []runtime.Object{u.FakeSecret(operatorclient.TargetNamespace, EtcdClientCertSecretName, map[string][]byte{
+				corev1.TLSPrivateKeyKey: longKey,
+			})},
+			secretName:  EtcdClientCertSecretName,
+			expectedErr: true,
+		},
+		"unparsable cert": {
+			objects: []runtime.Object{u.FakeSecret(operatorclient.TargetNamespace, EtcdClientCertSecretName, map[string][]byte{
+				corev1.TLSCertKey:       []byte("not a cert"),
+				corev1.TLSPrivateKeyKey: longKey,
+			})},
+			secretName:  EtcdClientCertSecretName,
+			expectedErr: true,
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			fakeKubeClient := fake.NewSimpleClientset(test.objects...)
+			notAfter, refreshAt, err := CertExpiryFor(context.TODO(), fakeKubeClient.CoreV1(), test.secretName)
+			if test.expectedErr {
+				require.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			require.True(t, test.expectedNotAfter.Equal(notAfter), "expected notAfter %v, got %v", test.expectedNotAfter, notAfter)
+			require.True(t, test.expectedRefreshAt.Equal(refreshAt), "expected refreshAt %v, got %v", test.expectedRefreshAt, refreshAt)
+			require.True(t, refreshAt.Before(notAfter))
+		})
+	}
+}
+
+func TestScanAllCerts(t *testing.T) {
+	signer := newTestSigner(t, "etcd-signer")
+	longLived, err := makeServerCertForDuration(signer, sets.NewString("10.0.0.1"), etcdCertValidity, RSAKeyAlgorithm, 0)
+	require.NoError(t, err)
+	longCert, longKey, err := longLived.GetPEMBytes()
+	require.NoError(t, err)
+	shortLived, err := makeServerCertForDuration(signer, sets.NewString("10.0.0.2"), time.Hour, RSAKeyAlgorithm, 0)
+	require.NoError(t, err)
+	shortCert, shortKey, err := shortLived.GetPEMBytes()
+	require.NoError(t, err)
+
+	allCerts := u.FakeSecret(operatorclient.TargetNamespace, EtcdAllCertsSecretName, map[string][]byte{
+		"etcd-peer-master-0.crt":    longCert,
+		"etcd-peer-master-0.key":    longKey,
+		"etcd-serving-master-1.crt": shortCert,
+		"etcd-serving-master-1.key": shortKey,
+		"README":                    []byte("not a cert"),
+	})
+	now := time.Now()
+
+	tests := map[string]struct {
+		now                  time.Time
+		expectedNeedsRefresh []bool
+	}{
+		"all valid": {
+			now:                  now,
+			expectedNeedsRefresh: []bool{false, false},
+		},
+		"short lived cert within refresh window": {
+			now:                  now.Add(50 * time.Minute),
+			expectedNeedsRefresh: []bool{false, true},
+		},
+		"short lived cert expired": {
+			now:                  now.Add(2 * time.Hour),
+			expectedNeedsRefresh: []bool{false, true},
+		},
+		"all expired": {
+			now:                  now.Add(etcdCertValidity + time.Hour),
+			expectedNeedsRefresh: []bool{true, true},
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			statuses, err := ScanAllCerts(allCerts, test.now)
+			require.NoError(t, err)
+			require.Len(t, statuses, 2)
+
+			require.Equal(t, "etcd-peer-master-0.crt", statuses[0].Key)
+			require.Equal(t, "CN=10.0.0.1", statuses[0].Subject)
+			require.True(t, longLived.Certs[0].NotAfter.Equal(statuses[0].NotAfter))
+			require.Equal(t, "etcd-serving-master-1.crt", statuses[1].Key)
+			require.Equal(t, "CN=10.0.0.2", statuses[1].Subject)
+			require.True(t, shortLived.Certs[0].NotAfter.Equal(statuses[1].NotAfter))
+
+			require.Equal(t, test.expectedNeedsRefresh, []bool{statuses[0].NeedsRefresh, statuses[1].NeedsRefresh})
+		})
+	}
+
+	broken := allCerts.DeepCopy()
+	broken.Data["etcd-metrics-master-2.crt"] = []byte("not a cert")
+	statuses, err := ScanAllCerts(broken, now)
+	require.ErrorContains(t, err, "could not parse etcd-metrics-master-2.crt in openshift-etcd/etcd-all-certs")
+	require.Len(t, statuses, 2)
+}
+
+func TestSummarizeAllCerts(t *testing.T) {
+	signer := newTestSigner(t, "etcd-signer")
+	newCert := func(ip string, validity time.Duration) []byte {
+		certKey, err := makeServerCertForDuration(signer, sets.NewString(ip), validity, RSAKeyAlgorithm, 0)
+		require.NoError(t, err)
+		certPEM, _, err := certKey.GetPEMBytes()
+		require.NoError(t, err)
+		return certPEM
+	}
+	shortLived := newCert("10.0.0.1", time.Hour)
+	shortLivedCert, err := cert.ParseCertsPEM(shortLived)
+	require.NoError(t, err)
+
+	allCerts := u.FakeSecret(operatorclient.TargetNamespace, EtcdAllCertsSecretName, map[string][]byte{
+		"etcd-peer-master-0.crt":            newCert("10.0.0.1", etcdCertValidity),
+		"etcd-peer-master-0.key":            []byte("key"),
+		"etcd-serving-master-0.crt":         newCert("10.0.0.1", etcdCertValidity),
+		"etcd-serving-metrics-master-0.crt": shortLived,
+		"etcd-peer-master-1.crt":            newCert("10.0.0.2", etcdCertValidity),
+		"etcd-serving-master-1.crt":         newCert("10.0.0.2", 2*time.Hour),
+		"etcd-serving-metrics-master-1.crt": newCert("10.0.0.2", etcdCertValidity),
+		"custom.crt":                        newCert("10.0.0.3", etcdCertValidity),
+	})
+	now := time.Now()
+
+	summary, err := SummarizeAllCerts(allCerts, now)
+	require.NoError(t, err)
+	require.Equal(t, 2, summary.Peer)
+	require.Equal(t, 2, summary.Serving)
+	require.Equal(t, 2, summary.ServingMetrics)
+	require.Equal(t, 1, summary.Other)
+	require.Equal(t, "etcd-serving-metrics-master-0.crt", summary.EarliestKey)
+	require.True(t, shortLivedCert[0].NotAfter.Equal(summary.EarliestNotAfter))
+	require.Empty(t, summary.Expired)
+
+	summary, err = SummarizeAllCerts(allCerts, now.Add(3*time.Hour))
+	require.NoError(t, err)
+	require.Equal(t, "etcd-serving-metrics-master-0.crt", summary.EarliestKey)
+	var expiredKeys []string
+	for _, expired := range summary.Expired {
+		expiredKeys = append(expiredKeys, expired.Key)
+	}
+	require.Equal(t, []string{"etcd-serving-master-1.crt", "etcd-serving-metrics-master-0.crt"}, expiredKeys)
+	require.Equal(t, fmt.Sprintf("2 peer, 2 serving, 2 serving-metrics, 1 other certs, earliest expiry %s (etcd-serving-metrics-master-0.crt), "+
+		"2 expired: etcd-serving-master-1.crt, etcd-serving-metrics-master-0.crt", shortLivedCert[0].NotAfter.UTC().Format(time.RFC3339)), summary.String())
+
+	broken := allCerts.DeepCopy()
+	broken.Data["etcd-peer-master-2.crt"] = []byte("not a cert")
+	summary, err = SummarizeAllCerts(broken, now)
+	require.ErrorContains(t, err, "could not parse etcd-peer-master-2.crt in openshift-etcd/etcd-all-certs")
+	require.Equal(t, 2, summary.Peer)
+
+	_, err = SummarizeAllCerts(nil, now)
+	require.EqualError(t, err, "all certs secret must not be nil")
+	summary, err = SummarizeAllCerts(u.FakeSecret(operatorclient.TargetNamespace, EtcdAllCertsSecretName, nil), now)
+	require.NoError(t, err)
+	require.Equal(t, "0 peer, 0 serving, 0 serving-metrics certs", summary.String())
+}
+
+func TestNextSignerRotation(t *testing.T) {
+	shortSigner := newTestSigner(t, "etcd-signer")
+	shortCert := shortSigner.Config.Certs[0]
+	longConfig, err := crypto.MakeSelfSignedCAConfigForDuration("etcd-signer", 10*365*24*time.Hour)
+	require.NoError(t, err)
+	longCert := longConfig.Certs[0]
+	oldConfig, err := crypto.UnsafeMakeSelfSignedCAConfigForDurationAtTime("etcd-signer", func() time.Time {
+		return time.Now().Add(-365 * 24 * time.Hour)
+	}, etcdCaCertValidity)
+	require.NoError(t, err)
+	leaf, err := makeServerCertForDuration(shortSigner, sets.NewString("10.0.0.1"), time.Hour, RSAKeyAlgorithm, 0)
+	require.NoError(t, err)
+
+	signerSecret := func(certs ...*x509.Certificate) *corev1.Secret {
+		certPEM, err := crypto.EncodeCertificates(certs...)
+		require.NoError(t, err)
+		return u.FakeSecret(operatorclient.TargetNamespace, EtcdSignerCertSecretName, map[string][]byte{corev1.TLSCertKey: certPEM})
+	}
+
+	tests := map[string]struct {
+		secret             *corev1.Secret
+		expectedRotationAt time.Time
+		expectedErr        string
+	}{
+		"short lived signer rotates at 80% of its validity": {
+			secret:             signerSecret(shortCert),
+			expectedRotationAt: shortCert.NotAfter.Add(-shortCert.NotAfter.Sub(shortCert.NotBefore) / 5),
+		},
+		"long lived signer rotates at 80% of its validity as well": {
+			secret:             signerSecret(longCert),
+			expectedRotationAt: longCert.NotAfter.Add(-longCert.NotAfter.Sub(longCert.NotBefore) / 5),
+		},
+		"bundle uses the most recently issued signer": {
+			secret:             signerSecret(oldConfig.Certs[0], longCert),
+			expectedRotationAt: longCert.NotAfter.Add(-longCert.NotAfter.Sub(longCert.NotBefore) / 5),
+		},
+		"bundle order does not matter": {
+			secret:             signerSecret(longCert, oldConfig.Certs[0]),
+			expectedRotationAt: longCert.NotAfter.Add(-longCert.NotAfter.Sub(longCert.NotBefore) / 5),
+		},
+		"leaf certs are ignored": {
+			secret:             signerSecret(leaf.Certs[0], shortCert),
+			expectedRotationAt: shortCert.NotAfter.Add(-shortCert.NotAfter.Sub(shortCert.NotBefore) / 5),
+		},
+		"no CA cert": {
+			secret:      signerSecret(leaf.Certs[0]),
+			expectedErr: "secret openshift-etcd/etcd-signer contains no CA certificate",
+		},
+		"missing cert": {
+			secret:      u.FakeSecret(operatorclient.TargetNamespace, EtcdSignerCertSecretName, map[string][]byte{}),
+			expectedErr: "secret openshift-etcd/etcd-signer is missing tls.crt",
+		},
+		"unparsable cert": {
+			secret:      u.FakeSecret(operatorclient.TargetNamespace, EtcdSignerCertSecretName, map[string][]byte{corev1.TLSCertKey: []byte("not a cert")}),
+			expectedErr: "could not parse tls.crt in openshift-etcd/etcd-signer: data does not contain any valid RSA or ECDSA certificates",
+		},
+		"nil secret": {
+			expectedErr: "signer secret must not be nil",
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			rotationAt, err := NextSignerRotation(test.secret)
+			if len(test.expectedErr) > 0 {
+				require.EqualError(t, err, test.expectedErr)
+				return
+			}
+			require.NoError(t, err)
+			require.True(t, test.expectedRotationAt.Equal(rotationAt), "expected rotation at %v, got %v", test.expectedRotationAt, rotationAt)
+		})
+	}
+}
+
+func TestCertLifetimeElapsed(t *testing.T) {
+	notBefore := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	oldConfig, err := crypto.UnsafeMakeSelfSignedCAConfigForDurationAtTime("etcd-signer", func() time.Time { return notBefore }, 100*time.Hour)
+	require.NoError(t, err)
+	newConfig, err := crypto.UnsafeMakeSelfSignedCAConfigForDurationAtTime("etcd-signer", func() time.Time { return notBefore.Add(50 * time.Hour) }, 200*time.Hour)
+	require.NoError(t, err)
+	signer := &crypto.CA{Config: oldConfig, SerialGenerator: &crypto.RandomSerialGenerator{}}
+	leafSecret := newTestCertSecret(t, signer, GetPeerClientSecretNameForNode("master-0"), []string{"10.0.0.1"})
+	leaf := parseSecretCert(t, leafSecret)
+
+	signerPEM, err := crypto.EncodeCertificates(oldConfig.Certs[0], newConfig.Certs[0])
+	require.NoError(t, err)
+	signerSecret := u.FakeSecret(operatorclient.TargetNamespace, EtcdSignerCertSecretName, map[string][]byte{corev1.TLSCertKey: signerPEM})
+
+	// the signer secret is in use with the most recently issued CA
+	windowStart, windowEnd, err := CertValidityWindow(signerSecret)
+	require.NoError(t, err)
+	require.Equal(t, newConfig.Certs[0].NotBefore, windowStart)
+	require.Equal(t, newConfig.Certs[0].NotAfter, windowEnd)
+
+	// leaf secrets are in use with their leaf cert, not the signer appended to it
+	windowStart, windowEnd, err = CertValidityWindow(leafSecret)
+	require.NoError(t, err)
+	require.Equal(t, leaf.NotBefore, windowStart)
+	require.Equal(t, leaf.NotAfter, windowEnd)
+
+	// library-go backdates the certs a little, so the window is taken from the cert
+	active := newConfig.Certs[0]
+	at := func(fraction float64) time.Time {
+		return active.NotBefore.Add(time.Duration(fraction * float64(active.NotAfter.Sub(active.NotBefore))))
+	}
+	tests := map[string]struct {
+		now      time.Time
+		expected float64
+	}{
+		"before the window":  {now: notBefore, expected: 0},
+		"at the start":       {now: active.NotBefore, expected: 0},
+		"a quarter elapsed":  {now: at(0.25), expected: 0.25},
+		"90% elapsed":        {now: at(0.9), expected: 0.9},
+		"at the end":         {now: active.NotAfter, expected: 1},
+		"expired for a half": {now: at(1.5), expected: 1.5},
+	}
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			elapsed, err := CertLifetimeElapsed(signerSecret, test.now)
+			require.NoError(t, err)
+			require.InDelta(t, test.expected, elapsed, 1e-9)
+		})
+	}
+
+	require.Equal(t, float64(1), lifetimeElapsed(notBefore, notBefore, notBefore.Add(time.Second)))
+
+	_, _, err = CertValidityWindow(nil)
+	require.EqualError(t, err, "secret must not be nil")
+	_, err = CertLifetimeElapsed(u.FakeSecret(operatorclient.TargetNamespace, EtcdMetricsSignerCertSecretName, map[string][]byte{}), notBefore)
+	require.EqualError(t, err, "secret openshift-etcd/etcd-metric-signer is missing tls.crt")
+}
@@ -0,0 +1,133 @@
+package tlshelpers
+
+import (
+	"bytes"
+	"context"
+	"crypto/x509"
+	"fmt"
+	"time"
+
+	"github.com/openshift/library-go/pkg/crypto"
+	"github.com/openshift/library-go/pkg/operator/certrotation"
+	"github.com/openshift/library-go/pkg/operator/resource/resourceapply"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	corev1client "k8s.io/client-go/kubernetes/typed/core/v1"
+
+	"github.com/openshift/cluster-etcd-operator/pkg/operator/operatorclient"
+)
+
+// ExternalSignerAnnotation marks a signer secret in the target namespace that was adopted from the externally provided
+// signer instead of being generated. Such a signer is never rotated by the operator.
+const ExternalSignerAnnotation = "etcd.openshift.io/external-signer"
+
+// ReadExternalSignerCert reads the externally provided signer, e.g. an intermediate of a corporate CA, from
+// openshift-config/etcd-external-signer. It returns nil if no external signer is provided and an error if the secret
+// lacks the private key or does not hold a CA.
+func ReadExternalSignerCert(ctx context.Context, secretClient corev1client.SecretsGetter) (*crypto.CA, error) {
+	secret, err := secretClient.Secrets(operatorclient.GlobalUserSpecifiedConfigNamespace).Get(ctx, EtcdExternalSignerCertSecretName, metav1.GetOptions{})
+	if err != nil {
+		if apierrors.IsNotFound(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("error getting %s/%s: %w", operatorclient.GlobalUserSpecifiedConfigNamespace, EtcdExternalSignerCertSecretName, err)
+	}
+	return externalSignerFromSecret(secret)
+}
+
+func externalSignerFromSecret(secret *corev1.Secret) (*crypto.CA, error) {
+	if len(secret.Data[corev1.TLSPrivateKeyKey]) == 0 {
+		return nil, fmt.Errorf("external signer %s/%s lacks the private key in %s", secret.Namespace, secret.Name, corev1.TLSPrivateKeyKey)
+	}
+	if err := ValidateCertKeyPair(secret); err != nil {
+		return nil, fmt.Errorf("invalid external signer: %w", err)
+	}
+	ca, err := crypto.GetCAFromBytes(secret.Data[corev1.TLSCertKey], secret.Data[corev1.TLSPrivateKeyKey])
+	if err != nil {
+		return nil, fmt.Errorf("could not load external signer %s/%s: %w", secret.Namespace, secret.Name, err)
+	}
+	signerCert := ca.Config.Certs[0]
+	if !signerCert.BasicConstraintsValid || !signerCert.IsCA || signerCert.KeyUsage&x509.KeyUsageCertSign == 0 {
+		return nil, fmt.Errorf("external signer %s/%s is not a CA, its cert %q must have the CA basic constraint and the cert sign key usage",
+			secret.Namespace, secret.Name, signerCert.Subject.CommonName)
+	}
+	return ca, nil
+}
+
+// EnsureSignerCertKeyPair is signer.EnsureSigningCertKeyPair, unless an external signer is provided, see
+// ReadExternalSignerCert. The external signer is then adopted into the signer secret instead of generating one and
+// returned together with true, so that the caller issues all leaf certs from it. An adopted signer is never rotated or
+// overwritten with a generated one, removing the external signer again is refused. Before a new or changed external
+// signer is adopted, approveAdoption is called with it and the adoption is refused if it returns an error. A nil
+// approveAdoption accepts any external signer.
+func EnsureSignerCertKeyPair(ctx context.Context, secretClient corev1client.SecretsGetter, signer certrotation.RotatedSigningCASecret,
+	approveAdoption func(externalSigner *crypto.CA) error) (*crypto.CA, bool, error) {
+	externalSigner, err := ReadExternalSignerCert(ctx, secretClient)
+	if err != nil {
+		return nil, false, err
+	}
+
+	current, err := secretClient.Secrets(signer.Namespace).Get(ctx, signer.Name, metav1.GetOptions{})
+	if err != nil {
+		if !apierrors.IsNotFound(err) {
+			return nil, false, fmt.Errorf("error getting %s/%s: %w", signer.Namespace, signer.Name, err)
+		}
+		current = nil
+	}
+	isAdopted := current != nil && current.Annotations[ExternalSignerAnnotation] == "true"
+
+	if externalSigner == nil {
+		if isAdopted {
+			return nil, false, fmt.Errorf("refusing to rotate the external signer adopted in %s/%s, %s/%s was removed",
+				signer.Namespace, signer.Name, operatorclient.GlobalUserSpecifiedConfigNamespace, EtcdExternalSignerCertSecretName)
+		}
+		ca, err := signer.EnsureSigningCertKeyPair(ctx)
+		return ca, false, err
+	}
+
+	certBytes, keyBytes := &bytes.Buffer{}, &bytes.Buffer{}
+	if err := externalSigner.Config.WriteCertConfig(certBytes, keyBytes); err != nil {
+		return nil, false, err
+	}
+	if isAdopted && bytes.Equal(current.Data[corev1.TLSCertKey], certBytes.Bytes()) && bytes.Equal(current.Data[corev1.TLSPrivateKeyKey], keyBytes.Bytes()) {
+		return externalSigner, true, nil
+	}
+
+	if approveAdoption != nil {
+		if err := approveAdoption(externalSigner); err != nil {
+			return nil, false, err
+		}
+	}
+
+	// adopting replaces the signer, which must not be blocked by the deletion protection
+	if current != nil {
+		if err := setDeletionProtection(ctx, secretClient, current, false); err != nil {
+			return nil, false, err
+		}
+	}
+
+	signerCert := externalSigner.Config.Certs[0]
+	adopted := &corev1.Secret{
+		ObjectMeta: certrotation.NewTLSArtifactObjectMeta(signer.Name, signer.Namespace, signer.JiraComponent, signer.Description),
+		Type:       corev1.SecretTypeTLS,
+		Data: map[string][]byte{
+			corev1.TLSCertKey:       certBytes.Bytes(),
+			corev1.TLSPrivateKeyKey: keyBytes.Bytes(),
+		},
+	}
+	if adopted.Annotations == nil {
+		adopted.Annotations = map[string]string{}
+	}
+	adopted.Annotations[ExternalSignerAnnotation] = "true"
+	adopted.Annotations[certrotation.CertificateNotAfterAnnotation] = signerCert.NotAfter.Format(time.RFC3339)
+	adopted.Annotations[certrotation.CertificateNotBeforeAnnotation] = signerCert.NotBefore.Format(time.RFC3339)
+	adopted.Annotations[certrotation.CertificateIssuer] = signerCert.Issuer.CommonName
+	certrotation.LabelAsManagedSecret(adopted, certrotation.CertificateTypeSigner)
+
+	if _, _, err := resourceapply.ApplySecret(ctx, secretClient, signer.EventRecorder, adopted); err != nil {
+		return nil, false, fmt.Errorf("error adopting the external signer into %s/%s: %w", signer.Namespace, signer.Name, err)
+	}
+	signer.EventRecorder.Eventf("ExternalSignerAdopted", "adopted external signer %q into %s/%s", signerCert.Subject.CommonName, signer.Namespace, signer.Name)
+	return externalSigner, true, nil
+}
@@ -0,0 +1,135 @@
+package tlshelpers
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/openshift/library-go/pkg/crypto"
+	"github.com/openshift/library-go/pkg/operator/events"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+	corev1listers "k8s.io/client-go/listers/core/v1"
+	"k8s.io/client-go/tools/cache"
+
+	"github.com/openshift/cluster-etcd-operator/pkg/operator/operatorclient"
+)
+
+func TestEnsureSignerCertKeyPair(t *testing.T) {
+	externalSigner := newTestSigner(t, "corporate-etcd-intermediate")
+	externalSecret := newTestCASecret(t, externalSigner, operatorclient.GlobalUserSpecifiedConfigNamespace, EtcdExternalSignerCertSecretName)
+
+	withoutKey := externalSecret.DeepCopy()
+	delete(withoutKey.Data, corev1.TLSPrivateKeyKey)
+
+	leaf := newTestCertSecret(t, externalSigner, EtcdExternalSignerCertSecretName, []string{"localhost"})
+	leaf.Namespace = operatorclient.GlobalUserSpecifiedConfigNamespace
+
+	adopted := newTestCASecret(t, externalSigner, operatorclient.TargetNamespace, EtcdSignerCertSecretName)
+	adopted.Annotations = map[string]string{ExternalSignerAnnotation: "true"}
+
+	protected := newTestCASecret(t, newTestSigner(t, "etcd-signer"), operatorclient.TargetNamespace, EtcdSignerCertSecretName)
+	protected.Finalizers = []string{DeletionProtectionFinalizer}
+
+	tests := map[string]struct {
+		objects          []runtime.Object
+		expectedExternal bool
+		expectedErr      string
+	}{
+		"no external signer generates one": {},
+		"external signer is adopted": {
+			objects:          []runtime.Object{externalSecret},
+			expectedExternal: true,
+		},
+		"protected generated signer is replaced": {
+			objects:          []runtime.Object{externalSecret, protected},
+			expectedExternal: true,
+		},
+		"external signer without key": {
+			objects:     []runtime.Object{withoutKey},
+			expectedErr: "external signer openshift-config/etcd-external-signer lacks the private key in tls.key",
+		},
+		"external signer is not a CA": {
+			objects:     []runtime.Object{leaf},
+			expectedErr: `external signer openshift-config/etcd-external-signer is not a CA, its cert "localhost" must have the CA basic constraint and the cert sign key usage`,
+		},
+		"removed external signer is not rotated": {
+			objects:     []runtime.Object{adopted},
+			expectedErr: "refusing to rotate the external signer adopted in openshift-etcd/etcd-signer, openshift-config/etcd-external-signer was removed",
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			fakeKubeClient := fake.NewSimpleClientset(test.objects...)
+			secretLister := corev1listers.NewSecretLister(cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{}))
+			signer := CreateSignerCert(nil, secretLister, fakeKubeClient.CoreV1(), events.NewInMemoryRecorder(t.Name()))
+
+			ca, external, err := EnsureSignerCertKeyPair(context.TODO(), fakeKubeClient.CoreV1(), signer, nil)
+			if test.expectedErr != "" {
+				require.EqualError(t, err, test.expectedErr)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, test.expectedExternal, external)
+
+			secret, err := fakeKubeClient.CoreV1().Secrets(operatorclient.TargetNamespace).Get(context.TODO(), EtcdSignerCertSecretName, metav1.GetOptions{})
+			require.NoError(t, err)
+			require.Equal(t, ca.Config.Certs[0].Raw, parseSecretCert(t, secret).Raw)
+			if !test.expectedExternal {
+				require.NotContains(t, secret.Annotations, ExternalSignerAnnotation)
+				return
+			}
+
+			require.Equal(t, externalSigner.Config.Certs[0].Raw, ca.Config.Certs[0].Raw)
+			require.Equal(t, "true", secret.Annotations[ExternalSignerAnnotation])
+			require.Equal(t, externalSecret.Data, secret.Data)
+			require.NotContains(t, secret.Finalizers, DeletionProtectionFinalizer)
+
+			// adopting again does not touch the secret
+			fakeKubeClient.ClearActions()
+			_, external, err = EnsureSignerCertKeyPair(context.TODO(), fakeKubeClient.CoreV1(), signer, nil)
+			require.NoError(t, err)
+			require.True(t, external)
+			for _, action := range fakeKubeClient.Actions() {
+				require.Equal(t, "get", action.GetVerb())
+			}
+		})
+	}
+}
+
+func TestEnsureSignerCertKeyPairApproval(t *testing.T) {
+	externalSigner := newTestSigner(t, "corporate-etcd-intermediate")
+	fakeKubeClient := fake.NewSimpleClientset(newTestCASecret(t, externalSigner, operatorclient.GlobalUserSpecifiedConfigNamespace, EtcdExternalSignerCertSecretName))
+	secretLister := corev1listers.NewSecretLister(cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{}))
+	signer := CreateSignerCert(nil, secretLister, fakeKubeClient.CoreV1(), events.NewInMemoryRecorder(t.Name()))
+	refuse := func(*crypto.CA) error {
+		return fmt.Errorf("not approved")
+	}
+
+	// a refused adoption writes nothing
+	fakeKubeClient.ClearActions()
+	_, _, err := EnsureSignerCertKeyPair(context.TODO(), fakeKubeClient.CoreV1(), signer, refuse)
+	require.EqualError(t, err, "not approved")
+	for _, action := range fakeKubeClient.Actions() {
+		require.Equal(t, "get", action.GetVerb())
+	}
+
+	var approved []*crypto.CA
+	_, external, err := EnsureSignerCertKeyPair(context.TODO(), fakeKubeClient.CoreV1(), signer, func(ca *crypto.CA) error {
+		approved = append(approved, ca)
+		return nil
+	})
+	require.NoError(t, err)
+	require.True(t, external)
+	require.Len(t, approved, 1)
+	require.Equal(t, externalSigner.Config.Certs[0].Raw, approved[0].Config.Certs[0].Raw)
+
+	// an unchanged adopted signer needs no approval
+	_, external, err = EnsureSignerCertKeyPair(context.TODO(), fakeKubeClient.CoreV1(), signer, refuse)
+	require.NoError(t, err)
+	require.True(t, external)
+}
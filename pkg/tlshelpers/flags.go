@@ -0,0 +1,127 @@
+package tlshelpers
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"strings"
+
+	"go.etcd.io/etcd/client/pkg/v3/tlsutil"
+	utilerrors "k8s.io/apimachinery/pkg/util/errors"
+)
+
+// etcdCertFlags are the cert, key and trusted CA flags of the client and the peer listeners of etcd.
+var etcdCertFlags = []struct {
+	cert, key, trustedCA string
+}{
+	{cert: "cert-file", key: "key-file", trustedCA: "trusted-ca-file"},
+	{cert: "peer-cert-file", key: "peer-key-file", trustedCA: "peer-trusted-ca-file"},
+}
+
+// ValidateEtcdTLSFlags cross-checks the TLS related flags of a rendered etcd command line before etcd is launched:
+// the cipher suites must be supported by etcd and configurable for the TLS versions in use, the min version must not
+// exceed the max version, every cert file must parse together with its key file and, if a trusted CA file is given,
+// must be trusted by it. The cert, key and CA files are read with certReader. Flags are accepted as --flag=value or
+// as --flag value, all other flags are ignored.
+func ValidateEtcdTLSFlags(flags []string, certReader func(path string) ([]byte, error)) error {
+	values := parseFlags(flags)
+
+	var errs []error
+	minVersion, err := tlsutil.GetTLSVersion(values["tls-min-version"])
+	if err != nil {
+		errs = append(errs, fmt.Errorf("invalid --tls-min-version: %w", err))
+	}
+	maxVersion, err := tlsutil.GetTLSVersion(values["tls-max-version"])
+	if err != nil {
+		errs = append(errs, fmt.Errorf("invalid --tls-max-version: %w", err))
+	}
+	if minVersion != 0 && maxVersion != 0 && minVersion > maxVersion {
+		errs = append(errs, fmt.Errorf("--tls-min-version %s is greater than --tls-max-version %s", values["tls-min-version"], values["tls-max-version"]))
+	}
+
+	if cipherSuites := values["cipher-suites"]; len(cipherSuites) > 0 {
+		// TLS 1.3 cipher suites are not configurable
+		if minVersion == tls.VersionTLS13 {
+			errs = append(errs, fmt.Errorf("--cipher-suites cannot be set with --tls-min-version %s", values["tls-min-version"]))
+		}
+		for _, cipher := range strings.Split(cipherSuites, ",") {
+			if _, ok := tlsutil.GetCipherSuite(cipher); !ok {
+				errs = append(errs, fmt.Errorf("cipher suite %q is not supported by etcd", cipher))
+			}
+		}
+	}
+
+	for _, certFlags := range etcdCertFlags {
+		if err := validateCertFlags(values, certFlags.cert, certFlags.key, certFlags.trustedCA, certReader); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return utilerrors.NewAggregate(errs)
+}
+
+// validateCertFlags checks that the cert file parses together with its key file and is trusted by the trusted CA file.
+func validateCertFlags(values map[string]string, certFlag, keyFlag, trustedCAFlag string, certReader func(path string) ([]byte, error)) error {
+	certPath, keyPath := values[certFlag], values[keyFlag]
+	if len(certPath) == 0 && len(keyPath) == 0 {
+		return nil
+	}
+	if len(certPath) == 0 || len(keyPath) == 0 {
+		return fmt.Errorf("--%s and --%s must be set together", certFlag, keyFlag)
+	}
+
+	certPEM, err := certReader(certPath)
+	if err != nil {
+		return fmt.Errorf("could not read --%s %s: %w", certFlag, certPath, err)
+	}
+	keyPEM, err := certReader(keyPath)
+	if err != nil {
+		return fmt.Errorf("could not read --%s %s: %w", keyFlag, keyPath, err)
+	}
+	pair, err := tls.X509KeyPair(certPEM, keyPEM)
+	if err != nil {
+		return fmt.Errorf("--%s %s does not parse with --%s %s: %w", certFlag, certPath, keyFlag, keyPath, err)
+	}
+
+	caPath := values[trustedCAFlag]
+	if len(caPath) == 0 {
+		return nil
+	}
+	caPEM, err := certReader(caPath)
+	if err != nil {
+		return fmt.Errorf("could not read --%s %s: %w", trustedCAFlag, caPath, err)
+	}
+	roots := x509.NewCertPool()
+	if !roots.AppendCertsFromPEM(caPEM) {
+		return fmt.Errorf("--%s %s contains no certificate", trustedCAFlag, caPath)
+	}
+	leaf, err := x509.ParseCertificate(pair.Certificate[0])
+	if err != nil {
+		return fmt.Errorf("could not parse --%s %s: %w", certFlag, certPath, err)
+	}
+	if _, err := leaf.Verify(x509.VerifyOptions{Roots: roots, KeyUsages: []x509.ExtKeyUsage{x509.ExtKeyUsageAny}}); err != nil {
+		return fmt.Errorf("--%s %s is not trusted by --%s %s: %w", certFlag, certPath, trustedCAFlag, caPath, err)
+	}
+	return nil
+}
+
+// parseFlags returns the values of the given --flag=value and --flag value flags by flag name.
+func parseFlags(flags []string) map[string]string {
+	values := map[string]string{}
+	for i := 0; i < len(flags); i++ {
+		if !strings.HasPrefix(flags[i], "--") {
+			continue
+		}
+		name := strings.TrimPrefix(flags[i], "--")
+		if key, value, ok := strings.Cut(name, "="); ok {
+			values[key] = value
+			continue
+		}
+		if i+1 < len(flags) && !strings.HasPrefix(flags[i+1], "--") {
+			values[name] = flags[i+1]
+			i++
+			continue
+		}
+		values[name] = ""
+	}
+	return values
+}
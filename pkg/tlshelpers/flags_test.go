@@ -0,0 +1,103 @@
+package tlshelpers
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestValidateEtcdTLSFlags(t *testing.T) {
+	signer := newTestSigner(t, "etcd-signer")
+	caCert, caKey, err := signer.Config.GetPEMBytes()
+	require.NoError(t, err)
+	otherSigner := newTestSigner(t, "other-signer")
+	otherCACert, _, err := otherSigner.Config.GetPEMBytes()
+	require.NoError(t, err)
+	servingCert, servingKey, err := CreateServerCertKeyWithContext(context.TODO(), caCert, caKey, "master-0", []string{"10.0.0.1"})
+	require.NoError(t, err)
+	peerCert, peerKey, err := CreatePeerCertKeyWithContext(context.TODO(), caCert, caKey, "master-0", []string{"10.0.0.1"})
+	require.NoError(t, err)
+
+	files := map[string][]byte{
+		"/certs/serving.crt": servingCert.Bytes(),
+		"/certs/serving.key": servingKey.Bytes(),
+		"/certs/peer.crt":    peerCert.Bytes(),
+		"/certs/peer.key":    peerKey.Bytes(),
+		"/certs/ca.crt":      caCert,
+		"/certs/other.crt":   otherCACert,
+	}
+	certReader := func(path string) ([]byte, error) {
+		if content, ok := files[path]; ok {
+			return content, nil
+		}
+		return nil, fmt.Errorf("open %s: no such file or directory", path)
+	}
+	consistent := []string{
+		"--cert-file=/certs/serving.crt",
+		"--key-file=/certs/serving.key",
+		"--trusted-ca-file=/certs/ca.crt",
+		"--peer-cert-file", "/certs/peer.crt",
+		"--peer-key-file", "/certs/peer.key",
+		"--peer-trusted-ca-file", "/certs/ca.crt",
+		"--cipher-suites=TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256,TLS_ECDHE_RSA_WITH_AES_256_GCM_SHA384",
+		"--tls-min-version=TLS1.2",
+		"--client-cert-auth",
+	}
+
+	tests := map[string]struct {
+		flags       []string
+		expectedErr string
+	}{
+		"consistent": {
+			flags: consistent,
+		},
+		"no TLS flags": {
+			flags: []string{"--name=master-0"},
+		},
+		"ciphers with TLS 1.3 only": {
+			flags:       append(append([]string{}, consistent...), "--tls-min-version=TLS1.3"),
+			expectedErr: "--cipher-suites cannot be set with --tls-min-version TLS1.3",
+		},
+		"unsupported cipher": {
+			flags:       []string{"--cipher-suites=TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256,TLS_FAKE_CIPHER"},
+			expectedErr: `cipher suite "TLS_FAKE_CIPHER" is not supported by etcd`,
+		},
+		"min version above max version": {
+			flags:       []string{"--tls-min-version=TLS1.3", "--tls-max-version=TLS1.2"},
+			expectedErr: "--tls-min-version TLS1.3 is greater than --tls-max-version TLS1.2",
+		},
+		"unknown version": {
+			flags:       []string{"--tls-min-version=TLS1.1"},
+			expectedErr: `invalid --tls-min-version: unexpected TLS version "TLS1.1" (must be one of: TLS1.2, TLS1.3)`,
+		},
+		"missing cert file": {
+			flags:       []string{"--cert-file=/certs/missing.crt", "--key-file=/certs/serving.key"},
+			expectedErr: "could not read --cert-file /certs/missing.crt: open /certs/missing.crt: no such file or directory",
+		},
+		"cert without key": {
+			flags:       []string{"--peer-cert-file=/certs/peer.crt"},
+			expectedErr: "--peer-cert-file and --peer-key-file must be set together",
+		},
+		"cert does not match key": {
+			flags:       []string{"--cert-file=/certs/serving.crt", "--key-file=/certs/peer.key"},
+			expectedErr: "--cert-file /certs/serving.crt does not parse with --key-file /certs/peer.key: tls: private key does not match public key",
+		},
+		"CA does not trust the cert": {
+			flags:       []string{"--cert-file=/certs/serving.crt", "--key-file=/certs/serving.key", "--trusted-ca-file=/certs/other.crt"},
+			expectedErr: "--cert-file /certs/serving.crt is not trusted by --trusted-ca-file /certs/other.crt: x509: certificate signed by unknown authority",
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			err := ValidateEtcdTLSFlags(test.flags, certReader)
+			if len(test.expectedErr) > 0 {
+				require.EqualError(t, err, test.expectedErr)
+				return
+			}
+			require.NoError(t, err)
+		})
+	}
+}
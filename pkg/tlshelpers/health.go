@@ -0,0 +1,93 @@
+package tlshelpers
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	operatorv1 "github.com/openshift/api/operator/v1"
+	corev1client "k8s.io/client-go/kubernetes/typed/core/v1"
+)
+
+// PKIDegradedConditionType is the type of the condition computed from a HealthReport. Like all *Degraded conditions it
+// is unioned into the Degraded condition of the operator.
+const PKIDegradedConditionType = "PKIDegraded"
+
+// requiredServiceSAN is the service SAN the audit expects on every node cert.
+const requiredServiceSAN = "etcd.openshift-etcd.svc"
+
+// maxReportedPKIIssues is the number of issues enumerated in the message of the PKIDegraded condition.
+const maxReportedPKIIssues = 3
+
+// HealthReport aggregates the findings of the PKI audit helpers for the managed secrets.
+type HealthReport struct {
+	// UnownedSecrets are managed secrets that are missing or look managed by something else, see VerifyManagedSecretOwnership
+	UnownedSecrets []string
+	// MismatchedKeyPairSecrets are managed secrets whose private key does not match their cert, see DetectMismatchedKeyPairs
+	MismatchedKeyPairSecrets []string
+	// WeakSignatureSecrets are managed secrets with a cert using a deprecated signature algorithm, see DetectWeakSignatureCerts
+	WeakSignatureSecrets []string
+	// MissingSANSecrets are node secrets whose cert lacks the service SAN, see CertsMissingSAN
+	MissingSANSecrets []string
+}
+
+// AuditPKIHealth runs the PKI audit helpers against the managed secrets of the given nodes. The options must be the
+// ones the secrets are issued with.
+func AuditPKIHealth(ctx context.Context, secretClient corev1client.SecretsGetter, nodeNames []string, opts ...CertOption) (HealthReport, error) {
+	var report HealthReport
+	var err error
+	if report.UnownedSecrets, err = VerifyManagedSecretOwnership(ctx, secretClient, nodeNames, opts...); err != nil {
+		return HealthReport{}, err
+	}
+	if report.MismatchedKeyPairSecrets, err = DetectMismatchedKeyPairs(ctx, secretClient, nodeNames); err != nil {
+		return HealthReport{}, err
+	}
+	if report.WeakSignatureSecrets, err = DetectWeakSignatureCerts(ctx, secretClient, nodeNames); err != nil {
+		return HealthReport{}, err
+	}
+	if report.MissingSANSecrets, err = CertsMissingSAN(ctx, secretClient, requiredServiceSAN, nodeNames); err != nil {
+		return HealthReport{}, err
+	}
+	return report, nil
+}
+
+// Issues returns a description of every finding of the report, the most severe first.
+func (r HealthReport) Issues() []string {
+	var issues []string
+	for _, name := range r.UnownedSecrets {
+		issues = append(issues, fmt.Sprintf("secret %s is missing or not owned by the operator", name))
+	}
+	for _, name := range r.MismatchedKeyPairSecrets {
+		issues = append(issues, fmt.Sprintf("secret %s has a private key not matching its cert", name))
+	}
+	for _, name := range r.WeakSignatureSecrets {
+		issues = append(issues, fmt.Sprintf("secret %s has a cert with a deprecated signature algorithm", name))
+	}
+	for _, name := range r.MissingSANSecrets {
+		issues = append(issues, fmt.Sprintf("secret %s has a cert missing the %s SAN", name, requiredServiceSAN))
+	}
+	return issues
+}
+
+// ComputePKIDegradedCondition maps the report onto the PKIDegraded condition, enumerating the top issues in its message.
+func ComputePKIDegradedCondition(report HealthReport) *operatorv1.OperatorCondition {
+	issues := report.Issues()
+	if len(issues) == 0 {
+		return &operatorv1.OperatorCondition{
+			Type:   PKIDegradedConditionType,
+			Status: operatorv1.ConditionFalse,
+			Reason: "AsExpected",
+		}
+	}
+
+	message := strings.Join(issues[:minInt(len(issues), maxReportedPKIIssues)], "; ")
+	if more := len(issues) - maxReportedPKIIssues; more > 0 {
+		message = fmt.Sprintf("%s; and %d more", message, more)
+	}
+	return &operatorv1.OperatorCondition{
+		Type:    PKIDegradedConditionType,
+		Status:  operatorv1.ConditionTrue,
+		Reason:  "PKIIssuesFound",
+		Message: fmt.Sprintf("%d PKI issues found: %s", len(issues), message),
+	}
+}
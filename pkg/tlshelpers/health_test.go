@@ -0,0 +1,65 @@
+package tlshelpers
+
+import (
+	"context"
+	"testing"
+
+	operatorv1 "github.com/openshift/api/operator/v1"
+	"github.com/stretchr/testify/require"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestComputePKIDegradedCondition(t *testing.T) {
+	tests := map[string]struct {
+		report   HealthReport
+		expected *operatorv1.OperatorCondition
+	}{
+		"healthy": {
+			expected: &operatorv1.OperatorCondition{
+				Type:   PKIDegradedConditionType,
+				Status: operatorv1.ConditionFalse,
+				Reason: "AsExpected",
+			},
+		},
+		"single issue": {
+			report: HealthReport{WeakSignatureSecrets: []string{"etcd-client"}},
+			expected: &operatorv1.OperatorCondition{
+				Type:    PKIDegradedConditionType,
+				Status:  operatorv1.ConditionTrue,
+				Reason:  "PKIIssuesFound",
+				Message: "1 PKI issues found: secret etcd-client has a cert with a deprecated signature algorithm",
+			},
+		},
+		"multiple issues": {
+			report: HealthReport{
+				UnownedSecrets:       []string{"etcd-signer"},
+				WeakSignatureSecrets: []string{"etcd-client", "etcd-peer-master-0"},
+				MissingSANSecrets:    []string{"etcd-serving-master-0", "etcd-serving-master-1"},
+			},
+			expected: &operatorv1.OperatorCondition{
+				Type:   PKIDegradedConditionType,
+				Status: operatorv1.ConditionTrue,
+				Reason: "PKIIssuesFound",
+				Message: "5 PKI issues found: secret etcd-signer is missing or not owned by the operator; " +
+					"secret etcd-client has a cert with a deprecated signature algorithm; " +
+					"secret etcd-peer-master-0 has a cert with a deprecated signature algorithm; and 2 more",
+			},
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			require.Equal(t, test.expected, ComputePKIDegradedCondition(test.report))
+		})
+	}
+}
+
+func TestAuditPKIHealth(t *testing.T) {
+	fakeKubeClient := fake.NewSimpleClientset()
+	report, err := AuditPKIHealth(context.TODO(), fakeKubeClient.CoreV1(), []string{"master-0"})
+	require.NoError(t, err)
+	require.Len(t, report.UnownedSecrets, 7)
+	require.Empty(t, report.WeakSignatureSecrets)
+	require.Empty(t, report.MissingSANSecrets)
+	require.Equal(t, operatorv1.ConditionTrue, ComputePKIDegradedCondition(report).Status)
+}
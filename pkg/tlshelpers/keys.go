@@ -0,0 +1,263 @@
+package tlshelpers
+
+import (
+	gocrypto "crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha1"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"fmt"
+	"math/big"
+	"strconv"
+	"time"
+
+	"github.com/openshift/library-go/pkg/crypto"
+	"github.com/openshift/library-go/pkg/operator/certrotation"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/apiserver/pkg/authentication/user"
+)
+
+// KeyAlgorithm is the algorithm of the private key generated for an issued certificate.
+type KeyAlgorithm string
+
+const (
+	// RSAKeyAlgorithm generates RSA keys with the library-go defaults.
+	RSAKeyAlgorithm KeyAlgorithm = "RSA"
+	// ECDSAP256KeyAlgorithm generates ECDSA keys on the P-256 curve, which are considerably cheaper in TLS handshakes.
+	ECDSAP256KeyAlgorithm KeyAlgorithm = "ECDSA-P256"
+)
+
+const (
+	// DefaultRSAKeySize is the modulus size in bits of the RSA keys generated by library-go.
+	DefaultRSAKeySize = 2048
+
+	// RSAKeySizeAnnotation records the modulus size of the RSA key on the managed secret, so that a changed key size
+	// is rolled out on the next sync instead of waiting for the refresh.
+	RSAKeySizeAnnotation = "etcd.openshift.io/rsa-key-size"
+)
+
+// makeServerCertForDuration issues a serving cert for the hostnames, just like crypto.CA.MakeServerCertForDuration,
+// but with a key of the given algorithm and RSA key size. A zero rsaKeySize means DefaultRSAKeySize.
+func makeServerCertForDuration(ca *crypto.CA, hostnames sets.String, lifetime time.Duration, keyAlgorithm KeyAlgorithm, rsaKeySize int, fns ...crypto.CertificateExtensionFunc) (*crypto.TLSCertificateConfig, error) {
+	if isDefaultRSAKey(keyAlgorithm, rsaKeySize) {
+		return ca.MakeServerCertForDuration(hostnames, lifetime, fns...)
+	}
+
+	publicKey, privateKey, subjectKeyId, err := newKeyPair(keyAlgorithm, rsaKeySize)
+	if err != nil {
+		return nil, err
+	}
+	keyUsage := x509.KeyUsageDigitalSignature
+	if _, ok := privateKey.(*rsa.PrivateKey); ok {
+		keyUsage |= x509.KeyUsageKeyEncipherment
+	}
+	now := time.Now()
+	template := &x509.Certificate{
+		Subject:               pkix.Name{CommonName: hostnames.List()[0]},
+		NotBefore:             now.Add(-1 * time.Second),
+		NotAfter:              now.Add(lifetime),
+		SerialNumber:          big.NewInt(1),
+		KeyUsage:              keyUsage,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		BasicConstraintsValid: true,
+		AuthorityKeyId:        ca.Config.Certs[0].SubjectKeyId,
+		SubjectKeyId:          subjectKeyId,
+	}
+	template.IPAddresses, template.DNSNames = crypto.IPAddressesDNSNames(hostnames.List())
+	for _, fn := range fns {
+		if err := fn(template); err != nil {
+			return nil, err
+		}
+	}
+	return signLeafCert(ca, template, publicKey, privateKey)
+}
+
+// makeClientCertForDuration issues a client cert for the user, just like crypto.CA.MakeClientCertificateForDuration,
+// but with a key of the given algorithm and RSA key size and the extension functions applied to the template.
+// A zero rsaKeySize means DefaultRSAKeySize.
+func makeClientCertForDuration(ca *crypto.CA, u user.Info, lifetime time.Duration, keyAlgorithm KeyAlgorithm, rsaKeySize int, fns ...crypto.CertificateExtensionFunc) (*crypto.TLSCertificateConfig, error) {
+	if isDefaultRSAKey(keyAlgorithm, rsaKeySize) && len(fns) == 0 {
+		return ca.MakeClientCertificateForDuration(u, lifetime)
+	}
+
+	publicKey, privateKey, _, err := newKeyPair(keyAlgorithm, rsaKeySize)
+	if err != nil {
+		return nil, err
+	}
+
+	template := crypto.NewClientCertificateTemplateForDuration(crypto.UserToSubject(u), lifetime, time.Now)
+	if keyAlgorithm == ECDSAP256KeyAlgorithm {
+		// key encipherment only applies to RSA keys
+		template.KeyUsage = x509.KeyUsageDigitalSignature
+	}
+	// let the signature algorithm follow the key type of the CA, unless an extension function picks one
+	template.SignatureAlgorithm = x509.UnknownSignatureAlgorithm
+	for _, fn := range fns {
+		if err := fn(template); err != nil {
+			return nil, err
+		}
+	}
+	return signLeafCert(ca, template, publicKey, privateKey)
+}
+
+// signLeafCert signs the template with the CA. An unset signature algorithm of the template follows the key type of
+// the CA.
+func signLeafCert(ca *crypto.CA, template *x509.Certificate, publicKey gocrypto.PublicKey, privateKey gocrypto.PrivateKey) (*crypto.TLSCertificateConfig, error) {
+	cert, err := ca.SignCertificate(template, publicKey)
+	if err != nil {
+		return nil, err
+	}
+	return &crypto.TLSCertificateConfig{
+		Certs: append([]*x509.Certificate{cert}, ca.Config.Certs...),
+		Key:   privateKey,
+	}, nil
+}
+
+// isDefaultRSAKey returns whether the key is an RSA key of the size library-go generates anyway.
+func isDefaultRSAKey(keyAlgorithm KeyAlgorithm, rsaKeySize int) bool {
+	return (keyAlgorithm == "" || keyAlgorithm == RSAKeyAlgorithm) && (rsaKeySize == 0 || rsaKeySize == DefaultRSAKeySize)
+}
+
+// newKeyPair generates a key pair of the given algorithm and RSA key size and returns it with its subject key ID.
+func newKeyPair(keyAlgorithm KeyAlgorithm, rsaKeySize int) (gocrypto.PublicKey, gocrypto.PrivateKey, []byte, error) {
+	switch keyAlgorithm {
+	case "", RSAKeyAlgorithm:
+		return newRSAKeyPair(rsaKeySize)
+	case ECDSAP256KeyAlgorithm:
+		return newECDSAKeyPair()
+	default:
+		return nil, nil, nil, fmt.Errorf("unsupported key algorithm %q", keyAlgorithm)
+	}
+}
+
+func newRSAKeyPair(keySize int) (*rsa.PublicKey, *rsa.PrivateKey, []byte, error) {
+	if keySize == 0 {
+		keySize = DefaultRSAKeySize
+	}
+	if keySize < DefaultRSAKeySize {
+		return nil, nil, nil, fmt.Errorf("RSA key size %d is below the minimum of %d bits", keySize, DefaultRSAKeySize)
+	}
+	privateKey, err := rsa.GenerateKey(rand.Reader, keySize)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	// same subject key ID as library-go derives for its RSA keys
+	hash := sha1.Sum(privateKey.PublicKey.N.Bytes())
+	return &privateKey.PublicKey, privateKey, hash[:], nil
+}
+
+func newECDSAKeyPair() (*ecdsa.PublicKey, *ecdsa.PrivateKey, []byte, error) {
+	privateKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	publicKeyBytes, err := x509.MarshalPKIXPublicKey(&privateKey.PublicKey)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	hash := sha1.Sum(publicKeyBytes)
+	return &privateKey.PublicKey, privateKey, hash[:], nil
+}
+
+// keyAlgorithmOf returns the KeyAlgorithm of the given private key.
+func keyAlgorithmOf(key gocrypto.PrivateKey) KeyAlgorithm {
+	if _, ok := key.(*ecdsa.PrivateKey); ok {
+		return ECDSAP256KeyAlgorithm
+	}
+	return RSAKeyAlgorithm
+}
+
+// rsaKeySizeOf returns the modulus size in bits of the given private key, or zero if it is not an RSA key.
+func rsaKeySizeOf(key gocrypto.PrivateKey) int {
+	if rsaKey, ok := key.(*rsa.PrivateKey); ok {
+		return rsaKey.N.BitLen()
+	}
+	return 0
+}
+
+// needNewRSAKeySize returns a non-empty reason if the RSA key size recorded on the secret differs from the configured
+// one. Secrets without the annotation were issued before the size became configurable and carry default sized keys.
+func needNewRSAKeySize(annotations map[string]string, keyAlgorithm KeyAlgorithm, rsaKeySize int) string {
+	if keyAlgorithm != "" && keyAlgorithm != RSAKeyAlgorithm {
+		return ""
+	}
+	if rsaKeySize == 0 {
+		rsaKeySize = DefaultRSAKeySize
+	}
+	currentKeySize := strconv.Itoa(DefaultRSAKeySize)
+	if value, ok := annotations[RSAKeySizeAnnotation]; ok {
+		currentKeySize = value
+	}
+	if currentKeySize != strconv.Itoa(rsaKeySize) {
+		return fmt.Sprintf("RSA key size changed from %s to %d bits", currentKeySize, rsaKeySize)
+	}
+	return ""
+}
+
+// setRSAKeySizeAnnotation records the RSA key size of the issued cert on the secret.
+func setRSAKeySizeAnnotation(cert *crypto.TLSCertificateConfig, annotations map[string]string) map[string]string {
+	if keySize := rsaKeySizeOf(cert.Key); keySize > 0 {
+		annotations[RSAKeySizeAnnotation] = strconv.Itoa(keySize)
+	} else {
+		delete(annotations, RSAKeySizeAnnotation)
+	}
+	return annotations
+}
+
+// servingRotation is a certrotation.ServingRotation that issues certs with keys of the configured algorithm and size.
+type servingRotation struct {
+	certrotation.ServingRotation
+	keyAlgorithm KeyAlgorithm
+	rsaKeySize   int
+	// nodeIPs are recorded in the NodeIPsAnnotation of the secret if set
+	nodeIPs []string
+}
+
+func (r *servingRotation) NewCertificate(signer *crypto.CA, validity time.Duration) (*crypto.TLSCertificateConfig, error) {
+	if len(r.Hostnames()) == 0 {
+		return nil, fmt.Errorf("no hostnames set")
+	}
+	return makeServerCertForDuration(signer, sets.NewString(r.Hostnames()...), validity, r.keyAlgorithm, r.rsaKeySize, r.CertificateExtensionFn...)
+}
+
+func (r *servingRotation) NeedNewTargetCertKeyPair(annotations map[string]string, signer *crypto.CA, caBundleCerts []*x509.Certificate, refresh time.Duration, refreshOnlyWhenExpired bool) string {
+	if reason := r.ServingRotation.NeedNewTargetCertKeyPair(annotations, signer, caBundleCerts, refresh, refreshOnlyWhenExpired); len(reason) > 0 {
+		return reason
+	}
+	return needNewRSAKeySize(annotations, r.keyAlgorithm, r.rsaKeySize)
+}
+
+func (r *servingRotation) SetAnnotations(cert *crypto.TLSCertificateConfig, annotations map[string]string) map[string]string {
+	annotations = setRSAKeySizeAnnotation(cert, r.ServingRotation.SetAnnotations(cert, annotations))
+	if len(r.nodeIPs) > 0 {
+		annotations[NodeIPsAnnotation] = formatNodeIPs(r.nodeIPs)
+	}
+	return annotations
+}
+
+// clientRotation is a certrotation.ClientRotation that issues certs with keys of the configured algorithm and size.
+type clientRotation struct {
+	certrotation.ClientRotation
+	keyAlgorithm KeyAlgorithm
+	rsaKeySize   int
+	// extensionFns are applied to the template of every issued cert
+	extensionFns []crypto.CertificateExtensionFunc
+}
+
+func (r *clientRotation) NewCertificate(signer *crypto.CA, validity time.Duration) (*crypto.TLSCertificateConfig, error) {
+	return makeClientCertForDuration(signer, r.UserInfo, validity, r.keyAlgorithm, r.rsaKeySize, r.extensionFns...)
+}
+
+func (r *clientRotation) NeedNewTargetCertKeyPair(annotations map[string]string, signer *crypto.CA, caBundleCerts []*x509.Certificate, refresh time.Duration, refreshOnlyWhenExpired bool) string {
+	if reason := r.ClientRotation.NeedNewTargetCertKeyPair(annotations, signer, caBundleCerts, refresh, refreshOnlyWhenExpired); len(reason) > 0 {
+		return reason
+	}
+	return needNewRSAKeySize(annotations, r.keyAlgorithm, r.rsaKeySize)
+}
+
+func (r *clientRotation) SetAnnotations(cert *crypto.TLSCertificateConfig, annotations map[string]string) map[string]string {
+	return setRSAKeySizeAnnotation(cert, r.ClientRotation.SetAnnotations(cert, annotations))
+}
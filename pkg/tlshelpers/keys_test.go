@@ -0,0 +1,269 @@
+package tlshelpers
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/pem"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+
+	"github.com/openshift/library-go/pkg/crypto"
+	"github.com/openshift/library-go/pkg/operator/events"
+	"github.com/stretchr/testify/require"
+	"go.etcd.io/etcd/client/pkg/v3/transport"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/client-go/kubernetes/fake"
+	corev1listers "k8s.io/client-go/listers/core/v1"
+	"k8s.io/client-go/tools/cache"
+
+	u "github.com/openshift/cluster-etcd-operator/pkg/testutils"
+)
+
+func TestKeyAlgorithm(t *testing.T) {
+	node := u.FakeNode("master-0", u.WithMasterLabel(), u.WithNodeInternalIP("10.0.0.1"))
+	signer := newTestSigner(t, "etcd-signer")
+	caCert, caKey, err := signer.Config.GetPEMBytes()
+	require.NoError(t, err)
+
+	tests := map[string]struct {
+		opts                 []CertOption
+		expectedKeyBlockType string
+		expectedCurve        elliptic.Curve
+	}{
+		"default is RSA": {
+			expectedKeyBlockType: "RSA PRIVATE KEY",
+		},
+		"explicit RSA": {
+			opts:                 []CertOption{WithKeyAlgorithm(RSAKeyAlgorithm)},
+			expectedKeyBlockType: "RSA PRIVATE KEY",
+		},
+		"ECDSA P-256": {
+			opts:                 []CertOption{WithKeyAlgorithm(ECDSAP256KeyAlgorithm)},
+			expectedKeyBlockType: "EC PRIVATE KEY",
+			expectedCurve:        elliptic.P256(),
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			fakeKubeClient := fake.NewSimpleClientset()
+			secretLister := corev1listers.NewSecretLister(cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{}))
+			certSecret, err := CreatePeerCertificate(node, nil, secretLister, fakeKubeClient.CoreV1(), events.NewInMemoryRecorder(t.Name()), test.opts...)
+			require.NoError(t, err)
+			secret, err := certSecret.EnsureTargetCertKeyPair(context.TODO(), signer, signer.Config.Certs)
+			require.NoError(t, err)
+			requireKeyAlgorithm(t, secret.Data[corev1.TLSCertKey], secret.Data[corev1.TLSPrivateKeyKey], caCert, test.expectedKeyBlockType, test.expectedCurve)
+
+			clientCert := CreateEtcdClientCert(nil, secretLister, fakeKubeClient.CoreV1(), events.NewInMemoryRecorder(t.Name()), test.opts...)
+			secret, err = clientCert.EnsureTargetCertKeyPair(context.TODO(), signer, signer.Config.Certs)
+			require.NoError(t, err)
+			requireKeyAlgorithm(t, secret.Data[corev1.TLSCertKey], secret.Data[corev1.TLSPrivateKeyKey], caCert, test.expectedKeyBlockType, test.expectedCurve)
+
+			certPEM, keyPEM, err := CreateServerCertKeyWithContext(context.TODO(), caCert, caKey, "master-0", []string{"10.0.0.1"}, test.opts...)
+			require.NoError(t, err)
+			requireKeyAlgorithm(t, certPEM.Bytes(), keyPEM.Bytes(), caCert, test.expectedKeyBlockType, test.expectedCurve)
+		})
+	}
+
+	_, _, err = CreateServerCertKeyWithContext(context.TODO(), caCert, caKey, "master-0", []string{"10.0.0.1"}, WithKeyAlgorithm("DSA"))
+	require.Error(t, err)
+}
+
+func TestRSAKeySize(t *testing.T) {
+	node := u.FakeNode("master-0", u.WithMasterLabel(), u.WithNodeInternalIP("10.0.0.1"))
+	signer := newTestSigner(t, "etcd-signer")
+	caCert, caKey, err := signer.Config.GetPEMBytes()
+	require.NoError(t, err)
+
+	tests := map[string]struct {
+		opts            []CertOption
+		expectedKeySize int
+	}{
+		"default": {
+			expectedKeySize: DefaultRSAKeySize,
+		},
+		"3072 bits": {
+			opts:            []CertOption{WithRSAKeySize(3072)},
+			expectedKeySize: 3072,
+		},
+		"4096 bits with cluster ID": {
+			opts:            []CertOption{WithRSAKeySize(4096), WithClusterID("cluster-a")},
+			expectedKeySize: 4096,
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			fakeKubeClient := fake.NewSimpleClientset()
+			secretLister := corev1listers.NewSecretLister(cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{}))
+			certSecret, err := CreatePeerCertificate(node, nil, secretLister, fakeKubeClient.CoreV1(), events.NewInMemoryRecorder(t.Name()), test.opts...)
+			require.NoError(t, err)
+			secret, err := certSecret.EnsureTargetCertKeyPair(context.TODO(), signer, signer.Config.Certs)
+			require.NoError(t, err)
+			requireRSAKeySize(t, secret.Data[corev1.TLSPrivateKeyKey], test.expectedKeySize)
+			requireKeyAlgorithm(t, secret.Data[corev1.TLSCertKey], secret.Data[corev1.TLSPrivateKeyKey], caCert, "RSA PRIVATE KEY", nil)
+			require.Equal(t, strconv.Itoa(test.expectedKeySize), secret.Annotations[RSAKeySizeAnnotation])
+
+			clientCert := CreateEtcdClientCert(nil, secretLister, fakeKubeClient.CoreV1(), events.NewInMemoryRecorder(t.Name()), test.opts...)
+			secret, err = clientCert.EnsureTargetCertKeyPair(context.TODO(), signer, signer.Config.Certs)
+			require.NoError(t, err)
+			requireRSAKeySize(t, secret.Data[corev1.TLSPrivateKeyKey], test.expectedKeySize)
+
+			_, keyPEM, err := CreateServerCertKeyWithContext(context.TODO(), caCert, caKey, "master-0", []string{"10.0.0.1"}, test.opts...)
+			require.NoError(t, err)
+			requireRSAKeySize(t, keyPEM.Bytes(), test.expectedKeySize)
+		})
+	}
+
+	_, _, err = CreateServerCertKeyWithContext(context.TODO(), caCert, caKey, "master-0", []string{"10.0.0.1"}, WithRSAKeySize(1024))
+	require.Error(t, err)
+}
+
+func TestRSAKeySizeChangeReissues(t *testing.T) {
+	node := u.FakeNode("master-0", u.WithMasterLabel(), u.WithNodeInternalIP("10.0.0.1"))
+	signer := newTestSigner(t, "etcd-signer")
+	fakeKubeClient := fake.NewSimpleClientset()
+	indexer := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{})
+	secretLister := corev1listers.NewSecretLister(indexer)
+
+	ensure := func(opts ...CertOption) *corev1.Secret {
+		certSecret, err := CreatePeerCertificate(node, nil, secretLister, fakeKubeClient.CoreV1(), events.NewInMemoryRecorder(t.Name()), opts...)
+		require.NoError(t, err)
+		secret, err := certSecret.EnsureTargetCertKeyPair(context.TODO(), signer, signer.Config.Certs)
+		require.NoError(t, err)
+		require.NoError(t, indexer.Update(secret))
+		return secret
+	}
+
+	secret := ensure()
+	requireRSAKeySize(t, secret.Data[corev1.TLSPrivateKeyKey], DefaultRSAKeySize)
+	// secrets issued before the key size was recorded are not re-issued at the default size
+	delete(secret.Annotations, RSAKeySizeAnnotation)
+	require.NoError(t, indexer.Update(secret))
+	require.Equal(t, secret.Data, ensure().Data)
+
+	secret = ensure(WithRSAKeySize(3072))
+	requireRSAKeySize(t, secret.Data[corev1.TLSPrivateKeyKey], 3072)
+	require.Equal(t, secret.Data, ensure(WithRSAKeySize(3072)).Data)
+
+	secret = ensure()
+	requireRSAKeySize(t, secret.Data[corev1.TLSPrivateKeyKey], DefaultRSAKeySize)
+}
+
+func requireRSAKeySize(t *testing.T, keyPEM []byte, expectedKeySize int) {
+	block, _ := pem.Decode(keyPEM)
+	require.NotNil(t, block)
+	key, err := x509.ParsePKCS1PrivateKey(block.Bytes)
+	require.NoError(t, err)
+	require.Equal(t, expectedKeySize, key.N.BitLen())
+}
+
+// requireKeyAlgorithm asserts the type of the issued key and that etcd is able to load the pair for serving.
+func requireKeyAlgorithm(t *testing.T, certPEM, keyPEM, caPEM []byte, expectedKeyBlockType string, expectedCurve elliptic.Curve) {
+	block, _ := pem.Decode(keyPEM)
+	require.NotNil(t, block)
+	require.Equal(t, expectedKeyBlockType, block.Type)
+
+	certConfig, err := crypto.GetTLSCertificateConfigFromBytes(certPEM, keyPEM)
+	require.NoError(t, err)
+	if expectedCurve == nil {
+		require.IsType(t, &rsa.PrivateKey{}, certConfig.Key)
+	} else {
+		key, ok := certConfig.Key.(*ecdsa.PrivateKey)
+		require.True(t, ok)
+		require.Equal(t, expectedCurve, key.Curve)
+		require.Equal(t, x509.ECDSA, certConfig.Certs[0].PublicKeyAlgorithm)
+	}
+
+	dir := t.TempDir()
+	tlsInfo := transport.TLSInfo{
+		CertFile:      filepath.Join(dir, "tls.crt"),
+		KeyFile:       filepath.Join(dir, "tls.key"),
+		TrustedCAFile: filepath.Join(dir, "ca.crt"),
+	}
+	require.NoError(t, os.WriteFile(tlsInfo.CertFile, certPEM, 0600))
+	require.NoError(t, os.WriteFile(tlsInfo.KeyFile, keyPEM, 0600))
+	require.NoError(t, os.WriteFile(tlsInfo.TrustedCAFile, caPEM, 0600))
+	_, err = tlsInfo.ServerConfig()
+	require.NoError(t, err)
+}
+
+func TestRSAPSSSignature(t *testing.T) {
+	signer := newTestSigner(t, "etcd-signer")
+	caCert, caKey, err := signer.Config.GetPEMBytes()
+	require.NoError(t, err)
+
+	tests := map[string]struct {
+		opts              []CertOption
+		expectedAlgorithm x509.SignatureAlgorithm
+	}{
+		"default is PKCS#1 v1.5": {
+			expectedAlgorithm: x509.SHA256WithRSA,
+		},
+		"RSA-PSS": {
+			opts:              []CertOption{WithRSAPSSSignature()},
+			expectedAlgorithm: x509.SHA256WithRSAPSS,
+		},
+		"RSA-PSS with a larger RSA key": {
+			opts:              []CertOption{WithRSAPSSSignature(), WithRSAKeySize(3072)},
+			expectedAlgorithm: x509.SHA256WithRSAPSS,
+		},
+		"RSA-PSS with an ECDSA key": {
+			opts:              []CertOption{WithRSAPSSSignature(), WithKeyAlgorithm(ECDSAP256KeyAlgorithm)},
+			expectedAlgorithm: x509.SHA256WithRSAPSS,
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			for _, create := range []func(context.Context, []byte, []byte, string, []string, ...CertOption) (*bytes.Buffer, *bytes.Buffer, error){
+				CreatePeerCertKeyWithContext, CreateServerCertKeyWithContext, CreateMetricCertKeyWithContext,
+			} {
+				certPEM, keyPEM, err := create(context.TODO(), caCert, caKey, "master-0", []string{"10.0.0.1"}, test.opts...)
+				require.NoError(t, err)
+				certConfig, err := crypto.GetTLSCertificateConfigFromBytes(certPEM.Bytes(), keyPEM.Bytes())
+				require.NoError(t, err)
+				require.Equal(t, test.expectedAlgorithm, certConfig.Certs[0].SignatureAlgorithm)
+				requireEtcdHandshake(t, certPEM.Bytes(), keyPEM.Bytes(), caCert)
+			}
+		})
+	}
+}
+
+// requireEtcdHandshake requires a mutually authenticated TLS handshake to succeed between an etcd server and client
+// that both use the given cert, key and CA.
+func requireEtcdHandshake(t *testing.T, certPEM, keyPEM, caPEM []byte) {
+	dir := t.TempDir()
+	tlsInfo := transport.TLSInfo{
+		CertFile:       filepath.Join(dir, "tls.crt"),
+		KeyFile:        filepath.Join(dir, "tls.key"),
+		TrustedCAFile:  filepath.Join(dir, "ca.crt"),
+		ClientCertAuth: true,
+	}
+	require.NoError(t, os.WriteFile(tlsInfo.CertFile, certPEM, 0600))
+	require.NoError(t, os.WriteFile(tlsInfo.KeyFile, keyPEM, 0600))
+	require.NoError(t, os.WriteFile(tlsInfo.TrustedCAFile, caPEM, 0600))
+	serverConfig, err := tlsInfo.ServerConfig()
+	require.NoError(t, err)
+	clientConfig, err := tlsInfo.ClientConfig()
+	require.NoError(t, err)
+	clientConfig.ServerName = "10.0.0.1"
+
+	serverConn, clientConn := net.Pipe()
+	defer serverConn.Close()
+	defer clientConn.Close()
+	serverErr := make(chan error, 1)
+	go func() {
+		serverErr <- tls.Server(serverConn, serverConfig).Handshake()
+	}()
+	require.NoError(t, tls.Client(clientConn, clientConfig).Handshake())
+	require.NoError(t, <-serverErr)
+}
@@ -0,0 +1,106 @@
+package tlshelpers
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net"
+	"net/url"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	corev1client "k8s.io/client-go/kubernetes/typed/core/v1"
+
+	"github.com/openshift/cluster-etcd-operator/pkg/operator/operatorclient"
+)
+
+// ServingSecretMatchesLiveServer compares the cert the etcd endpoint, e.g. https://10.0.0.1:2379, currently serves with
+// the cert in the etcd-serving-<node> secret of the node the endpoint belongs to. The secret is found by the IP or
+// hostname of the endpoint in its SANs. A mismatch means etcd still serves a stale cert and needs to be reloaded.
+func ServingSecretMatchesLiveServer(ctx context.Context, secretClient corev1client.SecretsGetter, endpoint string) (bool, error) {
+	hostPort := endpoint
+	if strings.Contains(endpoint, "://") {
+		u, err := url.Parse(endpoint)
+		if err != nil {
+			return false, fmt.Errorf("could not parse endpoint %q: %w", endpoint, err)
+		}
+		hostPort = u.Host
+	}
+	host, _, err := net.SplitHostPort(hostPort)
+	if err != nil {
+		return false, fmt.Errorf("could not parse endpoint %q: %w", endpoint, err)
+	}
+
+	servingCert, err := servingCertForHost(ctx, secretClient, host)
+	if err != nil {
+		return false, err
+	}
+	liveCert, err := liveServingCert(ctx, hostPort)
+	if err != nil {
+		return false, err
+	}
+	return bytes.Equal(servingCert.Raw, liveCert.Raw), nil
+}
+
+// servingCertForHost returns the cert of the etcd-serving-<node> secret whose SANs contain the given host.
+func servingCertForHost(ctx context.Context, secretClient corev1client.SecretsGetter, host string) (*x509.Certificate, error) {
+	secrets, err := secretClient.Secrets(operatorclient.TargetNamespace).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("error listing secrets in %s: %w", operatorclient.TargetNamespace, err)
+	}
+	for i := range secrets.Items {
+		secret := &secrets.Items[i]
+		if !isServingSecretName(secret.Name) || secret.Type != corev1.SecretTypeTLS {
+			continue
+		}
+		cert, err := certFromSecret(secret)
+		if err != nil {
+			return nil, err
+		}
+		if certHasSAN(cert, host) {
+			return cert, nil
+		}
+	}
+	return nil, fmt.Errorf("no serving secret in %s has a cert for %q", operatorclient.TargetNamespace, host)
+}
+
+// isServingSecretName returns true for the names of the etcd-serving-<node> secrets, which share their prefix with the
+// etcd-serving-metrics-<node> secrets.
+func isServingSecretName(name string) bool {
+	return strings.HasPrefix(name, GetServingSecretNameForNode("")) && !strings.HasPrefix(name, GetServingMetricsSecretNameForNode(""))
+}
+
+// liveServingCert returns the leaf cert presented by the TLS server at hostPort. The cert is only captured, not
+// verified, and the handshake may still fail afterward because no client cert is presented.
+func liveServingCert(ctx context.Context, hostPort string) (*x509.Certificate, error) {
+	var liveCert *x509.Certificate
+	dialer := &tls.Dialer{Config: &tls.Config{
+		// the presented cert is compared byte by byte, there is no trust decision to be made
+		InsecureSkipVerify: true,
+		VerifyPeerCertificate: func(rawCerts [][]byte, _ [][]*x509.Certificate) error {
+			if len(rawCerts) == 0 {
+				return fmt.Errorf("server presented no cert")
+			}
+			cert, err := x509.ParseCertificate(rawCerts[0])
+			if err != nil {
+				return err
+			}
+			liveCert = cert
+			return nil
+		},
+	}}
+	conn, err := dialer.DialContext(ctx, "tcp", hostPort)
+	if conn != nil {
+		conn.Close()
+	}
+	if liveCert == nil {
+		if err == nil {
+			err = fmt.Errorf("server presented no cert")
+		}
+		return nil, fmt.Errorf("could not get the serving cert of %s: %w", hostPort, err)
+	}
+	return liveCert, nil
+}
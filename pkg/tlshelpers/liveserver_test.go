@@ -0,0 +1,86 @@
+package tlshelpers
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestServingSecretMatchesLiveServer(t *testing.T) {
+	signer := newTestSigner(t, "etcd-signer")
+	hostNames := getServerHostNames([]string{"127.0.0.1"})
+	current := newTestCertSecret(t, signer, GetServingSecretNameForNode("master-0"), hostNames)
+	stale := newTestCertSecret(t, signer, GetServingSecretNameForNode("master-0"), hostNames)
+	// the metrics cert shares the SANs, but must not be picked up
+	metrics := newTestCertSecret(t, signer, GetServingMetricsSecretNameForNode("master-0"), hostNames)
+
+	tests := map[string]struct {
+		served            *corev1.Secret
+		clientAuth        tls.ClientAuthType
+		expectedMatch     bool
+		expectedErr       bool
+		endpointOverwrite string
+	}{
+		"serves the current cert": {
+			served:        current,
+			expectedMatch: true,
+		},
+		"serves the current cert and requires client certs": {
+			served:        current,
+			clientAuth:    tls.RequireAnyClientCert,
+			expectedMatch: true,
+		},
+		"serves a stale cert": {
+			served: stale,
+		},
+		"no serving secret for the endpoint": {
+			served:            current,
+			endpointOverwrite: "https://10.0.0.1:2379",
+			expectedErr:       true,
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			keyPair, err := tls.X509KeyPair(test.served.Data[corev1.TLSCertKey], test.served.Data[corev1.TLSPrivateKeyKey])
+			require.NoError(t, err)
+			endpoint := startTestTLSServer(t, &tls.Config{Certificates: []tls.Certificate{keyPair}, ClientAuth: test.clientAuth})
+			if len(test.endpointOverwrite) > 0 {
+				endpoint = test.endpointOverwrite
+			}
+
+			fakeKubeClient := fake.NewSimpleClientset(metrics, current)
+			match, err := ServingSecretMatchesLiveServer(context.TODO(), fakeKubeClient.CoreV1(), endpoint)
+			if test.expectedErr {
+				require.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, test.expectedMatch, match)
+		})
+	}
+}
+
+// startTestTLSServer serves TLS handshakes on a local port until the test ends and returns its endpoint.
+func startTestTLSServer(t *testing.T, config *tls.Config) string {
+	listener, err := tls.Listen("tcp", "127.0.0.1:0", config)
+	require.NoError(t, err)
+	t.Cleanup(func() { listener.Close() })
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			_ = conn.(*tls.Conn).Handshake()
+			conn.Close()
+		}
+	}()
+	return fmt.Sprintf("https://%s", listener.Addr().(*net.TCPAddr).String())
+}
@@ -0,0 +1,62 @@
+package tlshelpers
+
+import (
+	"fmt"
+
+	utilerrors "k8s.io/apimachinery/pkg/util/errors"
+)
+
+// ManagedSecretNames returns the names of all secrets the operator creates or reads for its certs, including the peer,
+// serving and serving metrics secrets of the given nodes, e.g. to generate least-privilege RBAC or to audit access.
+// They live in openshift-etcd, apart from the external signer in openshift-config, into which some are synced as well.
+func ManagedSecretNames(nodeNames []string) []string {
+	names := []string{
+		EtcdSignerCertSecretName,
+		EtcdMetricsSignerCertSecretName,
+		EtcdClientCertSecretName,
+		EtcdMetricsClientCertSecretName,
+		EtcdAllCertsSecretName,
+		EtcdBackupDestinationCertSecretName,
+		EtcdExternalSignerCertSecretName,
+	}
+	for _, nodeName := range nodeNames {
+		names = append(names, nodeSecretNames(nodeName)...)
+	}
+	return names
+}
+
+// ManagedConfigMapNames returns the names of all CA bundle configmaps the operator creates or reads, see
+// ManagedSecretNames.
+func ManagedConfigMapNames() []string {
+	return []string{
+		EtcdSignerCaBundleConfigMapName,
+		EtcdMetricsSignerCaBundleConfigMapName,
+	}
+}
+
+// ValidateNodeSecretNames returns an error identifying the nodes whose peer, serving or serving metrics secrets would
+// get the same name. The names are derived from the node names, so e.g. the serving secret etcd-serving-metrics-master-0
+// of a node metrics-master-0 is the serving metrics secret of the node master-0, and a node listed twice shares all of
+// its secrets. Issuing certs for such nodes overwrites the certs of one node with the ones of the other, so no cert
+// should be issued for the given nodes until the conflict is resolved.
+func ValidateNodeSecretNames(nodeNames []string) error {
+	nodeBySecretName := map[string]string{}
+	listed := map[string]bool{}
+	var errs []error
+	for _, nodeName := range nodeNames {
+		if listed[nodeName] {
+			errs = append(errs, fmt.Errorf("node %s is listed more than once", nodeName))
+			continue
+		}
+		listed[nodeName] = true
+
+		for _, secretName := range nodeSecretNames(nodeName) {
+			if otherNodeName, ok := nodeBySecretName[secretName]; ok {
+				errs = append(errs, fmt.Errorf("nodes %s and %s both map to the secret %s", otherNodeName, nodeName, secretName))
+				continue
+			}
+			nodeBySecretName[secretName] = nodeName
+		}
+	}
+	return utilerrors.NewAggregate(errs)
+}
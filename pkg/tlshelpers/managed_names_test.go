@@ -0,0 +1,90 @@
+package tlshelpers
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestManagedSecretNames(t *testing.T) {
+	constants := []string{
+		"etcd-signer",
+		"etcd-metric-signer",
+		"etcd-client",
+		"etcd-metric-client",
+		"etcd-all-certs",
+		"etcd-backup-destination",
+		"etcd-external-signer",
+	}
+
+	tests := map[string]struct {
+		nodeNames []string
+		expected  []string
+	}{
+		"no nodes": {
+			expected: constants,
+		},
+		"three nodes": {
+			nodeNames: []string{"master-0", "master-1", "master-2"},
+			expected: append(append([]string{}, constants...),
+				"etcd-peer-master-0", "etcd-serving-master-0", "etcd-serving-metrics-master-0",
+				"etcd-peer-master-1", "etcd-serving-master-1", "etcd-serving-metrics-master-1",
+				"etcd-peer-master-2", "etcd-serving-master-2", "etcd-serving-metrics-master-2",
+			),
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			require.Equal(t, test.expected, ManagedSecretNames(test.nodeNames))
+		})
+	}
+}
+
+func TestManagedConfigMapNames(t *testing.T) {
+	require.Equal(t, []string{"etcd-ca-bundle", "etcd-metrics-ca-bundle"}, ManagedConfigMapNames())
+}
+
+func TestValidateNodeSecretNames(t *testing.T) {
+	tests := map[string]struct {
+		nodeNames   []string
+		expectedErr string
+	}{
+		"no nodes": {},
+		"distinct nodes": {
+			nodeNames: []string{"master-0", "master-1", "master-2"},
+		},
+		"similar but distinct nodes": {
+			nodeNames: []string{"master-0", "serving-master-0", "peer-master-0", "metrics-master-1"},
+		},
+		"serving secret of one node is the metrics secret of another": {
+			nodeNames:   []string{"master-0", "metrics-master-0"},
+			expectedErr: "nodes master-0 and metrics-master-0 both map to the secret etcd-serving-metrics-master-0",
+		},
+		"collision is reported regardless of the order": {
+			nodeNames:   []string{"metrics-master-0", "master-1", "master-0"},
+			expectedErr: "nodes metrics-master-0 and master-0 both map to the secret etcd-serving-metrics-master-0",
+		},
+		"node listed twice": {
+			nodeNames:   []string{"master-0", "master-1", "master-0"},
+			expectedErr: "node master-0 is listed more than once",
+		},
+		"several conflicts": {
+			nodeNames: []string{"master-0", "metrics-master-0", "master-1", "metrics-master-1", "master-1"},
+			expectedErr: "[nodes master-0 and metrics-master-0 both map to the secret etcd-serving-metrics-master-0, " +
+				"nodes master-1 and metrics-master-1 both map to the secret etcd-serving-metrics-master-1, " +
+				"node master-1 is listed more than once]",
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			err := ValidateNodeSecretNames(test.nodeNames)
+			if len(test.expectedErr) > 0 {
+				require.EqualError(t, err, test.expectedErr)
+				return
+			}
+			require.NoError(t, err)
+		})
+	}
+}
@@ -0,0 +1,122 @@
+package tlshelpers
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/openshift/library-go/pkg/crypto"
+	"github.com/openshift/library-go/pkg/operator/certrotation"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apiserver/pkg/authentication/user"
+	corev1client "k8s.io/client-go/kubernetes/typed/core/v1"
+	corev1listers "k8s.io/client-go/listers/core/v1"
+
+	"github.com/openshift/cluster-etcd-operator/pkg/operator/operatorclient"
+)
+
+const (
+	metricsClientUserName = "etcd-metric"
+
+	// MetricsClientIdentityAnnotation records the identity suffix the metrics client cert is currently issued for.
+	MetricsClientIdentityAnnotation = "etcd.openshift.io/metrics-client-identity"
+	// MetricsClientPreviousIdentitiesAnnotation records the comma separated CNs of all previous metrics client
+	// identities, so they can be tracked for distrust.
+	MetricsClientPreviousIdentitiesAnnotation = "etcd.openshift.io/metrics-client-previous-identities"
+)
+
+func metricsClientUserInfo(identitySuffix string) user.Info {
+	name := metricsClientUserName
+	if len(identitySuffix) > 0 {
+		name = fmt.Sprintf("%s-%s", metricsClientUserName, identitySuffix)
+	}
+	return &user.DefaultInfo{
+		Name:   name,
+		Groups: []string{"system:etcd", "etcd-metric"},
+	}
+}
+
+// metricsClientRotation issues the metrics client cert for the identity recorded on the secret, so that a rotated
+// identity is kept across regular cert rotations.
+type metricsClientRotation struct {
+	clientRotation
+	lister corev1listers.SecretLister
+}
+
+func (r *metricsClientRotation) NewCertificate(signer *crypto.CA, validity time.Duration) (*crypto.TLSCertificateConfig, error) {
+	identitySuffix := ""
+	if secret, err := r.lister.Secrets(operatorclient.TargetNamespace).Get(EtcdMetricsClientCertSecretName); err == nil {
+		identitySuffix = secret.Annotations[MetricsClientIdentityAnnotation]
+	}
+	return makeClientCertForDuration(signer, metricsClientUserInfo(identitySuffix), validity, r.keyAlgorithm, r.rsaKeySize, r.extensionFns...)
+}
+
+// RotateMetricsClientIdentity re-issues the metrics client cert for a new identity, with the CN suffixed by
+// newIdentitySuffix, so that the cert of a compromised monitoring agent can be distrusted. The previous CN is
+// recorded on the secret. The new cert is signed by the metrics signer from openshift-config. It is valid for the client
+// cert validity configured by WithClientCertValidity or WithValidity, without one as long as the cert it replaces, and
+// never past the signer.
+func RotateMetricsClientIdentity(ctx context.Context, secretClient corev1client.SecretsGetter, newIdentitySuffix string, opts ...CertOption) error {
+	if len(newIdentitySuffix) == 0 {
+		return fmt.Errorf("new identity suffix must not be empty")
+	}
+
+	secret, err := secretClient.Secrets(operatorclient.TargetNamespace).Get(ctx, EtcdMetricsClientCertSecretName, metav1.GetOptions{})
+	if err != nil {
+		return fmt.Errorf("error getting %s/%s: %w", operatorclient.TargetNamespace, EtcdMetricsClientCertSecretName, err)
+	}
+	oldCertConfig, err := crypto.GetTLSCertificateConfigFromBytes(secret.Data[corev1.TLSCertKey], secret.Data[corev1.TLSPrivateKeyKey])
+	if err != nil {
+		return fmt.Errorf("could not parse %s/%s: %w", secret.Namespace, secret.Name, err)
+	}
+	oldCert := oldCertConfig.Certs[0]
+
+	userInfo := metricsClientUserInfo(newIdentitySuffix)
+	if oldCert.Subject.CommonName == userInfo.GetName() {
+		return fmt.Errorf("metrics client cert already has identity %q", userInfo.GetName())
+	}
+
+	signer, err := ReadConfigMetricsSignerCert(ctx, secretClient)
+	if err != nil {
+		return err
+	}
+	// the new cert keeps the key algorithm, key size and cluster ID of the cert it replaces
+	var fns []crypto.CertificateExtensionFunc
+	if len(oldCert.Subject.OrganizationalUnit) > 0 {
+		fns = append(fns, withClusterIDSubject(oldCert.Subject.OrganizationalUnit[0]))
+	}
+	certOpts := newCertOptions(opts...)
+	// the templates are backdated by a second, rounding keeps the validity from growing with every identity rotation
+	validity := oldCert.NotAfter.Sub(oldCert.NotBefore).Round(time.Minute)
+	if certOpts.clientValidity > 0 || certOpts.validity > 0 {
+		validity = certOpts.clientCertValidity()
+	}
+	certConfig, err := makeClientCertForDuration(signer, userInfo, validityWithinSigner(signer, validity), keyAlgorithmOf(oldCertConfig.Key), rsaKeySizeOf(oldCertConfig.Key), fns...)
+	if err != nil {
+		return err
+	}
+
+	secret = secret.DeepCopy()
+	secret.Data[corev1.TLSCertKey], secret.Data[corev1.TLSPrivateKeyKey], err = certConfig.GetPEMBytes()
+	if err != nil {
+		return err
+	}
+	if secret.Annotations == nil {
+		secret.Annotations = map[string]string{}
+	}
+	var previousIdentities []string
+	if previous := secret.Annotations[MetricsClientPreviousIdentitiesAnnotation]; len(previous) > 0 {
+		previousIdentities = strings.Split(previous, ",")
+	}
+	secret.Annotations[MetricsClientPreviousIdentitiesAnnotation] = strings.Join(append(previousIdentities, oldCert.Subject.CommonName), ",")
+	secret.Annotations[MetricsClientIdentityAnnotation] = newIdentitySuffix
+	// keep the rotation bookkeeping of library-go in sync with the new cert
+	secret.Annotations[certrotation.CertificateNotAfterAnnotation] = certConfig.Certs[0].NotAfter.Format(time.RFC3339)
+	secret.Annotations[certrotation.CertificateNotBeforeAnnotation] = certConfig.Certs[0].NotBefore.Format(time.RFC3339)
+	secret.Annotations[certrotation.CertificateIssuer] = certConfig.Certs[0].Issuer.CommonName
+
+	_, err = secretClient.Secrets(operatorclient.TargetNamespace).Update(ctx, secret, metav1.UpdateOptions{})
+	return err
+}
@@ -0,0 +1,70 @@
+package tlshelpers
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/openshift/library-go/pkg/crypto"
+	"github.com/openshift/library-go/pkg/operator/events"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+	corev1listers "k8s.io/client-go/listers/core/v1"
+	"k8s.io/client-go/tools/cache"
+
+	"github.com/openshift/cluster-etcd-operator/pkg/operator/operatorclient"
+	u "github.com/openshift/cluster-etcd-operator/pkg/testutils"
+)
+
+func TestRotateMetricsClientIdentity(t *testing.T) {
+	signer := newTestSigner(t, "etcd-metric-signer")
+	fakeKubeClient := fake.NewSimpleClientset(newTestCASecret(t, signer, operatorclient.GlobalUserSpecifiedConfigNamespace, EtcdMetricsSignerCertSecretName))
+	indexer := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{})
+	secretLister := corev1listers.NewSecretLister(indexer)
+
+	clientCert := CreateMetricsClientCert(nil, secretLister, fakeKubeClient.CoreV1(), events.NewInMemoryRecorder(t.Name()),
+		WithClientCertValidity(24*time.Hour))
+	oldSecret, err := clientCert.EnsureTargetCertKeyPair(context.TODO(), signer, signer.Config.Certs)
+	require.NoError(t, err)
+	require.Equal(t, "etcd-metric", parseSecretCert(t, oldSecret).Subject.CommonName)
+
+	require.Error(t, RotateMetricsClientIdentity(context.TODO(), fakeKubeClient.CoreV1(), ""))
+	require.NoError(t, RotateMetricsClientIdentity(context.TODO(), fakeKubeClient.CoreV1(), "rotated-1"))
+
+	newSecret, err := fakeKubeClient.CoreV1().Secrets(operatorclient.TargetNamespace).Get(context.TODO(), EtcdMetricsClientCertSecretName, metav1.GetOptions{})
+	require.NoError(t, err)
+	newCert := parseSecretCert(t, newSecret)
+	require.Equal(t, "etcd-metric-rotated-1", newCert.Subject.CommonName)
+	require.NotEqual(t, oldSecret.Data[corev1.TLSCertKey], newSecret.Data[corev1.TLSCertKey])
+	require.Equal(t, "etcd-metric", newSecret.Annotations[MetricsClientPreviousIdentitiesAnnotation])
+	require.Equal(t, []string{"etcd-metric", "system:etcd"}, newCert.Subject.Organization)
+	// without a configured validity the new cert is valid as long as the old one
+	require.InDelta(t, 24*time.Hour, newCert.NotAfter.Sub(newCert.NotBefore), float64(time.Minute))
+
+	// rotating to the identity already in use must fail
+	require.Error(t, RotateMetricsClientIdentity(context.TODO(), fakeKubeClient.CoreV1(), "rotated-1"))
+
+	require.NoError(t, RotateMetricsClientIdentity(context.TODO(), fakeKubeClient.CoreV1(), "rotated-2", WithClientCertValidity(48*time.Hour)))
+	newSecret, err = fakeKubeClient.CoreV1().Secrets(operatorclient.TargetNamespace).Get(context.TODO(), EtcdMetricsClientCertSecretName, metav1.GetOptions{})
+	require.NoError(t, err)
+	require.Equal(t, "etcd-metric,etcd-metric-rotated-1", newSecret.Annotations[MetricsClientPreviousIdentitiesAnnotation])
+	newCert = parseSecretCert(t, newSecret)
+	require.InDelta(t, 48*time.Hour, newCert.NotAfter.Sub(newCert.NotBefore), float64(time.Minute))
+
+	// a regular rotation keeps the rotated identity
+	require.NoError(t, indexer.Add(newSecret))
+	regular, err := clientCert.CertCreator.NewCertificate(signer, etcdCertValidity)
+	require.NoError(t, err)
+	require.Equal(t, "etcd-metric-rotated-2", regular.Certs[0].Subject.CommonName)
+}
+
+func newTestCASecret(t *testing.T, signer *crypto.CA, namespace, name string) *corev1.Secret {
+	certBytes, keyBytes, err := signer.Config.GetPEMBytes()
+	require.NoError(t, err)
+	return u.FakeSecret(namespace, name, map[string][]byte{
+		corev1.TLSCertKey:       certBytes,
+		corev1.TLSPrivateKeyKey: keyBytes,
+	})
+}
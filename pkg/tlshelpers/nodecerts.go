@@ -0,0 +1,276 @@
+package tlshelpers
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/openshift/api/annotations"
+	"github.com/openshift/library-go/pkg/crypto"
+	"github.com/openshift/library-go/pkg/operator/certrotation"
+	"github.com/openshift/library-go/pkg/operator/events"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	utilerrors "k8s.io/apimachinery/pkg/util/errors"
+	"k8s.io/apimachinery/pkg/util/sets"
+	corev1informers "k8s.io/client-go/informers/core/v1"
+	corev1client "k8s.io/client-go/kubernetes/typed/core/v1"
+	corev1listers "k8s.io/client-go/listers/core/v1"
+	"k8s.io/client-go/util/workqueue"
+
+	"github.com/openshift/cluster-etcd-operator/pkg/operator/operatorclient"
+)
+
+// NodeCertType is the type of a cert the operator issues for every node.
+type NodeCertType string
+
+const (
+	PeerNodeCertType           NodeCertType = "peer"
+	ServingNodeCertType        NodeCertType = "serving"
+	ServingMetricsNodeCertType NodeCertType = "serving-metrics"
+)
+
+// MissingNodeCert identifies the secret of a node cert that has not been provisioned yet.
+type MissingNodeCert struct {
+	NodeName   string
+	CertType   NodeCertType
+	SecretName string
+}
+
+// MissingNodeCertSecrets returns, in the order of the given nodes, every peer, serving and serving metrics secret that
+// does not exist yet in the target namespace, e.g. for a node that is being added during scale-up.
+func MissingNodeCertSecrets(nodes []*corev1.Node, secretLister corev1listers.SecretLister) ([]MissingNodeCert, error) {
+	var missing []MissingNodeCert
+	for _, node := range nodes {
+		for _, nodeCert := range []MissingNodeCert{
+			{NodeName: node.Name, CertType: PeerNodeCertType, SecretName: GetPeerClientSecretNameForNode(node.Name)},
+			{NodeName: node.Name, CertType: ServingNodeCertType, SecretName: GetServingSecretNameForNode(node.Name)},
+			{NodeName: node.Name, CertType: ServingMetricsNodeCertType, SecretName: GetServingMetricsSecretNameForNode(node.Name)},
+		} {
+			_, err := secretLister.Secrets(operatorclient.TargetNamespace).Get(nodeCert.SecretName)
+			if err == nil {
+				continue
+			}
+			if !apierrors.IsNotFound(err) {
+				return nil, fmt.Errorf("error getting %s/%s: %w", operatorclient.TargetNamespace, nodeCert.SecretName, err)
+			}
+			missing = append(missing, nodeCert)
+		}
+	}
+	return missing, nil
+}
+
+// OrphanedNodeCertSecrets returns the sorted names of the peer, serving and serving metrics secrets in the target
+// namespace that belong to none of the given nodes, e.g. after a node was removed from the cluster. Only secrets
+// labeled as managed target certs whose name follows GetPeerClientSecretNameForNode, GetServingSecretNameForNode or
+// GetServingMetricsSecretNameForNode are considered, so that unrelated secrets are never reported.
+func OrphanedNodeCertSecrets(nodes []*corev1.Node, secretLister corev1listers.SecretLister) ([]string, error) {
+	live := sets.NewString()
+	for _, node := range nodes {
+		live.Insert(GetPeerClientSecretNameForNode(node.Name), GetServingSecretNameForNode(node.Name), GetServingMetricsSecretNameForNode(node.Name))
+	}
+
+	secrets, err := secretLister.Secrets(operatorclient.TargetNamespace).List(labels.SelectorFromSet(labels.Set{
+		certrotation.ManagedCertificateTypeLabelName: string(certrotation.CertificateTypeTarget),
+	}))
+	if err != nil {
+		return nil, fmt.Errorf("error listing secrets in %s: %w", operatorclient.TargetNamespace, err)
+	}
+
+	var orphaned []string
+	for _, secret := range secrets {
+		if _, ok := nodeNameFromCertSecretName(secret.Name); ok && !live.Has(secret.Name) {
+			orphaned = append(orphaned, secret.Name)
+		}
+	}
+	sort.Strings(orphaned)
+	return orphaned, nil
+}
+
+// nodeNameFromCertSecretName returns the name of the node the given peer, serving or serving metrics secret name is
+// derived from. A node whose name starts with "metrics-" is ambiguous, its serving secret is taken for the serving
+// metrics secret of the node without the prefix.
+func nodeNameFromCertSecretName(secretName string) (string, bool) {
+	_, nodeName, ok := nodeCertFromSecretName(secretName)
+	return nodeName, ok
+}
+
+// nodeCertFromSecretName returns the type and the node name of the given peer, serving or serving metrics secret name.
+func nodeCertFromSecretName(secretName string) (NodeCertType, string, bool) {
+	// the serving metrics prefix must be checked before the serving prefix it starts with
+	for _, nodeCert := range []struct {
+		certType          NodeCertType
+		secretNameForNode func(string) string
+	}{
+		{ServingMetricsNodeCertType, GetServingMetricsSecretNameForNode},
+		{ServingNodeCertType, GetServingSecretNameForNode},
+		{PeerNodeCertType, GetPeerClientSecretNameForNode},
+	} {
+		if nodeName := strings.TrimPrefix(secretName, nodeCert.secretNameForNode("")); nodeName != secretName {
+			return nodeCert.certType, nodeName, len(nodeName) > 0
+		}
+	}
+	return "", "", false
+}
+
+// NodeCertBundle holds the rendered peer, serving and serving metrics secrets of a node.
+type NodeCertBundle struct {
+	Peer           *corev1.Secret
+	Serving        *corev1.Secret
+	ServingMetrics *corev1.Secret
+}
+
+// NodeCertError is returned by CreateAllNodeCerts when the cert of the given type could not be created.
+type NodeCertError struct {
+	NodeName string
+	CertType NodeCertType
+	Err      error
+}
+
+func (e *NodeCertError) Error() string {
+	return fmt.Sprintf("could not create %s cert for node %s: %v", e.CertType, e.NodeName, e.Err)
+}
+
+func (e *NodeCertError) Unwrap() error {
+	return e.Err
+}
+
+// nodeCertBatchWorkers bounds the number of nodes CreateNodeCertificates looks up at once.
+const nodeCertBatchWorkers = 4
+
+// NodeCertificates holds the peer, serving and serving metrics cert configs of a node.
+type NodeCertificates struct {
+	Node        *corev1.Node
+	PeerCert    *certrotation.RotatedSelfSignedCertKeySecret
+	ServingCert *certrotation.RotatedSelfSignedCertKeySecret
+	MetricsCert *certrotation.RotatedSelfSignedCertKeySecret
+}
+
+// CreateNodeCertificates returns the cert configs CreatePeerCertificate, CreateServingCertificate and
+// CreateMetricsServingCertificate would return for each of the given nodes, e.g. for several control plane nodes being
+// added at once. The hostnames of a node are looked up once for all of its certs and the nodes are looked up in
+// parallel. A node whose certs cannot be created does not abort the batch: the certs of all other nodes are returned
+// in the order of the given nodes, together with an aggregate of the errors of the failed nodes.
+func CreateNodeCertificates(ctx context.Context, nodes []*corev1.Node,
+	secretInformer corev1informers.SecretInformer,
+	secretLister corev1listers.SecretLister,
+	secretGetter corev1client.SecretsGetter,
+	recorder events.Recorder,
+	opts ...CertOption) ([]NodeCertificates, error) {
+
+	certOpts := newCertOptions(opts...)
+	results := make([]NodeCertificates, len(nodes))
+	errs := make([]error, len(nodes))
+	workqueue.ParallelizeUntil(ctx, nodeCertBatchWorkers, len(nodes), func(i int) {
+		node := nodes[i]
+		certs := []struct {
+			cert        **certrotation.RotatedSelfSignedCertKeySecret
+			description string
+			secretName  string
+			org         string
+			certOpts    *certOptions
+		}{
+			{&results[i].PeerCert, fmt.Sprintf("Peer Cert for node %s", node.Name), GetPeerClientSecretNameForNode(node.Name), peerOrg, certOpts},
+			{&results[i].ServingCert, fmt.Sprintf("Serving Cert for node %s", node.Name), GetServingSecretNameForNode(node.Name), serverOrg, certOpts},
+			{&results[i].MetricsCert, fmt.Sprintf("Metric Serving Cert for node %s", node.Name), GetServingMetricsSecretNameForNode(node.Name), metricOrg, certOpts.metricsServingCertOptions()},
+		}
+
+		nodeIPs, hostNames, err := nodeCertHostNames(node, certOpts)
+		if err != nil {
+			for _, c := range certs {
+				reportNodeCertError(err, node, c.secretName, c.description, recorder)
+			}
+			errs[i] = fmt.Errorf("error creating certs for node [%s]: %w", node.Name, err)
+			return
+		}
+		results[i].Node = node
+		for _, c := range certs {
+			*c.cert = newRotatedNodeCertSecret(c.description, c.secretName, c.org, node, hostNames, nodeIPs, c.certOpts,
+				secretInformer, secretLister, secretGetter, recorder)
+		}
+	})
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	var nodeCerts []NodeCertificates
+	var failed []error
+	for i := range nodes {
+		if errs[i] != nil {
+			failed = append(failed, errs[i])
+			continue
+		}
+		nodeCerts = append(nodeCerts, results[i])
+	}
+	return nodeCerts, utilerrors.NewAggregate(failed)
+}
+
+// CreateAllNodeCerts renders the peer, serving and serving metrics secrets of the given node signed by signer, the
+// same way CreatePeerCertificate, CreateServingCertificate and CreateMetricsServingCertificate would issue them, e.g.
+// for tooling that replaces a node. The internal IPs of the node are looked up once for all of them.
+func CreateAllNodeCerts(node *corev1.Node, signer *crypto.CA, opts ...CertOption) (NodeCertBundle, error) {
+	certOpts := newCertOptions(opts...)
+	nodeIPs, hostNames, err := nodeCertHostNames(node, certOpts)
+	if err != nil {
+		return NodeCertBundle{}, err
+	}
+
+	render := func(creator certrotation.TargetCertCreator, certType NodeCertType, description, secretName string) (*corev1.Secret, error) {
+		secret, err := renderNodeCertSecret(creator, signer, certOpts.certValidity(), certOpts.jiraComponentName(), certOpts.description(description), secretName)
+		if err != nil {
+			return nil, &NodeCertError{NodeName: node.Name, CertType: certType, Err: err}
+		}
+		return secret, nil
+	}
+
+	var bundle NodeCertBundle
+	if bundle.Peer, err = render(newNodeCertCreator(peerOrg, node.Name, hostNames, nodeIPs, certOpts), PeerNodeCertType, fmt.Sprintf("Peer Cert for node %s", node.Name), GetPeerClientSecretNameForNode(node.Name)); err != nil {
+		return NodeCertBundle{}, err
+	}
+	if bundle.Serving, err = render(newNodeCertCreator(serverOrg, node.Name, hostNames, nodeIPs, certOpts), ServingNodeCertType, fmt.Sprintf("Serving Cert for node %s", node.Name), GetServingSecretNameForNode(node.Name)); err != nil {
+		return NodeCertBundle{}, err
+	}
+	if bundle.ServingMetrics, err = render(newNodeCertCreator(metricOrg, node.Name, hostNames, nodeIPs, certOpts.metricsServingCertOptions()), ServingMetricsNodeCertType, fmt.Sprintf("Metric Serving Cert for node %s", node.Name), GetServingMetricsSecretNameForNode(node.Name)); err != nil {
+		return NodeCertBundle{}, err
+	}
+	return bundle, nil
+}
+
+// renderNodeCertSecret mirrors what certrotation.RotatedSelfSignedCertKeySecret writes into a newly issued secret, so
+// that the rendered secret is not re-issued by the operator once applied.
+func renderNodeCertSecret(creator certrotation.TargetCertCreator, signer *crypto.CA, validity time.Duration, jiraComponent, description, secretName string) (*corev1.Secret, error) {
+	certKeyPair, err := creator.NewCertificate(signer, validityWithinSigner(signer, validity))
+	if err != nil {
+		return nil, err
+	}
+	certBytes, keyBytes, err := certKeyPair.GetPEMBytes()
+	if err != nil {
+		return nil, err
+	}
+
+	secret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace: operatorclient.TargetNamespace,
+			Name:      secretName,
+			Annotations: map[string]string{
+				certrotation.CertificateNotAfterAnnotation:  certKeyPair.Certs[0].NotAfter.Format(time.RFC3339),
+				certrotation.CertificateNotBeforeAnnotation: certKeyPair.Certs[0].NotBefore.Format(time.RFC3339),
+				certrotation.CertificateIssuer:              certKeyPair.Certs[0].Issuer.CommonName,
+				annotations.OpenShiftComponent:              jiraComponent,
+				annotations.OpenShiftDescription:            description,
+			},
+		},
+		Type: corev1.SecretTypeTLS,
+		Data: map[string][]byte{
+			corev1.TLSCertKey:       certBytes,
+			corev1.TLSPrivateKeyKey: keyBytes,
+		},
+	}
+	creator.SetAnnotations(certKeyPair, secret.Annotations)
+	certrotation.LabelAsManagedSecret(secret, certrotation.CertificateTypeTarget)
+	return secret, nil
+}
@@ -0,0 +1,254 @@
+package tlshelpers
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/openshift/library-go/pkg/operator/certrotation"
+	"github.com/openshift/library-go/pkg/operator/events"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	utilerrors "k8s.io/apimachinery/pkg/util/errors"
+	corev1informers "k8s.io/client-go/informers/core/v1"
+	"k8s.io/client-go/kubernetes/fake"
+	corev1client "k8s.io/client-go/kubernetes/typed/core/v1"
+	corev1listers "k8s.io/client-go/listers/core/v1"
+	"k8s.io/client-go/tools/cache"
+
+	"github.com/openshift/cluster-etcd-operator/pkg/dnshelpers"
+	"github.com/openshift/cluster-etcd-operator/pkg/operator/operatorclient"
+	u "github.com/openshift/cluster-etcd-operator/pkg/testutils"
+)
+
+func TestMissingNodeCertSecrets(t *testing.T) {
+	nodes := []*corev1.Node{
+		u.FakeNode("master-0", u.WithMasterLabel()),
+		u.FakeNode("master-1", u.WithMasterLabel()),
+	}
+	allSecrets := func(nodeName string) []*corev1.Secret {
+		return []*corev1.Secret{
+			u.FakeSecret(operatorclient.TargetNamespace, GetPeerClientSecretNameForNode(nodeName), nil),
+			u.FakeSecret(operatorclient.TargetNamespace, GetServingSecretNameForNode(nodeName), nil),
+			u.FakeSecret(operatorclient.TargetNamespace, GetServingMetricsSecretNameForNode(nodeName), nil),
+		}
+	}
+
+	tests := map[string]struct {
+		secrets  []*corev1.Secret
+		expected []MissingNodeCert
+	}{
+		"all provisioned": {
+			secrets: append(allSecrets("master-0"), allSecrets("master-1")...),
+		},
+		"new node": {
+			secrets: allSecrets("master-0"),
+			expected: []MissingNodeCert{
+				{NodeName: "master-1", CertType: PeerNodeCertType, SecretName: "etcd-peer-master-1"},
+				{NodeName: "master-1", CertType: ServingNodeCertType, SecretName: "etcd-serving-master-1"},
+				{NodeName: "master-1", CertType: ServingMetricsNodeCertType, SecretName: "etcd-serving-metrics-master-1"},
+			},
+		},
+		"partially provisioned": {
+			secrets: append(allSecrets("master-0")[1:], allSecrets("master-1")[:2]...),
+			expected: []MissingNodeCert{
+				{NodeName: "master-0", CertType: PeerNodeCertType, SecretName: "etcd-peer-master-0"},
+				{NodeName: "master-1", CertType: ServingMetricsNodeCertType, SecretName: "etcd-serving-metrics-master-1"},
+			},
+		},
+		"secret in other namespace": {
+			secrets: append(allSecrets("master-0"), u.FakeSecret(operatorclient.OperatorNamespace, "etcd-peer-master-1", nil),
+				u.FakeSecret(operatorclient.TargetNamespace, "etcd-serving-master-1", nil),
+				u.FakeSecret(operatorclient.TargetNamespace, "etcd-serving-metrics-master-1", nil)),
+			expected: []MissingNodeCert{
+				{NodeName: "master-1", CertType: PeerNodeCertType, SecretName: "etcd-peer-master-1"},
+			},
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			indexer := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{})
+			for _, secret := range test.secrets {
+				require.NoError(t, indexer.Add(secret))
+			}
+			missing, err := MissingNodeCertSecrets(nodes, corev1listers.NewSecretLister(indexer))
+			require.NoError(t, err)
+			require.Equal(t, test.expected, missing)
+		})
+	}
+}
+
+func TestOrphanedNodeCertSecrets(t *testing.T) {
+	managed := func(namespace, name string) *corev1.Secret {
+		secret := u.FakeSecret(namespace, name, nil)
+		certrotation.LabelAsManagedSecret(secret, certrotation.CertificateTypeTarget)
+		return secret
+	}
+	nodeSecrets := func(nodeName string) []*corev1.Secret {
+		return []*corev1.Secret{
+			managed(operatorclient.TargetNamespace, GetPeerClientSecretNameForNode(nodeName)),
+			managed(operatorclient.TargetNamespace, GetServingSecretNameForNode(nodeName)),
+			managed(operatorclient.TargetNamespace, GetServingMetricsSecretNameForNode(nodeName)),
+		}
+	}
+
+	tests := map[string]struct {
+		nodes    []*corev1.Node
+		secrets  []*corev1.Secret
+		expected []string
+	}{
+		"all live": {
+			nodes:   []*corev1.Node{u.FakeNode("master-0", u.WithMasterLabel()), u.FakeNode("master-1", u.WithMasterLabel())},
+			secrets: append(nodeSecrets("master-0"), nodeSecrets("master-1")...),
+		},
+		"removed node": {
+			nodes:    []*corev1.Node{u.FakeNode("master-0", u.WithMasterLabel())},
+			secrets:  append(nodeSecrets("master-0"), nodeSecrets("master-1")...),
+			expected: []string{"etcd-peer-master-1", "etcd-serving-master-1", "etcd-serving-metrics-master-1"},
+		},
+		"all nodes removed": {
+			secrets:  nodeSecrets("master-0")[:2],
+			expected: []string{"etcd-peer-master-0", "etcd-serving-master-0"},
+		},
+		"node named like the metrics prefix": {
+			// etcd-serving-metrics-0 is the serving secret of the live node metrics-0, not the metrics secret of a node 0
+			nodes:   []*corev1.Node{u.FakeNode("metrics-0", u.WithMasterLabel())},
+			secrets: nodeSecrets("metrics-0"),
+		},
+		"unrelated secrets": {
+			nodes: []*corev1.Node{u.FakeNode("master-0", u.WithMasterLabel())},
+			secrets: append(nodeSecrets("master-0"),
+				u.FakeSecret(operatorclient.TargetNamespace, "etcd-peer-master-1", nil),
+				managed(operatorclient.OperatorNamespace, "etcd-serving-master-1"),
+				managed(operatorclient.TargetNamespace, "etcd-serving-"),
+				managed(operatorclient.TargetNamespace, EtcdClientCertSecretName),
+				managed(operatorclient.TargetNamespace, EtcdMetricsClientCertSecretName),
+				managed(operatorclient.TargetNamespace, EtcdAllCertsSecretName),
+			),
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			indexer := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{})
+			for _, secret := range test.secrets {
+				require.NoError(t, indexer.Add(secret))
+			}
+			orphaned, err := OrphanedNodeCertSecrets(test.nodes, corev1listers.NewSecretLister(indexer))
+			require.NoError(t, err)
+			require.Equal(t, test.expected, orphaned)
+		})
+	}
+}
+
+func TestCreateAllNodeCerts(t *testing.T) {
+	node := u.FakeNode("master-0", u.WithMasterLabel(),
+		u.WithNodeInternalIP("10.0.0.1"), u.WithNodeInternalIP("192.168.0.1"), u.WithNodeInternalIP("fd00::1"))
+	signer := newTestSigner(t, "etcd-signer")
+
+	bundle, err := CreateAllNodeCerts(node, signer, WithExtraSANs([]string{"etcd.example.com"}))
+	require.NoError(t, err)
+
+	indexer := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{})
+	secretLister := corev1listers.NewSecretLister(indexer)
+	fakeKubeClient := fake.NewSimpleClientset()
+	for _, nodeCert := range []struct {
+		secret       *corev1.Secret
+		expectedName string
+		create       func(*corev1.Node, corev1informers.SecretInformer, corev1listers.SecretLister, corev1client.SecretsGetter, events.Recorder, ...CertOption) (*certrotation.RotatedSelfSignedCertKeySecret, error)
+	}{
+		{secret: bundle.Peer, expectedName: "etcd-peer-master-0", create: CreatePeerCertificate},
+		{secret: bundle.Serving, expectedName: "etcd-serving-master-0", create: CreateServingCertificate},
+		{secret: bundle.ServingMetrics, expectedName: "etcd-serving-metrics-master-0", create: CreateMetricsServingCertificate},
+	} {
+		require.Equal(t, operatorclient.TargetNamespace, nodeCert.secret.Namespace)
+		require.Equal(t, nodeCert.expectedName, nodeCert.secret.Name)
+		require.NoError(t, ValidateCertKeyPair(nodeCert.secret))
+
+		cert := parseSecretCert(t, nodeCert.secret)
+		var ips []string
+		for _, ip := range cert.IPAddresses {
+			ips = append(ips, ip.String())
+		}
+		require.Subset(t, ips, []string{"10.0.0.1", "192.168.0.1", "fd00::1", "127.0.0.1", "::1"})
+		require.Contains(t, cert.DNSNames, "etcd.example.com")
+		require.NoError(t, cert.CheckSignatureFrom(signer.Config.Certs[0]))
+
+		// the rotation of the operator keeps the rendered secret
+		require.NoError(t, indexer.Add(nodeCert.secret))
+		rotated, err := nodeCert.create(node, nil, secretLister, fakeKubeClient.CoreV1(), events.NewInMemoryRecorder(t.Name()), WithExtraSANs([]string{"etcd.example.com"}))
+		require.NoError(t, err)
+		secret, err := rotated.EnsureTargetCertKeyPair(context.TODO(), signer, signer.Config.Certs)
+		require.NoError(t, err)
+		require.Equal(t, nodeCert.secret.Data, secret.Data)
+	}
+
+	_, err = CreateAllNodeCerts(node, signer, WithRSAKeySize(1024))
+	var nodeCertErr *NodeCertError
+	require.True(t, errors.As(err, &nodeCertErr))
+	require.Equal(t, "master-0", nodeCertErr.NodeName)
+	require.Equal(t, PeerNodeCertType, nodeCertErr.CertType)
+
+	_, err = CreateAllNodeCerts(u.FakeNode("master-1", u.WithMasterLabel()), signer)
+	var missingIPErr *dnshelpers.NodeMissingInternalIPError
+	require.True(t, errors.As(err, &missingIPErr))
+}
+
+func TestCreateNodeCertificates(t *testing.T) {
+	nodes := []*corev1.Node{
+		u.FakeNode("master-0", u.WithMasterLabel(), u.WithNodeInternalIP("10.0.0.1")),
+		u.FakeNode("master-1", u.WithMasterLabel(), u.WithNodeInternalIP("10.0.0.2")),
+		u.FakeNode("master-2", u.WithMasterLabel()),
+		u.FakeNode("master-3", u.WithMasterLabel(), u.WithNodeInternalIP("10.0.0.4")),
+		u.FakeNode("master-4", u.WithMasterLabel(), u.WithNodeInternalIP("10.0.0.5")),
+	}
+	signer := newTestSigner(t, "etcd-signer")
+	secretLister := corev1listers.NewSecretLister(cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{}))
+	fakeKubeClient := fake.NewSimpleClientset()
+	recorder := events.NewInMemoryRecorder(t.Name())
+
+	nodeCerts, err := CreateNodeCertificates(context.TODO(), nodes, nil, secretLister, fakeKubeClient.CoreV1(), recorder)
+	require.EqualError(t, err, "error creating certs for node [master-2]: could not retrieve internal IP addresses for node: node/master-2 missing InternalIP")
+	var aggregate utilerrors.Aggregate
+	require.True(t, errors.As(err, &aggregate))
+	require.Len(t, aggregate.Errors(), 1)
+	var missingIPErr *dnshelpers.NodeMissingInternalIPError
+	require.True(t, errors.As(aggregate.Errors()[0], &missingIPErr))
+
+	var missingIPEvents int
+	for _, event := range recorder.Events() {
+		if event.Reason == "NodeInternalIPMissing" {
+			require.Contains(t, event.Message, "master-2")
+			missingIPEvents++
+		}
+	}
+	require.Equal(t, 3, missingIPEvents)
+
+	// the certs of all other nodes are returned in order
+	require.Len(t, nodeCerts, 4)
+	for i, expected := range []struct {
+		nodeName string
+		ip       string
+	}{
+		{"master-0", "10.0.0.1"},
+		{"master-1", "10.0.0.2"},
+		{"master-3", "10.0.0.4"},
+		{"master-4", "10.0.0.5"},
+	} {
+		require.Equal(t, expected.nodeName, nodeCerts[i].Node.Name)
+		for _, nodeCert := range []struct {
+			rotated      *certrotation.RotatedSelfSignedCertKeySecret
+			expectedName string
+		}{
+			{nodeCerts[i].PeerCert, GetPeerClientSecretNameForNode(expected.nodeName)},
+			{nodeCerts[i].ServingCert, GetServingSecretNameForNode(expected.nodeName)},
+			{nodeCerts[i].MetricsCert, GetServingMetricsSecretNameForNode(expected.nodeName)},
+		} {
+			require.Equal(t, nodeCert.expectedName, nodeCert.rotated.Name)
+			secret, err := nodeCert.rotated.EnsureTargetCertKeyPair(context.TODO(), signer, signer.Config.Certs)
+			require.NoError(t, err)
+			require.Contains(t, parseSecretCert(t, secret).DNSNames, expected.ip)
+		}
+	}
+}
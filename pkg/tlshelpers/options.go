@@ -0,0 +1,391 @@
+package tlshelpers
+
+import (
+	"crypto/x509"
+	"strings"
+	"time"
+
+	"github.com/openshift/library-go/pkg/crypto"
+	"github.com/openshift/library-go/pkg/operator/certrotation"
+)
+
+// certOptions holds the optional knobs that can be applied when creating the rotated cert/key secrets.
+type certOptions struct {
+	// writeCertMetadataAnnotations mirrors key attributes of the issued certificate into annotations on the secret
+	writeCertMetadataAnnotations bool
+	// keyAlgorithm is the algorithm of the generated private keys, RSA if unset
+	keyAlgorithm KeyAlgorithm
+	// rsaKeySize is the modulus size in bits of generated RSA keys, DefaultRSAKeySize if unset
+	rsaKeySize int
+	// clusterID is added to the subject of the issued certificates if set
+	clusterID string
+	// rsaPSSSignature signs the peer, serving and metrics certs with RSA-PSS instead of PKCS#1 v1.5
+	rsaPSSSignature bool
+	// codeSigningUsage adds the code signing extended key usage to the peer, serving and metrics certs
+	codeSigningUsage bool
+	// metricsServerAuthOnly issues the serving metrics certs with the server auth extended key usage only
+	metricsServerAuthOnly bool
+	// serverAuthOnly is metricsServerAuthOnly applied to the cert being issued, see metricsServingCertOptions
+	serverAuthOnly bool
+	// extraSANs are appended to the SANs of the peer, serving and metrics certs
+	extraSANs []string
+	// extraServiceNames are the base names of services whose DNS names are appended to the SANs of the serving certs
+	extraServiceNames []string
+	// bootstrapAliases are appended to the SANs of the serving certs while bootstrapping is not complete
+	bootstrapAliases []string
+	// extraOrganizations are appended to the subject organizations of the node certs
+	extraOrganizations []string
+	// externalIPFallback issues the node certs on the ExternalIPs of nodes that have no InternalIP
+	externalIPFallback bool
+	// jiraComponent is the component annotation of the managed secrets and configmaps, EtcdJiraComponentName if unset
+	jiraComponent string
+	// descriptionFn maps the default description annotation of the managed secrets and configmaps to the one written
+	descriptionFn func(defaultDescription string) string
+	// validity is the validity of the leaf certs, etcdCertValidity if unset
+	validity time.Duration
+	// clientValidity is the validity of the etcd and etcd metrics client certs, validity if unset
+	clientValidity time.Duration
+	// caValidity is the validity of the signers, etcdCaCertValidity if unset
+	caValidity time.Duration
+	// intermediateCAsPEM are appended to the chain of the certs issued from a static CA
+	intermediateCAsPEM []byte
+	// clientCertExtraUsages are appended to the extended key usages of the etcd client cert
+	clientCertExtraUsages []x509.ExtKeyUsage
+	// minTrustedCAs is the minimum number of CAs the managed CA bundles must trust, DefaultMinTrustedCAs if unset
+	minTrustedCAs int
+}
+
+// CertOption configures how the managed certificates are issued.
+type CertOption func(*certOptions)
+
+// WithCertMetadataAnnotations makes the issuance write the notAfter, serial and SANs of the issued certificate
+// as annotations onto the managed secret. The annotations are refreshed on every rotation.
+func WithCertMetadataAnnotations() CertOption {
+	return func(o *certOptions) {
+		o.writeCertMetadataAnnotations = true
+	}
+}
+
+// WithKeyAlgorithm sets the algorithm of the private keys generated for the issued certificates. Defaults to RSA.
+func WithKeyAlgorithm(keyAlgorithm KeyAlgorithm) CertOption {
+	return func(o *certOptions) {
+		o.keyAlgorithm = keyAlgorithm
+	}
+}
+
+// WithRSAKeySize sets the modulus size in bits of the RSA keys generated for the issued certificates, e.g. 3072 or
+// 4096 where a security policy mandates it. Defaults to DefaultRSAKeySize, smaller sizes are rejected at issuance.
+// Larger keys make every TLS handshake with etcd noticeably more expensive, on the server side mostly, so only raise
+// the size when required. Secrets record the size of their key and are re-issued on the next sync when it changes.
+// The size only applies to the leaf certs, the signers are rotated by library-go which always uses DefaultRSAKeySize.
+func WithRSAKeySize(bits int) CertOption {
+	return func(o *certOptions) {
+		o.rsaKeySize = bits
+	}
+}
+
+// WithClusterID adds the given cluster ID as organizational unit to the subject of all issued certificates,
+// so that certificates can be correlated across a fleet of clusters.
+func WithClusterID(clusterID string) CertOption {
+	return func(o *certOptions) {
+		o.clusterID = clusterID
+	}
+}
+
+// WithCodeSigningUsage adds the code signing extended key usage to the peer, serving and metrics certs, which some
+// strict FIPS profiles expect, see https://github.com/etcd-io/etcd/issues/9398#issuecomment-435340312.
+// It is off by default to keep the issued certs unchanged.
+func WithCodeSigningUsage() CertOption {
+	return func(o *certOptions) {
+		o.codeSigningUsage = true
+	}
+}
+
+// WithMetricsServerAuthOnly issues the serving metrics certs with only the server auth extended key usage instead of
+// both client and server auth, as etcd only serves on its metrics listener and scanners flag the client auth usage as
+// over-broad. The code signing usage of WithCodeSigningUsage is kept. The peer and serving certs are unchanged, as etcd
+// uses them for both sides of its connections.
+// It is off by default to keep the issued certs unchanged, existing certs only switch on their next rotation.
+func WithMetricsServerAuthOnly() CertOption {
+	return func(o *certOptions) {
+		o.metricsServerAuthOnly = true
+	}
+}
+
+// WithRSAPSSSignature signs the peer, serving and metrics certs with SHA256-RSA-PSS instead of SHA256-RSA with
+// PKCS#1 v1.5 padding, which some hardened TLS policy scanners flag. It requires an RSA signer, which the signers
+// rotated by library-go are, and is independent of the algorithm of the leaf keys. etcd and its clients negotiate
+// such certs with TLS 1.2 and 1.3 just fine, as the Go TLS stack verifies PSS signatures on certificates.
+// It is off by default to keep the issued certs unchanged, existing certs only switch on their next rotation.
+func WithRSAPSSSignature() CertOption {
+	return func(o *certOptions) {
+		o.rsaPSSSignature = true
+	}
+}
+
+// WithExternalIPFallback issues the peer, serving and metrics certs of a node that only reports ExternalIP addresses,
+// as some bare-metal provisioners do, on those addresses. Without it, creating the certs of such a node fails with a
+// *dnshelpers.NodeOnlyExternalIPError. Nodes with an InternalIP are not affected.
+// Only opt in if the ExternalIPs are the addresses etcd members really use to talk to each other: the certs are then
+// valid for addresses that are commonly reachable from outside the cluster and that the provider may hand to another
+// machine later, see dnshelpers.GetIPAddressesForNodeNameWithExternalFallback.
+func WithExternalIPFallback() CertOption {
+	return func(o *certOptions) {
+		o.externalIPFallback = true
+	}
+}
+
+// WithExtraSANs appends the given DNS names or IPs, e.g. of a custom load balancer, to the SANs of the peer, serving
+// and metrics certs. SANs already part of the built-in set are skipped. Use ParseExtraSANs to validate them.
+func WithExtraSANs(sans []string) CertOption {
+	return func(o *certOptions) {
+		o.extraSANs = sans
+	}
+}
+
+// WithExtraServiceNames appends the kubernetes service DNS names of the given services to the SANs of the peer, serving
+// and metrics certs, e.g. of a read replica service or of the etcd service in a namespace being migrated to. Services are
+// given by their base name <service>.<namespace> and expanded into their .svc and .svc.cluster.local forms. Names that
+// already are part of the SANs, like the built-in etcd services, are skipped.
+func WithExtraServiceNames(baseNames []string) CertOption {
+	return func(o *certOptions) {
+		o.extraServiceNames = baseNames
+	}
+}
+
+// WithBootstrapAliases appends the given DNS names or IPs, e.g. etcd-bootstrap or the IP of the bootstrap node, to the
+// SANs of the serving certs as long as bootstrapComplete is false. Once bootstrapping is complete the aliases are
+// dropped, so the serving certs are re-issued without them on the next sync and steady-state certs never carry them.
+// Aliases that already are part of the SANs, like localhost or the node IPs, are skipped, as are blank ones.
+func WithBootstrapAliases(aliases []string, bootstrapComplete bool) CertOption {
+	return func(o *certOptions) {
+		o.bootstrapAliases = nil
+		if bootstrapComplete {
+			return
+		}
+		var trimmed []string
+		for _, alias := range aliases {
+			if alias = strings.TrimSpace(alias); len(alias) > 0 {
+				trimmed = append(trimmed, alias)
+			}
+		}
+		o.bootstrapAliases = normalizeIPs(trimmed)
+	}
+}
+
+// WithExtraOrganizations appends the given organizations to the subject of the peer, server and metric certs, both the
+// ones issued by CreatePeerCertKeyWithContext, CreateServerCertKeyWithContext and CreateMetricCertKeyWithContext and
+// the ones rotated by the operator, e.g. to attach custom RBAC to the etcd identities.
+// The system:etcd-* organization is always kept and the CN keeps being derived from it.
+func WithExtraOrganizations(orgs []string) CertOption {
+	return func(o *certOptions) {
+		o.extraOrganizations = orgs
+	}
+}
+
+// WithJiraComponent sets the component annotation of the managed secrets and configmaps, so that distributions
+// rebranding the operator can route them to their own support tooling. Defaults to EtcdJiraComponentName. The same
+// component must be passed to VerifyManagedSecretOwnership and the JiraComponent of the resource sync controller, which
+// identify the objects owned by the operator by it.
+func WithJiraComponent(component string) CertOption {
+	return func(o *certOptions) {
+		o.jiraComponent = component
+	}
+}
+
+// WithDescriptionFunc rewrites the description annotation of the managed secrets and configmaps. The function is given
+// the default description, e.g. "etcd client certificate", and returns the one to write.
+func WithDescriptionFunc(fn func(defaultDescription string) string) CertOption {
+	return func(o *certOptions) {
+		o.descriptionFn = fn
+	}
+}
+
+// WithValidity overrides the validity of the peer, serving, metrics and client certs. They are refreshed after the same
+// fraction of their validity as with the default validity of 3 years, e.g. after 10 of 12 months. A cert is never
+// valid past its signer: certs rotated by the operator and the ones issued from a static CA, e.g. by
+// CreatePeerCertKeyWithContext, are both capped at the remaining validity of the signer. Non-positive values are ignored.
+// WithClientCertValidity takes precedence for the client certs.
+func WithValidity(validity time.Duration) CertOption {
+	return func(o *certOptions) {
+		o.validity = validity
+	}
+}
+
+// WithClientCertValidity overrides the validity of the etcd and etcd metrics client certs independently of the one of
+// the peer, serving and metrics certs, e.g. to issue the client certs, which are easy to reissue but valuable when
+// leaked, for a shorter time. They are refreshed after the same fraction of their validity as the other leaf certs.
+// Defaults to the validity of WithValidity. Non-positive values are ignored.
+func WithClientCertValidity(validity time.Duration) CertOption {
+	return func(o *certOptions) {
+		o.clientValidity = validity
+	}
+}
+
+// WithSignerValidity overrides the validity of the etcd and etcd metrics signers. They are refreshed after the same
+// fraction of their validity as with the default validity of 5 years, e.g. after 9 of 10 months. Non-positive values
+// are ignored.
+func WithSignerValidity(validity time.Duration) CertOption {
+	return func(o *certOptions) {
+		o.caValidity = validity
+	}
+}
+
+// WithIntermediateCAs appends the given PEM encoded intermediate CAs to the chain of the peer, server and metric certs
+// issued by CreatePeerCertKeyWithContext, CreateServerCertKeyWithContext and CreateMetricCertKeyWithContext, e.g. when
+// the etcd signer is issued by an intermediate of a corporate root and remote verifiers only trust the root. The signer itself already is part of
+// every issued chain, as are the further certs in the signer PEM, those are not appended twice. The private key of the
+// issued cert is not affected. Certs that are not CAs are rejected at issuance.
+func WithIntermediateCAs(intermediateCAsPEM []byte) CertOption {
+	return func(o *certOptions) {
+		o.intermediateCAsPEM = intermediateCAsPEM
+	}
+}
+
+// WithClientCertExtraUsages appends the given extended key usages to the client auth usage of the etcd client cert
+// issued by CreateEtcdClientCert, e.g. for an external proxy in front of etcd that inspects them. Client auth is always
+// kept, while the any usage, which lifts the restriction to client auth, and unknown usages are rejected at issuance.
+// Without extra usages the cert is issued unchanged.
+func WithClientCertExtraUsages(usages []x509.ExtKeyUsage) CertOption {
+	return func(o *certOptions) {
+		o.clientCertExtraUsages = usages
+	}
+}
+
+// WithMinTrustedCAs sets the minimum number of CAs the etcd and etcd metrics CA bundles must trust after an update, see
+// MinTrustedCABundleConfigMap, e.g. 2 to make sure the old and the new signer are both trusted during a rotation.
+// Non-positive values are ignored.
+func WithMinTrustedCAs(minTrustedCAs int) CertOption {
+	return func(o *certOptions) {
+		o.minTrustedCAs = minTrustedCAs
+	}
+}
+
+func newCertOptions(opts ...CertOption) *certOptions {
+	o := &certOptions{}
+	for _, opt := range opts {
+		opt(o)
+	}
+	return o
+}
+
+// wrapCertCreator decorates the given creator according to the options. The SecretDataHashAnnotation is always recorded.
+func (o *certOptions) wrapCertCreator(creator certrotation.TargetCertCreator) certrotation.TargetCertCreator {
+	if o.writeCertMetadataAnnotations {
+		creator = &certMetadataCreator{TargetCertCreator: creator}
+	}
+	return &secretDataHashCreator{TargetCertCreator: creator}
+}
+
+// certValidity returns the validity of the leaf certs.
+func (o *certOptions) certValidity() time.Duration {
+	if o.validity > 0 {
+		return o.validity
+	}
+	return etcdCertValidity
+}
+
+// certRefresh returns the refresh of the leaf certs, derived from their validity.
+func (o *certOptions) certRefresh() time.Duration {
+	return refreshAfter(o.certValidity(), etcdCertRefreshFraction)
+}
+
+// clientCertValidity returns the validity of the client certs.
+func (o *certOptions) clientCertValidity() time.Duration {
+	if o.clientValidity > 0 {
+		return o.clientValidity
+	}
+	return o.certValidity()
+}
+
+// clientCertRefresh returns the refresh of the client certs, derived from their validity.
+func (o *certOptions) clientCertRefresh() time.Duration {
+	return refreshAfter(o.clientCertValidity(), etcdCertRefreshFraction)
+}
+
+// signerValidity returns the validity of the signers.
+func (o *certOptions) signerValidity() time.Duration {
+	if o.caValidity > 0 {
+		return o.caValidity
+	}
+	return etcdCaCertValidity
+}
+
+// signerRefresh returns the refresh of the signers, derived from their validity.
+func (o *certOptions) signerRefresh() time.Duration {
+	return refreshAfter(o.signerValidity(), etcdCaCertRefreshFraction)
+}
+
+// minTrustedCABundleCAs returns the minimum number of CAs the managed CA bundles must trust.
+func (o *certOptions) minTrustedCABundleCAs() int {
+	if o.minTrustedCAs > 0 {
+		return o.minTrustedCAs
+	}
+	return DefaultMinTrustedCAs
+}
+
+// jiraComponentName returns the component annotation of the managed secrets and configmaps.
+func (o *certOptions) jiraComponentName() string {
+	if len(o.jiraComponent) > 0 {
+		return o.jiraComponent
+	}
+	return EtcdJiraComponentName
+}
+
+// description returns the description annotation to write instead of the given default one.
+func (o *certOptions) description(defaultDescription string) string {
+	if o.descriptionFn != nil {
+		return o.descriptionFn(defaultDescription)
+	}
+	return defaultDescription
+}
+
+// extensionFns returns the functions to apply to the template of every issued certificate according to the options.
+func (o *certOptions) extensionFns() []crypto.CertificateExtensionFunc {
+	var fns []crypto.CertificateExtensionFunc
+	if len(o.clusterID) > 0 {
+		fns = append(fns, withClusterIDSubject(o.clusterID))
+	}
+	return fns
+}
+
+// serverHostNames returns the SANs of the serving certs of a node with the given IPs, followed by the DNS names of the
+// extra services and the bootstrap aliases.
+func (o *certOptions) serverHostNames(nodeInternalIPs []string) []string {
+	hostNames := appendExtraSANs(getServerHostNames(nodeInternalIPs), serviceHostNames(o.extraServiceNames))
+	return appendExtraSANs(hostNames, o.bootstrapAliases)
+}
+
+// nodeCertExtKeyUsages returns the extended key usages of the peer, serving and metrics certs.
+func (o *certOptions) nodeCertExtKeyUsages() []x509.ExtKeyUsage {
+	usages := []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth, x509.ExtKeyUsageServerAuth}
+	if o.serverAuthOnly {
+		usages = []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth}
+	}
+	if o.codeSigningUsage {
+		usages = append(usages, x509.ExtKeyUsageCodeSigning)
+	}
+	return usages
+}
+
+// metricsServingCertOptions returns the options the serving metrics certs are issued with, which apply the options
+// specific to them on top of the given ones.
+func (o *certOptions) metricsServingCertOptions() *certOptions {
+	metricsOpts := *o
+	metricsOpts.serverAuthOnly = o.metricsServerAuthOnly
+	return &metricsOpts
+}
+
+// withMetricsServingCert is the CertOption of metricsServingCertOptions, it must be applied after all others.
+func withMetricsServingCert(opts []CertOption) []CertOption {
+	return append(append([]CertOption{}, opts...), func(o *certOptions) {
+		*o = *o.metricsServingCertOptions()
+	})
+}
+
+func withClusterIDSubject(clusterID string) crypto.CertificateExtensionFunc {
+	return func(cert *x509.Certificate) error {
+		cert.Subject.OrganizationalUnit = []string{clusterID}
+		return nil
+	}
+}
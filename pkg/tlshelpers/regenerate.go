@@ -0,0 +1,56 @@
+package tlshelpers
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/openshift/library-go/pkg/operator/certrotation"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	corev1client "k8s.io/client-go/kubernetes/typed/core/v1"
+	"k8s.io/klog/v2"
+
+	"github.com/openshift/cluster-etcd-operator/pkg/operator/operatorclient"
+)
+
+// ForceRegenerateServingCert marks the etcd-serving-<node> secret of the given node for regeneration by removing its
+// notAfter annotation, which makes the certrotation machinery reissue the cert on the next sync regardless of its
+// refresh window. The cert stays in place until then, and neither the signer nor the CA bundle are touched. The
+// DeletionProtectionFinalizer is removed for the rotation, see SetDeletionProtectionForManagedSecrets. Calling it again
+// before the next sync or for a node without serving secret is a no-op.
+func ForceRegenerateServingCert(ctx context.Context, node *corev1.Node, secretGetter corev1client.SecretsGetter) error {
+	return markForRegeneration(ctx, secretGetter, GetServingSecretNameForNode(node.Name))
+}
+
+// ForceRotateMetricsSigner marks the etcd-metric-signer secret for regeneration the same way, e.g. when only the
+// metrics PKI is compromised. On the next sync a new metrics signer is generated and added to etcd-metrics-ca-bundle,
+// which the resource sync propagates, and the metrics serving and client certs are reissued off it. The etcd-signer,
+// its CA bundle and the peer and serving certs issued off it are not touched. Calling it again before the next sync or
+// without metrics signer is a no-op.
+func ForceRotateMetricsSigner(ctx context.Context, secretGetter corev1client.SecretsGetter) error {
+	return markForRegeneration(ctx, secretGetter, EtcdMetricsSignerCertSecretName)
+}
+
+func markForRegeneration(ctx context.Context, secretGetter corev1client.SecretsGetter, secretName string) error {
+	secret, err := secretGetter.Secrets(operatorclient.TargetNamespace).Get(ctx, secretName, metav1.GetOptions{})
+	if err != nil {
+		if apierrors.IsNotFound(err) {
+			return nil
+		}
+		return fmt.Errorf("error getting %s/%s: %w", operatorclient.TargetNamespace, secretName, err)
+	}
+	if _, ok := secret.Annotations[certrotation.CertificateNotAfterAnnotation]; !ok && !hasDeletionProtection(secret) {
+		return nil
+	}
+
+	// an intentional rotation must not be blocked by the deletion protection
+	secret = secret.DeepCopy()
+	delete(secret.Annotations, certrotation.CertificateNotAfterAnnotation)
+	secret.Finalizers = withDeletionProtection(secret.Finalizers, false)
+	if _, err := secretGetter.Secrets(operatorclient.TargetNamespace).Update(ctx, secret, metav1.UpdateOptions{}); err != nil {
+		return fmt.Errorf("error marking %s/%s for regeneration: %w", operatorclient.TargetNamespace, secretName, err)
+	}
+	klog.Infof("marked %s/%s for regeneration", operatorclient.TargetNamespace, secretName)
+	return nil
+}
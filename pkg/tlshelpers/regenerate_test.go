@@ -0,0 +1,116 @@
+package tlshelpers
+
+import (
+	"context"
+	"testing"
+
+	"github.com/openshift/library-go/pkg/operator/certrotation"
+	"github.com/openshift/library-go/pkg/operator/events"
+	"github.com/stretchr/testify/require"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+	corev1listers "k8s.io/client-go/listers/core/v1"
+	"k8s.io/client-go/tools/cache"
+
+	"github.com/openshift/cluster-etcd-operator/pkg/operator/operatorclient"
+	u "github.com/openshift/cluster-etcd-operator/pkg/testutils"
+)
+
+func TestForceRegenerateServingCert(t *testing.T) {
+	node := u.FakeNode("master-0", u.WithMasterLabel(), u.WithNodeInternalIP("10.0.0.1"))
+	signer := newTestSigner(t, "etcd-signer")
+	fakeKubeClient := fake.NewSimpleClientset()
+	secretLister := corev1listers.NewSecretLister(cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{}))
+
+	// absent secret
+	require.NoError(t, ForceRegenerateServingCert(context.TODO(), node, fakeKubeClient.CoreV1()))
+
+	servingCert, err := CreateServingCertificate(node, nil, secretLister, fakeKubeClient.CoreV1(), events.NewInMemoryRecorder(t.Name()))
+	require.NoError(t, err)
+	original, err := servingCert.EnsureTargetCertKeyPair(context.TODO(), signer, signer.Config.Certs)
+	require.NoError(t, err)
+	require.NoError(t, SetDeletionProtection(context.TODO(), fakeKubeClient.CoreV1(), original.Name, true))
+
+	fakeKubeClient.ClearActions()
+	require.NoError(t, ForceRegenerateServingCert(context.TODO(), node, fakeKubeClient.CoreV1()))
+	require.NoError(t, ForceRegenerateServingCert(context.TODO(), node, fakeKubeClient.CoreV1()))
+
+	// a single update of the serving secret, nothing else is touched
+	var writes []string
+	for _, action := range fakeKubeClient.Actions() {
+		if action.GetVerb() != "get" {
+			writes = append(writes, action.GetVerb()+" "+action.GetResource().Resource)
+		}
+	}
+	require.Equal(t, []string{"update secrets"}, writes)
+	marked, err := fakeKubeClient.CoreV1().Secrets(operatorclient.TargetNamespace).Get(context.TODO(), "etcd-serving-master-0", metav1.GetOptions{})
+	require.NoError(t, err)
+	require.NotContains(t, marked.Annotations, certrotation.CertificateNotAfterAnnotation)
+	require.Empty(t, marked.Finalizers)
+	require.Equal(t, original.Data, marked.Data)
+
+	regenerated, err := servingCert.EnsureTargetCertKeyPair(context.TODO(), signer, signer.Config.Certs)
+	require.NoError(t, err)
+	require.Contains(t, regenerated.Annotations, certrotation.CertificateNotAfterAnnotation)
+	require.NotEqual(t, parseSecretCert(t, original).SerialNumber, parseSecretCert(t, regenerated).SerialNumber)
+}
+
+func TestForceRotateMetricsSigner(t *testing.T) {
+	fakeKubeClient := fake.NewSimpleClientset()
+	indexer := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{})
+	secretLister := corev1listers.NewSecretLister(indexer)
+	// the signers read their secret from the lister
+	syncLister := func() {
+		secrets, err := fakeKubeClient.CoreV1().Secrets(operatorclient.TargetNamespace).List(context.TODO(), metav1.ListOptions{})
+		require.NoError(t, err)
+		for i := range secrets.Items {
+			require.NoError(t, indexer.Update(&secrets.Items[i]))
+		}
+	}
+	recorder := events.NewInMemoryRecorder(t.Name())
+	signerCert := CreateSignerCert(nil, secretLister, fakeKubeClient.CoreV1(), recorder)
+	metricsSignerCert := CreateMetricsSignerCert(nil, secretLister, fakeKubeClient.CoreV1(), recorder)
+
+	// absent secret
+	require.NoError(t, ForceRotateMetricsSigner(context.TODO(), fakeKubeClient.CoreV1()))
+
+	signer, err := signerCert.EnsureSigningCertKeyPair(context.TODO())
+	require.NoError(t, err)
+	metricsSigner, err := metricsSignerCert.EnsureSigningCertKeyPair(context.TODO())
+	require.NoError(t, err)
+	syncLister()
+	original, err := fakeKubeClient.CoreV1().Secrets(operatorclient.TargetNamespace).Get(context.TODO(), EtcdSignerCertSecretName, metav1.GetOptions{})
+	require.NoError(t, err)
+	require.NoError(t, SetDeletionProtection(context.TODO(), fakeKubeClient.CoreV1(), EtcdMetricsSignerCertSecretName, true))
+
+	fakeKubeClient.ClearActions()
+	require.NoError(t, ForceRotateMetricsSigner(context.TODO(), fakeKubeClient.CoreV1()))
+	require.NoError(t, ForceRotateMetricsSigner(context.TODO(), fakeKubeClient.CoreV1()))
+
+	// a single update of the metrics signer, nothing else is touched
+	var writes []string
+	for _, action := range fakeKubeClient.Actions() {
+		if action.GetVerb() != "get" {
+			writes = append(writes, action.GetVerb()+" "+action.GetResource().Resource)
+		}
+	}
+	require.Equal(t, []string{"update secrets"}, writes)
+	marked, err := fakeKubeClient.CoreV1().Secrets(operatorclient.TargetNamespace).Get(context.TODO(), EtcdMetricsSignerCertSecretName, metav1.GetOptions{})
+	require.NoError(t, err)
+	require.NotContains(t, marked.Annotations, certrotation.CertificateNotAfterAnnotation)
+	require.Empty(t, marked.Finalizers)
+
+	// on the next sync only the metrics signer is rotated
+	syncLister()
+	rotatedSigner, err := signerCert.EnsureSigningCertKeyPair(context.TODO())
+	require.NoError(t, err)
+	rotatedMetricsSigner, err := metricsSignerCert.EnsureSigningCertKeyPair(context.TODO())
+	require.NoError(t, err)
+	require.Equal(t, signer.Config.Certs[0].Raw, rotatedSigner.Config.Certs[0].Raw)
+	require.NotEqual(t, metricsSigner.Config.Certs[0].SerialNumber, rotatedMetricsSigner.Config.Certs[0].SerialNumber)
+
+	unchanged, err := fakeKubeClient.CoreV1().Secrets(operatorclient.TargetNamespace).Get(context.TODO(), EtcdSignerCertSecretName, metav1.GetOptions{})
+	require.NoError(t, err)
+	require.Equal(t, original.Data, unchanged.Data)
+	require.Equal(t, original.Annotations, unchanged.Annotations)
+}
@@ -0,0 +1,203 @@
+package tlshelpers
+
+import (
+	"context"
+	"crypto/x509"
+	"fmt"
+	"strings"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	utilerrors "k8s.io/apimachinery/pkg/util/errors"
+	corev1client "k8s.io/client-go/kubernetes/typed/core/v1"
+	"k8s.io/client-go/util/cert"
+
+	"github.com/openshift/library-go/pkg/crypto"
+
+	"github.com/openshift/cluster-etcd-operator/pkg/operator/operatorclient"
+)
+
+// RotationProgress counts how many of the live leaf certs for the given nodes are already signed by the newest CA of
+// the CA bundle they are trusted with, next to the total number of live leaf certs. Once migrated equals total, the
+// rotation is complete and the previous CA can be pruned from the bundles. Leaf secrets that do not exist are not
+// counted.
+func RotationProgress(ctx context.Context, secretClient corev1client.SecretsGetter, cmClient corev1client.ConfigMapsGetter, nodeNames []string) (migrated, total int, err error) {
+	leavesByBundle := leafSecretNamesByBundle(nodeNames)
+	for _, bundleName := range []string{EtcdSignerCaBundleConfigMapName, EtcdMetricsSignerCaBundleConfigMapName} {
+		newestCA, err := newestCAInBundle(ctx, cmClient, bundleName)
+		if err != nil {
+			return 0, 0, err
+		}
+
+		for _, secretName := range leavesByBundle[bundleName] {
+			secret, err := secretClient.Secrets(operatorclient.TargetNamespace).Get(ctx, secretName, metav1.GetOptions{})
+			if err != nil {
+				if apierrors.IsNotFound(err) {
+					continue
+				}
+				return 0, 0, fmt.Errorf("error getting %s/%s: %w", operatorclient.TargetNamespace, secretName, err)
+			}
+			leaf, err := certFromSecret(secret)
+			if err != nil {
+				return 0, 0, err
+			}
+
+			total++
+			if leaf.CheckSignatureFrom(newestCA) == nil {
+				migrated++
+			}
+		}
+	}
+	return migrated, total, nil
+}
+
+// EnsureBundleBeforeLeaves returns an error unless every signer leaf certs are issued off, both the one in
+// openshift-config and the rotated one in the target namespace, is already part of the CA bundle the leaves are trusted
+// with. Leaves issued off a CA that is not yet in the bundle are untrusted until the bundle catches up, so their
+// re-issuance must not proceed while this returns an error. The error names the leaf secrets of the given nodes that
+// are blocked. Controllers that have just ensured the bundles should check them with RequireSignersInBundles instead of
+// reading them back.
+func EnsureBundleBeforeLeaves(ctx context.Context, secretClient corev1client.SecretsGetter, cmClient corev1client.ConfigMapsGetter, nodeNames []string) error {
+	leavesByBundle := leafSecretNamesByBundle(nodeNames)
+	signerByBundle := map[string]string{
+		EtcdSignerCaBundleConfigMapName:        EtcdSignerCertSecretName,
+		EtcdMetricsSignerCaBundleConfigMapName: EtcdMetricsSignerCertSecretName,
+	}
+
+	var errs []error
+	for _, bundleName := range []string{EtcdSignerCaBundleConfigMapName, EtcdMetricsSignerCaBundleConfigMapName} {
+		cas, err := caBundleCerts(ctx, cmClient, bundleName)
+		if err != nil {
+			return err
+		}
+
+		for _, namespace := range []string{operatorclient.GlobalUserSpecifiedConfigNamespace, operatorclient.TargetNamespace} {
+			secretName := signerByBundle[bundleName]
+			secret, err := secretClient.Secrets(namespace).Get(ctx, secretName, metav1.GetOptions{})
+			if err != nil {
+				// the rotated signer in the target namespace does not exist before the first rotation
+				if apierrors.IsNotFound(err) && namespace == operatorclient.TargetNamespace {
+					continue
+				}
+				return fmt.Errorf("error getting %s/%s: %w", namespace, secretName, err)
+			}
+			signer, err := certFromSecret(secret)
+			if err != nil {
+				return err
+			}
+			if !containsCert(cas, signer) {
+				errs = append(errs, fmt.Errorf("refusing to re-issue %s: signer %s/%s is not yet in the CA bundle %s/%s",
+					strings.Join(leavesByBundle[bundleName], ", "), namespace, secretName, operatorclient.TargetNamespace, bundleName))
+			}
+		}
+	}
+	return utilerrors.NewAggregate(errs)
+}
+
+// BundleSigners is a CA bundle together with the signers the leaves trusted with it are issued off.
+type BundleSigners struct {
+	// BundleName is the name of the CA bundle configmap in the target namespace
+	BundleName string
+	Bundle     []*x509.Certificate
+	Signers    []*crypto.CA
+}
+
+// RequireSignersInBundles is EnsureBundleBeforeLeaves against the bundles and signers at hand, e.g. the ones a
+// controller has just ensured, so that no API reads are needed. The error names the leaf secrets of the given nodes
+// that are blocked.
+func RequireSignersInBundles(nodeNames []string, bundles ...BundleSigners) error {
+	leavesByBundle := leafSecretNamesByBundle(nodeNames)
+	var errs []error
+	for _, bundle := range bundles {
+		for _, signer := range bundle.Signers {
+			if signer == nil {
+				continue
+			}
+			signerCert := signer.Config.Certs[0]
+			if !containsCert(bundle.Bundle, signerCert) {
+				errs = append(errs, fmt.Errorf("refusing to re-issue %s: signer %q is not yet in the CA bundle %s/%s",
+					strings.Join(leavesByBundle[bundle.BundleName], ", "), signerCert.Subject.CommonName, operatorclient.TargetNamespace, bundle.BundleName))
+			}
+		}
+	}
+	return utilerrors.NewAggregate(errs)
+}
+
+// SignerRotationInProgress returns whether the tls.crt of the given signer secret holds more than one distinct CA
+// that has not expired yet, i.e. the previous and the new signer during a rotation window. Controllers can hold off
+// operations that are risky mid-rotation, e.g. pruning the CA bundles or removing nodes, until a single CA is left.
+func SignerRotationInProgress(secret *corev1.Secret) (bool, error) {
+	signerPEM := secret.Data[corev1.TLSCertKey]
+	if len(signerPEM) == 0 {
+		return false, fmt.Errorf("secret %s/%s is missing %s", secret.Namespace, secret.Name, corev1.TLSCertKey)
+	}
+	certs, err := cert.ParseCertsPEM(signerPEM)
+	if err != nil {
+		return false, fmt.Errorf("could not parse %s of secret %s/%s: %w", corev1.TLSCertKey, secret.Namespace, secret.Name, err)
+	}
+
+	now := time.Now()
+	var validCAs []*x509.Certificate
+	for _, c := range certs {
+		if c.IsCA && now.Before(c.NotAfter) && !containsCert(validCAs, c) {
+			validCAs = append(validCAs, c)
+		}
+	}
+	return len(validCAs) > 1, nil
+}
+
+// leafSecretNamesByBundle returns the names of the leaf cert secrets of the given nodes by the name of the CA bundle
+// they are trusted with.
+func leafSecretNamesByBundle(nodeNames []string) map[string][]string {
+	leavesByBundle := map[string][]string{
+		EtcdSignerCaBundleConfigMapName:        {EtcdClientCertSecretName},
+		EtcdMetricsSignerCaBundleConfigMapName: {EtcdMetricsClientCertSecretName},
+	}
+	for _, nodeName := range nodeNames {
+		leavesByBundle[EtcdSignerCaBundleConfigMapName] = append(leavesByBundle[EtcdSignerCaBundleConfigMapName],
+			GetPeerClientSecretNameForNode(nodeName), GetServingSecretNameForNode(nodeName))
+		leavesByBundle[EtcdMetricsSignerCaBundleConfigMapName] = append(leavesByBundle[EtcdMetricsSignerCaBundleConfigMapName],
+			GetServingMetricsSecretNameForNode(nodeName))
+	}
+	return leavesByBundle
+}
+
+func containsCert(certs []*x509.Certificate, cert *x509.Certificate) bool {
+	for _, c := range certs {
+		if c.Equal(cert) {
+			return true
+		}
+	}
+	return false
+}
+
+// caBundleCerts returns the CAs of the given CA bundle configmap in the target namespace.
+func caBundleCerts(ctx context.Context, cmClient corev1client.ConfigMapsGetter, bundleName string) ([]*x509.Certificate, error) {
+	bundle, err := cmClient.ConfigMaps(operatorclient.TargetNamespace).Get(ctx, bundleName, metav1.GetOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("error getting %s/%s: %w", operatorclient.TargetNamespace, bundleName, err)
+	}
+	cas, err := cert.ParseCertsPEM([]byte(bundle.Data[caBundleKey]))
+	if err != nil {
+		return nil, fmt.Errorf("could not parse %s/%s: %w", bundle.Namespace, bundle.Name, err)
+	}
+	return cas, nil
+}
+
+// newestCAInBundle returns the most recently issued CA of the given CA bundle configmap in the target namespace.
+func newestCAInBundle(ctx context.Context, cmClient corev1client.ConfigMapsGetter, bundleName string) (*x509.Certificate, error) {
+	cas, err := caBundleCerts(ctx, cmClient, bundleName)
+	if err != nil {
+		return nil, err
+	}
+
+	newest := cas[0]
+	for _, ca := range cas[1:] {
+		if ca.NotBefore.After(newest.NotBefore) {
+			newest = ca
+		}
+	}
+	return newest, nil
+}
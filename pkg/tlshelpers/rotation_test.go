@@ -0,0 +1,337 @@
+package tlshelpers
+
+import (
+	"context"
+	"crypto/x509"
+	"testing"
+	"time"
+
+	"github.com/openshift/library-go/pkg/crypto"
+	"github.com/openshift/library-go/pkg/operator/certrotation"
+	"github.com/openshift/library-go/pkg/operator/events"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+	corev1listers "k8s.io/client-go/listers/core/v1"
+	"k8s.io/client-go/tools/cache"
+
+	"github.com/openshift/cluster-etcd-operator/pkg/operator/operatorclient"
+	u "github.com/openshift/cluster-etcd-operator/pkg/testutils"
+)
+
+func TestRotationProgress(t *testing.T) {
+	oldCAConfig, err := crypto.UnsafeMakeSelfSignedCAConfigForDurationAtTime("etcd-signer-old", func() time.Time { return time.Now().Add(-time.Hour) }, 24*time.Hour)
+	require.NoError(t, err)
+	oldSigner := &crypto.CA{Config: oldCAConfig, SerialGenerator: &crypto.RandomSerialGenerator{}}
+	newSigner := newTestSigner(t, "etcd-signer-new")
+
+	caBytes, err := crypto.EncodeCertificates(oldSigner.Config.Certs[0], newSigner.Config.Certs[0])
+	require.NoError(t, err)
+	bundles := []runtime.Object{
+		&corev1.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{Namespace: operatorclient.TargetNamespace, Name: EtcdSignerCaBundleConfigMapName},
+			Data:       map[string]string{"ca-bundle.crt": string(caBytes)},
+		},
+		&corev1.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{Namespace: operatorclient.TargetNamespace, Name: EtcdMetricsSignerCaBundleConfigMapName},
+			Data:       map[string]string{"ca-bundle.crt": string(caBytes)},
+		},
+	}
+
+	leaves := func(signerFor func(name string) *crypto.CA) []runtime.Object {
+		var objects []runtime.Object
+		for _, name := range []string{
+			EtcdClientCertSecretName,
+			EtcdMetricsClientCertSecretName,
+			GetPeerClientSecretNameForNode("master-0"),
+			GetServingSecretNameForNode("master-0"),
+			GetServingMetricsSecretNameForNode("master-0"),
+		} {
+			if signer := signerFor(name); signer != nil {
+				objects = append(objects, newTestCertSecret(t, signer, name, []string{"10.0.0.1"}))
+			}
+		}
+		return objects
+	}
+
+	tests := map[string]struct {
+		objects          []runtime.Object
+		expectedMigrated int
+		expectedTotal    int
+		expectedErr      bool
+	}{
+		"no leaf migrated": {
+			objects:          append(leaves(func(string) *crypto.CA { return oldSigner }), bundles...),
+			expectedMigrated: 0,
+			expectedTotal:    5,
+		},
+		"partially migrated": {
+			objects: append(leaves(func(name string) *crypto.CA {
+				if name == GetPeerClientSecretNameForNode("master-0") || name == EtcdMetricsClientCertSecretName {
+					return newSigner
+				}
+				return oldSigner
+			}), bundles...),
+			expectedMigrated: 2,
+			expectedTotal:    5,
+		},
+		"fully migrated": {
+			objects:          append(leaves(func(string) *crypto.CA { return newSigner }), bundles...),
+			expectedMigrated: 5,
+			expectedTotal:    5,
+		},
+		"missing leaves are not counted": {
+			objects: append(leaves(func(name string) *crypto.CA {
+				if name == GetServingMetricsSecretNameForNode("master-0") {
+					return nil
+				}
+				return newSigner
+			}), bundles...),
+			expectedMigrated: 4,
+			expectedTotal:    4,
+		},
+		"missing bundle": {
+			objects:     leaves(func(string) *crypto.CA { return newSigner }),
+			expectedErr: true,
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			fakeKubeClient := fake.NewSimpleClientset(test.objects...)
+			migrated, total, err := RotationProgress(context.TODO(), fakeKubeClient.CoreV1(), fakeKubeClient.CoreV1(), []string{"master-0"})
+			if test.expectedErr {
+				require.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, test.expectedMigrated, migrated)
+			require.Equal(t, test.expectedTotal, total)
+		})
+	}
+}
+
+func TestEnsureBundleBeforeLeaves(t *testing.T) {
+	oldSigner := newTestSigner(t, "etcd-signer-old")
+	newSigner := newTestSigner(t, "etcd-signer-new")
+	metricsSigner := newTestSigner(t, "etcd-metric-signer")
+
+	bundle := func(name string, signers ...*crypto.CA) *corev1.ConfigMap {
+		var certs []*x509.Certificate
+		for _, signer := range signers {
+			certs = append(certs, signer.Config.Certs[0])
+		}
+		caBytes, err := crypto.EncodeCertificates(certs...)
+		require.NoError(t, err)
+		return &corev1.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{Namespace: operatorclient.TargetNamespace, Name: name},
+			Data:       map[string]string{"ca-bundle.crt": string(caBytes)},
+		}
+	}
+	signers := []runtime.Object{
+		newTestCASecret(t, oldSigner, operatorclient.GlobalUserSpecifiedConfigNamespace, EtcdSignerCertSecretName),
+		newTestCASecret(t, metricsSigner, operatorclient.GlobalUserSpecifiedConfigNamespace, EtcdMetricsSignerCertSecretName),
+	}
+	rotatedSigner := newTestCASecret(t, newSigner, operatorclient.TargetNamespace, EtcdSignerCertSecretName)
+
+	tests := map[string]struct {
+		objects     []runtime.Object
+		expectedErr string
+	}{
+		"signers in their bundles": {
+			objects: append([]runtime.Object{
+				bundle(EtcdSignerCaBundleConfigMapName, oldSigner),
+				bundle(EtcdMetricsSignerCaBundleConfigMapName, metricsSigner),
+			}, signers...),
+		},
+		"rotated signer in the bundle": {
+			objects: append([]runtime.Object{
+				rotatedSigner,
+				bundle(EtcdSignerCaBundleConfigMapName, oldSigner, newSigner),
+				bundle(EtcdMetricsSignerCaBundleConfigMapName, metricsSigner),
+			}, signers...),
+		},
+		"rotated signer not yet in the bundle": {
+			objects: append([]runtime.Object{
+				rotatedSigner,
+				bundle(EtcdSignerCaBundleConfigMapName, oldSigner),
+				bundle(EtcdMetricsSignerCaBundleConfigMapName, metricsSigner),
+			}, signers...),
+			expectedErr: "refusing to re-issue etcd-client, etcd-peer-master-0, etcd-serving-master-0: signer openshift-etcd/etcd-signer is not yet in the CA bundle openshift-etcd/etcd-ca-bundle",
+		},
+		"metrics signer not yet in the bundle": {
+			objects: append([]runtime.Object{
+				bundle(EtcdSignerCaBundleConfigMapName, oldSigner),
+				bundle(EtcdMetricsSignerCaBundleConfigMapName, newSigner),
+			}, signers...),
+			expectedErr: "refusing to re-issue etcd-metric-client, etcd-serving-metrics-master-0: signer openshift-config/etcd-metric-signer is not yet in the CA bundle openshift-etcd/etcd-metrics-ca-bundle",
+		},
+		"missing bundle": {
+			objects:     signers,
+			expectedErr: `error getting openshift-etcd/etcd-ca-bundle: configmaps "etcd-ca-bundle" not found`,
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			fakeKubeClient := fake.NewSimpleClientset(test.objects...)
+			err := EnsureBundleBeforeLeaves(context.TODO(), fakeKubeClient.CoreV1(), fakeKubeClient.CoreV1(), []string{"master-0"})
+			if len(test.expectedErr) > 0 {
+				require.EqualError(t, err, test.expectedErr)
+				return
+			}
+			require.NoError(t, err)
+		})
+	}
+}
+
+func TestEnsureBundleBeforeLeavesBlocksReissuance(t *testing.T) {
+	signer := newTestSigner(t, "etcd-signer")
+	metricsSigner := newTestSigner(t, "etcd-metric-signer")
+	metricsBundle, err := crypto.EncodeCertificates(metricsSigner.Config.Certs...)
+	require.NoError(t, err)
+	fakeKubeClient := fake.NewSimpleClientset(
+		newTestCASecret(t, signer, operatorclient.GlobalUserSpecifiedConfigNamespace, EtcdSignerCertSecretName),
+		newTestCASecret(t, metricsSigner, operatorclient.GlobalUserSpecifiedConfigNamespace, EtcdMetricsSignerCertSecretName),
+		&corev1.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{Namespace: operatorclient.TargetNamespace, Name: EtcdSignerCaBundleConfigMapName},
+		},
+		&corev1.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{Namespace: operatorclient.TargetNamespace, Name: EtcdMetricsSignerCaBundleConfigMapName},
+			Data:       map[string]string{"ca-bundle.crt": string(metricsBundle)},
+		},
+	)
+	secretLister := corev1listers.NewSecretLister(cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{}))
+	reissue := func() error {
+		if err := EnsureBundleBeforeLeaves(context.TODO(), fakeKubeClient.CoreV1(), fakeKubeClient.CoreV1(), nil); err != nil {
+			return err
+		}
+		clientCert := CreateEtcdClientCert(nil, secretLister, fakeKubeClient.CoreV1(), events.NewInMemoryRecorder(t.Name()))
+		_, err := clientCert.EnsureTargetCertKeyPair(context.TODO(), signer, signer.Config.Certs)
+		return err
+	}
+
+	// the bundle is not yet updated with the signer
+	require.Error(t, reissue())
+	_, err = fakeKubeClient.CoreV1().Secrets(operatorclient.TargetNamespace).Get(context.TODO(), EtcdClientCertSecretName, metav1.GetOptions{})
+	require.True(t, apierrors.IsNotFound(err))
+
+	bundle := &certrotation.CABundleConfigMap{
+		Namespace:     operatorclient.TargetNamespace,
+		Name:          EtcdSignerCaBundleConfigMapName,
+		Lister:        corev1listers.NewConfigMapLister(cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{})),
+		Client:        fakeKubeClient.CoreV1(),
+		EventRecorder: events.NewInMemoryRecorder(t.Name()),
+	}
+	_, err = bundle.EnsureConfigMapCABundle(context.TODO(), signer)
+	require.NoError(t, err)
+
+	require.NoError(t, reissue())
+	secret, err := fakeKubeClient.CoreV1().Secrets(operatorclient.TargetNamespace).Get(context.TODO(), EtcdClientCertSecretName, metav1.GetOptions{})
+	require.NoError(t, err)
+	require.NoError(t, parseSecretCert(t, secret).CheckSignatureFrom(signer.Config.Certs[0]))
+}
+
+func TestRequireSignersInBundles(t *testing.T) {
+	oldSigner := newTestSigner(t, "etcd-signer-old")
+	newSigner := newTestSigner(t, "etcd-signer-new")
+	metricsSigner := newTestSigner(t, "etcd-metric-signer")
+
+	tests := map[string]struct {
+		bundles     []BundleSigners
+		expectedErr string
+	}{
+		"signers in their bundles": {
+			bundles: []BundleSigners{
+				{BundleName: EtcdSignerCaBundleConfigMapName, Bundle: []*x509.Certificate{oldSigner.Config.Certs[0], newSigner.Config.Certs[0]}, Signers: []*crypto.CA{oldSigner, newSigner}},
+				{BundleName: EtcdMetricsSignerCaBundleConfigMapName, Bundle: metricsSigner.Config.Certs, Signers: []*crypto.CA{metricsSigner}},
+			},
+		},
+		"rotated signer not yet in the bundle": {
+			bundles: []BundleSigners{
+				{BundleName: EtcdSignerCaBundleConfigMapName, Bundle: oldSigner.Config.Certs, Signers: []*crypto.CA{oldSigner, newSigner}},
+				{BundleName: EtcdMetricsSignerCaBundleConfigMapName, Bundle: metricsSigner.Config.Certs, Signers: []*crypto.CA{metricsSigner}},
+			},
+			expectedErr: `refusing to re-issue etcd-client, etcd-peer-master-0, etcd-serving-master-0: signer "etcd-signer-new" is not yet in the CA bundle openshift-etcd/etcd-ca-bundle`,
+		},
+		"metrics signer not yet in the bundle": {
+			bundles: []BundleSigners{
+				{BundleName: EtcdMetricsSignerCaBundleConfigMapName, Bundle: nil, Signers: []*crypto.CA{metricsSigner}},
+			},
+			expectedErr: `refusing to re-issue etcd-metric-client, etcd-serving-metrics-master-0: signer "etcd-metric-signer" is not yet in the CA bundle openshift-etcd/etcd-metrics-ca-bundle`,
+		},
+		"no signer": {
+			bundles: []BundleSigners{{BundleName: EtcdSignerCaBundleConfigMapName, Signers: []*crypto.CA{nil}}},
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			err := RequireSignersInBundles([]string{"master-0"}, test.bundles...)
+			if len(test.expectedErr) > 0 {
+				require.EqualError(t, err, test.expectedErr)
+				return
+			}
+			require.NoError(t, err)
+		})
+	}
+}
+
+func TestSignerRotationInProgress(t *testing.T) {
+	expiredCAConfig, err := crypto.UnsafeMakeSelfSignedCAConfigForDurationAtTime("etcd-signer-expired", func() time.Time { return time.Now().Add(-48 * time.Hour) }, 24*time.Hour)
+	require.NoError(t, err)
+	oldSigner := newTestSigner(t, "etcd-signer-old")
+	newSigner := newTestSigner(t, "etcd-signer-new")
+	leafSecret := newTestCertSecret(t, newSigner, GetPeerClientSecretNameForNode("master-0"), []string{"10.0.0.1"})
+
+	signerSecret := func(certs ...*x509.Certificate) *corev1.Secret {
+		certPEM, err := crypto.EncodeCertificates(certs...)
+		require.NoError(t, err)
+		return u.FakeSecret(operatorclient.TargetNamespace, EtcdSignerCertSecretName, map[string][]byte{corev1.TLSCertKey: certPEM})
+	}
+
+	tests := map[string]struct {
+		secret           *corev1.Secret
+		expectedRotating bool
+		expectedErr      string
+	}{
+		"single CA": {
+			secret: signerSecret(newSigner.Config.Certs[0]),
+		},
+		"old and new CA": {
+			secret:           signerSecret(oldSigner.Config.Certs[0], newSigner.Config.Certs[0]),
+			expectedRotating: true,
+		},
+		"expired old CA": {
+			secret: signerSecret(expiredCAConfig.Certs[0], newSigner.Config.Certs[0]),
+		},
+		"CA and leaf": {
+			secret: u.FakeSecret(operatorclient.TargetNamespace, EtcdSignerCertSecretName, map[string][]byte{
+				corev1.TLSCertKey: append(leafSecret.Data[corev1.TLSCertKey], signerSecret(newSigner.Config.Certs[0]).Data[corev1.TLSCertKey]...),
+			}),
+		},
+		"missing cert": {
+			secret:      u.FakeSecret(operatorclient.TargetNamespace, EtcdSignerCertSecretName, map[string][]byte{}),
+			expectedErr: "secret openshift-etcd/etcd-signer is missing tls.crt",
+		},
+		"garbage cert": {
+			secret:      u.FakeSecret(operatorclient.TargetNamespace, EtcdSignerCertSecretName, map[string][]byte{corev1.TLSCertKey: []byte("garbage")}),
+			expectedErr: "could not parse tls.crt of secret openshift-etcd/etcd-signer: data does not contain any valid RSA or ECDSA certificates",
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			rotating, err := SignerRotationInProgress(test.secret)
+			if len(test.expectedErr) > 0 {
+				require.EqualError(t, err, test.expectedErr)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, test.expectedRotating, rotating)
+		})
+	}
+}
@@ -0,0 +1,166 @@
+package tlshelpers
+
+import (
+	"fmt"
+	"net"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/apimachinery/pkg/util/validation"
+
+	"github.com/openshift/cluster-etcd-operator/pkg/dnshelpers"
+)
+
+// maxSuspiciousSANDistance is the largest edit distance to a known service name for which a SAN is considered a typo.
+const maxSuspiciousSANDistance = 2
+
+// DetectSuspiciousSANs returns all SANs that are near-duplicates of, but not equal to, one of the etcd service names.
+// Such SANs are most likely a typo, e.g. "etcd.openshift-etc.svc", and indicate a misconfiguration of extra SANs.
+func DetectSuspiciousSANs(sans []string) []string {
+	var suspicious []string
+	for _, san := range sans {
+		san = strings.ToLower(strings.TrimSpace(san))
+		for _, known := range etcdServiceHostNames {
+			if distance := editDistance(san, known); distance > 0 && distance <= maxSuspiciousSANDistance {
+				suspicious = append(suspicious, san)
+				break
+			}
+		}
+	}
+	return suspicious
+}
+
+// ParseExtraSANs parses a comma separated list of extra SANs for WithExtraSANs. Every entry must be an IP or a
+// lowercase DNS name, IPs are normalized.
+func ParseExtraSANs(value string) ([]string, error) {
+	var sans, invalid []string
+	for _, san := range strings.Split(value, ",") {
+		san = strings.TrimSpace(san)
+		if len(san) == 0 {
+			continue
+		}
+		if ip := net.ParseIP(strings.Trim(san, "[]")); ip != nil {
+			sans = append(sans, ip.String())
+			continue
+		}
+		if errs := validation.IsDNS1123Subdomain(san); len(errs) > 0 {
+			invalid = append(invalid, san)
+			continue
+		}
+		sans = append(sans, san)
+	}
+	if len(invalid) > 0 {
+		return nil, fmt.Errorf("extra SANs must be DNS names or IPs, invalid: %s", strings.Join(invalid, ","))
+	}
+	return sans, nil
+}
+
+// ServingCertNeedsReissue compares the SANs of the serving cert in the given secret with the hostnames the operator
+// would issue it with for the node today, see ServerHostNamesForNode. It returns true together with the missing SANs
+// if the cert lags behind, e.g. because the InternalIP of the node changed, so that it can be reissued before the
+// regular rotation. SANs in the cert that are no longer desired, e.g. the previous IP or extra SANs, are not reported.
+func ServingCertNeedsReissue(secret *corev1.Secret, node *corev1.Node) (bool, []string, error) {
+	cert, err := certFromSecret(secret)
+	if err != nil {
+		return false, nil, err
+	}
+	hostNames, err := ServerHostNamesForNode(node)
+	if err != nil {
+		return false, nil, err
+	}
+
+	var missing []string
+	for _, hostName := range hostNames {
+		if !certHasSAN(cert, hostName) {
+			missing = append(missing, hostName)
+		}
+	}
+	return len(missing) > 0, missing, nil
+}
+
+// NodeIPsChangedSinceIssuance returns whether the InternalIPs of the given node differ from the ones recorded in the
+// NodeIPsAnnotation of its cert secret when the cert was issued, regardless of their order. Unlike
+// ServingCertNeedsReissue it does not parse the cert. Secrets issued before the IPs were recorded yield an error, fall
+// back to ServingCertNeedsReissue for those.
+func NodeIPsChangedSinceIssuance(secret *corev1.Secret, node *corev1.Node) (bool, error) {
+	recorded, ok := secret.Annotations[NodeIPsAnnotation]
+	if !ok {
+		return false, fmt.Errorf("secret %s/%s has no %s annotation", secret.Namespace, secret.Name, NodeIPsAnnotation)
+	}
+	current, err := dnshelpers.GetInternalIPAddressesForNodeName(node)
+	if err != nil {
+		return false, fmt.Errorf("could not retrieve internal IP addresses for node: %w", err)
+	}
+	return formatNodeIPs(current) != formatNodeIPs(strings.Split(recorded, ",")), nil
+}
+
+// formatNodeIPs returns the normalized IPs sorted and comma separated, as recorded in the NodeIPsAnnotation.
+func formatNodeIPs(ips []string) string {
+	return strings.Join(sets.NewString(normalizeIPs(ips)...).List(), ",")
+}
+
+// requireSANs rejects an empty set of SANs, a cert issued for it could not be verified by name by any peer. The
+// built-in hostnames never are empty, this guards the issuance against refactors of the hostname helpers.
+func requireSANs(sans []string) error {
+	for _, san := range sans {
+		if len(strings.TrimSpace(san)) > 0 {
+			return nil
+		}
+	}
+	return fmt.Errorf("refusing to issue a cert without any SAN")
+}
+
+// appendExtraSANs appends the extra SANs that are not yet part of sans.
+func appendExtraSANs(sans []string, extraSANs []string) []string {
+	for _, extra := range extraSANs {
+		if !containsSAN(sans, extra) {
+			sans = append(sans, extra)
+		}
+	}
+	return sans
+}
+
+func containsSAN(sans []string, san string) bool {
+	ip := net.ParseIP(san)
+	for _, s := range sans {
+		if s == san {
+			return true
+		}
+		if ip != nil && ip.Equal(net.ParseIP(s)) {
+			return true
+		}
+	}
+	return false
+}
+
+// editDistance computes the Levenshtein distance between a and b.
+func editDistance(a, b string) int {
+	prev := make([]int, len(b)+1)
+	curr := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		curr[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			curr[j] = minInt(prev[j]+1, curr[j-1]+1, prev[j-1]+cost)
+		}
+		prev, curr = curr, prev
+	}
+	return prev[len(b)]
+}
+
+func minInt(first int, rest ...int) int {
+	m := first
+	for _, v := range rest {
+		if v < m {
+			m = v
+		}
+	}
+	return m
+}
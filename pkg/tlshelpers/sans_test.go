@@ -0,0 +1,348 @@
+package tlshelpers
+
+import (
+	"context"
+	"testing"
+
+	"github.com/openshift/library-go/pkg/crypto"
+	"github.com/openshift/library-go/pkg/operator/events"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/client-go/kubernetes/fake"
+	corev1listers "k8s.io/client-go/listers/core/v1"
+	"k8s.io/client-go/tools/cache"
+
+	"github.com/openshift/cluster-etcd-operator/pkg/operator/operatorclient"
+	u "github.com/openshift/cluster-etcd-operator/pkg/testutils"
+)
+
+func TestDetectSuspiciousSANs(t *testing.T) {
+	tests := map[string]struct {
+		sans     []string
+		expected []string
+	}{
+		"empty": {},
+		"exact service names": {
+			sans: []string{"etcd.openshift-etcd.svc", "etcd.kube-system.svc.cluster.local"},
+		},
+		"unrelated names": {
+			sans: []string{"backup.example.com", "10.0.0.1", "localhost"},
+		},
+		"typo in namespace": {
+			sans:     []string{"etcd.openshift-etcd.svc", "etcd.openshift-etc.svc"},
+			expected: []string{"etcd.openshift-etc.svc"},
+		},
+		"swapped characters": {
+			sans:     []string{"etcd.kube-sytsem.svc"},
+			expected: []string{"etcd.kube-sytsem.svc"},
+		},
+		"case and whitespace only": {
+			sans: []string{" ETCD.openshift-etcd.svc "},
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			require.Equal(t, test.expected, DetectSuspiciousSANs(test.sans))
+		})
+	}
+}
+
+func TestParseExtraSANs(t *testing.T) {
+	tests := map[string]struct {
+		value       string
+		expected    []string
+		expectedErr string
+	}{
+		"empty": {},
+		"DNS names and IPs": {
+			value:    "etcd.lb.example.com, 192.168.0.10,[fd00::1],fd00:0::2",
+			expected: []string{"etcd.lb.example.com", "192.168.0.10", "fd00::1", "fd00::2"},
+		},
+		"invalid entries": {
+			value:       "etcd.lb.example.com,Etcd.Example.com,https://etcd.example.com,*.example.com",
+			expectedErr: "extra SANs must be DNS names or IPs, invalid: Etcd.Example.com,https://etcd.example.com,*.example.com",
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			sans, err := ParseExtraSANs(test.value)
+			if len(test.expectedErr) > 0 {
+				require.EqualError(t, err, test.expectedErr)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, test.expected, sans)
+		})
+	}
+}
+
+func TestExtraSANs(t *testing.T) {
+	node := u.FakeNode("master-0", u.WithMasterLabel(), u.WithNodeInternalIP("10.0.0.1"))
+	extraSANs, err := ParseExtraSANs("etcd.lb.example.com,etcd.openshift-etcd.svc,10.0.0.1,192.168.0.10")
+	require.NoError(t, err)
+
+	fakeKubeClient := fake.NewSimpleClientset()
+	secretLister := corev1listers.NewSecretLister(cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{}))
+	certSecret, err := CreateServingCertificate(node, nil, secretLister, fakeKubeClient.CoreV1(), events.NewInMemoryRecorder(t.Name()), WithExtraSANs(extraSANs))
+	require.NoError(t, err)
+
+	// the second signer forces a rotation of the cert issued by the first one
+	for _, signer := range []*crypto.CA{newTestSigner(t, "etcd-signer"), newTestSigner(t, "etcd-signer-rotated")} {
+		secret, err := certSecret.EnsureTargetCertKeyPair(context.TODO(), signer, signer.Config.Certs)
+		require.NoError(t, err)
+		cert := parseSecretCert(t, secret)
+		require.NoError(t, cert.CheckSignatureFrom(signer.Config.Certs[0]))
+
+		require.Contains(t, cert.DNSNames, "etcd.lb.example.com")
+		require.NoError(t, cert.VerifyHostname("192.168.0.10"))
+		dnsNames := sets.NewString(cert.DNSNames...)
+		require.Equal(t, len(cert.DNSNames), dnsNames.Len(), "duplicate DNS SANs: %v", cert.DNSNames)
+		var ips []string
+		for _, ip := range cert.IPAddresses {
+			ips = append(ips, ip.String())
+		}
+		require.ElementsMatch(t, []string{"127.0.0.1", "10.0.0.1", "192.168.0.10"}, ips)
+	}
+}
+
+func TestExtraServiceNames(t *testing.T) {
+	builtIns := getServerHostNames([]string{"10.0.0.1"})
+
+	tests := map[string]struct {
+		baseNames []string
+		expected  []string
+	}{
+		"none": {
+			expected: builtIns,
+		},
+		"replica service": {
+			baseNames: []string{"etcd-replica.openshift-etcd"},
+			expected:  append(append([]string{}, builtIns...), "etcd-replica.openshift-etcd.svc", "etcd-replica.openshift-etcd.svc.cluster.local"),
+		},
+		"built-in services are not repeated": {
+			baseNames: []string{"etcd.openshift-etcd", "etcd.kube-system.svc", "ETCD.kube-system.svc.cluster.local"},
+			expected:  builtIns,
+		},
+		"duplicates in different forms": {
+			baseNames: []string{"etcd.new-ns", " etcd.new-ns.svc ", "etcd.new-ns.svc.cluster.local", "", "etcd.new-ns"},
+			expected:  append(append([]string{}, builtIns...), "etcd.new-ns.svc", "etcd.new-ns.svc.cluster.local"),
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			require.Equal(t, test.expected, newCertOptions(WithExtraServiceNames(test.baseNames)).serverHostNames([]string{"10.0.0.1"}))
+
+			node := u.FakeNode("master-0", u.WithMasterLabel(), u.WithNodeInternalIP("10.0.0.1"))
+			bundle, err := CreateAllNodeCerts(node, newTestSigner(t, "etcd-signer"), WithExtraServiceNames(test.baseNames))
+			require.NoError(t, err)
+			cert := parseSecretCert(t, bundle.Serving)
+			for _, hostName := range test.expected {
+				require.NoError(t, cert.VerifyHostname(hostName))
+			}
+			require.Equal(t, len(cert.DNSNames), sets.NewString(cert.DNSNames...).Len(), "duplicate DNS SANs: %v", cert.DNSNames)
+		})
+	}
+}
+
+func TestBootstrapAliases(t *testing.T) {
+	builtIns := getServerHostNames([]string{"10.0.0.1"})
+	aliases := []string{"etcd-bootstrap", "localhost", " [fd00::5] ", "10.0.0.1", ""}
+
+	tests := map[string]struct {
+		bootstrapComplete bool
+		expected          []string
+	}{
+		"bootstrapping": {
+			expected: append(append([]string{}, builtIns...), "etcd-bootstrap", "fd00::5"),
+		},
+		"bootstrap complete": {
+			bootstrapComplete: true,
+			expected:          builtIns,
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			require.Equal(t, test.expected, newCertOptions(WithBootstrapAliases(aliases, test.bootstrapComplete)).serverHostNames([]string{"10.0.0.1"}))
+		})
+	}
+
+	// the serving cert issued while bootstrapping is re-issued without the aliases once bootstrapping completes
+	node := u.FakeNode("master-0", u.WithMasterLabel(), u.WithNodeInternalIP("10.0.0.1"))
+	signer := newTestSigner(t, "etcd-signer")
+	fakeKubeClient := fake.NewSimpleClientset()
+	indexer := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{})
+	secretLister := corev1listers.NewSecretLister(indexer)
+	recorder := events.NewInMemoryRecorder(t.Name())
+
+	bootstrapCert, err := CreateServingCertificate(node, nil, secretLister, fakeKubeClient.CoreV1(), recorder, WithBootstrapAliases(aliases, false))
+	require.NoError(t, err)
+	secret, err := bootstrapCert.EnsureTargetCertKeyPair(context.TODO(), signer, signer.Config.Certs)
+	require.NoError(t, err)
+	require.NoError(t, parseSecretCert(t, secret).VerifyHostname("etcd-bootstrap"))
+	require.NoError(t, indexer.Add(secret))
+
+	steadyStateCert, err := CreateServingCertificate(node, nil, secretLister, fakeKubeClient.CoreV1(), recorder, WithBootstrapAliases(aliases, true))
+	require.NoError(t, err)
+	secret, err = steadyStateCert.EnsureTargetCertKeyPair(context.TODO(), signer, signer.Config.Certs)
+	require.NoError(t, err)
+	cert := parseSecretCert(t, secret)
+	require.Error(t, cert.VerifyHostname("etcd-bootstrap"))
+	require.Error(t, cert.VerifyHostname("fd00::5"))
+	require.NoError(t, cert.VerifyHostname("localhost"))
+}
+
+func TestNodeIPsChangedSinceIssuance(t *testing.T) {
+	signer := newTestSigner(t, "etcd-signer")
+	issuedNode := u.FakeNode("master-0", u.WithMasterLabel(), u.WithNodeInternalIP("10.0.0.2"), u.WithNodeInternalIP("fd00:0:0:0:0:0:0:1"), u.WithNodeInternalIP("10.0.0.1"))
+
+	fakeKubeClient := fake.NewSimpleClientset()
+	secretLister := corev1listers.NewSecretLister(cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{}))
+	certSecret, err := CreateServingCertificate(issuedNode, nil, secretLister, fakeKubeClient.CoreV1(), events.NewInMemoryRecorder(t.Name()))
+	require.NoError(t, err)
+	secret, err := certSecret.EnsureTargetCertKeyPair(context.TODO(), signer, signer.Config.Certs)
+	require.NoError(t, err)
+	require.Equal(t, "10.0.0.1,10.0.0.2,fd00::1", secret.Annotations[NodeIPsAnnotation])
+
+	bundle, err := CreateAllNodeCerts(issuedNode, signer)
+	require.NoError(t, err)
+	for _, rendered := range []*corev1.Secret{bundle.Peer, bundle.Serving, bundle.ServingMetrics} {
+		require.Equal(t, "10.0.0.1,10.0.0.2,fd00::1", rendered.Annotations[NodeIPsAnnotation])
+	}
+
+	tests := map[string]struct {
+		node          *corev1.Node
+		secret        *corev1.Secret
+		expected      bool
+		expectedError string
+	}{
+		"unchanged": {
+			node:   issuedNode,
+			secret: secret,
+		},
+		"reordered but same": {
+			node:   u.FakeNode("master-0", u.WithMasterLabel(), u.WithNodeInternalIP("fd00::1"), u.WithNodeInternalIP("10.0.0.1"), u.WithNodeInternalIP("10.0.0.2")),
+			secret: secret,
+		},
+		"changed": {
+			node:     u.FakeNode("master-0", u.WithMasterLabel(), u.WithNodeInternalIP("10.0.0.3"), u.WithNodeInternalIP("fd00::1"), u.WithNodeInternalIP("10.0.0.1")),
+			secret:   secret,
+			expected: true,
+		},
+		"IP removed": {
+			node:     u.FakeNode("master-0", u.WithMasterLabel(), u.WithNodeInternalIP("10.0.0.1"), u.WithNodeInternalIP("10.0.0.2")),
+			secret:   secret,
+			expected: true,
+		},
+		"IPs not recorded": {
+			node:          issuedNode,
+			secret:        u.FakeSecret(operatorclient.TargetNamespace, GetServingSecretNameForNode("master-0"), nil),
+			expectedError: "secret openshift-etcd/etcd-serving-master-0 has no etcd.openshift.io/node-ips annotation",
+		},
+		"node without InternalIP": {
+			node:          u.FakeNode("master-0", u.WithMasterLabel()),
+			secret:        secret,
+			expectedError: "could not retrieve internal IP addresses for node: node/master-0 missing InternalIP",
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			changed, err := NodeIPsChangedSinceIssuance(test.secret, test.node)
+			if test.expectedError != "" {
+				require.EqualError(t, err, test.expectedError)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, test.expected, changed)
+		})
+	}
+}
+
+func TestServingCertNeedsReissue(t *testing.T) {
+	signer := newTestSigner(t, "etcd-signer")
+	secret := newTestCertSecret(t, signer, GetServingSecretNameForNode("master-0"), getServerHostNames([]string{"10.0.0.1"}))
+
+	tests := map[string]struct {
+		node            *corev1.Node
+		expectedReissue bool
+		expectedMissing []string
+		expectedErr     bool
+	}{
+		"unchanged IP": {
+			node: u.FakeNode("master-0", u.WithMasterLabel(), u.WithNodeInternalIP("10.0.0.1")),
+		},
+		"changed IP": {
+			node:            u.FakeNode("master-0", u.WithMasterLabel(), u.WithNodeInternalIP("10.0.0.2")),
+			expectedReissue: true,
+			expectedMissing: []string{"10.0.0.2"},
+		},
+		"additional IPv6 IP": {
+			node:            u.FakeNode("master-0", u.WithMasterLabel(), u.WithNodeInternalIP("10.0.0.1"), u.WithNodeInternalIP("fd00::1")),
+			expectedReissue: true,
+			expectedMissing: []string{"::1", "fd00::1"},
+		},
+		"node without IP": {
+			node:        u.FakeNode("master-0", u.WithMasterLabel()),
+			expectedErr: true,
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			reissue, missing, err := ServingCertNeedsReissue(secret, test.node)
+			if test.expectedErr {
+				require.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, test.expectedReissue, reissue)
+			require.Equal(t, test.expectedMissing, missing)
+		})
+	}
+
+	_, _, err := ServingCertNeedsReissue(u.FakeSecret(operatorclient.TargetNamespace, GetServingSecretNameForNode("master-0"), nil), u.FakeNode("master-0", u.WithNodeInternalIP("10.0.0.1")))
+	require.Error(t, err)
+}
+
+func TestRequireSANs(t *testing.T) {
+	signer := newTestSigner(t, "etcd-signer")
+	caCert, caKey, err := signer.Config.GetPEMBytes()
+	require.NoError(t, err)
+
+	tests := map[string]struct {
+		sans          []string
+		expectedError string
+	}{
+		"nil": {
+			expectedError: "could not create the system:etcd-peers cert for master-0: refusing to issue a cert without any SAN",
+		},
+		"empty": {
+			sans:          []string{},
+			expectedError: "could not create the system:etcd-peers cert for master-0: refusing to issue a cert without any SAN",
+		},
+		"blank": {
+			sans:          []string{"", " "},
+			expectedError: "could not create the system:etcd-peers cert for master-0: refusing to issue a cert without any SAN",
+		},
+		"single IP": {
+			sans: []string{"10.0.0.1"},
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			certPEM, _, err := createNewCombinedClientAndServingCerts(context.TODO(), caCert, caKey, "master-0", peerOrg, test.sans, newCertOptions())
+			if test.expectedError != "" {
+				require.EqualError(t, err, test.expectedError)
+				return
+			}
+			require.NoError(t, err)
+			require.NoError(t, RequireClientAndServerAuth(certPEM.Bytes()))
+		})
+	}
+}
@@ -0,0 +1,215 @@
+package tlshelpers
+
+import (
+	"bytes"
+	"context"
+	"crypto/x509"
+	"fmt"
+	"sort"
+
+	"github.com/openshift/library-go/pkg/crypto"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	utilerrors "k8s.io/apimachinery/pkg/util/errors"
+	"k8s.io/apiserver/pkg/authentication/user"
+
+	"github.com/openshift/cluster-etcd-operator/pkg/operator/operatorclient"
+)
+
+// CertKeyPEM is a PEM encoded cert together with its PEM encoded private key.
+type CertKeyPEM struct {
+	Cert []byte
+	Key  []byte
+}
+
+// TestPKINode is a node NewTestPKI issues the peer, serving and metrics certs for.
+type TestPKINode struct {
+	Name        string
+	InternalIPs []string
+}
+
+// TestPKINodeCerts holds the certs NewTestPKI issued for a node.
+type TestPKINodeCerts struct {
+	Peer    CertKeyPEM
+	Serving CertKeyPEM
+	Metrics CertKeyPEM
+}
+
+// TestPKI is a complete, internally consistent etcd PKI held in memory, see NewTestPKI.
+type TestPKI struct {
+	Signer        CertKeyPEM
+	MetricsSigner CertKeyPEM
+	// Nodes holds the certs of every node, keyed by node name
+	Nodes         map[string]TestPKINodeCerts
+	Client        CertKeyPEM
+	MetricsClient CertKeyPEM
+}
+
+// NewTestPKI generates a fresh etcd signer and metrics signer and issues all certs of the etcd PKI from them: the peer,
+// serving and metrics certs of the given nodes with CreatePeerCertKeyWithContext, CreateServerCertKeyWithContext and
+// CreateMetricCertKeyWithContext, and the etcd and metrics client certs. It is meant for tests that need the PKI of a cluster without running the
+// cert rotation controllers. The same nodes always yield certs for the same subjects and SANs, only the keys and
+// serials differ between calls. The options are passed on to the issuance of every cert.
+func NewTestPKI(nodes []TestPKINode, opts ...CertOption) (*TestPKI, error) {
+	certOpts := newCertOptions(opts...)
+	signer, err := newTestPKISigner(EtcdSignerCertSecretName, certOpts)
+	if err != nil {
+		return nil, err
+	}
+	metricsSigner, err := newTestPKISigner(EtcdMetricsSignerCertSecretName, certOpts)
+	if err != nil {
+		return nil, err
+	}
+	pki := &TestPKI{
+		Signer:        signer,
+		MetricsSigner: metricsSigner,
+		Nodes:         map[string]TestPKINodeCerts{},
+	}
+
+	for _, node := range nodes {
+		if len(node.Name) == 0 {
+			return nil, fmt.Errorf("test PKI nodes must be named")
+		}
+		if _, ok := pki.Nodes[node.Name]; ok {
+			return nil, fmt.Errorf("duplicate test PKI node %s", node.Name)
+		}
+		var nodeCerts TestPKINodeCerts
+		for _, issue := range []struct {
+			certKey *CertKeyPEM
+			signer  CertKeyPEM
+			create  func(context.Context, []byte, []byte, string, []string, ...CertOption) (*bytes.Buffer, *bytes.Buffer, error)
+		}{
+			{&nodeCerts.Peer, signer, CreatePeerCertKeyWithContext},
+			{&nodeCerts.Serving, signer, CreateServerCertKeyWithContext},
+			{&nodeCerts.Metrics, metricsSigner, CreateMetricCertKeyWithContext},
+		} {
+			certPEM, keyPEM, err := issue.create(context.Background(), issue.signer.Cert, issue.signer.Key, node.Name, node.InternalIPs, opts...)
+			if err != nil {
+				return nil, fmt.Errorf("could not issue the certs of node %s: %w", node.Name, err)
+			}
+			*issue.certKey = CertKeyPEM{Cert: certPEM.Bytes(), Key: keyPEM.Bytes()}
+		}
+		pki.Nodes[node.Name] = nodeCerts
+	}
+
+	if pki.Client, err = newTestPKIClientCert(signer, etcdClientUser(), certOpts); err != nil {
+		return nil, err
+	}
+	if pki.MetricsClient, err = newTestPKIClientCert(metricsSigner, metricsClientUserInfo(""), certOpts); err != nil {
+		return nil, err
+	}
+	return pki, nil
+}
+
+func newTestPKISigner(name string, certOpts *certOptions) (CertKeyPEM, error) {
+	signerConfig, err := crypto.MakeSelfSignedCAConfigForDuration(name, certOpts.signerValidity())
+	if err != nil {
+		return CertKeyPEM{}, fmt.Errorf("could not generate the test signer %s: %w", name, err)
+	}
+	certPEM, keyPEM, err := signerConfig.GetPEMBytes()
+	if err != nil {
+		return CertKeyPEM{}, fmt.Errorf("could not encode the test signer %s: %w", name, err)
+	}
+	return CertKeyPEM{Cert: certPEM, Key: keyPEM}, nil
+}
+
+func newTestPKIClientCert(signer CertKeyPEM, userInfo user.Info, certOpts *certOptions) (CertKeyPEM, error) {
+	ca, err := crypto.GetCAFromBytes(signer.Cert, signer.Key)
+	if err != nil {
+		return CertKeyPEM{}, err
+	}
+	certConfig, err := makeClientCertForDuration(ca, userInfo, validityWithinSigner(ca, certOpts.clientCertValidity()), certOpts.keyAlgorithm, certOpts.rsaKeySize, certOpts.extensionFns()...)
+	if err != nil {
+		return CertKeyPEM{}, fmt.Errorf("could not issue the client cert of %s: %w", userInfo.GetName(), err)
+	}
+	certPEM, keyPEM, err := certConfig.GetPEMBytes()
+	if err != nil {
+		return CertKeyPEM{}, fmt.Errorf("could not encode the client cert of %s: %w", userInfo.GetName(), err)
+	}
+	return CertKeyPEM{Cert: certPEM, Key: keyPEM}, nil
+}
+
+// nodeNames returns the names of the nodes of the PKI, sorted.
+func (p *TestPKI) nodeNames() []string {
+	var nodeNames []string
+	for nodeName := range p.Nodes {
+		nodeNames = append(nodeNames, nodeName)
+	}
+	sort.Strings(nodeNames)
+	return nodeNames
+}
+
+// Verify checks that every cert of the PKI chains to its signer: the peer and serving certs and the client cert to
+// the etcd signer, the metrics and metrics client cert to the metrics signer. The node certs must be usable for both
+// client and server auth, see VerifyCertAgainstBundle, the client certs for client auth.
+func (p *TestPKI) Verify() error {
+	var errs []error
+	for _, nodeName := range p.nodeNames() {
+		nodeCerts := p.Nodes[nodeName]
+		for _, leaf := range []struct {
+			secretName string
+			certPEM    []byte
+			signerPEM  []byte
+		}{
+			{GetPeerClientSecretNameForNode(nodeName), nodeCerts.Peer.Cert, p.Signer.Cert},
+			{GetServingSecretNameForNode(nodeName), nodeCerts.Serving.Cert, p.Signer.Cert},
+			{GetServingMetricsSecretNameForNode(nodeName), nodeCerts.Metrics.Cert, p.MetricsSigner.Cert},
+		} {
+			if err := VerifyCertAgainstBundle(leaf.certPEM, leaf.signerPEM); err != nil {
+				errs = append(errs, fmt.Errorf("%s: %w", leaf.secretName, err))
+			}
+		}
+	}
+	if err := verifyClientCert(p.Client.Cert, p.Signer.Cert); err != nil {
+		errs = append(errs, fmt.Errorf("%s: %w", EtcdClientCertSecretName, err))
+	}
+	if err := verifyClientCert(p.MetricsClient.Cert, p.MetricsSigner.Cert); err != nil {
+		errs = append(errs, fmt.Errorf("%s: %w", EtcdMetricsClientCertSecretName, err))
+	}
+	return utilerrors.NewAggregate(errs)
+}
+
+func verifyClientCert(certPEM, signerPEM []byte) error {
+	certs, err := crypto.CertsFromPEM(certPEM)
+	if err != nil {
+		return fmt.Errorf("could not parse cert: %w", err)
+	}
+	roots := x509.NewCertPool()
+	if !roots.AppendCertsFromPEM(signerPEM) {
+		return fmt.Errorf("could not load the signer")
+	}
+	_, err = certs[0].Verify(x509.VerifyOptions{Roots: roots, KeyUsages: []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth}})
+	return err
+}
+
+// Secrets renders the PKI as the kubernetes.io/tls secrets of the target namespace the operator manages: the signers,
+// the certs of every node and the client certs, in a stable order. They can be fed into a fake clientset or lister.
+func (p *TestPKI) Secrets() []*corev1.Secret {
+	secrets := []*corev1.Secret{
+		newTestPKISecret(EtcdSignerCertSecretName, p.Signer),
+		newTestPKISecret(EtcdMetricsSignerCertSecretName, p.MetricsSigner),
+	}
+	for _, nodeName := range p.nodeNames() {
+		nodeCerts := p.Nodes[nodeName]
+		secrets = append(secrets,
+			newTestPKISecret(GetPeerClientSecretNameForNode(nodeName), nodeCerts.Peer),
+			newTestPKISecret(GetServingSecretNameForNode(nodeName), nodeCerts.Serving),
+			newTestPKISecret(GetServingMetricsSecretNameForNode(nodeName), nodeCerts.Metrics),
+		)
+	}
+	return append(secrets,
+		newTestPKISecret(EtcdClientCertSecretName, p.Client),
+		newTestPKISecret(EtcdMetricsClientCertSecretName, p.MetricsClient),
+	)
+}
+
+func newTestPKISecret(name string, certKey CertKeyPEM) *corev1.Secret {
+	return &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Namespace: operatorclient.TargetNamespace, Name: name},
+		Type:       corev1.SecretTypeTLS,
+		Data: map[string][]byte{
+			corev1.TLSCertKey:       certKey.Cert,
+			corev1.TLSPrivateKeyKey: certKey.Key,
+		},
+	}
+}
@@ -0,0 +1,79 @@
+package tlshelpers
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+)
+
+func TestNewTestPKI(t *testing.T) {
+	nodes := []TestPKINode{
+		{Name: "master-1", InternalIPs: []string{"10.0.0.2"}},
+		{Name: "master-0", InternalIPs: []string{"10.0.0.1", "fd00::1"}},
+	}
+	pki, err := NewTestPKI(nodes)
+	require.NoError(t, err)
+	require.NoError(t, pki.Verify())
+
+	for _, node := range nodes {
+		nodeCerts := pki.Nodes[node.Name]
+		for _, ip := range node.InternalIPs {
+			require.NoError(t, VerifyCertAgainstBundleForHost(nodeCerts.Peer.Cert, pki.Signer.Cert, ip))
+			require.NoError(t, VerifyCertAgainstBundleForHost(nodeCerts.Serving.Cert, pki.Signer.Cert, ip))
+			require.NoError(t, VerifyCertAgainstBundleForHost(nodeCerts.Metrics.Cert, pki.MetricsSigner.Cert, ip))
+		}
+		require.NoError(t, ValidatePeerCertOrg(nodeCerts.Peer.Cert))
+		require.NoError(t, ValidateServerCertOrg(nodeCerts.Serving.Cert))
+		require.NoError(t, ValidateMetricCertOrg(nodeCerts.Metrics.Cert))
+
+		// the metrics certs are signed by the metrics signer only
+		var verificationErr *CertVerificationError
+		require.ErrorAs(t, VerifyCertAgainstBundle(nodeCerts.Metrics.Cert, pki.Signer.Cert), &verificationErr)
+		require.Equal(t, CertVerificationUnknownAuthority, verificationErr.Reason)
+	}
+
+	var secretNames []string
+	for _, secret := range pki.Secrets() {
+		require.Equal(t, corev1.SecretTypeTLS, secret.Type)
+		require.NoError(t, ValidateCertKeyPair(secret), secret.Name)
+		secretNames = append(secretNames, secret.Name)
+	}
+	require.Equal(t, []string{
+		"etcd-signer", "etcd-metric-signer",
+		"etcd-peer-master-0", "etcd-serving-master-0", "etcd-serving-metrics-master-0",
+		"etcd-peer-master-1", "etcd-serving-master-1", "etcd-serving-metrics-master-1",
+		"etcd-client", "etcd-metric-client",
+	}, secretNames)
+
+	// a cert signed by the wrong signer is caught
+	tampered := *pki
+	tampered.MetricsClient = pki.Client
+	require.ErrorContains(t, tampered.Verify(), "etcd-metric-client: x509: certificate signed by unknown authority")
+
+	_, err = NewTestPKI([]TestPKINode{{Name: "master-0", InternalIPs: []string{"10.0.0.1"}}, {Name: "master-0", InternalIPs: []string{"10.0.0.2"}}})
+	require.EqualError(t, err, "duplicate test PKI node master-0")
+	_, err = NewTestPKI([]TestPKINode{{InternalIPs: []string{"10.0.0.1"}}})
+	require.EqualError(t, err, "test PKI nodes must be named")
+}
+
+func TestNewTestPKIIsDeterministic(t *testing.T) {
+	nodes := []TestPKINode{{Name: "master-0", InternalIPs: []string{"10.0.0.1"}}}
+	first, err := NewTestPKI(nodes)
+	require.NoError(t, err)
+	second, err := NewTestPKI(nodes)
+	require.NoError(t, err)
+
+	firstSecrets, secondSecrets := first.Secrets(), second.Secrets()
+	require.Len(t, secondSecrets, len(firstSecrets))
+	for i := range firstSecrets {
+		firstCert, err := certFromSecret(firstSecrets[i])
+		require.NoError(t, err)
+		secondCert, err := certFromSecret(secondSecrets[i])
+		require.NoError(t, err)
+		require.Equal(t, firstCert.Subject.String(), secondCert.Subject.String(), firstSecrets[i].Name)
+		require.Equal(t, firstCert.DNSNames, secondCert.DNSNames, firstSecrets[i].Name)
+		require.Equal(t, firstCert.IPAddresses, secondCert.IPAddresses, firstSecrets[i].Name)
+		require.Equal(t, firstCert.ExtKeyUsage, secondCert.ExtKeyUsage, firstSecrets[i].Name)
+	}
+}
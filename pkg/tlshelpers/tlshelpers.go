@@ -3,39 +3,57 @@ package tlshelpers
 import (
 	"bytes"
 	"context"
+	"crypto/rsa"
 	"crypto/x509"
 	"crypto/x509/pkix"
+	"errors"
 	"fmt"
 	"github.com/openshift/cluster-etcd-operator/pkg/dnshelpers"
 	"github.com/openshift/cluster-etcd-operator/pkg/operator/operatorclient"
 	"github.com/openshift/library-go/pkg/operator/certrotation"
 	"github.com/openshift/library-go/pkg/operator/events"
+	"hash/fnv"
 	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apiserver/pkg/authentication/user"
 	corev1informers "k8s.io/client-go/informers/core/v1"
 	corev1client "k8s.io/client-go/kubernetes/typed/core/v1"
 	corev1listers "k8s.io/client-go/listers/core/v1"
+	"math"
+	"net"
 	"strings"
 	"time"
 
+	configv1 "github.com/openshift/api/config/v1"
 	"github.com/openshift/library-go/pkg/crypto"
 	"go.etcd.io/etcd/client/pkg/v3/tlsutil"
 	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/apimachinery/pkg/util/wait"
 	"k8s.io/klog/v2"
 )
 
 const (
-	etcdCertValidity          = 3 * 365 * 24 * time.Hour
-	etcdCertValidityRefresh   = 2.5 * 365 * 24 * time.Hour
-	etcdCaCertValidity        = 5 * 365 * 24 * time.Hour
-	etcdCaCertValidityRefresh = 4.5 * 365 * 24 * time.Hour
+	etcdCertValidity   = 3 * 365 * 24 * time.Hour
+	etcdCaCertValidity = 5 * 365 * 24 * time.Hour
+	// etcdCertRefreshFraction and etcdCaCertRefreshFraction are the fractions of their validity after which the leaf
+	// certs and the signers are refreshed, 2.5 of 3 and 4.5 of 5 years by default. Expressing the refresh relative to
+	// the validity keeps both consistent when the validity is overridden, see WithValidity and WithSignerValidity.
+	etcdCertRefreshFraction   = 2.5 / 3
+	etcdCaCertRefreshFraction = 4.5 / 5
+	// nodeCertRefreshJitterFraction bounds how much earlier the certs of a node are refreshed relative to their
+	// validity, see nodeCertRefresh
+	nodeCertRefreshJitterFraction = 1.0 / 20
 
 	peerOrg   = "system:etcd-peers"
 	serverOrg = "system:etcd-servers"
 	metricOrg = "system:etcd-metrics"
 
-	// TODO debt left for @hexfusion or @sanchezl
+	// signerExpiryMargin is how long a signer must stay valid at least for certs to be issued from it, see
+	// requireUnexpiredSigner
+	signerExpiryMargin = time.Minute
+
+	// fakePodFQDN is the identity in the CommonName of certs that are not issued for a particular node
 	fakePodFQDN = "etcd-client"
 
 	EtcdJiraComponentName                  = "etcd"
@@ -46,6 +64,8 @@ const (
 	EtcdAllCertsSecretName                 = "etcd-all-certs"
 	EtcdClientCertSecretName               = "etcd-client"
 	EtcdMetricsClientCertSecretName        = "etcd-metric-client"
+	EtcdBackupDestinationCertSecretName    = "etcd-backup-destination"
+	EtcdExternalSignerCertSecretName       = "etcd-external-signer"
 )
 
 func GetPeerClientSecretNameForNode(nodeName string) string {
@@ -58,38 +78,137 @@ func GetServingMetricsSecretNameForNode(nodeName string) string {
 	return fmt.Sprintf("etcd-serving-metrics-%s", nodeName)
 }
 
+// ServerHostNamesForNode returns the hostnames the operator puts as SANs onto the certs it issues for the given node.
+func ServerHostNamesForNode(node *corev1.Node) ([]string, error) {
+	return serverHostNamesForNode(node, newCertOptions())
+}
+
+func serverHostNamesForNode(node *corev1.Node, certOpts *certOptions) ([]string, error) {
+	ipAddresses, err := nodeCertIPs(node, certOpts)
+	if err != nil {
+		return nil, err
+	}
+	return certOpts.serverHostNames(ipAddresses), nil
+}
+
+// nodeCertIPs returns the IPs of the given node the peer, serving and serving metrics certs are issued for.
+func nodeCertIPs(node *corev1.Node, certOpts *certOptions) ([]string, error) {
+	getIPAddresses := dnshelpers.GetInternalIPAddressesForNodeName
+	if certOpts.externalIPFallback {
+		getIPAddresses = dnshelpers.GetIPAddressesForNodeNameWithExternalFallback
+	}
+	ipAddresses, err := getIPAddresses(node)
+	if err != nil {
+		return nil, fmt.Errorf("could not retrieve internal IP addresses for node: %w", err)
+	}
+	return ipAddresses, nil
+}
+
 func getPeerHostNames(nodeInternalIPs []string) []string {
-	return append([]string{"localhost"}, nodeInternalIPs...)
+	return append([]string{"localhost"}, normalizeIPs(nodeInternalIPs)...)
+}
+
+// etcdServiceHostNames are the kubernetes service DNS names etcd is reachable with.
+var etcdServiceHostNames = []string{
+	"etcd.kube-system.svc",
+	"etcd.kube-system.svc.cluster.local",
+	"etcd.openshift-etcd.svc",
+	"etcd.openshift-etcd.svc.cluster.local",
 }
 
 func getServerHostNames(nodeInternalIPs []string) []string {
-	return append([]string{
-		"localhost",
-		"etcd.kube-system.svc",
-		"etcd.kube-system.svc.cluster.local",
-		"etcd.openshift-etcd.svc",
-		"etcd.openshift-etcd.svc.cluster.local",
-		"127.0.0.1",
-		"::1",
+	nodeInternalIPs = normalizeIPs(nodeInternalIPs)
+	hostNames := append([]string{"localhost"}, etcdServiceHostNames...)
+	hostNames = append(hostNames, loopbackIPs(nodeInternalIPs)...)
+	// a node IP may be a loopback address already in the list
+	return appendExtraSANs(hostNames, nodeInternalIPs)
+}
+
+// serviceHostNames expands the given service base names, <service>.<namespace>, into their .svc and .svc.cluster.local
+// DNS names. Names given in one of these forms already are expanded just the same, blank names are skipped.
+func serviceHostNames(baseNames []string) []string {
+	var hostNames []string
+	for _, baseName := range baseNames {
+		baseName = strings.ToLower(strings.TrimSpace(baseName))
+		baseName = strings.TrimSuffix(strings.TrimSuffix(baseName, ".cluster.local"), ".svc")
+		if len(baseName) == 0 {
+			continue
+		}
+		hostNames = append(hostNames, baseName+".svc", baseName+".svc.cluster.local")
+	}
+	return hostNames
+}
+
+// loopbackIPs returns the loopback addresses of the IP families used by the node IPs. Both families are returned
+// when the family can't be detected.
+func loopbackIPs(nodeInternalIPs []string) []string {
+	var hasIPv4, hasIPv6 bool
+	for _, ip := range nodeInternalIPs {
+		parsed := net.ParseIP(ip)
+		if parsed == nil {
+			continue
+		}
+		if parsed.To4() != nil {
+			hasIPv4 = true
+		} else {
+			hasIPv6 = true
+		}
+	}
+	if !hasIPv4 && !hasIPv6 {
+		hasIPv4, hasIPv6 = true, true
+	}
+
+	var loopbacks []string
+	if hasIPv4 {
+		loopbacks = append(loopbacks, "127.0.0.1")
+	}
+	if hasIPv6 {
 		// "0:0:0:0:0:0:0:1" will be automatically collapsed to "::1", so we don't have to add it on top
-	}, nodeInternalIPs...)
+		loopbacks = append(loopbacks, "::1")
+	}
+	return loopbacks
+}
+
+// normalizeIPs strips the brackets off IPv6 addresses given in URL host form, e.g. "[fd00::1]", and returns all IPs
+// in their canonical form, so they end up as IP SANs. Entries that are not IPs are passed through. Duplicates, e.g. an
+// IPv6 address reported both expanded and collapsed, are dropped keeping the first occurrence, so that the SANs stay
+// minimal and deterministic.
+func normalizeIPs(ips []string) []string {
+	normalized := make([]string, 0, len(ips))
+	seen := sets.NewString()
+	for _, ip := range ips {
+		if parsed := net.ParseIP(strings.TrimSuffix(strings.TrimPrefix(ip, "["), "]")); parsed != nil {
+			ip = parsed.String()
+		}
+		if seen.Has(ip) {
+			continue
+		}
+		seen.Insert(ip)
+		normalized = append(normalized, ip)
+	}
+	return normalized
 }
 
 func CreateSignerCertRotationBundleConfigMap(
 	cmInformer corev1informers.ConfigMapInformer,
 	cmLister corev1listers.ConfigMapLister,
 	cmGetter corev1client.ConfigMapsGetter,
-	recorder events.Recorder) certrotation.CABundleConfigMap {
-
-	return certrotation.CABundleConfigMap{
-		Name:          EtcdSignerCaBundleConfigMapName,
-		Namespace:     operatorclient.TargetNamespace,
-		JiraComponent: EtcdJiraComponentName,
-		Description:   "bundle for etcd signer certificate authorities",
-		Informer:      cmInformer,
-		Lister:        cmLister,
-		Client:        cmGetter,
-		EventRecorder: recorder,
+	recorder events.Recorder,
+	opts ...CertOption) MinTrustedCABundleConfigMap {
+	certOpts := newCertOptions(opts...)
+
+	return MinTrustedCABundleConfigMap{
+		CABundleConfigMap: certrotation.CABundleConfigMap{
+			Name:          EtcdSignerCaBundleConfigMapName,
+			Namespace:     operatorclient.TargetNamespace,
+			JiraComponent: certOpts.jiraComponentName(),
+			Description:   certOpts.description("bundle for etcd signer certificate authorities"),
+			Informer:      cmInformer,
+			Lister:        cmLister,
+			Client:        cmGetter,
+			EventRecorder: recorder,
+		},
+		MinTrustedCAs: certOpts.minTrustedCABundleCAs(),
 	}
 }
 
@@ -97,17 +216,22 @@ func CreateMetricsSignerCertRotationBundleConfigMap(
 	cmInformer corev1informers.ConfigMapInformer,
 	cmLister corev1listers.ConfigMapLister,
 	cmGetter corev1client.ConfigMapsGetter,
-	recorder events.Recorder) certrotation.CABundleConfigMap {
-
-	return certrotation.CABundleConfigMap{
-		Name:          EtcdMetricsSignerCaBundleConfigMapName,
-		Namespace:     operatorclient.TargetNamespace,
-		JiraComponent: EtcdJiraComponentName,
-		Description:   "bundle for etcd metrics signer certificate authorities",
-		Informer:      cmInformer,
-		Lister:        cmLister,
-		Client:        cmGetter,
-		EventRecorder: recorder,
+	recorder events.Recorder,
+	opts ...CertOption) MinTrustedCABundleConfigMap {
+	certOpts := newCertOptions(opts...)
+
+	return MinTrustedCABundleConfigMap{
+		CABundleConfigMap: certrotation.CABundleConfigMap{
+			Name:          EtcdMetricsSignerCaBundleConfigMapName,
+			Namespace:     operatorclient.TargetNamespace,
+			JiraComponent: certOpts.jiraComponentName(),
+			Description:   certOpts.description("bundle for etcd metrics signer certificate authorities"),
+			Informer:      cmInformer,
+			Lister:        cmLister,
+			Client:        cmGetter,
+			EventRecorder: recorder,
+		},
+		MinTrustedCAs: certOpts.minTrustedCABundleCAs(),
 	}
 }
 
@@ -115,15 +239,17 @@ func CreateSignerCert(
 	secretInformer corev1informers.SecretInformer,
 	secretLister corev1listers.SecretLister,
 	secretGetter corev1client.SecretsGetter,
-	recorder events.Recorder) certrotation.RotatedSigningCASecret {
+	recorder events.Recorder,
+	opts ...CertOption) certrotation.RotatedSigningCASecret {
+	certOpts := newCertOptions(opts...)
 
 	return certrotation.RotatedSigningCASecret{
 		Namespace:     operatorclient.TargetNamespace,
 		Name:          EtcdSignerCertSecretName,
-		JiraComponent: EtcdJiraComponentName,
-		Description:   "etcd signer certificate authorities",
-		Validity:      etcdCaCertValidity,
-		Refresh:       etcdCaCertValidityRefresh,
+		JiraComponent: certOpts.jiraComponentName(),
+		Description:   certOpts.description("etcd signer certificate authorities"),
+		Validity:      certOpts.signerValidity(),
+		Refresh:       certOpts.signerRefresh(),
 
 		Informer:      secretInformer,
 		Lister:        secretLister,
@@ -136,15 +262,17 @@ func CreateMetricsSignerCert(
 	secretInformer corev1informers.SecretInformer,
 	secretLister corev1listers.SecretLister,
 	secretGetter corev1client.SecretsGetter,
-	recorder events.Recorder) certrotation.RotatedSigningCASecret {
+	recorder events.Recorder,
+	opts ...CertOption) certrotation.RotatedSigningCASecret {
+	certOpts := newCertOptions(opts...)
 
 	return certrotation.RotatedSigningCASecret{
 		Namespace:     operatorclient.TargetNamespace,
 		Name:          EtcdMetricsSignerCertSecretName,
-		JiraComponent: EtcdJiraComponentName,
-		Description:   "etcd metrics signer certificate authorities",
-		Validity:      etcdCaCertValidity,
-		Refresh:       etcdCaCertValidityRefresh,
+		JiraComponent: certOpts.jiraComponentName(),
+		Description:   certOpts.description("etcd metrics signer certificate authorities"),
+		Validity:      certOpts.signerValidity(),
+		Refresh:       certOpts.signerRefresh(),
 
 		Informer:      secretInformer,
 		Lister:        secretLister,
@@ -157,95 +285,245 @@ func CreatePeerCertificate(node *corev1.Node,
 	secretInformer corev1informers.SecretInformer,
 	secretLister corev1listers.SecretLister,
 	secretGetter corev1client.SecretsGetter,
-	recorder events.Recorder) (*certrotation.RotatedSelfSignedCertKeySecret, error) {
+	recorder events.Recorder,
+	opts ...CertOption) (*certrotation.RotatedSelfSignedCertKeySecret, error) {
 	return createCertForNode(
 		fmt.Sprintf("Peer Cert for node %s", node.Name),
-		GetPeerClientSecretNameForNode(node.Name),
-		node, secretInformer, secretLister, secretGetter, recorder)
+		GetPeerClientSecretNameForNode(node.Name), peerOrg,
+		node, secretInformer, secretLister, secretGetter, recorder, opts...)
 }
 
 func CreateServingCertificate(node *corev1.Node,
 	secretInformer corev1informers.SecretInformer,
 	secretLister corev1listers.SecretLister,
 	secretGetter corev1client.SecretsGetter,
-	recorder events.Recorder) (*certrotation.RotatedSelfSignedCertKeySecret, error) {
+	recorder events.Recorder,
+	opts ...CertOption) (*certrotation.RotatedSelfSignedCertKeySecret, error) {
 	return createCertForNode(
 		fmt.Sprintf("Serving Cert for node %s", node.Name),
-		GetServingSecretNameForNode(node.Name),
-		node, secretInformer, secretLister, secretGetter, recorder)
+		GetServingSecretNameForNode(node.Name), serverOrg,
+		node, secretInformer, secretLister, secretGetter, recorder, opts...)
 }
 
 func CreateMetricsServingCertificate(node *corev1.Node,
 	secretInformer corev1informers.SecretInformer,
 	secretLister corev1listers.SecretLister,
 	secretGetter corev1client.SecretsGetter,
-	recorder events.Recorder) (*certrotation.RotatedSelfSignedCertKeySecret, error) {
+	recorder events.Recorder,
+	opts ...CertOption) (*certrotation.RotatedSelfSignedCertKeySecret, error) {
 	return createCertForNode(
 		fmt.Sprintf("Metric Serving Cert for node %s", node.Name),
-		GetServingMetricsSecretNameForNode(node.Name),
-		node, secretInformer, secretLister, secretGetter, recorder)
+		GetServingMetricsSecretNameForNode(node.Name), metricOrg,
+		node, secretInformer, secretLister, secretGetter, recorder, withMetricsServingCert(opts)...)
+}
+
+// NodeCertIssuance describes what the cert of a node is issued with, e.g. to record it in a status without looking up
+// the node IPs and assembling the hostnames again.
+type NodeCertIssuance struct {
+	SecretName string
+	// SANs are the DNS names and IPs the cert is issued for, including the extra SANs
+	SANs []string
+	// NodeIPs are the IPs of the node the SANs were derived from
+	NodeIPs  []string
+	Validity time.Duration
+}
+
+// CreateNodeCertificateWithIssuance is CreatePeerCertificate, CreateServingCertificate or
+// CreateMetricsServingCertificate, depending on the given cert type, that additionally describes what the cert is
+// issued with.
+func CreateNodeCertificateWithIssuance(certType NodeCertType, node *corev1.Node,
+	secretInformer corev1informers.SecretInformer,
+	secretLister corev1listers.SecretLister,
+	secretGetter corev1client.SecretsGetter,
+	recorder events.Recorder,
+	opts ...CertOption) (*certrotation.RotatedSelfSignedCertKeySecret, NodeCertIssuance, error) {
+
+	var description, secretName, org string
+	switch certType {
+	case PeerNodeCertType:
+		description, secretName, org = fmt.Sprintf("Peer Cert for node %s", node.Name), GetPeerClientSecretNameForNode(node.Name), peerOrg
+	case ServingNodeCertType:
+		description, secretName, org = fmt.Sprintf("Serving Cert for node %s", node.Name), GetServingSecretNameForNode(node.Name), serverOrg
+	case ServingMetricsNodeCertType:
+		description, secretName, org = fmt.Sprintf("Metric Serving Cert for node %s", node.Name), GetServingMetricsSecretNameForNode(node.Name), metricOrg
+		opts = withMetricsServingCert(opts)
+	default:
+		return nil, NodeCertIssuance{}, fmt.Errorf("unknown node cert type %q", certType)
+	}
+	return createCertForNodeWithIssuance(description, secretName, org, node, secretInformer, secretLister, secretGetter, recorder, opts...)
+}
+
+func createCertForNode(description, secretName, org string, node *corev1.Node,
+	secretInformer corev1informers.SecretInformer,
+	secretLister corev1listers.SecretLister,
+	secretGetter corev1client.SecretsGetter,
+	recorder events.Recorder,
+	opts ...CertOption) (*certrotation.RotatedSelfSignedCertKeySecret, error) {
+	certSecret, _, err := createCertForNodeWithIssuance(description, secretName, org, node, secretInformer, secretLister, secretGetter, recorder, opts...)
+	return certSecret, err
 }
 
-func createCertForNode(description, secretName string, node *corev1.Node,
+func createCertForNodeWithIssuance(description, secretName, org string, node *corev1.Node,
 	secretInformer corev1informers.SecretInformer,
 	secretLister corev1listers.SecretLister,
 	secretGetter corev1client.SecretsGetter,
-	recorder events.Recorder) (*certrotation.RotatedSelfSignedCertKeySecret, error) {
+	recorder events.Recorder,
+	opts ...CertOption) (*certrotation.RotatedSelfSignedCertKeySecret, NodeCertIssuance, error) {
 
-	ipAddresses, err := dnshelpers.GetInternalIPAddressesForNodeName(node)
+	certOpts := newCertOptions(opts...)
+	nodeIPs, hostNames, err := nodeCertHostNames(node, certOpts)
 	if err != nil {
-		return nil, fmt.Errorf("could not retrieve internal IP addresses for node: %w", err)
+		reportNodeCertError(err, node, secretName, description, recorder)
+		return nil, NodeCertIssuance{}, err
 	}
-	hostNames := getServerHostNames(ipAddresses)
+	certSecret := newRotatedNodeCertSecret(description, secretName, org, node, hostNames, nodeIPs, certOpts,
+		secretInformer, secretLister, secretGetter, recorder)
+	return certSecret, NodeCertIssuance{
+		SecretName: secretName,
+		SANs:       appendExtraSANs(append([]string{}, hostNames...), certOpts.extraSANs),
+		NodeIPs:    nodeIPs,
+		Validity:   certSecret.Validity,
+	}, nil
+}
 
-	creator := &certrotation.ServingRotation{
-		Hostnames: func() []string {
-			return hostNames
-		},
-		CertificateExtensionFn: []crypto.CertificateExtensionFunc{
-			func(certificate *x509.Certificate) error {
-				certificate.ExtKeyUsage = []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth, x509.ExtKeyUsageServerAuth}
-				return nil
-			},
-		},
+// nodeCertHostNames returns the IPs of the given node and the hostnames its peer, serving and serving metrics certs
+// are issued for.
+func nodeCertHostNames(node *corev1.Node, certOpts *certOptions) ([]string, []string, error) {
+	nodeIPs, err := nodeCertIPs(node, certOpts)
+	if err != nil {
+		return nil, nil, err
+	}
+	hostNames := certOpts.serverHostNames(nodeIPs)
+	if err := requireSANs(appendExtraSANs(hostNames, certOpts.extraSANs)); err != nil {
+		return nil, nil, err
 	}
+	return nodeIPs, hostNames, nil
+}
 
+// reportNodeCertError logs why the given cert of the node could not be created and emits a warning event when the
+// node is lacking the addresses it needs.
+func reportNodeCertError(err error, node *corev1.Node, secretName, description string, recorder events.Recorder) {
+	var missingIPErr *dnshelpers.NodeMissingInternalIPError
+	if errors.As(err, &missingIPErr) {
+		recorder.Warningf("NodeInternalIPMissing", "node %s has no %s address yet, postponing the creation of %s", node.Name, corev1.NodeInternalIP, secretName)
+	}
+	var externalOnlyErr *dnshelpers.NodeOnlyExternalIPError
+	if errors.As(err, &externalOnlyErr) {
+		recorder.Warningf("NodeOnlyExternalIP", "node %s has no %s but only %s addresses, %s cannot be created", node.Name, corev1.NodeInternalIP, corev1.NodeExternalIP, secretName)
+	}
+	klog.ErrorS(err, "Failed to create node certificate", "node", klog.KObj(node),
+		"secret", klog.KRef(operatorclient.TargetNamespace, secretName), "description", description)
+}
+
+func newRotatedNodeCertSecret(description, secretName, org string, node *corev1.Node, hostNames, nodeIPs []string, certOpts *certOptions,
+	secretInformer corev1informers.SecretInformer,
+	secretLister corev1listers.SecretLister,
+	secretGetter corev1client.SecretsGetter,
+	recorder events.Recorder) *certrotation.RotatedSelfSignedCertKeySecret {
 	return &certrotation.RotatedSelfSignedCertKeySecret{
 		Namespace:     operatorclient.TargetNamespace,
 		Name:          secretName,
-		JiraComponent: EtcdJiraComponentName,
-		Description:   description,
-		Validity:      etcdCertValidity,
-		Refresh:       etcdCertValidityRefresh,
-		CertCreator:   creator,
+		JiraComponent: certOpts.jiraComponentName(),
+		Description:   certOpts.description(description),
+		Validity:      certOpts.certValidity(),
+		Refresh:       nodeCertRefresh(node.Name, certOpts.certValidity()),
+		CertCreator:   newNodeCertCreator(org, node.Name, hostNames, nodeIPs, certOpts),
 
 		Informer:      secretInformer,
 		Lister:        secretLister,
 		Client:        secretGetter,
 		EventRecorder: recorder,
-	}, nil
+	}
+}
+
+// nodeCertRefresh returns the refresh of the peer, serving and serving metrics certs of the given node with the given
+// validity. Certs are refreshed at etcdCertRefreshFraction or at 80% of their validity, whichever comes first, so the
+// certs of nodes that were installed at once would all be rotated at the same time. To spread the rotations, a jitter
+// of up to nodeCertRefreshJitterFraction of the validity derived from the node name is subtracted from that time, the
+// certs are never refreshed later.
+func nodeCertRefresh(nodeName string, validity time.Duration) time.Duration {
+	refresh := refreshAfter(validity, etcdCertRefreshFraction)
+	if latest := validity / 5 * 4; latest < refresh {
+		refresh = latest
+	}
+	jitter := nodeCertRefreshJitter(validity)
+	if jitter <= 0 {
+		// too short a validity to spread the rotations
+		return refresh
+	}
+	hash := fnv.New64a()
+	_, _ = hash.Write([]byte(nodeName))
+	return refresh - time.Duration(hash.Sum64()%uint64(jitter))
+}
+
+// nodeCertRefreshJitter returns the maximum jitter of the refresh of node certs with the given validity. Unlike the
+// refresh it is not rounded to the second, which would drop it entirely for validities below 10s.
+func nodeCertRefreshJitter(validity time.Duration) time.Duration {
+	return time.Duration(float64(validity) * nodeCertRefreshJitterFraction)
+}
+
+// refreshAfter returns the given fraction of the validity, rounded to the second so that the default refreshes are
+// exact.
+func refreshAfter(validity time.Duration, fraction float64) time.Duration {
+	return time.Duration(float64(validity) * fraction).Round(time.Second)
+}
+
+// newNodeCertCreator returns the creator of the peer, serving or serving metrics certs of the given org of a node with
+// the given hostnames. The certs carry the same subject as the ones issued from a static CA, see nodeCertSubject. The
+// node IPs the hostnames were derived from are recorded on the secrets, see NodeIPsAnnotation.
+func newNodeCertCreator(org, nodeName string, hostNames, nodeIPs []string, certOpts *certOptions) certrotation.TargetCertCreator {
+	hostNames = appendExtraSANs(hostNames, certOpts.extraSANs)
+	creator := &servingRotation{
+		ServingRotation: certrotation.ServingRotation{
+			Hostnames: func() []string {
+				return hostNames
+			},
+			CertificateExtensionFn: append([]crypto.CertificateExtensionFunc{
+				func(certificate *x509.Certificate) error {
+					subject, err := nodeCertSubject(org, certIdentity(nodeName), certOpts.extraOrganizations)
+					if err != nil {
+						return err
+					}
+					certificate.Subject = subject
+					certificate.ExtKeyUsage = certOpts.nodeCertExtKeyUsages()
+					return nil
+				},
+			}, certOpts.extensionFns()...),
+		},
+		keyAlgorithm: certOpts.keyAlgorithm,
+		rsaKeySize:   certOpts.rsaKeySize,
+		nodeIPs:      nodeIPs,
+	}
+	return certOpts.wrapCertCreator(creator)
 }
 
 func CreateMetricsClientCert(
 	secretInformer corev1informers.SecretInformer,
 	secretLister corev1listers.SecretLister,
 	secretGetter corev1client.SecretsGetter,
-	recorder events.Recorder) certrotation.RotatedSelfSignedCertKeySecret {
-	creator := &certrotation.ClientRotation{
-		UserInfo: &user.DefaultInfo{
-			Name:   "etcd-metric",
-			Groups: []string{"system:etcd", "etcd-metric"},
+	recorder events.Recorder,
+	opts ...CertOption) certrotation.RotatedSelfSignedCertKeySecret {
+	certOpts := newCertOptions(opts...)
+	creator := &metricsClientRotation{
+		clientRotation: clientRotation{
+			ClientRotation: certrotation.ClientRotation{
+				UserInfo: metricsClientUserInfo(""),
+			},
+			keyAlgorithm: certOpts.keyAlgorithm,
+			rsaKeySize:   certOpts.rsaKeySize,
+			extensionFns: certOpts.extensionFns(),
 		},
+		lister: secretLister,
 	}
 
 	return certrotation.RotatedSelfSignedCertKeySecret{
 		Namespace:     operatorclient.TargetNamespace,
 		Name:          EtcdMetricsClientCertSecretName,
-		JiraComponent: EtcdJiraComponentName,
-		Description:   "etcd metrics client certificate",
-		Validity:      etcdCertValidity,
-		Refresh:       etcdCertValidityRefresh,
-		CertCreator:   creator,
+		JiraComponent: certOpts.jiraComponentName(),
+		Description:   certOpts.description("etcd metrics client certificate"),
+		Validity:      certOpts.clientCertValidity(),
+		Refresh:       certOpts.clientCertRefresh(),
+		CertCreator:   certOpts.wrapCertCreator(creator),
 
 		Informer:      secretInformer,
 		Lister:        secretLister,
@@ -254,26 +532,49 @@ func CreateMetricsClientCert(
 	}
 }
 
+// etcdClientUser is the identity of the etcd-client cert.
+func etcdClientUser() user.Info {
+	return &user.DefaultInfo{
+		Name:   "etcd-client",
+		Groups: []string{"system:etcd", "etcd-client"},
+	}
+}
+
 func CreateEtcdClientCert(
 	secretInformer corev1informers.SecretInformer,
 	secretLister corev1listers.SecretLister,
 	secretGetter corev1client.SecretsGetter,
-	recorder events.Recorder) certrotation.RotatedSelfSignedCertKeySecret {
-	creator := &certrotation.ClientRotation{
-		UserInfo: &user.DefaultInfo{
-			Name:   "etcd-client",
-			Groups: []string{"system:etcd", "etcd-client"},
+	recorder events.Recorder,
+	opts ...CertOption) certrotation.RotatedSelfSignedCertKeySecret {
+	certOpts := newCertOptions(opts...)
+	extensionFns := certOpts.extensionFns()
+	if len(certOpts.clientCertExtraUsages) > 0 {
+		extensionFns = append(extensionFns, func(cert *x509.Certificate) error {
+			usages, err := clientCertExtKeyUsages(certOpts.clientCertExtraUsages)
+			if err != nil {
+				return err
+			}
+			cert.ExtKeyUsage = usages
+			return nil
+		})
+	}
+	creator := &clientRotation{
+		ClientRotation: certrotation.ClientRotation{
+			UserInfo: etcdClientUser(),
 		},
+		keyAlgorithm: certOpts.keyAlgorithm,
+		rsaKeySize:   certOpts.rsaKeySize,
+		extensionFns: extensionFns,
 	}
 
 	return certrotation.RotatedSelfSignedCertKeySecret{
 		Namespace:     operatorclient.TargetNamespace,
 		Name:          EtcdClientCertSecretName,
-		JiraComponent: EtcdJiraComponentName,
-		Description:   "etcd client certificate",
-		Validity:      etcdCertValidity,
-		Refresh:       etcdCertValidityRefresh,
-		CertCreator:   creator,
+		JiraComponent: certOpts.jiraComponentName(),
+		Description:   certOpts.description("etcd client certificate"),
+		Validity:      certOpts.clientCertValidity(),
+		Refresh:       certOpts.clientCertRefresh(),
+		CertCreator:   certOpts.wrapCertCreator(creator),
 
 		Informer:      secretInformer,
 		Lister:        secretLister,
@@ -282,78 +583,432 @@ func CreateEtcdClientCert(
 	}
 }
 
+// clientCertExtKeyUsages returns the extended key usages of the etcd client cert with the given extra usages: client
+// auth followed by the extra usages it does not hold yet.
+func clientCertExtKeyUsages(extraUsages []x509.ExtKeyUsage) ([]x509.ExtKeyUsage, error) {
+	usages := []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth}
+	for _, usage := range extraUsages {
+		if usage == x509.ExtKeyUsageAny {
+			return nil, fmt.Errorf("the client cert must not carry the any extended key usage, it lifts the restriction to client auth")
+		}
+		if usage < x509.ExtKeyUsageAny || usage > x509.ExtKeyUsageMicrosoftKernelCodeSigning {
+			return nil, fmt.Errorf("unknown extended key usage %d", usage)
+		}
+		if !containsExtKeyUsage(usages, usage) {
+			usages = append(usages, usage)
+		}
+	}
+	return usages, nil
+}
+
 func ReadConfigSignerCert(ctx context.Context, secretClient corev1client.SecretsGetter) (*crypto.CA, error) {
-	signingCertKeyPairSecret, err := secretClient.Secrets(operatorclient.GlobalUserSpecifiedConfigNamespace).Get(ctx, EtcdSignerCertSecretName, metav1.GetOptions{})
+	return ReadSignerCertFromNamespace(ctx, secretClient, operatorclient.GlobalUserSpecifiedConfigNamespace)
+}
+
+func ReadConfigMetricsSignerCert(ctx context.Context, secretClient corev1client.SecretsGetter) (*crypto.CA, error) {
+	return ReadMetricsSignerCertFromNamespace(ctx, secretClient, operatorclient.GlobalUserSpecifiedConfigNamespace)
+}
+
+// ReadSignerCertFromNamespace reads the etcd signer from the given namespace instead of openshift-config, e.g. to read
+// it from openshift-etcd on a restored control plane.
+func ReadSignerCertFromNamespace(ctx context.Context, secretClient corev1client.SecretsGetter, namespace string) (*crypto.CA, error) {
+	return readSignerCert(ctx, secretClient, namespace, EtcdSignerCertSecretName)
+}
+
+// ReadMetricsSignerCertFromNamespace reads the etcd metrics signer from the given namespace instead of openshift-config.
+func ReadMetricsSignerCertFromNamespace(ctx context.Context, secretClient corev1client.SecretsGetter, namespace string) (*crypto.CA, error) {
+	return readSignerCert(ctx, secretClient, namespace, EtcdMetricsSignerCertSecretName)
+}
+
+func readSignerCert(ctx context.Context, secretClient corev1client.SecretsGetter, namespace, name string) (*crypto.CA, error) {
+	signingCertKeyPairSecret, err := secretClient.Secrets(namespace).Get(ctx, name, metav1.GetOptions{})
 	if err != nil {
-		return nil, fmt.Errorf("error getting %s/%s: %w", operatorclient.GlobalUserSpecifiedConfigNamespace, EtcdSignerCertSecretName, err)
+		return nil, fmt.Errorf("error getting %s/%s: %w", namespace, name, err)
 	}
 
 	return crypto.GetCAFromBytes(signingCertKeyPairSecret.Data["tls.crt"], signingCertKeyPairSecret.Data["tls.key"])
 }
 
-func ReadConfigMetricsSignerCert(ctx context.Context, secretClient corev1client.SecretsGetter) (*crypto.CA, error) {
-	metricsSigningCertKeyPairSecret, err := secretClient.Secrets(operatorclient.GlobalUserSpecifiedConfigNamespace).Get(ctx, EtcdMetricsSignerCertSecretName, metav1.GetOptions{})
-	if err != nil {
-		return nil, fmt.Errorf("error getting %s/%s: %w", operatorclient.GlobalUserSpecifiedConfigNamespace, EtcdMetricsSignerCertSecretName, err)
+// signerWaitBackoff is the backoff WaitForConfigSignerCert and WaitForConfigMetricsSignerCert poll the signer with
+// until their context is done.
+var signerWaitBackoff = wait.Backoff{
+	Duration: time.Second,
+	Factor:   2,
+	Jitter:   0.1,
+	Steps:    math.MaxInt32,
+	Cap:      30 * time.Second,
+}
+
+// WaitForConfigSignerCert is ReadConfigSignerCert that waits for the signer to appear, as it is only created in
+// openshift-config some time into the bootstrap. A missing signer is retried with backoff until ctx is done, while
+// any other error, e.g. a signer that cannot be parsed, is returned right away.
+func WaitForConfigSignerCert(ctx context.Context, secretClient corev1client.SecretsGetter) (*crypto.CA, error) {
+	return waitForSignerCert(ctx, secretClient, operatorclient.GlobalUserSpecifiedConfigNamespace, EtcdSignerCertSecretName)
+}
+
+// WaitForConfigMetricsSignerCert is the WaitForConfigSignerCert of the etcd metrics signer.
+func WaitForConfigMetricsSignerCert(ctx context.Context, secretClient corev1client.SecretsGetter) (*crypto.CA, error) {
+	return waitForSignerCert(ctx, secretClient, operatorclient.GlobalUserSpecifiedConfigNamespace, EtcdMetricsSignerCertSecretName)
+}
+
+func waitForSignerCert(ctx context.Context, secretClient corev1client.SecretsGetter, namespace, name string) (*crypto.CA, error) {
+	var ca *crypto.CA
+	var lastErr error
+	err := wait.ExponentialBackoffWithContext(ctx, signerWaitBackoff, func(ctx context.Context) (bool, error) {
+		var err error
+		ca, err = readSignerCert(ctx, secretClient, namespace, name)
+		if apierrors.IsNotFound(err) {
+			klog.V(2).Infof("waiting for the signer %s/%s to be created", namespace, name)
+			lastErr = err
+			return false, nil
+		}
+		return err == nil, err
+	})
+	if err != nil && lastErr != nil && ctx.Err() != nil {
+		return nil, fmt.Errorf("%w: %v", ctx.Err(), lastErr)
 	}
+	return ca, err
+}
 
-	return crypto.GetCAFromBytes(metricsSigningCertKeyPairSecret.Data["tls.crt"], metricsSigningCertKeyPairSecret.Data["tls.key"])
+// certIdentity returns the identity put into the CommonName of the certs issued for the given node, which is the node
+// name, falling back to fakePodFQDN if it is unknown.
+func certIdentity(nodeName string) string {
+	if len(nodeName) == 0 {
+		return fakePodFQDN
+	}
+	return nodeName
 }
 
+// Deprecated: use CreatePeerCertKeyWithContext, which issues the cert for the node name instead of a shared identity.
 func CreatePeerCertKey(caCert, caKey []byte, nodeInternalIPs []string) (*bytes.Buffer, *bytes.Buffer, error) {
-	return createNewCombinedClientAndServingCerts(caCert, caKey, fakePodFQDN, peerOrg, getPeerHostNames(nodeInternalIPs))
+	return CreatePeerCertKeyWithContext(context.Background(), caCert, caKey, "", nodeInternalIPs)
 }
 
+// Deprecated: use CreateServerCertKeyWithContext, which issues the cert for the node name instead of a shared identity.
 func CreateServerCertKey(caCert, caKey []byte, nodeInternalIPs []string) (*bytes.Buffer, *bytes.Buffer, error) {
-	return createNewCombinedClientAndServingCerts(caCert, caKey, fakePodFQDN, serverOrg, getServerHostNames(nodeInternalIPs))
+	return CreateServerCertKeyWithContext(context.Background(), caCert, caKey, "", nodeInternalIPs)
 }
 
+// Deprecated: use CreateMetricCertKeyWithContext, which issues the cert for the node name instead of a shared identity.
 func CreateMetricCertKey(caCert, caKey []byte, nodeInternalIPs []string) (*bytes.Buffer, *bytes.Buffer, error) {
-	return createNewCombinedClientAndServingCerts(caCert, caKey, fakePodFQDN, metricOrg, getServerHostNames(nodeInternalIPs))
+	return CreateMetricCertKeyWithContext(context.Background(), caCert, caKey, "", nodeInternalIPs)
+}
+
+// CreatePeerCertKeyWithContext issues the peer cert and key of the given node. It returns without generating anything
+// once ctx is done.
+func CreatePeerCertKeyWithContext(ctx context.Context, caCert, caKey []byte, nodeName string, nodeInternalIPs []string, opts ...CertOption) (*bytes.Buffer, *bytes.Buffer, error) {
+	return createNewCombinedClientAndServingCerts(ctx, caCert, caKey, certIdentity(nodeName), peerOrg, getPeerHostNames(nodeInternalIPs), newCertOptions(opts...))
 }
 
-func createNewCombinedClientAndServingCerts(caCert, caKey []byte, podFQDN, org string, hostNames []string) (*bytes.Buffer, *bytes.Buffer, error) {
+// CreateServerCertKeyWithContext issues the serving cert and key of the given node. It returns without generating
+// anything once ctx is done.
+func CreateServerCertKeyWithContext(ctx context.Context, caCert, caKey []byte, nodeName string, nodeInternalIPs []string, opts ...CertOption) (*bytes.Buffer, *bytes.Buffer, error) {
+	certOpts := newCertOptions(opts...)
+	return createNewCombinedClientAndServingCerts(ctx, caCert, caKey, certIdentity(nodeName), serverOrg, certOpts.serverHostNames(nodeInternalIPs), certOpts)
+}
+
+// CreateMetricCertKeyWithContext issues the serving metrics cert and key of the given node. It returns without
+// generating anything once ctx is done.
+func CreateMetricCertKeyWithContext(ctx context.Context, caCert, caKey []byte, nodeName string, nodeInternalIPs []string, opts ...CertOption) (*bytes.Buffer, *bytes.Buffer, error) {
+	certOpts := newCertOptions(withMetricsServingCert(opts)...)
+	return createNewCombinedClientAndServingCerts(ctx, caCert, caKey, certIdentity(nodeName), metricOrg, certOpts.serverHostNames(nodeInternalIPs), certOpts)
+}
+
+func createNewCombinedClientAndServingCerts(ctx context.Context, caCert, caKey []byte, podFQDN, org string, hostNames []string, certOpts *certOptions) (*bytes.Buffer, *bytes.Buffer, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, nil, fmt.Errorf("aborted creating the %s cert for %s: %w", org, podFQDN, err)
+	}
+	if err := requireSANs(hostNames); err != nil {
+		return nil, nil, fmt.Errorf("could not create the %s cert for %s: %w", org, podFQDN, err)
+	}
 	etcdCAKeyPair, err := crypto.GetCAFromBytes(caCert, caKey)
 	if err != nil {
 		return nil, nil, err
 	}
+	if err := requireUnexpiredSigner(etcdCAKeyPair, time.Now()); err != nil {
+		return nil, nil, fmt.Errorf("could not create the %s cert for %s: %w", org, podFQDN, err)
+	}
+	subject, err := nodeCertSubject(org, podFQDN, certOpts.extraOrganizations)
+	if err != nil {
+		return nil, nil, err
+	}
 
-	certConfig, err := etcdCAKeyPair.MakeServerCertForDuration(sets.NewString(hostNames...), etcdCertValidity, func(cert *x509.Certificate) error {
-		cert.Subject = pkix.Name{
-			Organization: []string{org},
-			CommonName:   strings.TrimSuffix(org, "s") + ":" + podFQDN,
+	fns := []crypto.CertificateExtensionFunc{func(cert *x509.Certificate) error {
+		cert.Subject = subject
+		cert.ExtKeyUsage = certOpts.nodeCertExtKeyUsages()
+		return nil
+	}}
+	// the option functions run last, so they are applied on top of the subject set above
+	fns = append(fns, certOpts.extensionFns()...)
+	if certOpts.rsaPSSSignature {
+		if _, ok := etcdCAKeyPair.Config.Key.(*rsa.PrivateKey); !ok {
+			return nil, nil, fmt.Errorf("RSA-PSS signatures require an RSA signer key")
 		}
-		cert.ExtKeyUsage = []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth, x509.ExtKeyUsageServerAuth}
-
-		// TODO: Extended Key Usage:
-		// All profiles expect a x509.ExtKeyUsageCodeSigning set on extended Key Usages
-		// need to investigage: https://github.com/etcd-io/etcd/issues/9398#issuecomment-435340312
+		fns = append(fns, func(cert *x509.Certificate) error {
+			cert.SignatureAlgorithm = x509.SHA256WithRSAPSS
+			return nil
+		})
+	}
 
-		return nil
-	})
+	validity := validityWithinSigner(etcdCAKeyPair, certOpts.certValidity())
+	certConfig, err := makeServerCertForDuration(etcdCAKeyPair, sets.NewString(hostNames...), validity, certOpts.keyAlgorithm, certOpts.rsaKeySize, fns...)
 	if err != nil {
 		return nil, nil, err
 	}
+	if len(certOpts.intermediateCAsPEM) > 0 {
+		if certConfig.Certs, err = appendIntermediateCAs(certConfig.Certs, certOpts.intermediateCAsPEM); err != nil {
+			return nil, nil, fmt.Errorf("could not create the %s cert for %s: %w", org, podFQDN, err)
+		}
+	}
 
 	certBytes := &bytes.Buffer{}
 	keyBytes := &bytes.Buffer{}
 	if err := certConfig.WriteCertConfig(certBytes, keyBytes); err != nil {
 		return nil, nil, err
 	}
+	// the extension functions of the options may have changed the usages
+	requireUsages := RequireClientAndServerAuth
+	if certOpts.serverAuthOnly {
+		requireUsages = requireServerAuth
+	}
+	if err := requireUsages(certBytes.Bytes()); err != nil {
+		return nil, nil, err
+	}
 	return certBytes, keyBytes, nil
 }
 
-func SupportedEtcdCiphers(cipherSuites []string) []string {
+// appendIntermediateCAs appends the CAs in the given PEM to the chain, skipping the ones it already holds.
+func appendIntermediateCAs(chain []*x509.Certificate, intermediateCAsPEM []byte) ([]*x509.Certificate, error) {
+	intermediates, err := crypto.CertsFromPEM(intermediateCAsPEM)
+	if err != nil {
+		return nil, fmt.Errorf("could not parse the intermediate CAs: %w", err)
+	}
+	for _, intermediate := range intermediates {
+		if !intermediate.IsCA {
+			return nil, fmt.Errorf("intermediate %q is not a CA", intermediate.Subject.CommonName)
+		}
+		if !chainHasCert(chain, intermediate) {
+			chain = append(chain, intermediate)
+		}
+	}
+	return chain, nil
+}
+
+func chainHasCert(chain []*x509.Certificate, cert *x509.Certificate) bool {
+	for _, c := range chain {
+		if c.Equal(cert) {
+			return true
+		}
+	}
+	return false
+}
+
+// requireUnexpiredSigner returns an error if the signer has expired at the given time or expires within
+// signerExpiryMargin, e.g. after the operator stalled past the rotation of the signer or due to clock skew. Certs issued
+// from it would chain to an expired CA and fail verification right away.
+func requireUnexpiredSigner(signer *crypto.CA, now time.Time) error {
+	signerCert := signer.Config.Certs[0]
+	if now.Add(signerExpiryMargin).Before(signerCert.NotAfter) {
+		return nil
+	}
+	if now.Before(signerCert.NotAfter) {
+		return fmt.Errorf("refusing to issue a cert from signer %q, it expires at %s", signerCert.Subject.CommonName, signerCert.NotAfter.Format(time.RFC3339))
+	}
+	return fmt.Errorf("refusing to issue a cert from signer %q, it expired at %s", signerCert.Subject.CommonName, signerCert.NotAfter.Format(time.RFC3339))
+}
+
+// validityWithinSigner returns the given validity, capped at the remaining validity of the signer so that the issued
+// cert is not valid past it, just like certrotation caps the certs it rotates.
+func validityWithinSigner(signer *crypto.CA, validity time.Duration) time.Duration {
+	if remaining := time.Until(signer.Config.Certs[0].NotAfter); remaining < validity {
+		return remaining
+	}
+	return validity
+}
+
+// nodeCertSubject returns the subject of the certs of the given org issued for the given identity, see certIdentity.
+// Certs issued from a static CA and the ones rotated by the operator carry the same subject, so a node has a single
+// identity whichever path issued its certs.
+func nodeCertSubject(org, identity string, extraOrgs []string) (pkix.Name, error) {
+	orgs, err := subjectOrganizations(org, extraOrgs)
+	if err != nil {
+		return pkix.Name{}, err
+	}
+	return pkix.Name{
+		Organization: orgs,
+		CommonName:   commonNamePrefix(org) + identity,
+	}, nil
+}
+
+// commonNamePrefix returns the prefix of the CommonName of the certs issued for the given org, e.g. system:etcd-peer: for
+// system:etcd-peers.
+func commonNamePrefix(org string) string {
+	return strings.TrimSuffix(org, "s") + ":"
+}
+
+// PeerCertCommonName returns the CommonName of the peer certs issued for the given node, both by
+// CreatePeerCertKeyWithContext and by CreatePeerCertificate. As it carries the node name, it cannot be rendered into
+// etcd's --peer-cert-allowed-cn, which etcd compares with the CommonName of every peer exactly.
+func PeerCertCommonName(nodeName string) string {
+	return commonNamePrefix(peerOrg) + certIdentity(nodeName)
+}
+
+// subjectOrganizations returns the primary org followed by the extra orgs, skipping duplicates so that the primary
+// org is never replaced or repeated.
+func subjectOrganizations(primaryOrg string, extraOrgs []string) ([]string, error) {
+	orgs := []string{primaryOrg}
+	seen := sets.NewString(primaryOrg)
+	for _, extraOrg := range extraOrgs {
+		if len(strings.TrimSpace(extraOrg)) == 0 {
+			return nil, fmt.Errorf("extra organizations must not be empty")
+		}
+		if seen.Has(extraOrg) {
+			continue
+		}
+		seen.Insert(extraOrg)
+		orgs = append(orgs, extraOrg)
+	}
+	return orgs, nil
+}
+
+// UnsupportedCiphersError lists the configured cipher suites that etcd does not accept, e.g. to name them in a status
+// condition.
+type UnsupportedCiphersError struct {
+	// Ciphers are the rejected cipher suites in the form they were given
+	Ciphers []string
+	// NoneSupported is set if none of the given cipher suites is supported
+	NoneSupported bool
+}
+
+func (e *UnsupportedCiphersError) Error() string {
+	if e.NoneSupported {
+		return fmt.Sprintf("none of the cipher suites is supported by etcd, rejected: %s", strings.Join(e.Ciphers, ","))
+	}
+	return fmt.Sprintf("cipher suites not supported by etcd: %s", strings.Join(e.Ciphers, ","))
+}
+
+// SupportedEtcdCiphers filters the given cipher suites down to the ones etcd supports. It returns an
+// *UnsupportedCiphersError naming the rejected ciphers if none of the given ciphers is supported, an empty input yields
+// an empty list. Ciphers that are skipped while others are supported are only logged, see UnsupportedEtcdCiphers.
+// Ciphers may be given in IANA form, e.g. TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256, or in OpenSSL form, e.g.
+// ECDHE-RSA-AES128-GCM-SHA256. The supported ciphers are returned in IANA form, which is the one etcd accepts.
+func SupportedEtcdCiphers(cipherSuites []string) ([]string, error) {
+	allowedCiphers, rejectedCiphers := filterEtcdCiphers(cipherSuites)
+	for _, cipher := range rejectedCiphers {
+		klog.Warningf("cipher is not supported for use with etcd, skipping: %q", cipher)
+	}
+	if len(cipherSuites) > 0 && len(allowedCiphers) == 0 {
+		return nil, &UnsupportedCiphersError{Ciphers: rejectedCiphers, NoneSupported: true}
+	}
+	return allowedCiphers, nil
+}
+
+// UnsupportedEtcdCiphers returns an *UnsupportedCiphersError naming all given cipher suites that SupportedEtcdCiphers
+// rejects, or nil if etcd supports all of them.
+func UnsupportedEtcdCiphers(cipherSuites []string) error {
+	allowedCiphers, rejectedCiphers := filterEtcdCiphers(cipherSuites)
+	if len(rejectedCiphers) == 0 {
+		return nil
+	}
+	return &UnsupportedCiphersError{Ciphers: rejectedCiphers, NoneSupported: len(allowedCiphers) == 0}
+}
+
+// fipsApprovedEtcdCiphers are the IANA names of the cipher suites etcd may use in FIPS mode. They are the TLS 1.2
+// cipher suites crypto/tls restricts itself to in FIPS mode, i.e. AES-GCM with ECDHE or RSA key exchange.
+var fipsApprovedEtcdCiphers = sets.NewString(
+	"TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256",
+	"TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256",
+	"TLS_ECDHE_ECDSA_WITH_AES_256_GCM_SHA384",
+	"TLS_ECDHE_RSA_WITH_AES_256_GCM_SHA384",
+	"TLS_RSA_WITH_AES_128_GCM_SHA256",
+	"TLS_RSA_WITH_AES_256_GCM_SHA384",
+)
+
+// FIPSApprovedEtcdCiphers splits the given cipher suites into the ones etcd may use in FIPS mode and the ones etcd
+// supports but that are not FIPS approved, both deduplicated and in IANA form. It returns an *UnsupportedCiphersError
+// if any of the given ciphers is not supported by etcd at all, the same as UnsupportedEtcdCiphers. Ciphers are
+// accepted in the same forms as by SupportedEtcdCiphers.
+func FIPSApprovedEtcdCiphers(cipherSuites []string) ([]string, []string, error) {
+	allowedCiphers, rejectedCiphers := filterEtcdCiphers(cipherSuites)
+	if len(rejectedCiphers) > 0 {
+		return nil, nil, &UnsupportedCiphersError{Ciphers: rejectedCiphers, NoneSupported: len(allowedCiphers) == 0}
+	}
+	approvedCiphers := []string{}
+	var nonFIPSCiphers []string
+	for _, cipher := range allowedCiphers {
+		if fipsApprovedEtcdCiphers.Has(cipher) {
+			approvedCiphers = append(approvedCiphers, cipher)
+		} else {
+			nonFIPSCiphers = append(nonFIPSCiphers, cipher)
+		}
+	}
+	return approvedCiphers, nonFIPSCiphers, nil
+}
+
+// filterEtcdCiphers splits the given cipher suites into the deduplicated IANA names of the ones etcd supports and the
+// ones it rejects, in the form they were given.
+func filterEtcdCiphers(cipherSuites []string) ([]string, []string) {
 	allowedCiphers := []string{}
+	allowed := sets.NewString()
+	var rejectedCiphers []string
 	for _, cipher := range cipherSuites {
-		_, ok := tlsutil.GetCipherSuite(cipher)
-		if !ok {
-			// skip and log unsupported ciphers
-			klog.Warningf("cipher is not supported for use with etcd, skipping: %q", cipher)
+		ianaCipher := normalizeCipherName(cipher)
+		if _, ok := tlsutil.GetCipherSuite(ianaCipher); !ok {
+			rejectedCiphers = append(rejectedCiphers, cipher)
+			continue
+		}
+		if allowed.Has(ianaCipher) {
+			// the same cipher given in both forms
 			continue
 		}
-		allowedCiphers = append(allowedCiphers, cipher)
+		allowed.Insert(ianaCipher)
+		allowedCiphers = append(allowedCiphers, ianaCipher)
 	}
-	return allowedCiphers
+	return allowedCiphers, rejectedCiphers
+}
 
+// normalizeCipherName returns the IANA name of a cipher given in OpenSSL form, other names are returned unchanged.
+func normalizeCipherName(cipher string) string {
+	if ianaCiphers := crypto.OpenSSLToIANACipherSuites([]string{cipher}); len(ianaCiphers) == 1 {
+		return ianaCiphers[0]
+	}
+	return cipher
+}
+
+// SupportedEtcdTLSVersion translates the given TLS version into the value etcd accepts for --tls-min-version and
+// --tls-max-version. Both the API form of the TLS security profiles, e.g. VersionTLS12, and the etcd form, e.g. TLS1.2,
+// are accepted. An empty version yields an empty string, which lets etcd pick its default.
+func SupportedEtcdTLSVersion(v string) (string, error) {
+	switch v {
+	case "":
+		return "", nil
+	case string(configv1.VersionTLS12), string(tlsutil.TLSVersion12):
+		return string(tlsutil.TLSVersion12), nil
+	case string(configv1.VersionTLS13), string(tlsutil.TLSVersion13):
+		return string(tlsutil.TLSVersion13), nil
+	case string(configv1.VersionTLS10), string(configv1.VersionTLS11):
+		return "", fmt.Errorf("TLS version %s is not supported by etcd, use %s or %s", v, configv1.VersionTLS12, configv1.VersionTLS13)
+	default:
+		return "", fmt.Errorf("unknown TLS version %q, use %s or %s", v, configv1.VersionTLS12, configv1.VersionTLS13)
+	}
+}
+
+// ValidateEtcdTLSVersionAndCiphers validates the TLS min version and the cipher suites etcd is configured with
+// together. Cipher suites only apply to TLS 1.2, with a min version of TLS 1.3 etcd silently ignores them, which is
+// logged as a warning and returned as error.
+func ValidateEtcdTLSVersionAndCiphers(minVersion string, cipherSuites []string) error {
+	etcdMinVersion, err := SupportedEtcdTLSVersion(minVersion)
+	if err != nil {
+		return fmt.Errorf("invalid min TLS version: %w", err)
+	}
+	ciphers, err := SupportedEtcdCiphers(cipherSuites)
+	if err != nil {
+		return err
+	}
+	if etcdMinVersion == string(tlsutil.TLSVersion13) && len(ciphers) > 0 {
+		klog.Warningf("cipher suites %s are unreachable with min TLS version %s", strings.Join(ciphers, ","), minVersion)
+		return fmt.Errorf("cipher suites %s only apply to TLS 1.2 and are ignored with min TLS version %s, remove the cipher suites or lower the min TLS version to %s",
+			strings.Join(ciphers, ","), minVersion, configv1.VersionTLS12)
+	}
+	return nil
 }
@@ -0,0 +1,1504 @@
+package tlshelpers
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/openshift/api/annotations"
+	"github.com/openshift/library-go/pkg/crypto"
+	"github.com/openshift/library-go/pkg/operator/certrotation"
+	"github.com/openshift/library-go/pkg/operator/events"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/apimachinery/pkg/util/wait"
+	corev1informers "k8s.io/client-go/informers/core/v1"
+	"k8s.io/client-go/kubernetes/fake"
+	corev1client "k8s.io/client-go/kubernetes/typed/core/v1"
+	corev1listers "k8s.io/client-go/listers/core/v1"
+	clienttesting "k8s.io/client-go/testing"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/klog/v2"
+
+	"github.com/openshift/cluster-etcd-operator/pkg/dnshelpers"
+	"github.com/openshift/cluster-etcd-operator/pkg/operator/operatorclient"
+	u "github.com/openshift/cluster-etcd-operator/pkg/testutils"
+)
+
+func TestCertMetadataAnnotations(t *testing.T) {
+	node := u.FakeNode("master-0", u.WithMasterLabel(), u.WithNodeInternalIP("10.0.0.1"))
+	signer := newTestSigner(t, "etcd-signer")
+
+	tests := map[string]struct {
+		opts                []CertOption
+		expectedAnnotations bool
+	}{
+		"default off":   {},
+		"option set on": {opts: []CertOption{WithCertMetadataAnnotations()}, expectedAnnotations: true},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			fakeKubeClient := fake.NewSimpleClientset()
+			indexer := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{})
+			secretLister := corev1listers.NewSecretLister(indexer)
+			certSecret, err := CreatePeerCertificate(node, nil, secretLister, fakeKubeClient.CoreV1(), events.NewInMemoryRecorder(t.Name()), test.opts...)
+			require.NoError(t, err)
+
+			secret, err := certSecret.EnsureTargetCertKeyPair(context.TODO(), signer, signer.Config.Certs)
+			require.NoError(t, err)
+			require.Equal(t, operatorclient.TargetNamespace, secret.Namespace)
+
+			if !test.expectedAnnotations {
+				require.NotContains(t, secret.Annotations, CertNotAfterAnnotation)
+				require.NotContains(t, secret.Annotations, CertSerialAnnotation)
+				require.NotContains(t, secret.Annotations, CertSANsAnnotation)
+				return
+			}
+
+			cert := parseSecretCert(t, secret)
+			expected := setCertMetadataAnnotations(cert, map[string]string{})
+			for k, v := range expected {
+				require.Equal(t, v, secret.Annotations[k])
+			}
+			require.Equal(t, cert.SerialNumber.String(), secret.Annotations[CertSerialAnnotation])
+			require.Contains(t, secret.Annotations[CertSANsAnnotation], "10.0.0.1")
+			require.Contains(t, secret.Annotations[CertSANsAnnotation], "etcd.openshift-etcd.svc")
+
+			// a new signer forces a rotation, which must refresh the annotations
+			require.NoError(t, indexer.Add(secret))
+			newSigner := newTestSigner(t, "etcd-signer-rotated")
+			rotated, err := certSecret.EnsureTargetCertKeyPair(context.TODO(), newSigner, newSigner.Config.Certs)
+			require.NoError(t, err)
+			rotatedCert := parseSecretCert(t, rotated)
+			require.NotEqual(t, secret.Annotations[CertSerialAnnotation], rotated.Annotations[CertSerialAnnotation])
+			require.Equal(t, rotatedCert.SerialNumber.String(), rotated.Annotations[CertSerialAnnotation])
+		})
+	}
+}
+
+func newTestSigner(t *testing.T, name string) *crypto.CA {
+	caConfig, err := crypto.MakeSelfSignedCAConfig(name, 100)
+	require.NoError(t, err)
+	return &crypto.CA{Config: caConfig, SerialGenerator: &crypto.RandomSerialGenerator{}}
+}
+
+func parseSecretCert(t *testing.T, secret *corev1.Secret) *x509.Certificate {
+	cfg, err := crypto.GetTLSCertificateConfigFromBytes(secret.Data["tls.crt"], secret.Data["tls.key"])
+	require.NoError(t, err)
+	return cfg.Certs[0]
+}
+
+func TestSupportedEtcdCiphers(t *testing.T) {
+	tests := map[string]struct {
+		cipherSuites     []string
+		expectedCiphers  []string
+		expectedRejected []string
+		expectedErr      string
+	}{
+		"empty input": {
+			cipherSuites:    nil,
+			expectedCiphers: []string{},
+		},
+		"all valid": {
+			cipherSuites:    []string{"TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256", "TLS_ECDHE_RSA_WITH_CHACHA20_POLY1305"},
+			expectedCiphers: []string{"TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256", "TLS_ECDHE_RSA_WITH_CHACHA20_POLY1305"},
+		},
+		"mixed valid and invalid": {
+			cipherSuites:     []string{"ECDHE-RSA-NOT-A-CIPHER", "TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256", "TLS_NOT_A_CIPHER"},
+			expectedCiphers:  []string{"TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256"},
+			expectedRejected: []string{"ECDHE-RSA-NOT-A-CIPHER", "TLS_NOT_A_CIPHER"},
+		},
+		"mixed IANA and OpenSSL names": {
+			cipherSuites: []string{"ECDHE-RSA-AES128-GCM-SHA256", "TLS_ECDHE_ECDSA_WITH_AES_256_GCM_SHA384", "ECDHE-ECDSA-CHACHA20-POLY1305", "AES128-GCM-SHA256"},
+			expectedCiphers: []string{"TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256", "TLS_ECDHE_ECDSA_WITH_AES_256_GCM_SHA384",
+				"TLS_ECDHE_ECDSA_WITH_CHACHA20_POLY1305_SHA256", "TLS_RSA_WITH_AES_128_GCM_SHA256"},
+		},
+		"same cipher in both forms": {
+			cipherSuites:    []string{"ECDHE-RSA-AES128-GCM-SHA256", "TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256"},
+			expectedCiphers: []string{"TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256"},
+		},
+		"all invalid": {
+			cipherSuites:     []string{"ECDHE-RSA-NOT-A-CIPHER", "TLS_NOT_A_CIPHER"},
+			expectedRejected: []string{"ECDHE-RSA-NOT-A-CIPHER", "TLS_NOT_A_CIPHER"},
+			expectedErr:      "none of the cipher suites is supported by etcd, rejected: ECDHE-RSA-NOT-A-CIPHER,TLS_NOT_A_CIPHER",
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			unsupportedErr := UnsupportedEtcdCiphers(test.cipherSuites)
+			if len(test.expectedRejected) == 0 {
+				require.NoError(t, unsupportedErr)
+			} else {
+				var rejected *UnsupportedCiphersError
+				require.ErrorAs(t, unsupportedErr, &rejected)
+				require.Equal(t, test.expectedRejected, rejected.Ciphers)
+				require.Equal(t, len(test.expectedErr) > 0, rejected.NoneSupported)
+			}
+
+			ciphers, err := SupportedEtcdCiphers(test.cipherSuites)
+			if len(test.expectedErr) > 0 {
+				require.EqualError(t, err, test.expectedErr)
+				var rejected *UnsupportedCiphersError
+				require.ErrorAs(t, err, &rejected)
+				require.Equal(t, test.expectedRejected, rejected.Ciphers)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, test.expectedCiphers, ciphers)
+		})
+	}
+
+	require.EqualError(t, UnsupportedEtcdCiphers([]string{"TLS_NOT_A_CIPHER", "TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256"}),
+		"cipher suites not supported by etcd: TLS_NOT_A_CIPHER")
+}
+
+func TestFIPSApprovedEtcdCiphers(t *testing.T) {
+	tests := map[string]struct {
+		cipherSuites     []string
+		expectedApproved []string
+		expectedNonFIPS  []string
+		expectedErr      string
+	}{
+		"empty input": {
+			expectedApproved: []string{},
+		},
+		"all approved": {
+			cipherSuites:     []string{"TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256", "ECDHE-ECDSA-AES256-GCM-SHA384", "AES128-GCM-SHA256"},
+			expectedApproved: []string{"TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256", "TLS_ECDHE_ECDSA_WITH_AES_256_GCM_SHA384", "TLS_RSA_WITH_AES_128_GCM_SHA256"},
+		},
+		"approved and non-approved": {
+			cipherSuites:     []string{"TLS_ECDHE_RSA_WITH_CHACHA20_POLY1305", "TLS_ECDHE_RSA_WITH_AES_256_GCM_SHA384", "ECDHE-RSA-AES128-SHA256"},
+			expectedApproved: []string{"TLS_ECDHE_RSA_WITH_AES_256_GCM_SHA384"},
+			expectedNonFIPS:  []string{"TLS_ECDHE_RSA_WITH_CHACHA20_POLY1305", "TLS_ECDHE_RSA_WITH_AES_128_CBC_SHA256"},
+		},
+		"none approved": {
+			cipherSuites:     []string{"TLS_ECDHE_ECDSA_WITH_CHACHA20_POLY1305"},
+			expectedApproved: []string{},
+			expectedNonFIPS:  []string{"TLS_ECDHE_ECDSA_WITH_CHACHA20_POLY1305"},
+		},
+		"same cipher in both forms": {
+			cipherSuites:     []string{"ECDHE-RSA-AES128-GCM-SHA256", "TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256"},
+			expectedApproved: []string{"TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256"},
+		},
+		"unknown cipher": {
+			cipherSuites: []string{"TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256", "TLS_NOT_A_CIPHER"},
+			expectedErr:  "cipher suites not supported by etcd: TLS_NOT_A_CIPHER",
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			approved, nonFIPS, err := FIPSApprovedEtcdCiphers(test.cipherSuites)
+			if len(test.expectedErr) > 0 {
+				require.EqualError(t, err, test.expectedErr)
+				var rejected *UnsupportedCiphersError
+				require.ErrorAs(t, err, &rejected)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, test.expectedApproved, approved)
+			require.Equal(t, test.expectedNonFIPS, nonFIPS)
+		})
+	}
+}
+
+func TestGetServerHostNames(t *testing.T) {
+	serviceNames := []string{
+		"localhost",
+		"etcd.kube-system.svc",
+		"etcd.kube-system.svc.cluster.local",
+		"etcd.openshift-etcd.svc",
+		"etcd.openshift-etcd.svc.cluster.local",
+	}
+
+	tests := map[string]struct {
+		nodeInternalIPs   []string
+		expectedHostNames []string
+	}{
+		"IPv4 only": {
+			nodeInternalIPs:   []string{"10.0.0.1"},
+			expectedHostNames: append(append([]string{}, serviceNames...), "127.0.0.1", "10.0.0.1"),
+		},
+		"IPv6 only": {
+			nodeInternalIPs:   []string{"fd00::1"},
+			expectedHostNames: append(append([]string{}, serviceNames...), "::1", "fd00::1"),
+		},
+		"IPv6 only in bracketed and expanded form": {
+			nodeInternalIPs:   []string{"[fd00::1]", "fd00:0:0:0:0:0:0:2"},
+			expectedHostNames: append(append([]string{}, serviceNames...), "::1", "fd00::1", "fd00::2"),
+		},
+		"IPv6 duplicates in different forms": {
+			nodeInternalIPs:   []string{"fd00::1", "fd00:0:0:0:0:0:0:1", "[fd00::1]", "FD00:0000::0001"},
+			expectedHostNames: append(append([]string{}, serviceNames...), "::1", "fd00::1"),
+		},
+		"IPv4 duplicates from multiple NICs": {
+			nodeInternalIPs:   []string{"10.0.0.1", "10.0.0.2", "10.0.0.1", "::ffff:10.0.0.2"},
+			expectedHostNames: append(append([]string{}, serviceNames...), "127.0.0.1", "10.0.0.1", "10.0.0.2"),
+		},
+		"loopback node IP": {
+			nodeInternalIPs:   []string{"127.0.0.1"},
+			expectedHostNames: append(append([]string{}, serviceNames...), "127.0.0.1"),
+		},
+		"hostnames pass through": {
+			nodeInternalIPs:   []string{"master-0.example.com", "10.0.0.1", "master-0.example.com"},
+			expectedHostNames: append(append([]string{}, serviceNames...), "127.0.0.1", "master-0.example.com", "10.0.0.1"),
+		},
+		"dual stack": {
+			nodeInternalIPs:   []string{"10.0.0.1", "fd00::1"},
+			expectedHostNames: append(append([]string{}, serviceNames...), "127.0.0.1", "::1", "10.0.0.1", "fd00::1"),
+		},
+		"no node IPs": {
+			expectedHostNames: append(append([]string{}, serviceNames...), "127.0.0.1", "::1"),
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			require.Equal(t, test.expectedHostNames, getServerHostNames(test.nodeInternalIPs))
+		})
+	}
+}
+
+func TestSupportedEtcdTLSVersion(t *testing.T) {
+	tests := map[string]struct {
+		version         string
+		expectedVersion string
+		expectedErr     string
+	}{
+		"default":             {version: "", expectedVersion: ""},
+		"API TLS 1.2":         {version: "VersionTLS12", expectedVersion: "TLS1.2"},
+		"API TLS 1.3":         {version: "VersionTLS13", expectedVersion: "TLS1.3"},
+		"etcd TLS 1.2":        {version: "TLS1.2", expectedVersion: "TLS1.2"},
+		"etcd TLS 1.3":        {version: "TLS1.3", expectedVersion: "TLS1.3"},
+		"TLS 1.1 unsupported": {version: "VersionTLS11", expectedErr: "TLS version VersionTLS11 is not supported by etcd, use VersionTLS12 or VersionTLS13"},
+		"TLS 1.0 unsupported": {version: "VersionTLS10", expectedErr: "TLS version VersionTLS10 is not supported by etcd, use VersionTLS12 or VersionTLS13"},
+		"unknown version":     {version: "tls13", expectedErr: `unknown TLS version "tls13", use VersionTLS12 or VersionTLS13`},
+		"surrounding spaces":  {version: " TLS1.2", expectedErr: `unknown TLS version " TLS1.2", use VersionTLS12 or VersionTLS13`},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			version, err := SupportedEtcdTLSVersion(test.version)
+			if len(test.expectedErr) > 0 {
+				require.EqualError(t, err, test.expectedErr)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, test.expectedVersion, version)
+		})
+	}
+}
+
+func TestValidateEtcdTLSVersionAndCiphers(t *testing.T) {
+	tls12Ciphers := []string{"TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256", "TLS_ECDHE_RSA_WITH_CHACHA20_POLY1305"}
+
+	tests := map[string]struct {
+		minVersion   string
+		cipherSuites []string
+		expectedErr  string
+	}{
+		"default version without ciphers": {},
+		"default version with ciphers": {
+			cipherSuites: tls12Ciphers,
+		},
+		"TLS 1.2 with ciphers": {
+			minVersion:   "VersionTLS12",
+			cipherSuites: tls12Ciphers,
+		},
+		"TLS 1.2 without ciphers": {
+			minVersion: "VersionTLS12",
+		},
+		"TLS 1.3 without ciphers": {
+			minVersion: "VersionTLS13",
+		},
+		"TLS 1.3 with ciphers": {
+			minVersion:   "VersionTLS13",
+			cipherSuites: tls12Ciphers,
+			expectedErr:  "cipher suites TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256,TLS_ECDHE_RSA_WITH_CHACHA20_POLY1305 only apply to TLS 1.2 and are ignored with min TLS version VersionTLS13, remove the cipher suites or lower the min TLS version to VersionTLS12",
+		},
+		"etcd form TLS 1.3 with ciphers": {
+			minVersion:   "TLS1.3",
+			cipherSuites: tls12Ciphers[:1],
+			expectedErr:  "cipher suites TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256 only apply to TLS 1.2 and are ignored with min TLS version TLS1.3, remove the cipher suites or lower the min TLS version to VersionTLS12",
+		},
+		"TLS 1.3 with only unsupported ciphers": {
+			minVersion:   "VersionTLS13",
+			cipherSuites: []string{"TLS_NOT_A_CIPHER"},
+			expectedErr:  "none of the cipher suites is supported by etcd, rejected: TLS_NOT_A_CIPHER",
+		},
+		"TLS 1.1 with ciphers": {
+			minVersion:   "VersionTLS11",
+			cipherSuites: tls12Ciphers,
+			expectedErr:  "invalid min TLS version: TLS version VersionTLS11 is not supported by etcd, use VersionTLS12 or VersionTLS13",
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			err := ValidateEtcdTLSVersionAndCiphers(test.minVersion, test.cipherSuites)
+			if len(test.expectedErr) > 0 {
+				require.EqualError(t, err, test.expectedErr)
+				return
+			}
+			require.NoError(t, err)
+		})
+	}
+}
+
+func TestCreateCertForNodeInternalIPs(t *testing.T) {
+	tests := map[string]struct {
+		node                  *corev1.Node
+		expectMissingIPErr    bool
+		expectErr             bool
+		expectedMissingEvents int
+	}{
+		"no addresses": {
+			node:                  u.FakeNode("master-0", u.WithMasterLabel()),
+			expectMissingIPErr:    true,
+			expectErr:             true,
+			expectedMissingEvents: 1,
+		},
+		"only hostname addresses": {
+			node: u.FakeNode("master-0", u.WithMasterLabel(), func(node *corev1.Node) {
+				node.Status.Addresses = []corev1.NodeAddress{{Type: corev1.NodeHostName, Address: "master-0"}}
+			}),
+			expectMissingIPErr:    true,
+			expectErr:             true,
+			expectedMissingEvents: 1,
+		},
+		"malformed internal IP": {
+			node:      u.FakeNode("master-0", u.WithMasterLabel(), u.WithNodeInternalIP("master-0.example.com")),
+			expectErr: true,
+		},
+		"valid internal IPs": {
+			node: u.FakeNode("master-0", u.WithMasterLabel(), u.WithNodeInternalIP("10.0.0.1"), u.WithNodeInternalIP("fd00::1")),
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			fakeKubeClient := fake.NewSimpleClientset()
+			secretLister := corev1listers.NewSecretLister(cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{}))
+			recorder := events.NewInMemoryRecorder(t.Name())
+			_, err := CreatePeerCertificate(test.node, nil, secretLister, fakeKubeClient.CoreV1(), recorder)
+			if test.expectErr {
+				require.Error(t, err)
+			} else {
+				require.NoError(t, err)
+			}
+
+			var missingIPErr *dnshelpers.NodeMissingInternalIPError
+			require.Equal(t, test.expectMissingIPErr, errors.As(err, &missingIPErr))
+			if test.expectMissingIPErr {
+				require.Equal(t, test.node.Name, missingIPErr.NodeName)
+			}
+
+			missingEvents := 0
+			for _, event := range recorder.Events() {
+				if event.Reason == "NodeInternalIPMissing" {
+					require.Contains(t, event.Message, test.node.Name)
+					missingEvents++
+				}
+			}
+			require.Equal(t, test.expectedMissingEvents, missingEvents)
+		})
+	}
+}
+
+func TestCreateCertForNodeFailureLog(t *testing.T) {
+	var logs bytes.Buffer
+	state := klog.CaptureState()
+	defer state.Restore()
+	klog.LogToStderr(false)
+	klog.SetOutput(io.Discard)
+	klog.SetOutputBySeverity("ERROR", &logs)
+
+	node := u.FakeNode("master-2", u.WithMasterLabel())
+	fakeKubeClient := fake.NewSimpleClientset()
+	secretLister := corev1listers.NewSecretLister(cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{}))
+	for _, create := range []func(*corev1.Node, corev1informers.SecretInformer, corev1listers.SecretLister, corev1client.SecretsGetter, events.Recorder, ...CertOption) (*certrotation.RotatedSelfSignedCertKeySecret, error){
+		CreatePeerCertificate, CreateServingCertificate, CreateMetricsServingCertificate,
+	} {
+		_, err := create(node, nil, secretLister, fakeKubeClient.CoreV1(), events.NewInMemoryRecorder(t.Name()))
+		var missingIPErr *dnshelpers.NodeMissingInternalIPError
+		require.ErrorAs(t, err, &missingIPErr)
+	}
+	klog.Flush()
+
+	lines := strings.Split(strings.TrimSpace(logs.String()), "\n")
+	require.Len(t, lines, 3)
+	for i, expected := range []struct{ secret, description string }{
+		{"openshift-etcd/etcd-peer-master-2", "Peer Cert for node master-2"},
+		{"openshift-etcd/etcd-serving-master-2", "Serving Cert for node master-2"},
+		{"openshift-etcd/etcd-serving-metrics-master-2", "Metric Serving Cert for node master-2"},
+	} {
+		require.Contains(t, lines[i], `"Failed to create node certificate"`)
+		require.Contains(t, lines[i], `node="master-2"`)
+		require.Contains(t, lines[i], fmt.Sprintf("secret=%q", expected.secret))
+		require.Contains(t, lines[i], fmt.Sprintf("description=%q", expected.description))
+	}
+}
+
+func TestCreateNodeCertificateWithIssuance(t *testing.T) {
+	node := u.FakeNode("master-0", u.WithMasterLabel(), u.WithNodeInternalIP("10.0.0.1"), u.WithNodeInternalIP("fd00::1"))
+	signer := newTestSigner(t, "etcd-signer")
+
+	for certType, expectedSecretName := range map[NodeCertType]string{
+		PeerNodeCertType:           "etcd-peer-master-0",
+		ServingNodeCertType:        "etcd-serving-master-0",
+		ServingMetricsNodeCertType: "etcd-serving-metrics-master-0",
+	} {
+		t.Run(string(certType), func(t *testing.T) {
+			fakeKubeClient := fake.NewSimpleClientset()
+			secretLister := corev1listers.NewSecretLister(cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{}))
+
+			certSecret, issuance, err := CreateNodeCertificateWithIssuance(certType, node, nil, secretLister, fakeKubeClient.CoreV1(),
+				events.NewInMemoryRecorder(t.Name()), WithExtraSANs([]string{"etcd.example.com"}))
+			require.NoError(t, err)
+			require.Equal(t, expectedSecretName, issuance.SecretName)
+			require.Equal(t, certSecret.Name, issuance.SecretName)
+			require.Equal(t, []string{"10.0.0.1", "fd00::1"}, issuance.NodeIPs)
+			require.Equal(t, etcdCertValidity, issuance.Validity)
+
+			secret, err := certSecret.EnsureTargetCertKeyPair(context.TODO(), signer, signer.Config.Certs)
+			require.NoError(t, err)
+			cert := parseSecretCert(t, secret)
+			sans := sets.New[string](cert.DNSNames...)
+			for _, ip := range cert.IPAddresses {
+				sans.Insert(ip.String())
+			}
+			require.ElementsMatch(t, sets.List(sans), issuance.SANs)
+			require.Contains(t, issuance.SANs, "etcd.example.com")
+		})
+	}
+
+	_, _, err := CreateNodeCertificateWithIssuance("client", node, nil, nil, nil, events.NewInMemoryRecorder(t.Name()))
+	require.EqualError(t, err, `unknown node cert type "client"`)
+}
+
+func TestServerHostNamesForNodeExternalIPs(t *testing.T) {
+	withExternalIP := func(ip string) func(*corev1.Node) {
+		return func(node *corev1.Node) {
+			node.Status.Addresses = append(node.Status.Addresses, corev1.NodeAddress{Type: corev1.NodeExternalIP, Address: ip})
+		}
+	}
+
+	tests := map[string]struct {
+		node                   *corev1.Node
+		opts                   []CertOption
+		expectedIPs            []string
+		expectExternalOnlyErr  bool
+		expectedEventsByReason map[string]int
+	}{
+		"internal only": {
+			node:        u.FakeNode("master-0", u.WithNodeInternalIP("10.0.0.1")),
+			expectedIPs: []string{"10.0.0.1"},
+		},
+		"external only": {
+			node:                   u.FakeNode("master-0", withExternalIP("203.0.113.10")),
+			expectExternalOnlyErr:  true,
+			expectedEventsByReason: map[string]int{"NodeOnlyExternalIP": 1},
+		},
+		"external only with fallback": {
+			node:        u.FakeNode("master-0", withExternalIP("203.0.113.10"), withExternalIP("2001:db8::10")),
+			opts:        []CertOption{WithExternalIPFallback()},
+			expectedIPs: []string{"203.0.113.10", "2001:db8::10"},
+		},
+		"mixed": {
+			node:        u.FakeNode("master-0", withExternalIP("203.0.113.10"), u.WithNodeInternalIP("10.0.0.1")),
+			expectedIPs: []string{"10.0.0.1"},
+		},
+		"mixed with fallback uses the internal IPs": {
+			node:        u.FakeNode("master-0", withExternalIP("203.0.113.10"), u.WithNodeInternalIP("10.0.0.1")),
+			opts:        []CertOption{WithExternalIPFallback()},
+			expectedIPs: []string{"10.0.0.1"},
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			hostNames, err := serverHostNamesForNode(test.node, newCertOptions(test.opts...))
+			var externalOnlyErr *dnshelpers.NodeOnlyExternalIPError
+			require.Equal(t, test.expectExternalOnlyErr, errors.As(err, &externalOnlyErr))
+			if test.expectExternalOnlyErr {
+				require.Equal(t, []string{"203.0.113.10"}, externalOnlyErr.ExternalIPs)
+				require.EqualError(t, err, "could not retrieve internal IP addresses for node: node/master-0 missing InternalIP, it only reports the ExternalIP addresses 203.0.113.10")
+			} else {
+				require.NoError(t, err)
+				require.Equal(t, getServerHostNames(test.expectedIPs), hostNames)
+			}
+
+			recorder := events.NewInMemoryRecorder(t.Name())
+			fakeKubeClient := fake.NewSimpleClientset()
+			secretLister := corev1listers.NewSecretLister(cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{}))
+			_, err = CreateServingCertificate(test.node, nil, secretLister, fakeKubeClient.CoreV1(), recorder, test.opts...)
+			require.Equal(t, test.expectExternalOnlyErr, err != nil)
+			eventsByReason := map[string]int{}
+			for _, event := range recorder.Events() {
+				eventsByReason[event.Reason]++
+			}
+			if test.expectedEventsByReason == nil {
+				test.expectedEventsByReason = map[string]int{}
+			}
+			require.Equal(t, test.expectedEventsByReason, eventsByReason)
+		})
+	}
+}
+
+func TestReadSignerCertFromNamespace(t *testing.T) {
+	signer := newTestSigner(t, "etcd-signer")
+	metricsSigner := newTestSigner(t, "etcd-metric-signer")
+	fakeKubeClient := fake.NewSimpleClientset(
+		newTestCASecret(t, signer, operatorclient.TargetNamespace, EtcdSignerCertSecretName),
+		newTestCASecret(t, metricsSigner, operatorclient.TargetNamespace, EtcdMetricsSignerCertSecretName),
+	)
+
+	ca, err := ReadSignerCertFromNamespace(context.TODO(), fakeKubeClient.CoreV1(), operatorclient.TargetNamespace)
+	require.NoError(t, err)
+	require.Equal(t, signer.Config.Certs[0].Raw, ca.Config.Certs[0].Raw)
+
+	ca, err = ReadMetricsSignerCertFromNamespace(context.TODO(), fakeKubeClient.CoreV1(), operatorclient.TargetNamespace)
+	require.NoError(t, err)
+	require.Equal(t, metricsSigner.Config.Certs[0].Raw, ca.Config.Certs[0].Raw)
+
+	// the default readers still look into openshift-config
+	_, err = ReadConfigSignerCert(context.TODO(), fakeKubeClient.CoreV1())
+	require.EqualError(t, err, `error getting openshift-config/etcd-signer: secrets "etcd-signer" not found`)
+	_, err = ReadConfigMetricsSignerCert(context.TODO(), fakeKubeClient.CoreV1())
+	require.EqualError(t, err, `error getting openshift-config/etcd-metric-signer: secrets "etcd-metric-signer" not found`)
+}
+
+func TestWaitForConfigSignerCert(t *testing.T) {
+	defer func(backoff wait.Backoff) { signerWaitBackoff = backoff }(signerWaitBackoff)
+	signerWaitBackoff = wait.Backoff{Duration: time.Millisecond, Factor: 1, Steps: math.MaxInt32}
+	signer := newTestSigner(t, "etcd-signer")
+
+	// the signer only lands in openshift-config on the third get
+	fakeKubeClient := fake.NewSimpleClientset()
+	gets := 0
+	fakeKubeClient.PrependReactor("get", "secrets", func(action clienttesting.Action) (bool, runtime.Object, error) {
+		gets++
+		if gets == 3 {
+			require.NoError(t, fakeKubeClient.Tracker().Add(newTestCASecret(t, signer, operatorclient.GlobalUserSpecifiedConfigNamespace, EtcdSignerCertSecretName)))
+		}
+		return false, nil, nil
+	})
+	ca, err := WaitForConfigSignerCert(context.TODO(), fakeKubeClient.CoreV1())
+	require.NoError(t, err)
+	require.Equal(t, signer.Config.Certs[0].Raw, ca.Config.Certs[0].Raw)
+	require.Equal(t, 3, gets)
+
+	// a signer that cannot be parsed is not retried
+	fakeKubeClient = fake.NewSimpleClientset(u.FakeSecret(operatorclient.GlobalUserSpecifiedConfigNamespace, EtcdMetricsSignerCertSecretName, map[string][]byte{
+		corev1.TLSCertKey:       []byte("garbage"),
+		corev1.TLSPrivateKeyKey: []byte("garbage"),
+	}))
+	gets = 0
+	fakeKubeClient.PrependReactor("get", "secrets", func(action clienttesting.Action) (bool, runtime.Object, error) {
+		gets++
+		return false, nil, nil
+	})
+	_, err = WaitForConfigMetricsSignerCert(context.TODO(), fakeKubeClient.CoreV1())
+	require.Error(t, err)
+	require.False(t, apierrors.IsNotFound(err))
+	require.Equal(t, 1, gets)
+
+	// a signer that never appears is waited for until the context is done
+	ctx, cancel := context.WithTimeout(context.TODO(), 50*time.Millisecond)
+	defer cancel()
+	_, err = WaitForConfigSignerCert(ctx, fake.NewSimpleClientset().CoreV1())
+	require.ErrorIs(t, err, context.DeadlineExceeded)
+	require.ErrorContains(t, err, `error getting openshift-config/etcd-signer: secrets "etcd-signer" not found`)
+}
+
+func TestGetPeerHostNames(t *testing.T) {
+	require.Equal(t, []string{"localhost", "10.0.0.1"}, getPeerHostNames([]string{"10.0.0.1"}))
+	require.Equal(t, []string{"localhost", "fd00::1"}, getPeerHostNames([]string{"[fd00::1]"}))
+	require.Equal(t, []string{"localhost", "10.0.0.1", "fd00::1"}, getPeerHostNames([]string{"10.0.0.1", "fd00::1"}))
+	require.Equal(t, []string{"localhost", "10.0.0.1", "fd00::1"}, getPeerHostNames([]string{"10.0.0.1", "fd00:0:0::1", "10.0.0.1", "[fd00::1]"}))
+}
+
+func TestCreateCertKeyWithContext(t *testing.T) {
+	signer := newTestSigner(t, "etcd-signer")
+	caCert, caKey, err := signer.Config.GetPEMBytes()
+	require.NoError(t, err)
+
+	creators := map[string]func(context.Context, []byte, []byte, string, []string, ...CertOption) (*bytes.Buffer, *bytes.Buffer, error){
+		"peer":    CreatePeerCertKeyWithContext,
+		"server":  CreateServerCertKeyWithContext,
+		"metrics": CreateMetricCertKeyWithContext,
+	}
+	for name, create := range creators {
+		t.Run(name, func(t *testing.T) {
+			certPEM, keyPEM, err := create(context.TODO(), caCert, caKey, "master-0", []string{"10.0.0.1"})
+			require.NoError(t, err)
+			require.NotEmpty(t, certPEM.Bytes())
+			require.NotEmpty(t, keyPEM.Bytes())
+
+			ctx, cancel := context.WithCancel(context.Background())
+			cancel()
+			certPEM, keyPEM, err = create(ctx, caCert, caKey, "master-0", []string{"10.0.0.1"})
+			require.ErrorIs(t, err, context.Canceled)
+			require.Nil(t, certPEM)
+			require.Nil(t, keyPEM)
+
+			// the context is checked before the signer is even loaded
+			_, _, err = create(ctx, []byte("not a cert"), []byte("not a key"), "master-0", []string{"10.0.0.1"})
+			require.ErrorIs(t, err, context.Canceled)
+		})
+	}
+}
+
+func TestIntermediateCAs(t *testing.T) {
+	rootConfig, err := crypto.MakeSelfSignedCAConfigForDuration("corporate-root", time.Hour)
+	require.NoError(t, err)
+	root := &crypto.CA{Config: rootConfig, SerialGenerator: &crypto.RandomSerialGenerator{}}
+	intermediateConfig, err := crypto.MakeCAConfigForDuration("corporate-intermediate", time.Hour, root)
+	require.NoError(t, err)
+	intermediate := &crypto.CA{Config: intermediateConfig, SerialGenerator: &crypto.RandomSerialGenerator{}}
+	signerConfig, err := crypto.MakeCAConfigForDuration("etcd-signer", time.Hour, intermediate)
+	require.NoError(t, err)
+
+	// the signer PEM only holds the signer itself, not the corporate certs above it
+	caCert, err := crypto.EncodeCertificates(signerConfig.Certs[0])
+	require.NoError(t, err)
+	caKey, err := crypto.EncodeKey(signerConfig.Key)
+	require.NoError(t, err)
+	rootPEM, err := crypto.EncodeCertificates(root.Config.Certs[0])
+	require.NoError(t, err)
+	intermediatePEM, err := crypto.EncodeCertificates(intermediate.Config.Certs[0])
+	require.NoError(t, err)
+	signerAndIntermediatePEM, err := crypto.EncodeCertificates(signerConfig.Certs[0], intermediate.Config.Certs[0])
+	require.NoError(t, err)
+	leafPEM, _, err := CreateServerCertKeyWithContext(context.TODO(), caCert, caKey, "master-0", []string{"10.0.0.1"})
+	require.NoError(t, err)
+
+	tests := map[string]struct {
+		opts            []CertOption
+		expectedChain   []string
+		expectedErr     string
+		expectVerifyErr bool
+	}{
+		"signer only": {
+			expectedChain:   []string{"system:etcd-server:master-0", "etcd-signer"},
+			expectVerifyErr: true,
+		},
+		"intermediate appended": {
+			opts:          []CertOption{WithIntermediateCAs(intermediatePEM)},
+			expectedChain: []string{"system:etcd-server:master-0", "etcd-signer", "corporate-intermediate"},
+		},
+		"certs of the chain are not appended twice": {
+			opts:          []CertOption{WithIntermediateCAs(signerAndIntermediatePEM)},
+			expectedChain: []string{"system:etcd-server:master-0", "etcd-signer", "corporate-intermediate"},
+		},
+		"leaf is no intermediate": {
+			opts:        []CertOption{WithIntermediateCAs(leafPEM.Bytes())},
+			expectedErr: `could not create the system:etcd-servers cert for master-0: intermediate "system:etcd-server:master-0" is not a CA`,
+		},
+		"unparsable intermediate": {
+			opts:        []CertOption{WithIntermediateCAs([]byte("not a cert"))},
+			expectedErr: "could not parse the intermediate CAs: Could not read any certificates",
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			certPEM, keyPEM, err := CreateServerCertKeyWithContext(context.TODO(), caCert, caKey, "master-0", []string{"10.0.0.1"}, test.opts...)
+			if len(test.expectedErr) > 0 {
+				require.ErrorContains(t, err, test.expectedErr)
+				return
+			}
+			require.NoError(t, err)
+
+			chain, err := crypto.CertsFromPEM(certPEM.Bytes())
+			require.NoError(t, err)
+			var commonNames []string
+			for _, cert := range chain {
+				commonNames = append(commonNames, cert.Subject.CommonName)
+			}
+			require.Equal(t, test.expectedChain, commonNames)
+
+			// the key output is a single key matching the leaf
+			require.Equal(t, 1, bytes.Count(keyPEM.Bytes(), []byte("-----BEGIN")))
+			_, err = tls.X509KeyPair(certPEM.Bytes(), keyPEM.Bytes())
+			require.NoError(t, err)
+
+			// remote verifiers only trust the corporate root
+			err = VerifyCertAgainstBundleForHost(certPEM.Bytes(), rootPEM, "10.0.0.1")
+			if test.expectVerifyErr {
+				require.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+		})
+	}
+}
+
+func TestCertKeyFromExpiredSigner(t *testing.T) {
+	newSignerPEM := func(name string, notBefore time.Time, lifetime time.Duration) ([]byte, []byte) {
+		caConfig, err := crypto.UnsafeMakeSelfSignedCAConfigForDurationAtTime(name, func() time.Time { return notBefore }, lifetime)
+		require.NoError(t, err)
+		caCert, caKey, err := caConfig.GetPEMBytes()
+		require.NoError(t, err)
+		return caCert, caKey
+	}
+
+	tests := map[string]struct {
+		notBefore     time.Time
+		lifetime      time.Duration
+		expectedError string
+	}{
+		"fresh signer": {
+			notBefore: time.Now(),
+			lifetime:  etcdCaCertValidity,
+		},
+		"expired signer": {
+			notBefore:     time.Now().Add(-48 * time.Hour),
+			lifetime:      24 * time.Hour,
+			expectedError: `refusing to issue a cert from signer "etcd-signer", it expired at`,
+		},
+		"signer expiring within the margin": {
+			notBefore:     time.Now(),
+			lifetime:      signerExpiryMargin / 2,
+			expectedError: `refusing to issue a cert from signer "etcd-signer", it expires at`,
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			caCert, caKey := newSignerPEM("etcd-signer", test.notBefore, test.lifetime)
+			for org, create := range map[string]func(context.Context, []byte, []byte, string, []string, ...CertOption) (*bytes.Buffer, *bytes.Buffer, error){
+				peerOrg:   CreatePeerCertKeyWithContext,
+				serverOrg: CreateServerCertKeyWithContext,
+				metricOrg: CreateMetricCertKeyWithContext,
+			} {
+				certPEM, _, err := create(context.TODO(), caCert, caKey, "master-0", []string{"10.0.0.1"})
+				if len(test.expectedError) == 0 {
+					require.NoError(t, err)
+					require.NotEmpty(t, certPEM.Bytes())
+					continue
+				}
+				require.ErrorContains(t, err, "could not create the "+org+" cert for master-0: "+test.expectedError)
+			}
+		})
+	}
+}
+
+func TestClusterIDSubject(t *testing.T) {
+	node := u.FakeNode("master-0", u.WithMasterLabel(), u.WithNodeInternalIP("10.0.0.1"))
+	signer := newTestSigner(t, "etcd-signer")
+	caCert, caKey, err := signer.Config.GetPEMBytes()
+	require.NoError(t, err)
+
+	tests := map[string]struct {
+		opts       []CertOption
+		expectedOU []string
+	}{
+		"default unset":    {},
+		"cluster ID set":   {opts: []CertOption{WithClusterID("0b9a6c4e-1f3d-4c2a-9d7e-2f1b8a3c5d6e")}, expectedOU: []string{"0b9a6c4e-1f3d-4c2a-9d7e-2f1b8a3c5d6e"}},
+		"empty cluster ID": {opts: []CertOption{WithClusterID("")}},
+		"with ECDSA keys":  {opts: []CertOption{WithClusterID("cluster-a"), WithKeyAlgorithm(ECDSAP256KeyAlgorithm)}, expectedOU: []string{"cluster-a"}},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			fakeKubeClient := fake.NewSimpleClientset()
+			secretLister := corev1listers.NewSecretLister(cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{}))
+			recorder := events.NewInMemoryRecorder(t.Name())
+
+			peerCert, err := CreatePeerCertificate(node, nil, secretLister, fakeKubeClient.CoreV1(), recorder, test.opts...)
+			require.NoError(t, err)
+			clientCert := CreateEtcdClientCert(nil, secretLister, fakeKubeClient.CoreV1(), recorder, test.opts...)
+			metricsClientCert := CreateMetricsClientCert(nil, secretLister, fakeKubeClient.CoreV1(), recorder, test.opts...)
+
+			for _, rotated := range []*certrotation.RotatedSelfSignedCertKeySecret{peerCert, &clientCert, &metricsClientCert} {
+				secret, err := rotated.EnsureTargetCertKeyPair(context.TODO(), signer, signer.Config.Certs)
+				require.NoError(t, err)
+				cert := parseSecretCert(t, secret)
+				require.Equal(t, test.expectedOU, cert.Subject.OrganizationalUnit, "unexpected OU on %s", secret.Name)
+				require.NotEmpty(t, cert.Subject.CommonName)
+			}
+
+			certPEM, keyPEM, err := CreateServerCertKeyWithContext(context.TODO(), caCert, caKey, "master-0", []string{"10.0.0.1"}, test.opts...)
+			require.NoError(t, err)
+			certConfig, err := crypto.GetTLSCertificateConfigFromBytes(certPEM.Bytes(), keyPEM.Bytes())
+			require.NoError(t, err)
+			require.Equal(t, test.expectedOU, certConfig.Certs[0].Subject.OrganizationalUnit)
+			require.Equal(t, []string{serverOrg}, certConfig.Certs[0].Subject.Organization)
+		})
+	}
+}
+
+func TestCodeSigningUsage(t *testing.T) {
+	node := u.FakeNode("master-0", u.WithMasterLabel(), u.WithNodeInternalIP("10.0.0.1"))
+	signer := newTestSigner(t, "etcd-signer")
+	caCert, caKey, err := signer.Config.GetPEMBytes()
+	require.NoError(t, err)
+
+	tests := map[string]struct {
+		opts           []CertOption
+		expectedUsages []x509.ExtKeyUsage
+	}{
+		"default off": {
+			expectedUsages: []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth, x509.ExtKeyUsageServerAuth},
+		},
+		"option set on": {
+			opts:           []CertOption{WithCodeSigningUsage()},
+			expectedUsages: []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth, x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageCodeSigning},
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			fakeKubeClient := fake.NewSimpleClientset()
+			secretLister := corev1listers.NewSecretLister(cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{}))
+			recorder := events.NewInMemoryRecorder(t.Name())
+
+			for _, create := range []func(*corev1.Node, corev1informers.SecretInformer, corev1listers.SecretLister, corev1client.SecretsGetter, events.Recorder, ...CertOption) (*certrotation.RotatedSelfSignedCertKeySecret, error){
+				CreatePeerCertificate, CreateServingCertificate, CreateMetricsServingCertificate,
+			} {
+				certSecret, err := create(node, nil, secretLister, fakeKubeClient.CoreV1(), recorder, test.opts...)
+				require.NoError(t, err)
+				secret, err := certSecret.EnsureTargetCertKeyPair(context.TODO(), signer, signer.Config.Certs)
+				require.NoError(t, err)
+				require.Equal(t, test.expectedUsages, parseSecretCert(t, secret).ExtKeyUsage, "unexpected usages on %s", secret.Name)
+			}
+
+			for _, create := range []func(context.Context, []byte, []byte, string, []string, ...CertOption) (*bytes.Buffer, *bytes.Buffer, error){
+				CreatePeerCertKeyWithContext, CreateServerCertKeyWithContext, CreateMetricCertKeyWithContext,
+			} {
+				certPEM, keyPEM, err := create(context.TODO(), caCert, caKey, "master-0", []string{"10.0.0.1"}, test.opts...)
+				require.NoError(t, err)
+				certConfig, err := crypto.GetTLSCertificateConfigFromBytes(certPEM.Bytes(), keyPEM.Bytes())
+				require.NoError(t, err)
+				require.Equal(t, test.expectedUsages, certConfig.Certs[0].ExtKeyUsage)
+			}
+		})
+	}
+}
+
+func TestMetricsServerAuthOnly(t *testing.T) {
+	node := u.FakeNode("master-0", u.WithMasterLabel(), u.WithNodeInternalIP("10.0.0.1"))
+	signer := newTestSigner(t, "etcd-signer")
+	caCert, caKey, err := signer.Config.GetPEMBytes()
+	require.NoError(t, err)
+
+	tests := map[string]struct {
+		opts                  []CertOption
+		expectedNodeUsages    []x509.ExtKeyUsage
+		expectedMetricsUsages []x509.ExtKeyUsage
+	}{
+		"default off": {
+			expectedNodeUsages:    []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth, x509.ExtKeyUsageServerAuth},
+			expectedMetricsUsages: []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth, x509.ExtKeyUsageServerAuth},
+		},
+		"option set on": {
+			opts:                  []CertOption{WithMetricsServerAuthOnly()},
+			expectedNodeUsages:    []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth, x509.ExtKeyUsageServerAuth},
+			expectedMetricsUsages: []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		},
+		"with code signing usage": {
+			opts:                  []CertOption{WithMetricsServerAuthOnly(), WithCodeSigningUsage()},
+			expectedNodeUsages:    []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth, x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageCodeSigning},
+			expectedMetricsUsages: []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageCodeSigning},
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			fakeKubeClient := fake.NewSimpleClientset()
+			secretLister := corev1listers.NewSecretLister(cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{}))
+			recorder := events.NewInMemoryRecorder(t.Name())
+
+			for _, c := range []struct {
+				create         func(*corev1.Node, corev1informers.SecretInformer, corev1listers.SecretLister, corev1client.SecretsGetter, events.Recorder, ...CertOption) (*certrotation.RotatedSelfSignedCertKeySecret, error)
+				expectedUsages []x509.ExtKeyUsage
+			}{
+				{CreatePeerCertificate, test.expectedNodeUsages},
+				{CreateServingCertificate, test.expectedNodeUsages},
+				{CreateMetricsServingCertificate, test.expectedMetricsUsages},
+			} {
+				certSecret, err := c.create(node, nil, secretLister, fakeKubeClient.CoreV1(), recorder, test.opts...)
+				require.NoError(t, err)
+				secret, err := certSecret.EnsureTargetCertKeyPair(context.TODO(), signer, signer.Config.Certs)
+				require.NoError(t, err)
+				require.Equal(t, c.expectedUsages, parseSecretCert(t, secret).ExtKeyUsage, "unexpected usages on %s", secret.Name)
+			}
+
+			certSecret, _, err := CreateNodeCertificateWithIssuance(ServingMetricsNodeCertType, node, nil, secretLister, fakeKubeClient.CoreV1(), recorder, test.opts...)
+			require.NoError(t, err)
+			secret, err := certSecret.EnsureTargetCertKeyPair(context.TODO(), signer, signer.Config.Certs)
+			require.NoError(t, err)
+			require.Equal(t, test.expectedMetricsUsages, parseSecretCert(t, secret).ExtKeyUsage)
+
+			for _, c := range []struct {
+				create         func(context.Context, []byte, []byte, string, []string, ...CertOption) (*bytes.Buffer, *bytes.Buffer, error)
+				expectedUsages []x509.ExtKeyUsage
+			}{
+				{CreatePeerCertKeyWithContext, test.expectedNodeUsages},
+				{CreateServerCertKeyWithContext, test.expectedNodeUsages},
+				{CreateMetricCertKeyWithContext, test.expectedMetricsUsages},
+			} {
+				certPEM, keyPEM, err := c.create(context.TODO(), caCert, caKey, "master-0", []string{"10.0.0.1"}, test.opts...)
+				require.NoError(t, err)
+				certConfig, err := crypto.GetTLSCertificateConfigFromBytes(certPEM.Bytes(), keyPEM.Bytes())
+				require.NoError(t, err)
+				require.Equal(t, c.expectedUsages, certConfig.Certs[0].ExtKeyUsage)
+			}
+
+			bundle, err := CreateAllNodeCerts(node, signer, test.opts...)
+			require.NoError(t, err)
+			require.Equal(t, test.expectedNodeUsages, parseSecretCert(t, bundle.Peer).ExtKeyUsage)
+			require.Equal(t, test.expectedNodeUsages, parseSecretCert(t, bundle.Serving).ExtKeyUsage)
+			require.Equal(t, test.expectedMetricsUsages, parseSecretCert(t, bundle.ServingMetrics).ExtKeyUsage)
+
+			// the metrics cert is still accepted by the clients of the etcd metrics listener
+			roots := x509.NewCertPool()
+			roots.AddCert(signer.Config.Certs[0])
+			_, err = parseSecretCert(t, bundle.ServingMetrics).Verify(x509.VerifyOptions{
+				DNSName:   "10.0.0.1",
+				Roots:     roots,
+				KeyUsages: []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+			})
+			require.NoError(t, err)
+		})
+	}
+}
+
+func TestClientCertExtraUsages(t *testing.T) {
+	signer := newTestSigner(t, "etcd-signer")
+
+	tests := map[string]struct {
+		opts           []CertOption
+		expectedUsages []x509.ExtKeyUsage
+		expectedErr    string
+	}{
+		"default": {
+			expectedUsages: []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+		},
+		"extra usages": {
+			opts:           []CertOption{WithClientCertExtraUsages([]x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageEmailProtection})},
+			expectedUsages: []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth, x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageEmailProtection},
+		},
+		"duplicate usages": {
+			opts:           []CertOption{WithClientCertExtraUsages([]x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth, x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageServerAuth})},
+			expectedUsages: []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth, x509.ExtKeyUsageServerAuth},
+		},
+		"with ECDSA keys": {
+			opts:           []CertOption{WithKeyAlgorithm(ECDSAP256KeyAlgorithm), WithClientCertExtraUsages([]x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth})},
+			expectedUsages: []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth, x509.ExtKeyUsageServerAuth},
+		},
+		"any usage": {
+			opts:        []CertOption{WithClientCertExtraUsages([]x509.ExtKeyUsage{x509.ExtKeyUsageAny})},
+			expectedErr: "the client cert must not carry the any extended key usage, it lifts the restriction to client auth",
+		},
+		"unknown usage": {
+			opts:        []CertOption{WithClientCertExtraUsages([]x509.ExtKeyUsage{x509.ExtKeyUsage(100)})},
+			expectedErr: "unknown extended key usage 100",
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			fakeKubeClient := fake.NewSimpleClientset()
+			secretLister := corev1listers.NewSecretLister(cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{}))
+			clientCert := CreateEtcdClientCert(nil, secretLister, fakeKubeClient.CoreV1(), events.NewInMemoryRecorder(t.Name()), test.opts...)
+			secret, err := clientCert.EnsureTargetCertKeyPair(context.TODO(), signer, signer.Config.Certs)
+			if len(test.expectedErr) > 0 {
+				require.ErrorContains(t, err, test.expectedErr)
+				return
+			}
+			require.NoError(t, err)
+			cert := parseSecretCert(t, secret)
+			require.Equal(t, test.expectedUsages, cert.ExtKeyUsage)
+			require.Equal(t, "etcd-client", cert.Subject.CommonName)
+
+			// the extra usages only apply to the etcd client cert
+			metricsClientCert := CreateMetricsClientCert(nil, secretLister, fakeKubeClient.CoreV1(), events.NewInMemoryRecorder(t.Name()), test.opts...)
+			secret, err = metricsClientCert.EnsureTargetCertKeyPair(context.TODO(), signer, signer.Config.Certs)
+			require.NoError(t, err)
+			require.Equal(t, []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth}, parseSecretCert(t, secret).ExtKeyUsage)
+		})
+	}
+}
+
+func TestCertKeyCommonName(t *testing.T) {
+	signer := newTestSigner(t, "etcd-signer")
+	caCert, caKey, err := signer.Config.GetPEMBytes()
+	require.NoError(t, err)
+
+	tests := map[string]struct {
+		create       func(context.Context, []byte, []byte, string, []string, ...CertOption) (*bytes.Buffer, *bytes.Buffer, error)
+		nodeName     string
+		expectedCN   string
+		expectedOrgs []string
+	}{
+		"peer":                   {create: CreatePeerCertKeyWithContext, nodeName: "master-0", expectedCN: "system:etcd-peer:master-0", expectedOrgs: []string{"system:etcd-peers"}},
+		"server":                 {create: CreateServerCertKeyWithContext, nodeName: "master-0", expectedCN: "system:etcd-server:master-0", expectedOrgs: []string{"system:etcd-servers"}},
+		"metric":                 {create: CreateMetricCertKeyWithContext, nodeName: "master-0", expectedCN: "system:etcd-metric:master-0", expectedOrgs: []string{"system:etcd-metrics"}},
+		"peer without node name": {create: CreatePeerCertKeyWithContext, expectedCN: "system:etcd-peer:etcd-client", expectedOrgs: []string{"system:etcd-peers"}},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			certPEM, keyPEM, err := test.create(context.TODO(), caCert, caKey, test.nodeName, []string{"10.0.0.1"})
+			require.NoError(t, err)
+			certConfig, err := crypto.GetTLSCertificateConfigFromBytes(certPEM.Bytes(), keyPEM.Bytes())
+			require.NoError(t, err)
+			require.Equal(t, test.expectedCN, certConfig.Certs[0].Subject.CommonName)
+			require.Equal(t, test.expectedOrgs, certConfig.Certs[0].Subject.Organization)
+		})
+	}
+
+	// the deprecated helpers keep their signature and issue the certs for the shared identity
+	certPEM, keyPEM, err := CreatePeerCertKey(caCert, caKey, []string{"10.0.0.1"})
+	require.NoError(t, err)
+	certConfig, err := crypto.GetTLSCertificateConfigFromBytes(certPEM.Bytes(), keyPEM.Bytes())
+	require.NoError(t, err)
+	require.Equal(t, "system:etcd-peer:etcd-client", certConfig.Certs[0].Subject.CommonName)
+}
+
+func TestNodeCertIdentityMatchesAcrossIssuance(t *testing.T) {
+	signer := newTestSigner(t, "etcd-signer")
+	caCert, caKey, err := signer.Config.GetPEMBytes()
+	require.NoError(t, err)
+	node := u.FakeNode("master-0", u.WithMasterLabel(), u.WithNodeInternalIP("10.0.0.1"))
+	opts := []CertOption{WithExtraOrganizations([]string{"example:etcd-readers"})}
+	bundle, err := CreateAllNodeCerts(node, signer, opts...)
+	require.NoError(t, err)
+
+	tests := map[string]struct {
+		createStatic  func(context.Context, []byte, []byte, string, []string, ...CertOption) (*bytes.Buffer, *bytes.Buffer, error)
+		createRotated func(*corev1.Node, corev1informers.SecretInformer, corev1listers.SecretLister, corev1client.SecretsGetter, events.Recorder, ...CertOption) (*certrotation.RotatedSelfSignedCertKeySecret, error)
+		rendered      *corev1.Secret
+		validateOrg   func([]byte) error
+		expectedCN    string
+	}{
+		"peer":    {createStatic: CreatePeerCertKeyWithContext, createRotated: CreatePeerCertificate, rendered: bundle.Peer, validateOrg: ValidatePeerCertOrg, expectedCN: "system:etcd-peer:master-0"},
+		"serving": {createStatic: CreateServerCertKeyWithContext, createRotated: CreateServingCertificate, rendered: bundle.Serving, validateOrg: ValidateServerCertOrg, expectedCN: "system:etcd-server:master-0"},
+		"metrics": {createStatic: CreateMetricCertKeyWithContext, createRotated: CreateMetricsServingCertificate, rendered: bundle.ServingMetrics, validateOrg: ValidateMetricCertOrg, expectedCN: "system:etcd-metric:master-0"},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			certPEM, keyPEM, err := test.createStatic(context.TODO(), caCert, caKey, node.Name, []string{"10.0.0.1"}, opts...)
+			require.NoError(t, err)
+			certConfig, err := crypto.GetTLSCertificateConfigFromBytes(certPEM.Bytes(), keyPEM.Bytes())
+			require.NoError(t, err)
+			staticSubject := certConfig.Certs[0].Subject
+
+			certSecret, err := test.createRotated(node, nil, corev1listers.NewSecretLister(cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{})),
+				fake.NewSimpleClientset().CoreV1(), events.NewInMemoryRecorder(t.Name()), opts...)
+			require.NoError(t, err)
+			secret, err := certSecret.EnsureTargetCertKeyPair(context.TODO(), signer, signer.Config.Certs)
+			require.NoError(t, err)
+			rotatedSubject := parseSecretCert(t, secret).Subject
+
+			require.Equal(t, test.expectedCN, staticSubject.CommonName)
+			require.Equal(t, staticSubject.CommonName, rotatedSubject.CommonName)
+			require.Equal(t, staticSubject.Organization, rotatedSubject.Organization)
+			require.Equal(t, staticSubject.CommonName, parseSecretCert(t, test.rendered).Subject.CommonName)
+			require.NoError(t, test.validateOrg(secret.Data[corev1.TLSCertKey]))
+		})
+	}
+}
+
+func TestPeerCertCommonName(t *testing.T) {
+	signer := newTestSigner(t, "etcd-signer")
+	caCert, caKey, err := signer.Config.GetPEMBytes()
+	require.NoError(t, err)
+	secretLister := corev1listers.NewSecretLister(cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{}))
+	fakeKubeClient := fake.NewSimpleClientset()
+
+	for _, nodeName := range []string{"master-0", "master-1"} {
+		node := u.FakeNode(nodeName, u.WithMasterLabel(), u.WithNodeInternalIP("10.0.0.1"))
+		certSecret, err := CreatePeerCertificate(node, nil, secretLister, fakeKubeClient.CoreV1(), events.NewInMemoryRecorder(t.Name()))
+		require.NoError(t, err)
+		secret, err := certSecret.EnsureTargetCertKeyPair(context.TODO(), signer, signer.Config.Certs)
+		require.NoError(t, err)
+		require.Equal(t, PeerCertCommonName(nodeName), parseSecretCert(t, secret).Subject.CommonName)
+
+		certPEM, keyPEM, err := CreatePeerCertKeyWithContext(context.TODO(), caCert, caKey, nodeName, []string{"10.0.0.1"})
+		require.NoError(t, err)
+		certConfig, err := crypto.GetTLSCertificateConfigFromBytes(certPEM.Bytes(), keyPEM.Bytes())
+		require.NoError(t, err)
+		require.Equal(t, PeerCertCommonName(nodeName), certConfig.Certs[0].Subject.CommonName)
+	}
+	require.NotEqual(t, PeerCertCommonName("master-0"), PeerCertCommonName("master-1"))
+}
+
+func TestExtraOrganizations(t *testing.T) {
+	signer := newTestSigner(t, "etcd-signer")
+	caCert, caKey, err := signer.Config.GetPEMBytes()
+	require.NoError(t, err)
+
+	tests := map[string]struct {
+		create       func(context.Context, []byte, []byte, string, []string, ...CertOption) (*bytes.Buffer, *bytes.Buffer, error)
+		extraOrgs    []string
+		expectedCN   string
+		expectedOrgs []string
+		expectedErr  string
+	}{
+		"peer with extra orgs": {
+			create:       CreatePeerCertKeyWithContext,
+			extraOrgs:    []string{"example:etcd-admins", "example:auditors"},
+			expectedCN:   "system:etcd-peer:master-0",
+			expectedOrgs: []string{"system:etcd-peers", "example:etcd-admins", "example:auditors"},
+		},
+		"server with extra org": {
+			create:       CreateServerCertKeyWithContext,
+			extraOrgs:    []string{"example:etcd-admins"},
+			expectedCN:   "system:etcd-server:master-0",
+			expectedOrgs: []string{"system:etcd-servers", "example:etcd-admins"},
+		},
+		"primary org and duplicates are not repeated": {
+			create:       CreateMetricCertKeyWithContext,
+			extraOrgs:    []string{"system:etcd-metrics", "example:etcd-admins", "example:etcd-admins"},
+			expectedCN:   "system:etcd-metric:master-0",
+			expectedOrgs: []string{"system:etcd-metrics", "example:etcd-admins"},
+		},
+		"empty org": {
+			create:      CreatePeerCertKeyWithContext,
+			extraOrgs:   []string{" "},
+			expectedErr: "extra organizations must not be empty",
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			certPEM, keyPEM, err := test.create(context.TODO(), caCert, caKey, "master-0", []string{"10.0.0.1"}, WithExtraOrganizations(test.extraOrgs))
+			if len(test.expectedErr) > 0 {
+				require.EqualError(t, err, test.expectedErr)
+				return
+			}
+			require.NoError(t, err)
+			certConfig, err := crypto.GetTLSCertificateConfigFromBytes(certPEM.Bytes(), keyPEM.Bytes())
+			require.NoError(t, err)
+			require.Equal(t, test.expectedCN, certConfig.Certs[0].Subject.CommonName)
+			// the organizations are a DER set in the encoded subject, which does not keep their order
+			require.ElementsMatch(t, test.expectedOrgs, certConfig.Certs[0].Subject.Organization)
+		})
+	}
+}
+
+func TestJiraComponentAndDescriptionOverride(t *testing.T) {
+	node := u.FakeNode("master-0", u.WithMasterLabel(), u.WithNodeInternalIP("10.0.0.1"))
+	signer := newTestSigner(t, "etcd-signer")
+
+	tests := map[string]struct {
+		opts              []CertOption
+		expectedComponent string
+		expectedPrefix    string
+	}{
+		"defaults": {
+			expectedComponent: EtcdJiraComponentName,
+		},
+		"overridden": {
+			opts: []CertOption{WithJiraComponent("acme-etcd"), WithDescriptionFunc(func(description string) string {
+				return "acme: " + description
+			})},
+			expectedComponent: "acme-etcd",
+			expectedPrefix:    "acme: ",
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			fakeKubeClient := fake.NewSimpleClientset()
+			secretLister := corev1listers.NewSecretLister(cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{}))
+			cmLister := corev1listers.NewConfigMapLister(cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{}))
+			recorder := events.NewInMemoryRecorder(t.Name())
+
+			signerCert := CreateSignerCert(nil, secretLister, fakeKubeClient.CoreV1(), recorder, test.opts...)
+			metricsSignerCert := CreateMetricsSignerCert(nil, secretLister, fakeKubeClient.CoreV1(), recorder, test.opts...)
+			signerBundle := CreateSignerCertRotationBundleConfigMap(nil, cmLister, fakeKubeClient.CoreV1(), recorder, test.opts...)
+			metricsSignerBundle := CreateMetricsSignerCertRotationBundleConfigMap(nil, cmLister, fakeKubeClient.CoreV1(), recorder, test.opts...)
+			clientCert := CreateEtcdClientCert(nil, secretLister, fakeKubeClient.CoreV1(), recorder, test.opts...)
+			metricsClientCert := CreateMetricsClientCert(nil, secretLister, fakeKubeClient.CoreV1(), recorder, test.opts...)
+			peerCert, err := CreatePeerCertificate(node, nil, secretLister, fakeKubeClient.CoreV1(), recorder, test.opts...)
+			require.NoError(t, err)
+			backupCert, err := CreateBackupDestinationCert("backup.example.com", nil, secretLister, fakeKubeClient.CoreV1(), recorder, test.opts...)
+			require.NoError(t, err)
+
+			for _, actual := range []struct{ component, description, defaultDescription string }{
+				{signerCert.JiraComponent, signerCert.Description, "etcd signer certificate authorities"},
+				{metricsSignerCert.JiraComponent, metricsSignerCert.Description, "etcd metrics signer certificate authorities"},
+				{signerBundle.JiraComponent, signerBundle.Description, "bundle for etcd signer certificate authorities"},
+				{metricsSignerBundle.JiraComponent, metricsSignerBundle.Description, "bundle for etcd metrics signer certificate authorities"},
+				{clientCert.JiraComponent, clientCert.Description, "etcd client certificate"},
+				{metricsClientCert.JiraComponent, metricsClientCert.Description, "etcd metrics client certificate"},
+				{peerCert.JiraComponent, peerCert.Description, "Peer Cert for node master-0"},
+				{backupCert.JiraComponent, backupCert.Description, "serving certificate of the backup destination backup.example.com"},
+			} {
+				require.Equal(t, test.expectedComponent, actual.component)
+				require.Equal(t, test.expectedPrefix+actual.defaultDescription, actual.description)
+			}
+
+			// the override also ends up in the objects written by library-go
+			_, err = signerBundle.EnsureConfigMapCABundle(context.TODO(), signer)
+			require.NoError(t, err)
+			configMap, err := fakeKubeClient.CoreV1().ConfigMaps(operatorclient.TargetNamespace).Get(context.TODO(), EtcdSignerCaBundleConfigMapName, metav1.GetOptions{})
+			require.NoError(t, err)
+			require.Equal(t, test.expectedComponent, configMap.Annotations[annotations.OpenShiftComponent])
+			require.Equal(t, test.expectedPrefix+"bundle for etcd signer certificate authorities", configMap.Annotations[annotations.OpenShiftDescription])
+
+			nodeCerts, err := CreateAllNodeCerts(node, signer, test.opts...)
+			require.NoError(t, err)
+			require.Equal(t, test.expectedComponent, nodeCerts.Serving.Annotations[annotations.OpenShiftComponent])
+			require.Equal(t, test.expectedPrefix+"Serving Cert for node master-0", nodeCerts.Serving.Annotations[annotations.OpenShiftDescription])
+		})
+	}
+}
+
+func TestNodeCertRefresh(t *testing.T) {
+	// certrotation refreshes at 80% of the validity at the latest
+	latest := etcdCertValidity / 5 * 4
+	require.Less(t, int64(latest), int64(refreshAfter(etcdCertValidity, etcdCertRefreshFraction)))
+
+	refreshes := map[time.Duration]string{}
+	for i := 0; i < 20; i++ {
+		nodeName := fmt.Sprintf("master-%d", i)
+		refresh := nodeCertRefresh(nodeName, etcdCertValidity)
+		require.LessOrEqual(t, int64(refresh), int64(latest), "refresh of %s must not be later than certrotation's", nodeName)
+		require.Greater(t, int64(refresh), int64(latest-nodeCertRefreshJitter(etcdCertValidity)), "refresh of %s must be bounded", nodeName)
+		require.Equal(t, refresh, nodeCertRefresh(nodeName, etcdCertValidity), "refresh of %s must be deterministic", nodeName)
+		require.NotContains(t, refreshes, refresh, "%s is refreshed at the same time as %s", nodeName, refreshes[refresh])
+		refreshes[refresh] = nodeName
+	}
+
+	node := u.FakeNode("master-0", u.WithMasterLabel(), u.WithNodeInternalIP("10.0.0.1"))
+	fakeKubeClient := fake.NewSimpleClientset()
+	secretLister := corev1listers.NewSecretLister(cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{}))
+	for _, create := range []func(*corev1.Node, corev1informers.SecretInformer, corev1listers.SecretLister, corev1client.SecretsGetter, events.Recorder, ...CertOption) (*certrotation.RotatedSelfSignedCertKeySecret, error){
+		CreatePeerCertificate, CreateServingCertificate, CreateMetricsServingCertificate,
+	} {
+		certSecret, err := create(node, nil, secretLister, fakeKubeClient.CoreV1(), events.NewInMemoryRecorder(t.Name()))
+		require.NoError(t, err)
+		require.Equal(t, nodeCertRefresh("master-0", etcdCertValidity), certSecret.Refresh)
+		require.Equal(t, etcdCertValidity, certSecret.Validity)
+		require.Equal(t, nodeCertRefresh("master-0", etcdCertValidity), refreshFor(certSecret.Name, etcdCertValidity), "expiry of %s must be reported with the jittered refresh", certSecret.Name)
+	}
+	require.Equal(t, refreshAfter(etcdCertValidity, etcdCertRefreshFraction), refreshFor(EtcdClientCertSecretName, etcdCertValidity))
+
+	// validities too short for a jitter of a whole second must not break the refresh
+	for _, validity := range []time.Duration{9 * time.Second, 5 * time.Second, time.Second, time.Nanosecond} {
+		refresh := nodeCertRefresh("master-0", validity)
+		require.LessOrEqual(t, int64(refresh), int64(validity/5*4), "refresh of a %s validity", validity)
+		require.GreaterOrEqual(t, int64(refresh), int64(0), "refresh of a %s validity", validity)
+	}
+	require.Equal(t, nodeCertRefresh("master-0", time.Nanosecond), nodeCertRefresh("master-1", time.Nanosecond))
+	// the jitter is not rounded away like the refresh
+	require.Equal(t, 250*time.Millisecond, nodeCertRefreshJitter(5*time.Second))
+	require.NotEqual(t, nodeCertRefresh("master-0", 5*time.Second), nodeCertRefresh("master-1", 5*time.Second))
+	certSecret, err := CreatePeerCertificate(node, nil, secretLister, fakeKubeClient.CoreV1(), events.NewInMemoryRecorder(t.Name()), WithValidity(5*time.Second))
+	require.NoError(t, err)
+	require.LessOrEqual(t, int64(certSecret.Refresh), int64(4*time.Second))
+}
+
+func TestRefreshScalesWithValidity(t *testing.T) {
+	// the default fractions keep the refreshes of 2.5 and 4.5 years
+	require.Equal(t, time.Duration(2.5*365*24*time.Hour), refreshAfter(etcdCertValidity, etcdCertRefreshFraction))
+	require.Equal(t, time.Duration(4.5*365*24*time.Hour), refreshAfter(etcdCaCertValidity, etcdCaCertRefreshFraction))
+
+	node := u.FakeNode("master-0", u.WithMasterLabel(), u.WithNodeInternalIP("10.0.0.1"))
+	fakeKubeClient := fake.NewSimpleClientset()
+	secretLister := corev1listers.NewSecretLister(cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{}))
+	recorder := events.NewInMemoryRecorder(t.Name())
+
+	tests := map[string]struct {
+		opts                   []CertOption
+		expectedValidity       time.Duration
+		expectedRefresh        time.Duration
+		expectedSignerValidity time.Duration
+		expectedSignerRefresh  time.Duration
+	}{
+		"defaults": {
+			expectedValidity:       etcdCertValidity,
+			expectedRefresh:        time.Duration(2.5 * 365 * 24 * time.Hour),
+			expectedSignerValidity: etcdCaCertValidity,
+			expectedSignerRefresh:  time.Duration(4.5 * 365 * 24 * time.Hour),
+		},
+		"one year certs": {
+			opts:                   []CertOption{WithValidity(365 * 24 * time.Hour)},
+			expectedValidity:       365 * 24 * time.Hour,
+			expectedRefresh:        time.Duration(2.5 / 3 * 365 * 24 * time.Hour),
+			expectedSignerValidity: etcdCaCertValidity,
+			expectedSignerRefresh:  time.Duration(4.5 * 365 * 24 * time.Hour),
+		},
+		"twelve month certs from ten month signers": {
+			opts:                   []CertOption{WithValidity(12 * 30 * 24 * time.Hour), WithSignerValidity(10 * 30 * 24 * time.Hour)},
+			expectedValidity:       12 * 30 * 24 * time.Hour,
+			expectedRefresh:        10 * 30 * 24 * time.Hour,
+			expectedSignerValidity: 10 * 30 * 24 * time.Hour,
+			expectedSignerRefresh:  9 * 30 * 24 * time.Hour,
+		},
+		"non-positive validity is ignored": {
+			opts:                   []CertOption{WithValidity(0), WithSignerValidity(-time.Hour)},
+			expectedValidity:       etcdCertValidity,
+			expectedRefresh:        time.Duration(2.5 * 365 * 24 * time.Hour),
+			expectedSignerValidity: etcdCaCertValidity,
+			expectedSignerRefresh:  time.Duration(4.5 * 365 * 24 * time.Hour),
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			for _, certSecret := range []certrotation.RotatedSelfSignedCertKeySecret{
+				CreateEtcdClientCert(nil, secretLister, fakeKubeClient.CoreV1(), recorder, test.opts...),
+				CreateMetricsClientCert(nil, secretLister, fakeKubeClient.CoreV1(), recorder, test.opts...),
+			} {
+				require.Equal(t, test.expectedValidity, certSecret.Validity, certSecret.Name)
+				require.Equal(t, test.expectedRefresh, certSecret.Refresh, certSecret.Name)
+			}
+			for _, signerSecret := range []certrotation.RotatedSigningCASecret{
+				CreateSignerCert(nil, secretLister, fakeKubeClient.CoreV1(), recorder, test.opts...),
+				CreateMetricsSignerCert(nil, secretLister, fakeKubeClient.CoreV1(), recorder, test.opts...),
+			} {
+				require.Equal(t, test.expectedSignerValidity, signerSecret.Validity, signerSecret.Name)
+				require.Equal(t, test.expectedSignerRefresh, signerSecret.Refresh, signerSecret.Name)
+			}
+
+			// node certs keep refreshing at 80% of their validity at the latest, minus a jitter proportional to it
+			certSecret, err := CreatePeerCertificate(node, nil, secretLister, fakeKubeClient.CoreV1(), recorder, test.opts...)
+			require.NoError(t, err)
+			require.Equal(t, test.expectedValidity, certSecret.Validity)
+			require.LessOrEqual(t, int64(certSecret.Refresh), int64(test.expectedValidity/5*4))
+			require.Greater(t, int64(certSecret.Refresh), int64(test.expectedValidity/5*4-test.expectedValidity/20))
+		})
+	}
+}
+
+func TestClientCertValidity(t *testing.T) {
+	node := u.FakeNode("master-0", u.WithMasterLabel(), u.WithNodeInternalIP("10.0.0.1"))
+	// the issued certs are capped at the validity of the signer
+	signerConfig, err := crypto.MakeSelfSignedCAConfigForDuration("etcd-signer", 10*365*24*time.Hour)
+	require.NoError(t, err)
+	signer := &crypto.CA{Config: signerConfig, SerialGenerator: &crypto.RandomSerialGenerator{}}
+	fakeKubeClient := fake.NewSimpleClientset()
+	secretLister := corev1listers.NewSecretLister(cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{}))
+	recorder := events.NewInMemoryRecorder(t.Name())
+
+	tests := map[string]struct {
+		opts                   []CertOption
+		expectedClientValidity time.Duration
+		expectedClientRefresh  time.Duration
+		expectedNodeValidity   time.Duration
+	}{
+		"defaults": {
+			expectedClientValidity: etcdCertValidity,
+			expectedClientRefresh:  time.Duration(2.5 * 365 * 24 * time.Hour),
+			expectedNodeValidity:   etcdCertValidity,
+		},
+		"short lived client certs": {
+			opts:                   []CertOption{WithClientCertValidity(90 * 24 * time.Hour)},
+			expectedClientValidity: 90 * 24 * time.Hour,
+			expectedClientRefresh:  75 * 24 * time.Hour,
+			expectedNodeValidity:   etcdCertValidity,
+		},
+		"client certs follow the leaf validity by default": {
+			opts:                   []CertOption{WithValidity(12 * 30 * 24 * time.Hour)},
+			expectedClientValidity: 12 * 30 * 24 * time.Hour,
+			expectedClientRefresh:  10 * 30 * 24 * time.Hour,
+			expectedNodeValidity:   12 * 30 * 24 * time.Hour,
+		},
+		"both overridden": {
+			opts:                   []CertOption{WithValidity(12 * 30 * 24 * time.Hour), WithClientCertValidity(30 * 24 * time.Hour)},
+			expectedClientValidity: 30 * 24 * time.Hour,
+			expectedClientRefresh:  25 * 24 * time.Hour,
+			expectedNodeValidity:   12 * 30 * 24 * time.Hour,
+		},
+		"non-positive validity is ignored": {
+			opts:                   []CertOption{WithClientCertValidity(-time.Hour)},
+			expectedClientValidity: etcdCertValidity,
+			expectedClientRefresh:  time.Duration(2.5 * 365 * 24 * time.Hour),
+			expectedNodeValidity:   etcdCertValidity,
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			for _, certSecret := range []certrotation.RotatedSelfSignedCertKeySecret{
+				CreateEtcdClientCert(nil, secretLister, fakeKubeClient.CoreV1(), recorder, test.opts...),
+				CreateMetricsClientCert(nil, secretLister, fakeKubeClient.CoreV1(), recorder, test.opts...),
+			} {
+				require.Equal(t, test.expectedClientValidity, certSecret.Validity, certSecret.Name)
+				require.Equal(t, test.expectedClientRefresh, certSecret.Refresh, certSecret.Name)
+				require.Less(t, int64(certSecret.Refresh), int64(certSecret.Validity), certSecret.Name)
+			}
+
+			servingCert, err := CreateServingCertificate(node, nil, secretLister, fakeKubeClient.CoreV1(), recorder, test.opts...)
+			require.NoError(t, err)
+			require.Equal(t, test.expectedNodeValidity, servingCert.Validity)
+
+			// the issued certs carry the respective validity
+			clientCert := CreateEtcdClientCert(nil, secretLister, fakeKubeClient.CoreV1(), recorder, test.opts...)
+			secret, err := clientCert.EnsureTargetCertKeyPair(context.TODO(), signer, signer.Config.Certs)
+			require.NoError(t, err)
+			// library-go backdates the certs by a second
+			require.Equal(t, test.expectedClientValidity, certValidity(parseSecretCert(t, secret)).Round(time.Minute))
+
+			pki, err := NewTestPKI([]TestPKINode{{Name: "master-0", InternalIPs: []string{"10.0.0.1"}}}, test.opts...)
+			require.NoError(t, err)
+			for _, certKey := range []CertKeyPEM{pki.Client, pki.MetricsClient} {
+				certs, err := crypto.CertsFromPEM(certKey.Cert)
+				require.NoError(t, err)
+				require.Equal(t, test.expectedClientValidity, certValidity(certs[0]).Round(time.Minute))
+			}
+		})
+	}
+}
+
+func TestValidityCappedAtSigner(t *testing.T) {
+	// the test signer expires long before the default validity of the leaf certs
+	signer := newTestSigner(t, "etcd-signer")
+	signerNotAfter := signer.Config.Certs[0].NotAfter
+	caCert, caKey, err := signer.Config.GetPEMBytes()
+	require.NoError(t, err)
+	node := u.FakeNode("master-0", u.WithMasterLabel(), u.WithNodeInternalIP("10.0.0.1"))
+
+	for name, opts := range map[string][]CertOption{
+		"default validity":    nil,
+		"overridden validity": {WithValidity(10 * 365 * 24 * time.Hour)},
+	} {
+		t.Run(name, func(t *testing.T) {
+			// issued from a static CA
+			for _, create := range []func(context.Context, []byte, []byte, string, []string, ...CertOption) (*bytes.Buffer, *bytes.Buffer, error){
+				CreatePeerCertKeyWithContext, CreateServerCertKeyWithContext, CreateMetricCertKeyWithContext,
+			} {
+				certPEM, keyPEM, err := create(context.TODO(), caCert, caKey, "master-0", []string{"10.0.0.1"}, opts...)
+				require.NoError(t, err)
+				certConfig, err := crypto.GetTLSCertificateConfigFromBytes(certPEM.Bytes(), keyPEM.Bytes())
+				require.NoError(t, err)
+				require.False(t, certConfig.Certs[0].NotAfter.After(signerNotAfter), "static cert valid past its signer")
+				require.NoError(t, VerifyCertAgainstBundle(certPEM.Bytes(), caCert))
+			}
+
+			// rotated by the operator
+			certSecret, err := CreatePeerCertificate(node, nil, corev1listers.NewSecretLister(cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{})),
+				fake.NewSimpleClientset().CoreV1(), events.NewInMemoryRecorder(t.Name()), opts...)
+			require.NoError(t, err)
+			secret, err := certSecret.EnsureTargetCertKeyPair(context.TODO(), signer, signer.Config.Certs)
+			require.NoError(t, err)
+			require.False(t, parseSecretCert(t, secret).NotAfter.After(signerNotAfter), "rotated cert valid past its signer")
+
+			// rendered for tooling
+			bundle, err := CreateAllNodeCerts(node, signer, opts...)
+			require.NoError(t, err)
+			require.False(t, parseSecretCert(t, bundle.Peer).NotAfter.After(signerNotAfter), "rendered cert valid past its signer")
+		})
+	}
+}
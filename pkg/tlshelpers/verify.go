@@ -0,0 +1,468 @@
+package tlshelpers
+
+import (
+	"context"
+	gocrypto "crypto"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/openshift/api/annotations"
+	"github.com/openshift/library-go/pkg/crypto"
+	"github.com/openshift/library-go/pkg/operator/certrotation"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/sets"
+	corev1client "k8s.io/client-go/kubernetes/typed/core/v1"
+	"k8s.io/client-go/util/keyutil"
+	"k8s.io/klog/v2"
+
+	"github.com/openshift/cluster-etcd-operator/pkg/operator/operatorclient"
+)
+
+// CertsMissingSAN returns the names of all per-node secrets whose certificate does not contain the requiredSAN,
+// either as DNS name or as IP address. Only those certs need to be rotated when a new SAN is added.
+// Secrets that do not exist yet are skipped, they will be created with the SAN in place.
+func CertsMissingSAN(ctx context.Context, secretClient corev1client.SecretsGetter, requiredSAN string, nodeNames []string) ([]string, error) {
+	var missing []string
+	for _, nodeName := range nodeNames {
+		for _, secretName := range nodeSecretNames(nodeName) {
+			secret, err := secretClient.Secrets(operatorclient.TargetNamespace).Get(ctx, secretName, metav1.GetOptions{})
+			if err != nil {
+				if apierrors.IsNotFound(err) {
+					continue
+				}
+				return nil, fmt.Errorf("error getting %s/%s: %w", operatorclient.TargetNamespace, secretName, err)
+			}
+
+			cert, err := certFromSecret(secret)
+			if err != nil {
+				return nil, err
+			}
+			if !certHasSAN(cert, requiredSAN) {
+				missing = append(missing, secretName)
+			}
+		}
+	}
+	return missing, nil
+}
+
+// nodeSecretNames returns the names of all cert secrets that are maintained for the given node.
+func nodeSecretNames(nodeName string) []string {
+	return []string{
+		GetPeerClientSecretNameForNode(nodeName),
+		GetServingSecretNameForNode(nodeName),
+		GetServingMetricsSecretNameForNode(nodeName),
+	}
+}
+
+// managedSecret describes a cert secret in the target namespace that is maintained by the operator.
+type managedSecret struct {
+	name     string
+	certType certrotation.CertificateType
+}
+
+// managedSecrets returns all cert secrets the operator maintains in the target namespace for the given nodes.
+func managedSecrets(nodeNames []string) []managedSecret {
+	secrets := []managedSecret{
+		{name: EtcdSignerCertSecretName, certType: certrotation.CertificateTypeSigner},
+		{name: EtcdMetricsSignerCertSecretName, certType: certrotation.CertificateTypeSigner},
+		{name: EtcdClientCertSecretName, certType: certrotation.CertificateTypeTarget},
+		{name: EtcdMetricsClientCertSecretName, certType: certrotation.CertificateTypeTarget},
+	}
+	for _, nodeName := range nodeNames {
+		for _, secretName := range nodeSecretNames(nodeName) {
+			secrets = append(secrets, managedSecret{name: secretName, certType: certrotation.CertificateTypeTarget})
+		}
+	}
+	return secrets
+}
+
+// VerifyManagedSecretOwnership checks that all secrets the operator is expected to manage exist and carry the etcd
+// JiraComponent annotation, or the one set by WithJiraComponent, and the managed certificate type label. It returns the
+// names of all secrets that are missing or look like they are managed by something else.
+func VerifyManagedSecretOwnership(ctx context.Context, secretClient corev1client.SecretsGetter, nodeNames []string, opts ...CertOption) ([]string, error) {
+	jiraComponent := newCertOptions(opts...).jiraComponentName()
+	var unowned []string
+	for _, expected := range managedSecrets(nodeNames) {
+		secret, err := secretClient.Secrets(operatorclient.TargetNamespace).Get(ctx, expected.name, metav1.GetOptions{})
+		if err != nil {
+			if apierrors.IsNotFound(err) {
+				klog.Warningf("managed secret %s/%s is missing", operatorclient.TargetNamespace, expected.name)
+				unowned = append(unowned, expected.name)
+				continue
+			}
+			return nil, fmt.Errorf("error getting %s/%s: %w", operatorclient.TargetNamespace, expected.name, err)
+		}
+
+		if component := secret.Annotations[annotations.OpenShiftComponent]; component != jiraComponent {
+			klog.Warningf("managed secret %s/%s has unexpected %s annotation: %q", secret.Namespace, secret.Name, annotations.OpenShiftComponent, component)
+			unowned = append(unowned, expected.name)
+			continue
+		}
+		if certType := secret.Labels[certrotation.ManagedCertificateTypeLabelName]; certType != string(expected.certType) {
+			klog.Warningf("managed secret %s/%s has unexpected %s label: %q", secret.Namespace, secret.Name, certrotation.ManagedCertificateTypeLabelName, certType)
+			unowned = append(unowned, expected.name)
+		}
+	}
+	return unowned, nil
+}
+
+// DetectWeakSignatureCerts returns the names of all managed secrets for the given nodes whose cert is signed with a
+// deprecated signature algorithm (SHA-1 or MD5), e.g. after restoring a legacy backup. Those certs should be re-issued.
+// Managed secrets that do not exist are skipped.
+func DetectWeakSignatureCerts(ctx context.Context, secretClient corev1client.SecretsGetter, nodeNames []string) ([]string, error) {
+	var weak []string
+	for _, managed := range managedSecrets(nodeNames) {
+		secret, err := secretClient.Secrets(operatorclient.TargetNamespace).Get(ctx, managed.name, metav1.GetOptions{})
+		if err != nil {
+			if apierrors.IsNotFound(err) {
+				continue
+			}
+			return nil, fmt.Errorf("error getting %s/%s: %w", operatorclient.TargetNamespace, managed.name, err)
+		}
+
+		cert, err := certFromSecret(secret)
+		if err != nil {
+			return nil, err
+		}
+		if isWeakSignatureAlgorithm(cert.SignatureAlgorithm) {
+			klog.Warningf("managed secret %s/%s has a cert signed with the deprecated signature algorithm %s and should be re-issued", secret.Namespace, secret.Name, cert.SignatureAlgorithm)
+			weak = append(weak, managed.name)
+		}
+	}
+	return weak, nil
+}
+
+// ValidateCertKeyPair verifies that the private key in tls.key of the given secret belongs to the cert in tls.crt, e.g.
+// after a partial manual edit, and that the pair loads the same way the operator loads it for issuing and serving.
+func ValidateCertKeyPair(secret *corev1.Secret) error {
+	cert, err := certFromSecret(secret)
+	if err != nil {
+		return err
+	}
+	key, err := keyutil.ParsePrivateKeyPEM(secret.Data[corev1.TLSPrivateKeyKey])
+	if err != nil {
+		return fmt.Errorf("could not parse private key in secret %s/%s: %w", secret.Namespace, secret.Name, err)
+	}
+	signer, ok := key.(gocrypto.Signer)
+	if !ok {
+		return fmt.Errorf("unsupported private key type %T in secret %s/%s", key, secret.Namespace, secret.Name)
+	}
+	publicKey, ok := signer.Public().(interface{ Equal(gocrypto.PublicKey) bool })
+	if !ok || !publicKey.Equal(cert.PublicKey) {
+		return fmt.Errorf("private key in %s of secret %s/%s does not match the public key of the cert %q in %s",
+			corev1.TLSPrivateKeyKey, secret.Namespace, secret.Name, cert.Subject.CommonName, corev1.TLSCertKey)
+	}
+	if _, err := crypto.GetTLSCertificateConfigFromBytes(secret.Data[corev1.TLSCertKey], secret.Data[corev1.TLSPrivateKeyKey]); err != nil {
+		return fmt.Errorf("could not load the cert/key pair of secret %s/%s: %w", secret.Namespace, secret.Name, err)
+	}
+	return nil
+}
+
+// DetectMismatchedKeyPairs returns the names of all managed secrets for the given nodes whose private key does not
+// belong to their cert, see ValidateCertKeyPair. Managed secrets that do not exist are skipped.
+func DetectMismatchedKeyPairs(ctx context.Context, secretClient corev1client.SecretsGetter, nodeNames []string) ([]string, error) {
+	var mismatched []string
+	for _, managed := range managedSecrets(nodeNames) {
+		secret, err := secretClient.Secrets(operatorclient.TargetNamespace).Get(ctx, managed.name, metav1.GetOptions{})
+		if err != nil {
+			if apierrors.IsNotFound(err) {
+				continue
+			}
+			return nil, fmt.Errorf("error getting %s/%s: %w", operatorclient.TargetNamespace, managed.name, err)
+		}
+
+		if err := ValidateCertKeyPair(secret); err != nil {
+			klog.Warningf("managed secret %s/%s has an invalid cert/key pair: %v", secret.Namespace, secret.Name, err)
+			mismatched = append(mismatched, managed.name)
+		}
+	}
+	return mismatched, nil
+}
+
+func isWeakSignatureAlgorithm(algorithm x509.SignatureAlgorithm) bool {
+	switch algorithm {
+	case x509.MD2WithRSA, x509.MD5WithRSA, x509.SHA1WithRSA, x509.DSAWithSHA1, x509.ECDSAWithSHA1:
+		return true
+	default:
+		return false
+	}
+}
+
+// PeerCertHasBothAuths returns true if the peer cert stored in the given secret carries both the ClientAuth and
+// ServerAuth extended key usages. Peer connections are mutually authenticated, missing either breaks the mesh.
+func PeerCertHasBothAuths(secret *corev1.Secret) (bool, error) {
+	cert, err := certFromSecret(secret)
+	if err != nil {
+		return false, err
+	}
+	return hasExtKeyUsage(cert, x509.ExtKeyUsageClientAuth) && hasExtKeyUsage(cert, x509.ExtKeyUsageServerAuth), nil
+}
+
+// NotBeforeSkewTolerance is how far the notBefore of a cert may lie in the future before CertNotBeforeSkew reports it.
+// The certs issued by library-go are backdated by a second only, so small differences between the clocks of the
+// operator and the etcd members are expected and must not raise warnings.
+const NotBeforeSkewTolerance = time.Minute
+
+// CertNotBeforeSkew returns how far the notBefore of the cert in the tls.crt key of the given secret lies in the future
+// of now, and whether that is beyond NotBeforeSkewTolerance. A freshly issued cert with a notBefore in the future
+// points at a clock skew between the issuing operator and now, e.g. an install with a bad RTC. Peers and clients
+// reject such a cert until their clock catches up, so controllers should warn about the skew rather than silently
+// serving the not yet valid cert.
+func CertNotBeforeSkew(secret *corev1.Secret, now time.Time) (time.Duration, bool, error) {
+	cert, err := certFromSecret(secret)
+	if err != nil {
+		return 0, false, err
+	}
+	skew := cert.NotBefore.Sub(now)
+	if skew <= 0 {
+		return 0, false, nil
+	}
+	return skew, skew > NotBeforeSkewTolerance, nil
+}
+
+// RequireClientAndServerAuth returns an error naming the missing extended key usages unless the first cert in the
+// given PEM carries both ClientAuth and ServerAuth. Every etcd member is client and server of its peers at the same
+// time, so all peer, serving and metrics certs need both, unless the metrics certs are issued with
+// WithMetricsServerAuthOnly.
+func RequireClientAndServerAuth(certPEM []byte) error {
+	certs, err := crypto.CertsFromPEM(certPEM)
+	if err != nil {
+		return fmt.Errorf("could not parse certificate: %w", err)
+	}
+	cert := certs[0]
+
+	var missing []string
+	if !hasExtKeyUsage(cert, x509.ExtKeyUsageClientAuth) {
+		missing = append(missing, "ClientAuth")
+	}
+	if !hasExtKeyUsage(cert, x509.ExtKeyUsageServerAuth) {
+		missing = append(missing, "ServerAuth")
+	}
+	if len(missing) > 0 {
+		return fmt.Errorf("cert %q lacks the extended key usages %s required by etcd", cert.Subject.CommonName, strings.Join(missing, ","))
+	}
+	return nil
+}
+
+// requireServerAuth is RequireClientAndServerAuth of the metrics certs issued with WithMetricsServerAuthOnly, which
+// only need ServerAuth.
+func requireServerAuth(certPEM []byte) error {
+	certs, err := crypto.CertsFromPEM(certPEM)
+	if err != nil {
+		return fmt.Errorf("could not parse certificate: %w", err)
+	}
+	if !hasExtKeyUsage(certs[0], x509.ExtKeyUsageServerAuth) {
+		return fmt.Errorf("cert %q lacks the extended key usages ServerAuth required by etcd", certs[0].Subject.CommonName)
+	}
+	return nil
+}
+
+// ValidatePeerCertOrg returns an error unless the first cert in the given PEM is a peer cert, i.e. its subject carries
+// the system:etcd-peers organization and a system:etcd-peer: CommonName, the way CreatePeerCertKeyWithContext and
+// CreatePeerCertificate issue it. It detects e.g. a serving cert misplaced into a peer secret, which makes the peer
+// authentication fail cryptically. Peer certs rotated before they carried the node identity have no organization and
+// are rejected until their next rotation.
+func ValidatePeerCertOrg(certPEM []byte) error {
+	return validateCertOrg(certPEM, peerOrg)
+}
+
+// ValidateServerCertOrg is the ValidatePeerCertOrg of the serving certs issued by CreateServerCertKeyWithContext and
+// CreateServingCertificate.
+func ValidateServerCertOrg(certPEM []byte) error {
+	return validateCertOrg(certPEM, serverOrg)
+}
+
+// ValidateMetricCertOrg is the ValidatePeerCertOrg of the metrics certs issued by CreateMetricCertKeyWithContext and
+// CreateMetricsServingCertificate.
+func ValidateMetricCertOrg(certPEM []byte) error {
+	return validateCertOrg(certPEM, metricOrg)
+}
+
+// ValidateServingMetricsSecretOrg runs ValidateMetricCertOrg against the cert of the given etcd-serving-metrics-<node>
+// secret. It detects e.g. a metrics secret that was populated with a regular serving cert by a copy/paste mistake,
+// which makes Prometheus fail to authenticate against the metrics endpoint of the node.
+func ValidateServingMetricsSecretOrg(secret *corev1.Secret) error {
+	if secret == nil {
+		return fmt.Errorf("serving metrics secret must not be nil")
+	}
+	certType, nodeName, ok := nodeCertFromSecretName(secret.Name)
+	if !ok || certType != ServingMetricsNodeCertType {
+		return fmt.Errorf("secret %s/%s is not a serving metrics secret, expected a name like %s", secret.Namespace, secret.Name, GetServingMetricsSecretNameForNode("<node>"))
+	}
+	if err := ValidateMetricCertOrg(secret.Data[corev1.TLSCertKey]); err != nil {
+		return fmt.Errorf("serving metrics secret %s/%s of node %s: %w", secret.Namespace, secret.Name, nodeName, err)
+	}
+	return nil
+}
+
+func validateCertOrg(certPEM []byte, org string) error {
+	certs, err := crypto.CertsFromPEM(certPEM)
+	if err != nil {
+		return fmt.Errorf("could not parse certificate: %w", err)
+	}
+	cert := certs[0]
+
+	if !sets.NewString(cert.Subject.Organization...).Has(org) {
+		return fmt.Errorf("cert %q is not issued for the organization %s, got %v", cert.Subject.CommonName, org, cert.Subject.Organization)
+	}
+	if prefix := commonNamePrefix(org); !strings.HasPrefix(cert.Subject.CommonName, prefix) {
+		return fmt.Errorf("cert %q of the organization %s lacks the common name prefix %s", cert.Subject.CommonName, org, prefix)
+	}
+	return nil
+}
+
+func hasExtKeyUsage(cert *x509.Certificate, usage x509.ExtKeyUsage) bool {
+	return containsExtKeyUsage(cert.ExtKeyUsage, usage)
+}
+
+func containsExtKeyUsage(usages []x509.ExtKeyUsage, usage x509.ExtKeyUsage) bool {
+	for _, u := range usages {
+		if u == usage {
+			return true
+		}
+	}
+	return false
+}
+
+// certFromSecret parses the leaf certificate stored in the tls.crt key of the given secret.
+func certFromSecret(secret *corev1.Secret) (*x509.Certificate, error) {
+	certs, err := crypto.CertsFromPEM(secret.Data[corev1.TLSCertKey])
+	if err != nil {
+		return nil, fmt.Errorf("could not parse certificate in secret %s/%s: %w", secret.Namespace, secret.Name, err)
+	}
+	return certs[0], nil
+}
+
+func certHasSAN(cert *x509.Certificate, san string) bool {
+	if ip := net.ParseIP(san); ip != nil {
+		for _, certIP := range cert.IPAddresses {
+			if certIP.Equal(ip) {
+				return true
+			}
+		}
+		return false
+	}
+
+	for _, dnsName := range cert.DNSNames {
+		if dnsName == san {
+			return true
+		}
+	}
+	return false
+}
+
+// CertVerificationReason classifies why a cert failed verification against a CA bundle.
+type CertVerificationReason string
+
+const (
+	CertVerificationExpired          CertVerificationReason = "Expired"
+	CertVerificationUnknownAuthority CertVerificationReason = "UnknownAuthority"
+	CertVerificationHostnameMismatch CertVerificationReason = "HostnameMismatch"
+	CertVerificationInvalid          CertVerificationReason = "Invalid"
+)
+
+// CertVerificationError is returned by VerifyCertAgainstBundle when the cert is not accepted by the bundle.
+type CertVerificationError struct {
+	Reason CertVerificationReason
+	Err    error
+}
+
+func (e *CertVerificationError) Error() string {
+	return fmt.Sprintf("cert verification failed (%s): %v", e.Reason, e.Err)
+}
+
+func (e *CertVerificationError) Unwrap() error {
+	return e.Err
+}
+
+// VerifyCertAgainstBundle verifies that the leaf cert in certPEM chains to one of the CAs in caBundlePEM and is
+// usable for both client and server auth, like the certs issued by createCertForNode. A *CertVerificationError
+// tells apart expired certs, certs of an unknown authority, e.g. signed by a CA rotated out of the bundle, and
+// otherwise invalid certs.
+func VerifyCertAgainstBundle(certPEM []byte, caBundlePEM []byte) error {
+	return VerifyCertAgainstBundleForHost(certPEM, caBundlePEM, "")
+}
+
+// VerifyCertAgainstBundleForHost is VerifyCertAgainstBundle that additionally verifies the cert is valid for the given
+// hostname or IP, unless it is empty.
+func VerifyCertAgainstBundleForHost(certPEM []byte, caBundlePEM []byte, hostname string) error {
+	certs, err := crypto.CertsFromPEM(certPEM)
+	if err != nil {
+		return fmt.Errorf("could not parse cert: %w", err)
+	}
+	caPool := x509.NewCertPool()
+	if !caPool.AppendCertsFromPEM(caBundlePEM) {
+		return fmt.Errorf("could not load any CA from the bundle")
+	}
+	intermediates := x509.NewCertPool()
+	for _, intermediate := range certs[1:] {
+		intermediates.AddCert(intermediate)
+	}
+
+	// a chain is accepted if it allows any of the given usages, so verify each separately to require both
+	for _, usage := range []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth, x509.ExtKeyUsageServerAuth} {
+		_, err := certs[0].Verify(x509.VerifyOptions{
+			DNSName:       hostname,
+			Roots:         caPool,
+			Intermediates: intermediates,
+			KeyUsages:     []x509.ExtKeyUsage{usage},
+		})
+		if err != nil {
+			return &CertVerificationError{Reason: certVerificationReason(err), Err: err}
+		}
+	}
+	return nil
+}
+
+func certVerificationReason(err error) CertVerificationReason {
+	var invalidErr x509.CertificateInvalidError
+	var unknownAuthorityErr x509.UnknownAuthorityError
+	var hostnameErr x509.HostnameError
+	switch {
+	case errors.As(err, &invalidErr) && invalidErr.Reason == x509.Expired:
+		return CertVerificationExpired
+	case errors.As(err, &unknownAuthorityErr):
+		return CertVerificationUnknownAuthority
+	case errors.As(err, &hostnameErr):
+		return CertVerificationHostnameMismatch
+	default:
+		return CertVerificationInvalid
+	}
+}
+
+// CertFingerprint returns the hex encoded SHA-256 fingerprint of the DER encoded certificate.
+func CertFingerprint(cert *x509.Certificate) string {
+	sum := sha256.Sum256(cert.Raw)
+	return hex.EncodeToString(sum[:])
+}
+
+// SignerFingerprint returns the CertFingerprint of the first cert of the given PEM encoded signer, e.g. to record which
+// signer issued a leaf and cheaply detect leaves of an old signer without verifying the chain.
+func SignerFingerprint(caPEM []byte) (string, error) {
+	certs, err := crypto.CertsFromPEM(caPEM)
+	if err != nil {
+		return "", fmt.Errorf("could not parse the signer cert: %w", err)
+	}
+	return CertFingerprint(certs[0]), nil
+}
+
+// ReadSignerFingerprint returns the SignerFingerprint of the current etcd signer in openshift-etcd.
+func ReadSignerFingerprint(ctx context.Context, secretClient corev1client.SecretsGetter) (string, error) {
+	secret, err := secretClient.Secrets(operatorclient.TargetNamespace).Get(ctx, EtcdSignerCertSecretName, metav1.GetOptions{})
+	if err != nil {
+		return "", fmt.Errorf("error getting %s/%s: %w", operatorclient.TargetNamespace, EtcdSignerCertSecretName, err)
+	}
+	caPEM := secret.Data[corev1.TLSCertKey]
+	if len(caPEM) == 0 {
+		return "", fmt.Errorf("secret %s/%s is missing %s", secret.Namespace, secret.Name, corev1.TLSCertKey)
+	}
+	return SignerFingerprint(caPEM)
+}
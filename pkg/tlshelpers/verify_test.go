@@ -0,0 +1,742 @@
+package tlshelpers
+
+import (
+	"bytes"
+	"context"
+	"crypto/x509"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/openshift/api/annotations"
+	"github.com/openshift/library-go/pkg/crypto"
+	"github.com/openshift/library-go/pkg/operator/certrotation"
+	"github.com/openshift/library-go/pkg/operator/events"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/sets"
+	corev1informers "k8s.io/client-go/informers/core/v1"
+	"k8s.io/client-go/kubernetes/fake"
+	corev1client "k8s.io/client-go/kubernetes/typed/core/v1"
+	corev1listers "k8s.io/client-go/listers/core/v1"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/util/keyutil"
+
+	"github.com/openshift/cluster-etcd-operator/pkg/operator/operatorclient"
+	u "github.com/openshift/cluster-etcd-operator/pkg/testutils"
+)
+
+func TestCertsMissingSAN(t *testing.T) {
+	signer := newTestSigner(t, "etcd-signer")
+	withSAN := getServerHostNames([]string{"10.0.0.1"})
+	withoutSAN := getPeerHostNames([]string{"10.0.0.2"})
+
+	tests := map[string]struct {
+		objects     []runtime.Object
+		requiredSAN string
+		expected    []string
+	}{
+		"no secrets": {
+			requiredSAN: "etcd.openshift-etcd.svc",
+		},
+		"all certs have the SAN": {
+			objects: []runtime.Object{
+				newTestCertSecret(t, signer, GetPeerClientSecretNameForNode("master-0"), withSAN),
+				newTestCertSecret(t, signer, GetServingSecretNameForNode("master-0"), withSAN),
+				newTestCertSecret(t, signer, GetServingMetricsSecretNameForNode("master-0"), withSAN),
+			},
+			requiredSAN: "etcd.openshift-etcd.svc",
+		},
+		"some certs lack the SAN": {
+			objects: []runtime.Object{
+				newTestCertSecret(t, signer, GetPeerClientSecretNameForNode("master-0"), withoutSAN),
+				newTestCertSecret(t, signer, GetServingSecretNameForNode("master-0"), withSAN),
+				newTestCertSecret(t, signer, GetServingMetricsSecretNameForNode("master-0"), withSAN),
+				newTestCertSecret(t, signer, GetServingSecretNameForNode("master-1"), withoutSAN),
+			},
+			requiredSAN: "etcd.openshift-etcd.svc",
+			expected:    []string{"etcd-peer-master-0", "etcd-serving-master-1"},
+		},
+		"ip SAN": {
+			objects: []runtime.Object{
+				newTestCertSecret(t, signer, GetPeerClientSecretNameForNode("master-0"), withoutSAN),
+				newTestCertSecret(t, signer, GetServingSecretNameForNode("master-0"), withSAN),
+			},
+			requiredSAN: "10.0.0.1",
+			expected:    []string{"etcd-peer-master-0"},
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			fakeKubeClient := fake.NewSimpleClientset(test.objects...)
+			missing, err := CertsMissingSAN(context.TODO(), fakeKubeClient.CoreV1(), test.requiredSAN, []string{"master-0", "master-1"})
+			require.NoError(t, err)
+			require.Equal(t, test.expected, missing)
+		})
+	}
+}
+
+func newTestCertSecret(t *testing.T, signer *crypto.CA, name string, hostNames []string, fns ...crypto.CertificateExtensionFunc) *corev1.Secret {
+	certConfig, err := signer.MakeServerCertForDuration(sets.NewString(hostNames...), time.Hour, fns...)
+	require.NoError(t, err)
+	certBytes, keyBytes, err := certConfig.GetPEMBytes()
+	require.NoError(t, err)
+	secret := u.FakeSecret(operatorclient.TargetNamespace, name, map[string][]byte{
+		corev1.TLSCertKey:       certBytes,
+		corev1.TLSPrivateKeyKey: keyBytes,
+	})
+	secret.Type = corev1.SecretTypeTLS
+	return secret
+}
+
+func withUsages(usages ...x509.ExtKeyUsage) crypto.CertificateExtensionFunc {
+	return func(cert *x509.Certificate) error {
+		cert.ExtKeyUsage = usages
+		return nil
+	}
+}
+
+func TestVerifyManagedSecretOwnership(t *testing.T) {
+	managed := func(name string, certType certrotation.CertificateType) *corev1.Secret {
+		secret := u.FakeSecret(operatorclient.TargetNamespace, name, nil)
+		secret.Annotations = map[string]string{annotations.OpenShiftComponent: EtcdJiraComponentName}
+		certrotation.LabelAsManagedSecret(secret, certType)
+		return secret
+	}
+	allManaged := func() []runtime.Object {
+		return []runtime.Object{
+			managed(EtcdSignerCertSecretName, certrotation.CertificateTypeSigner),
+			managed(EtcdMetricsSignerCertSecretName, certrotation.CertificateTypeSigner),
+			managed(EtcdClientCertSecretName, certrotation.CertificateTypeTarget),
+			managed(EtcdMetricsClientCertSecretName, certrotation.CertificateTypeTarget),
+			managed(GetPeerClientSecretNameForNode("master-0"), certrotation.CertificateTypeTarget),
+			managed(GetServingSecretNameForNode("master-0"), certrotation.CertificateTypeTarget),
+			managed(GetServingMetricsSecretNameForNode("master-0"), certrotation.CertificateTypeTarget),
+		}
+	}
+
+	withComponent := func(objects []runtime.Object, component string) []runtime.Object {
+		for _, object := range objects {
+			object.(*corev1.Secret).Annotations[annotations.OpenShiftComponent] = component
+		}
+		return objects
+	}
+
+	foreignComponent := managed(GetServingSecretNameForNode("master-0"), certrotation.CertificateTypeTarget)
+	foreignComponent.Annotations[annotations.OpenShiftComponent] = "kube-apiserver"
+	unlabeled := managed(EtcdClientCertSecretName, certrotation.CertificateTypeTarget)
+	unlabeled.Labels = nil
+
+	tests := map[string]struct {
+		objects  []runtime.Object
+		opts     []CertOption
+		expected []string
+	}{
+		"all secrets correctly labeled": {
+			objects: allManaged(),
+		},
+		"all secrets labeled with the configured component": {
+			objects: withComponent(allManaged(), "acme-etcd"),
+			opts:    []CertOption{WithJiraComponent("acme-etcd")},
+		},
+		"default component with a configured component": {
+			objects: allManaged()[:2],
+			opts:    []CertOption{WithJiraComponent("acme-etcd")},
+			expected: []string{
+				EtcdSignerCertSecretName, EtcdMetricsSignerCertSecretName, EtcdClientCertSecretName, EtcdMetricsClientCertSecretName,
+				"etcd-peer-master-0", "etcd-serving-master-0", "etcd-serving-metrics-master-0",
+			},
+		},
+		"missing secret": {
+			objects:  allManaged()[1:],
+			expected: []string{EtcdSignerCertSecretName},
+		},
+		"foreign component and missing label": {
+			objects: []runtime.Object{
+				managed(EtcdSignerCertSecretName, certrotation.CertificateTypeSigner),
+				managed(EtcdMetricsSignerCertSecretName, certrotation.CertificateTypeSigner),
+				unlabeled,
+				managed(EtcdMetricsClientCertSecretName, certrotation.CertificateTypeTarget),
+				managed(GetPeerClientSecretNameForNode("master-0"), certrotation.CertificateTypeTarget),
+				foreignComponent,
+				managed(GetServingMetricsSecretNameForNode("master-0"), certrotation.CertificateTypeTarget),
+			},
+			expected: []string{EtcdClientCertSecretName, "etcd-serving-master-0"},
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			fakeKubeClient := fake.NewSimpleClientset(test.objects...)
+			unowned, err := VerifyManagedSecretOwnership(context.TODO(), fakeKubeClient.CoreV1(), []string{"master-0"}, test.opts...)
+			require.NoError(t, err)
+			require.Equal(t, test.expected, unowned)
+		})
+	}
+}
+
+func TestPeerCertHasBothAuths(t *testing.T) {
+	signer := newTestSigner(t, "etcd-signer")
+	peerName := GetPeerClientSecretNameForNode("master-0")
+
+	tests := map[string]struct {
+		secret      *corev1.Secret
+		expected    bool
+		expectedErr bool
+	}{
+		"client and server auth": {
+			secret:   newTestCertSecret(t, signer, peerName, getPeerHostNames([]string{"10.0.0.1"}), withUsages(x509.ExtKeyUsageClientAuth, x509.ExtKeyUsageServerAuth)),
+			expected: true,
+		},
+		"missing client auth": {
+			secret: newTestCertSecret(t, signer, peerName, getPeerHostNames([]string{"10.0.0.1"}), withUsages(x509.ExtKeyUsageServerAuth)),
+		},
+		"missing server auth": {
+			secret: newTestCertSecret(t, signer, peerName, getPeerHostNames([]string{"10.0.0.1"}), withUsages(x509.ExtKeyUsageClientAuth)),
+		},
+		"no cert": {
+			secret:      u.FakeSecret(operatorclient.TargetNamespace, peerName, map[string][]byte{}),
+			expectedErr: true,
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			ok, err := PeerCertHasBothAuths(test.secret)
+			if test.expectedErr {
+				require.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, test.expected, ok)
+		})
+	}
+}
+
+func TestCertNotBeforeSkew(t *testing.T) {
+	signer := newTestSigner(t, "etcd-signer")
+	servingName := GetServingSecretNameForNode("master-0")
+	now := time.Now()
+	withNotBefore := func(notBefore time.Time) crypto.CertificateExtensionFunc {
+		return func(cert *x509.Certificate) error {
+			cert.NotBefore = notBefore
+			return nil
+		}
+	}
+
+	tests := map[string]struct {
+		secret         *corev1.Secret
+		expectedSkew   time.Duration
+		expectedSkewed bool
+		expectedErr    string
+	}{
+		"issued now": {
+			secret: newTestCertSecret(t, signer, servingName, []string{"10.0.0.1"}),
+		},
+		"issued in the past": {
+			secret: newTestCertSecret(t, signer, servingName, []string{"10.0.0.1"}, withNotBefore(now.Add(-time.Hour))),
+		},
+		"future-dated within tolerance": {
+			secret:       newTestCertSecret(t, signer, servingName, []string{"10.0.0.1"}, withNotBefore(now.Add(30*time.Second))),
+			expectedSkew: 30 * time.Second,
+		},
+		"future-dated beyond tolerance": {
+			secret:         newTestCertSecret(t, signer, servingName, []string{"10.0.0.1"}, withNotBefore(now.Add(10*time.Minute))),
+			expectedSkew:   10 * time.Minute,
+			expectedSkewed: true,
+		},
+		"no cert": {
+			secret:      u.FakeSecret(operatorclient.TargetNamespace, servingName, map[string][]byte{}),
+			expectedErr: "could not parse certificate in secret openshift-etcd/etcd-serving-master-0",
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			skew, skewed, err := CertNotBeforeSkew(test.secret, now)
+			if len(test.expectedErr) > 0 {
+				require.ErrorContains(t, err, test.expectedErr)
+				return
+			}
+			require.NoError(t, err)
+			// the notBefore of the cert is truncated to the second
+			require.InDelta(t, test.expectedSkew, skew, float64(time.Second))
+			require.Equal(t, test.expectedSkewed, skewed)
+		})
+	}
+}
+
+func TestRequireClientAndServerAuth(t *testing.T) {
+	signer := newTestSigner(t, "etcd-signer")
+	peerName := GetPeerClientSecretNameForNode("master-0")
+
+	tests := map[string]struct {
+		certPEM     []byte
+		expectedErr string
+	}{
+		"client and server auth": {
+			certPEM: newTestCertSecret(t, signer, peerName, []string{"localhost"}, withUsages(x509.ExtKeyUsageClientAuth, x509.ExtKeyUsageServerAuth)).Data[corev1.TLSCertKey],
+		},
+		"missing client auth": {
+			certPEM:     newTestCertSecret(t, signer, peerName, []string{"localhost"}, withUsages(x509.ExtKeyUsageServerAuth)).Data[corev1.TLSCertKey],
+			expectedErr: `cert "localhost" lacks the extended key usages ClientAuth required by etcd`,
+		},
+		"missing both": {
+			certPEM:     newTestCertSecret(t, signer, peerName, []string{"localhost"}, withUsages(x509.ExtKeyUsageCodeSigning)).Data[corev1.TLSCertKey],
+			expectedErr: `cert "localhost" lacks the extended key usages ClientAuth,ServerAuth required by etcd`,
+		},
+		"no cert": {
+			expectedErr: "could not parse certificate: Could not read any certificates",
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			err := RequireClientAndServerAuth(test.certPEM)
+			if len(test.expectedErr) > 0 {
+				require.EqualError(t, err, test.expectedErr)
+				return
+			}
+			require.NoError(t, err)
+		})
+	}
+}
+
+func TestValidateServingMetricsSecretOrg(t *testing.T) {
+	signer := newTestSigner(t, "etcd-signer")
+	caCert, caKey, err := signer.Config.GetPEMBytes()
+	require.NoError(t, err)
+	secret := func(name string, create func(context.Context, []byte, []byte, string, []string, ...CertOption) (*bytes.Buffer, *bytes.Buffer, error)) *corev1.Secret {
+		certPEM, keyPEM, err := create(context.TODO(), caCert, caKey, "master-0", []string{"10.0.0.1"})
+		require.NoError(t, err)
+		return u.FakeSecret(operatorclient.TargetNamespace, name, map[string][]byte{
+			corev1.TLSCertKey:       certPEM.Bytes(),
+			corev1.TLSPrivateKeyKey: keyPEM.Bytes(),
+		})
+	}
+	metricsName := GetServingMetricsSecretNameForNode("master-0")
+
+	tests := map[string]struct {
+		secret      *corev1.Secret
+		expectedErr string
+	}{
+		"metrics cert": {
+			secret: secret(metricsName, CreateMetricCertKeyWithContext),
+		},
+		"serving cert in metrics secret": {
+			secret: secret(metricsName, CreateServerCertKeyWithContext),
+			expectedErr: `serving metrics secret openshift-etcd/etcd-serving-metrics-master-0 of node master-0: ` +
+				`cert "system:etcd-server:master-0" is not issued for the organization system:etcd-metrics, got [system:etcd-servers]`,
+		},
+		"peer cert in metrics secret": {
+			secret: secret(metricsName, CreatePeerCertKeyWithContext),
+			expectedErr: `serving metrics secret openshift-etcd/etcd-serving-metrics-master-0 of node master-0: ` +
+				`cert "system:etcd-peer:master-0" is not issued for the organization system:etcd-metrics, got [system:etcd-peers]`,
+		},
+		"metrics cert in serving secret": {
+			secret:      secret(GetServingSecretNameForNode("master-0"), CreateMetricCertKeyWithContext),
+			expectedErr: "secret openshift-etcd/etcd-serving-master-0 is not a serving metrics secret, expected a name like etcd-serving-metrics-<node>",
+		},
+		"no cert": {
+			secret:      u.FakeSecret(operatorclient.TargetNamespace, metricsName, map[string][]byte{}),
+			expectedErr: "serving metrics secret openshift-etcd/etcd-serving-metrics-master-0 of node master-0: could not parse certificate: Could not read any certificates",
+		},
+		"no secret": {
+			expectedErr: "serving metrics secret must not be nil",
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			err := ValidateServingMetricsSecretOrg(test.secret)
+			if len(test.expectedErr) > 0 {
+				require.EqualError(t, err, test.expectedErr)
+				return
+			}
+			require.NoError(t, err)
+		})
+	}
+}
+
+// TestNodeCertConstructorsIssueClientAndServerAuth runs RequireClientAndServerAuth against every constructor of peer,
+// serving and metrics certs, so that a refactoring dropping one of the usages is caught.
+func TestValidateCertOrg(t *testing.T) {
+	signer := newTestSigner(t, "etcd-signer")
+	caCert, caKey, err := signer.Config.GetPEMBytes()
+	require.NoError(t, err)
+	issue := func(create func(context.Context, []byte, []byte, string, []string, ...CertOption) (*bytes.Buffer, *bytes.Buffer, error), opts ...CertOption) []byte {
+		certPEM, _, err := create(context.TODO(), caCert, caKey, "master-0", []string{"10.0.0.1"}, opts...)
+		require.NoError(t, err)
+		return certPEM.Bytes()
+	}
+	peerCert := issue(CreatePeerCertKeyWithContext)
+	servingCert := issue(CreateServerCertKeyWithContext)
+	metricCert := issue(CreateMetricCertKeyWithContext)
+	withoutPrefix := newTestCertSecret(t, signer, "etcd-peer-master-0", []string{"10.0.0.1"}, func(cert *x509.Certificate) error {
+		cert.Subject.Organization = []string{peerOrg}
+		cert.Subject.CommonName = "master-0"
+		return nil
+	})
+	rotated := newTestCertSecret(t, signer, "etcd-peer-master-0", []string{"10.0.0.1"})
+
+	tests := map[string]struct {
+		certPEM     []byte
+		validate    func([]byte) error
+		expectedErr string
+	}{
+		"peer cert": {
+			certPEM:  peerCert,
+			validate: ValidatePeerCertOrg,
+		},
+		"peer cert with extra organizations": {
+			certPEM:  issue(CreatePeerCertKeyWithContext, WithExtraOrganizations([]string{"example:etcd-readers"})),
+			validate: ValidatePeerCertOrg,
+		},
+		"serving cert": {
+			certPEM:  servingCert,
+			validate: ValidateServerCertOrg,
+		},
+		"metric cert": {
+			certPEM:  metricCert,
+			validate: ValidateMetricCertOrg,
+		},
+		"serving cert in place of a peer cert": {
+			certPEM:     servingCert,
+			validate:    ValidatePeerCertOrg,
+			expectedErr: `cert "system:etcd-server:master-0" is not issued for the organization system:etcd-peers, got [system:etcd-servers]`,
+		},
+		"peer cert in place of a serving cert": {
+			certPEM:     peerCert,
+			validate:    ValidateServerCertOrg,
+			expectedErr: `cert "system:etcd-peer:master-0" is not issued for the organization system:etcd-servers, got [system:etcd-peers]`,
+		},
+		"serving cert in place of a metric cert": {
+			certPEM:     servingCert,
+			validate:    ValidateMetricCertOrg,
+			expectedErr: `cert "system:etcd-server:master-0" is not issued for the organization system:etcd-metrics, got [system:etcd-servers]`,
+		},
+		"peer org without common name prefix": {
+			certPEM:     withoutPrefix.Data[corev1.TLSCertKey],
+			validate:    ValidatePeerCertOrg,
+			expectedErr: `cert "master-0" of the organization system:etcd-peers lacks the common name prefix system:etcd-peer:`,
+		},
+		"cert without organization": {
+			certPEM:     rotated.Data[corev1.TLSCertKey],
+			validate:    ValidatePeerCertOrg,
+			expectedErr: `cert "10.0.0.1" is not issued for the organization system:etcd-peers, got []`,
+		},
+		"no cert": {
+			validate:    ValidatePeerCertOrg,
+			expectedErr: "could not parse certificate: Could not read any certificates",
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			err := test.validate(test.certPEM)
+			if test.expectedErr != "" {
+				require.EqualError(t, err, test.expectedErr)
+				return
+			}
+			require.NoError(t, err)
+		})
+	}
+}
+
+func TestNodeCertConstructorsIssueClientAndServerAuth(t *testing.T) {
+	node := u.FakeNode("master-0", u.WithMasterLabel(), u.WithNodeInternalIP("10.0.0.1"))
+	signer := newTestSigner(t, "etcd-signer")
+	caCert, caKey, err := signer.Config.GetPEMBytes()
+	require.NoError(t, err)
+
+	for name, opts := range map[string][]CertOption{
+		"default":              nil,
+		"code signing usage":   {WithCodeSigningUsage()},
+		"ECDSA and cluster ID": {WithKeyAlgorithm(ECDSAP256KeyAlgorithm), WithClusterID("cluster-a")},
+	} {
+		t.Run(name, func(t *testing.T) {
+			for _, create := range []func(context.Context, []byte, []byte, string, []string, ...CertOption) (*bytes.Buffer, *bytes.Buffer, error){
+				CreatePeerCertKeyWithContext, CreateServerCertKeyWithContext, CreateMetricCertKeyWithContext,
+			} {
+				certPEM, _, err := create(context.TODO(), caCert, caKey, node.Name, []string{"10.0.0.1"}, opts...)
+				require.NoError(t, err)
+				require.NoError(t, RequireClientAndServerAuth(certPEM.Bytes()))
+			}
+
+			fakeKubeClient := fake.NewSimpleClientset()
+			secretLister := corev1listers.NewSecretLister(cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{}))
+			for _, create := range []func(*corev1.Node, corev1informers.SecretInformer, corev1listers.SecretLister, corev1client.SecretsGetter, events.Recorder, ...CertOption) (*certrotation.RotatedSelfSignedCertKeySecret, error){
+				CreatePeerCertificate, CreateServingCertificate, CreateMetricsServingCertificate,
+			} {
+				rotated, err := create(node, nil, secretLister, fakeKubeClient.CoreV1(), events.NewInMemoryRecorder(t.Name()), opts...)
+				require.NoError(t, err)
+				secret, err := rotated.EnsureTargetCertKeyPair(context.TODO(), signer, signer.Config.Certs)
+				require.NoError(t, err)
+				require.NoError(t, RequireClientAndServerAuth(secret.Data[corev1.TLSCertKey]))
+			}
+
+			bundle, err := CreateAllNodeCerts(node, signer, opts...)
+			require.NoError(t, err)
+			for _, secret := range []*corev1.Secret{bundle.Peer, bundle.Serving, bundle.ServingMetrics} {
+				require.NoError(t, RequireClientAndServerAuth(secret.Data[corev1.TLSCertKey]))
+			}
+		})
+	}
+}
+
+func TestVerifyCertAgainstBundle(t *testing.T) {
+	signer := newTestSigner(t, "etcd-signer")
+	caCert, caKey, err := signer.Config.GetPEMBytes()
+	require.NoError(t, err)
+	otherSigner := newTestSigner(t, "etcd-signer-rotated-out")
+	otherCACert, _, err := otherSigner.Config.GetPEMBytes()
+	require.NoError(t, err)
+
+	certPEM, _, err := CreateServerCertKeyWithContext(context.TODO(), caCert, caKey, "master-0", []string{"10.0.0.1"})
+	require.NoError(t, err)
+	expired, err := signer.MakeServerCertForDuration(sets.NewString("10.0.0.1"), -time.Hour, withUsages(x509.ExtKeyUsageClientAuth, x509.ExtKeyUsageServerAuth))
+	require.NoError(t, err)
+	expiredPEM, _, err := expired.GetPEMBytes()
+	require.NoError(t, err)
+	serverOnly, err := signer.MakeServerCertForDuration(sets.NewString("10.0.0.1"), time.Hour, withUsages(x509.ExtKeyUsageServerAuth))
+	require.NoError(t, err)
+	serverOnlyPEM, _, err := serverOnly.GetPEMBytes()
+	require.NoError(t, err)
+
+	tests := map[string]struct {
+		certPEM        []byte
+		caBundlePEM    []byte
+		hostname       string
+		expectedReason CertVerificationReason
+	}{
+		"valid": {
+			certPEM:     certPEM.Bytes(),
+			caBundlePEM: caCert,
+		},
+		"valid with the signer among others in the bundle": {
+			certPEM:     certPEM.Bytes(),
+			caBundlePEM: append(append([]byte{}, otherCACert...), caCert...),
+		},
+		"valid for a SAN": {
+			certPEM:     certPEM.Bytes(),
+			caBundlePEM: caCert,
+			hostname:    "etcd.openshift-etcd.svc",
+		},
+		"signer rotated out of the bundle": {
+			certPEM:        certPEM.Bytes(),
+			caBundlePEM:    otherCACert,
+			expectedReason: CertVerificationUnknownAuthority,
+		},
+		"expired": {
+			certPEM:        expiredPEM,
+			caBundlePEM:    caCert,
+			expectedReason: CertVerificationExpired,
+		},
+		"hostname mismatch": {
+			certPEM:        certPEM.Bytes(),
+			caBundlePEM:    caCert,
+			hostname:       "10.0.0.2",
+			expectedReason: CertVerificationHostnameMismatch,
+		},
+		"missing client auth": {
+			certPEM:        serverOnlyPEM,
+			caBundlePEM:    caCert,
+			expectedReason: CertVerificationInvalid,
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			err := VerifyCertAgainstBundleForHost(test.certPEM, test.caBundlePEM, test.hostname)
+			if len(test.expectedReason) == 0 {
+				require.NoError(t, err)
+				return
+			}
+			var verificationErr *CertVerificationError
+			require.ErrorAs(t, err, &verificationErr)
+			require.Equal(t, test.expectedReason, verificationErr.Reason)
+		})
+	}
+
+	require.NoError(t, VerifyCertAgainstBundle(certPEM.Bytes(), caCert))
+}
+
+func TestDetectWeakSignatureCerts(t *testing.T) {
+	signer := newTestSigner(t, "etcd-signer")
+	withSignatureAlgorithm := func(algorithm x509.SignatureAlgorithm) crypto.CertificateExtensionFunc {
+		return func(cert *x509.Certificate) error {
+			cert.SignatureAlgorithm = algorithm
+			return nil
+		}
+	}
+	hostNames := getServerHostNames([]string{"10.0.0.1"})
+
+	tests := map[string]struct {
+		objects  []runtime.Object
+		expected []string
+	}{
+		"no secrets": {},
+		"SHA-256 signed": {
+			objects: []runtime.Object{
+				newTestCertSecret(t, signer, GetServingSecretNameForNode("master-0"), hostNames, withSignatureAlgorithm(x509.SHA256WithRSA)),
+			},
+		},
+		"SHA-1 signed": {
+			objects: []runtime.Object{
+				newTestCertSecret(t, signer, GetPeerClientSecretNameForNode("master-0"), hostNames, withSignatureAlgorithm(x509.SHA256WithRSA)),
+				newTestCertSecret(t, signer, GetServingSecretNameForNode("master-0"), hostNames, withSignatureAlgorithm(x509.SHA1WithRSA)),
+				newTestCertSecret(t, signer, EtcdClientCertSecretName, hostNames, withSignatureAlgorithm(x509.SHA1WithRSA)),
+			},
+			expected: []string{EtcdClientCertSecretName, "etcd-serving-master-0"},
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			fakeKubeClient := fake.NewSimpleClientset(test.objects...)
+			weak, err := DetectWeakSignatureCerts(context.TODO(), fakeKubeClient.CoreV1(), []string{"master-0"})
+			require.NoError(t, err)
+			require.Equal(t, test.expected, weak)
+		})
+	}
+}
+
+func TestValidateCertKeyPair(t *testing.T) {
+	signer := newTestSigner(t, "etcd-signer")
+	hostNames := getServerHostNames([]string{"10.0.0.1"})
+	peer := newTestCertSecret(t, signer, GetPeerClientSecretNameForNode("master-0"), hostNames)
+	serving := newTestCertSecret(t, signer, GetServingSecretNameForNode("master-0"), hostNames)
+
+	swapped := peer.DeepCopy()
+	swapped.Data[corev1.TLSPrivateKeyKey] = serving.Data[corev1.TLSPrivateKeyKey]
+
+	ecdsaKey, err := keyutil.MakeEllipticPrivateKeyPEM()
+	require.NoError(t, err)
+	otherKeyType := peer.DeepCopy()
+	otherKeyType.Data[corev1.TLSPrivateKeyKey] = ecdsaKey
+
+	brokenKey := peer.DeepCopy()
+	brokenKey.Data[corev1.TLSPrivateKeyKey] = []byte("not a key")
+
+	tests := map[string]struct {
+		secret      *corev1.Secret
+		expectedErr string
+	}{
+		"matching pair": {
+			secret: peer,
+		},
+		"swapped key": {
+			secret:      swapped,
+			expectedErr: `private key in tls.key of secret openshift-etcd/etcd-peer-master-0 does not match the public key of the cert "10.0.0.1" in tls.crt`,
+		},
+		"key of another type": {
+			secret:      otherKeyType,
+			expectedErr: `private key in tls.key of secret openshift-etcd/etcd-peer-master-0 does not match the public key of the cert "10.0.0.1" in tls.crt`,
+		},
+		"unparsable key": {
+			secret:      brokenKey,
+			expectedErr: "could not parse private key in secret openshift-etcd/etcd-peer-master-0: data does not contain a valid RSA or ECDSA private key",
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			err := ValidateCertKeyPair(test.secret)
+			if len(test.expectedErr) > 0 {
+				require.EqualError(t, err, test.expectedErr)
+				return
+			}
+			require.NoError(t, err)
+		})
+	}
+
+	fakeKubeClient := fake.NewSimpleClientset(serving, swapped)
+	mismatched, err := DetectMismatchedKeyPairs(context.TODO(), fakeKubeClient.CoreV1(), []string{"master-0"})
+	require.NoError(t, err)
+	require.Equal(t, []string{"etcd-peer-master-0"}, mismatched)
+
+	report, err := AuditPKIHealth(context.TODO(), fakeKubeClient.CoreV1(), []string{"master-0"})
+	require.NoError(t, err)
+	require.Equal(t, []string{"etcd-peer-master-0"}, report.MismatchedKeyPairSecrets)
+	require.Contains(t, report.Issues(), "secret etcd-peer-master-0 has a private key not matching its cert")
+}
+
+func TestSignerFingerprint(t *testing.T) {
+	caPEM, err := os.ReadFile(u.MustAbsPath("../testutils/testdata/ca.crt"))
+	require.NoError(t, err)
+	const expected = "6d30fc889b6b9dce082709bd0ba9a6b5b2f686cf9c360150c5b00100dc49dd9d"
+
+	tests := map[string]struct {
+		caPEM         []byte
+		expected      string
+		expectedError string
+	}{
+		"signer": {
+			caPEM:    caPEM,
+			expected: expected,
+		},
+		"only the first cert counts": {
+			caPEM:    append(append(append([]byte{}, caPEM...), '\n'), newTestSignerPEM(t)...),
+			expected: expected,
+		},
+		"empty": {
+			expectedError: "could not parse the signer cert: Could not read any certificates",
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			fingerprint, err := SignerFingerprint(test.caPEM)
+			if test.expectedError != "" {
+				require.EqualError(t, err, test.expectedError)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, test.expected, fingerprint)
+		})
+	}
+}
+
+func TestReadSignerFingerprint(t *testing.T) {
+	caPEM, err := os.ReadFile(u.MustAbsPath("../testutils/testdata/ca.crt"))
+	require.NoError(t, err)
+
+	tests := map[string]struct {
+		objects       []runtime.Object
+		expected      string
+		expectedError string
+	}{
+		"signer": {
+			objects:  []runtime.Object{u.FakeSecret(operatorclient.TargetNamespace, EtcdSignerCertSecretName, map[string][]byte{corev1.TLSCertKey: caPEM})},
+			expected: "6d30fc889b6b9dce082709bd0ba9a6b5b2f686cf9c360150c5b00100dc49dd9d",
+		},
+		"signer in another namespace": {
+			objects:       []runtime.Object{u.FakeSecret(operatorclient.GlobalUserSpecifiedConfigNamespace, EtcdSignerCertSecretName, map[string][]byte{corev1.TLSCertKey: caPEM})},
+			expectedError: `error getting openshift-etcd/etcd-signer: secrets "etcd-signer" not found`,
+		},
+		"missing cert": {
+			objects:       []runtime.Object{u.FakeSecret(operatorclient.TargetNamespace, EtcdSignerCertSecretName, map[string][]byte{})},
+			expectedError: "secret openshift-etcd/etcd-signer is missing tls.crt",
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			fingerprint, err := ReadSignerFingerprint(context.TODO(), fake.NewSimpleClientset(test.objects...).CoreV1())
+			if test.expectedError != "" {
+				require.EqualError(t, err, test.expectedError)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, test.expected, fingerprint)
+		})
+	}
+}
+
+func newTestSignerPEM(t *testing.T) []byte {
+	caPEM, _, err := newTestSigner(t, "etcd-signer").Config.GetPEMBytes()
+	require.NoError(t, err)
+	return caPEM
+}